@@ -0,0 +1,153 @@
+// main.go
+
+// index_check đối chiếu các index với dữ liệu trong Badger khi server đã dừng (Badger chỉ cho một process mở).
+// Cách dùng, chạy trong thư mục chứa config/config_local.yaml:
+//
+//	index_check [-workspace <name|id>] [-collection <name|id>] [-index <name|id>] [-repair]
+//
+// Không có -workspace thì kiểm tra tất cả workspace. Exit code là 1 nếu có index không nhất quán
+// (khi -repair, các lỗi đã sửa được vẫn được tính) hoặc có lỗi khi kiểm tra.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run kiểm tra các index và trả về exit code, các kết nối được đóng trước khi thoát
+func run() int {
+	workspaceFlag := flag.String("workspace", "", "workspace name or ID (default: all workspaces)")
+	collectionFlag := flag.String("collection", "", "collection name or ID (default: all collections)")
+	indexFlag := flag.String("index", "", "index name or ID (default: all indexes)")
+	repair := flag.Bool("repair", false, "add missing entries, remove orphans and recompute counts")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	if cfg == nil {
+		log.Println("Failed to load configuration.")
+		return 1
+	}
+
+	catalog, err := service.NewSQLiteCatalogService(cfg)
+	if err != nil {
+		log.Printf("Failed to open catalog: %v", err)
+		return 1
+	}
+	defer catalog.Close()
+
+	badgerService, err := service.NewBadgerService(cfg)
+	if err != nil {
+		log.Printf("Failed to open Badger (is the server still running?): %v", err)
+		return 1
+	}
+	defer badgerService.Close()
+
+	bboltService, err := service.NewBboltService(cfg)
+	if err != nil {
+		log.Printf("Failed to open index files: %v", err)
+		return 1
+	}
+	defer bboltService.Close()
+
+	// Collection dùng backend memory không có dữ liệu ngoài process server, nên luôn nhất quán khi kiểm tra ở đây
+	// Table OLAP không có index nên không cần ParquetService
+	storage := service.NewStorage(badgerService, bboltService, nil)
+
+	workspaces, err := selectWorkspaces(catalog, *workspaceFlag)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	ok := true
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, workspace := range workspaces {
+		collections, err := catalog.ListCollectionsByWorkspace(workspace.ID)
+		if err != nil {
+			log.Printf("Failed to list collections of workspace %s: %v", workspace.Name, err)
+			return 1
+		}
+
+		for i := range collections {
+			collection := &collections[i]
+			if !matches(*collectionFlag, collection.ID, collection.Name) {
+				continue
+			}
+
+			for j := range collection.Indexes {
+				index := &collection.Indexes[j]
+				if !matches(*indexFlag, index.ID, index.Name) {
+					continue
+				}
+
+				indexWrapper, err := domain.NewIndexWrapper(index, catalog, storage)
+				var report *domain.IndexVerifyReport
+				if err == nil {
+					report, err = indexWrapper.Verify(*repair)
+				}
+				if err != nil {
+					log.Printf("%s/%s/%s: %v", workspace.Name, collection.Name, index.Name, err)
+					ok = false
+					continue
+				}
+				if !report.Consistent {
+					ok = false
+				}
+				log.Printf("%s/%s/%s: consistent=%t missing=%d orphans=%d unique_violations=%d invalid_documents=%d count_mismatches=%d repaired=%t",
+					workspace.Name, collection.Name, index.Name, report.Consistent, report.MissingCount, report.OrphanCount,
+					report.UniqueViolationCount, report.InvalidDocumentCount, report.CountMismatches, report.Repaired)
+				if err := encoder.Encode(report); err != nil {
+					log.Printf("Failed to write report: %v", err)
+					return 1
+				}
+			}
+		}
+	}
+
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// selectWorkspaces trả về workspace theo tên hoặc ID, hoặc tất cả workspace nếu không chỉ định
+func selectWorkspaces(catalog *service.SQLiteCatalogService, workspaceFlag string) ([]models.Workspace, error) {
+	if workspaceFlag == "" {
+		workspaces, err := catalog.ListWorkspaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspaces: %v", err)
+		}
+		return workspaces, nil
+	}
+
+	var workspace *models.Workspace
+	var err error
+	if id, convErr := strconv.Atoi(workspaceFlag); convErr == nil {
+		workspace, err = catalog.GetWorkspaceByID(id)
+	} else {
+		workspace, err = catalog.GetWorkspaceByName(workspaceFlag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s not found: %v", workspaceFlag, err)
+	}
+	return []models.Workspace{*workspace}, nil
+}
+
+// matches kiểm tra filter (tên hoặc ID) khớp với đối tượng, filter rỗng khớp với mọi đối tượng
+func matches(filter string, id int, name string) bool {
+	return filter == "" || filter == name || filter == strconv.Itoa(id)
+}
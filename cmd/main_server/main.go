@@ -13,7 +13,9 @@ import (
 
 	"github.com/dehuy69/mydp/config"
 	consumer "github.com/dehuy69/mydp/main_server/consumer/write-collection"
+	"github.com/dehuy69/mydp/main_server/domain"
 	"github.com/dehuy69/mydp/main_server/router" // Import the new router package
+	"github.com/dehuy69/mydp/main_server/scheduler"
 )
 
 func main() {
@@ -43,7 +45,7 @@ func main() {
 	}()
 
 	// Initialize and run write-collection consumer in a goroutine
-	consumerService, err := consumer.NewWriteCollectionConsumer(ctrl.SQLiteCatalogService, ctrl.BadgerService, ctrl.QueueManager, ctrl.BboltService)
+	consumerService, err := consumer.NewWriteCollectionConsumer(ctrl.SQLiteCatalogService, ctrl.QueueManager, ctrl.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initialize consumer service: %v", err)
 	}
@@ -54,6 +56,24 @@ func main() {
 		}
 	}()
 
+	// Initialize and run background jobs
+	jobScheduler := scheduler.NewScheduler()
+	jobScheduler.Register(scheduler.NewRateLimiterCleanupJob(ctrl.RateLimiter))
+	jobScheduler.Register(scheduler.NewIndexUsageFlushJob(ctrl.BboltService))
+	jobScheduler.Register(scheduler.NewWorkspacePurgeJob(ctrl.SQLiteCatalogService, ctrl.Storage, cfg.WorkspaceDeleteGraceHours))
+	jobScheduler.Register(scheduler.NewTableFlushJob(ctrl.SQLiteCatalogService, ctrl.Storage, cfg.TableFlushIntervalSeconds))
+	jobScheduler.Register(scheduler.NewCollectionSyncJob(ctrl.SQLiteCatalogService, ctrl.Storage, cfg.TableSyncIntervalSeconds, cfg.TableSyncBatchSize))
+	if cfg.TableCompactionIntervalSeconds > 0 {
+		jobScheduler.Register(scheduler.NewTableCompactionJob(ctrl.SQLiteCatalogService, ctrl.Storage, cfg.TableCompactionIntervalSeconds))
+	}
+	if cfg.TableSnapshotRetentionHours > 0 {
+		jobScheduler.Register(scheduler.NewTableSnapshotExpireJob(ctrl.SQLiteCatalogService, ctrl.Storage, cfg.TableSnapshotRetentionHours))
+	}
+	if cfg.AuditRetentionDays > 0 {
+		jobScheduler.Register(scheduler.NewAuditRetentionJob(ctrl.SQLiteCatalogService, cfg.AuditRetentionDays))
+	}
+	jobScheduler.Start()
+
 	// Listen for system signals to perform graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -67,5 +87,18 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Stop background jobs
+	jobScheduler.Shutdown()
+
+	// Write rows still buffered in memory to Parquet files so they are not lost
+	if err := domain.FlushTables(ctrl.SQLiteCatalogService, ctrl.Storage); err != nil {
+		log.Printf("Failed to flush tables: %v", err)
+	}
+
+	// Close index files after in-flight operations finish
+	if err := ctrl.BboltService.Close(); err != nil {
+		log.Printf("Failed to close index files: %v", err)
+	}
+
 	log.Println("Server exiting")
 }
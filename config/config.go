@@ -9,9 +9,24 @@ import (
 
 // Config struct chứa cấu hình đường dẫn cho SQLite, Badger, và Parquet
 type Config struct {
-	DataFolderDefault string `mapstructure:"data_folder_default" envconfig:"DATA_FOLDER_DEFAULT"`
-	JWTSecret         string `mapstructure:"jwt_secret" envconfig:"JWT_SECRET"`
-	JWTDuration       int    `mapstructure:"jwt_duration" envconfig:"JWT_DURATION"`
+	DataFolderDefault              string  `mapstructure:"data_folder_default" envconfig:"DATA_FOLDER_DEFAULT"`
+	JWTSecret                      string  `mapstructure:"jwt_secret" envconfig:"JWT_SECRET"`
+	JWTDuration                    int     `mapstructure:"jwt_duration" envconfig:"JWT_DURATION"`
+	AuditRetentionDays             int     `mapstructure:"audit_retention_days" envconfig:"AUDIT_RETENTION_DAYS"`                           // Số ngày giữ lại audit log, 0 nghĩa là giữ vĩnh viễn
+	RateLimitPerSecond             float64 `mapstructure:"rate_limit_per_second" envconfig:"RATE_LIMIT_PER_SECOND"`                         // Giới hạn request mặc định cho mỗi user/API key, 0 nghĩa là không giới hạn
+	RateLimitBurst                 int     `mapstructure:"rate_limit_burst" envconfig:"RATE_LIMIT_BURST"`                                   // Số request tối đa trong một đợt
+	WorkspaceDeleteGraceHours      int     `mapstructure:"workspace_delete_grace_hours" envconfig:"WORKSPACE_DELETE_GRACE_HOURS"`           // Số giờ chờ trước khi xóa hẳn workspace đã bị xóa mềm
+	BboltMaxOpenFiles              int     `mapstructure:"bbolt_max_open_files" envconfig:"BBOLT_MAX_OPEN_FILES"`                           // Số file index mở cùng lúc tối đa, 0 nghĩa là dùng mặc định 256
+	TableCompression               string  `mapstructure:"table_compression" envconfig:"TABLE_COMPRESSION"`                                 // Codec nén mặc định của tệp Parquet (snappy, zstd, none)
+	TableRowGroupSize              int     `mapstructure:"table_row_group_size" envconfig:"TABLE_ROW_GROUP_SIZE"`                           // Số dòng tối đa mặc định của một row group
+	TableFlushRows                 int     `mapstructure:"table_flush_rows" envconfig:"TABLE_FLUSH_ROWS"`                                   // Số dòng trong buffer của table để ghi ra tệp ngay khi append
+	TableFlushIntervalSeconds      int     `mapstructure:"table_flush_interval_seconds" envconfig:"TABLE_FLUSH_INTERVAL_SECONDS"`           // Chu kỳ ghi các buffer còn lại ra tệp, 0 nghĩa là 60 giây
+	TableSnapshotRetentionHours    int     `mapstructure:"table_snapshot_retention_hours" envconfig:"TABLE_SNAPSHOT_RETENTION_HOURS"`       // Số giờ giữ lại snapshot cũ của table để truy vấn AS OF, 0 nghĩa là giữ vĩnh viễn
+	TableCompactionIntervalSeconds int     `mapstructure:"table_compaction_interval_seconds" envconfig:"TABLE_COMPACTION_INTERVAL_SECONDS"` // Chu kỳ compaction định kỳ các table, 0 nghĩa là tắt
+	TableCompactionTargetBytes     int64   `mapstructure:"table_compaction_target_bytes" envconfig:"TABLE_COMPACTION_TARGET_BYTES"`         // Kích thước mong muốn của tệp sau compaction, 0 nghĩa là 128 MiB
+	TableCompactionMinFiles        int     `mapstructure:"table_compaction_min_files" envconfig:"TABLE_COMPACTION_MIN_FILES"`               // Số tệp nhỏ tối thiểu trong một phân vùng để compaction định kỳ gộp, 0 nghĩa là 5
+	TableSyncIntervalSeconds       int     `mapstructure:"table_sync_interval_seconds" envconfig:"TABLE_SYNC_INTERVAL_SECONDS"`             // Chu kỳ áp dụng thay đổi của collection vào các table được đồng bộ, 0 nghĩa là 10 giây
+	TableSyncBatchSize             int     `mapstructure:"table_sync_batch_size" envconfig:"TABLE_SYNC_BATCH_SIZE"`                         // Số thay đổi tối đa của collection trong một lô ghi vào table, 0 nghĩa là 10000
 }
 
 // LoadConfig tải cấu hình từ file YAML và biến môi trường
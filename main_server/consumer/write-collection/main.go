@@ -1,32 +1,30 @@
 package consumer
 
 import (
-	"fmt"
 	"log"
 	"time"
 
 	"github.com/dehuy69/mydp/main_server/domain"
 	"github.com/dehuy69/mydp/main_server/service"
+	"gorm.io/gorm"
 )
 
 type WriteCollectionConsumer struct {
 	SQLiteCatalogService *service.SQLiteCatalogService
-	BadgerService        *service.BadgerService
 	QueueManager         *service.QueueManager
-	BboltService         *service.BboltService
+	Storage              *service.Storage
 	queueName            string
 	stopChan             chan struct{}
 }
 
-func NewWriteCollectionConsumer(SQLiteCatalogService *service.SQLiteCatalogService, BadgerService *service.BadgerService, QueueManager *service.QueueManager, BboltService *service.BboltService) (*WriteCollectionConsumer, error) {
+func NewWriteCollectionConsumer(SQLiteCatalogService *service.SQLiteCatalogService, QueueManager *service.QueueManager, Storage *service.Storage) (*WriteCollectionConsumer, error) {
 
 	return &WriteCollectionConsumer{
 		queueName:            "write-collection",
 		stopChan:             make(chan struct{}),
 		SQLiteCatalogService: SQLiteCatalogService,
-		BadgerService:        BadgerService,
 		QueueManager:         QueueManager,
-		BboltService:         BboltService,
+		Storage:              Storage,
 	}, nil
 }
 
@@ -45,8 +43,14 @@ func (cs *WriteCollectionConsumer) Start() error {
 				// Xử lý message write data vào collection ở đây
 				// Retrieve collection
 				collection, err := cs.SQLiteCatalogService.GetCollectionByID(collectionID)
+				if err == gorm.ErrRecordNotFound {
+					// Collection đã bị xóa sau khi message được đưa vào queue
+					log.Printf("Collection %d no longer exists, message dropped", collectionID)
+					continue
+				}
 				if err != nil {
-					return fmt.Errorf("failed to get collection: %v", err)
+					log.Printf("Failed to get collection %d, message dropped: %v", collectionID, err)
+					continue
 				}
 
 				// Remove _connection_id from itemMap
@@ -54,9 +58,14 @@ func (cs *WriteCollectionConsumer) Start() error {
 
 				// Create collection wrapper
 				// Write data to collection
-				wrapper := domain.NewCollectionWrapper(collection, cs.SQLiteCatalogService, cs.BadgerService, cs.BboltService)
-				if err := wrapper.Write(item); err != nil {
-					return fmt.Errorf("failed to write collection: %v", err)
+				// Schema hoặc index của collection có thể đã đổi sau khi message được đưa vào queue, document không còn hợp lệ
+				// chỉ bị bỏ để không làm dừng consumer
+				wrapper, err := domain.NewCollectionWrapper(collection, cs.SQLiteCatalogService, cs.Storage)
+				if err == nil {
+					err = wrapper.Write(item)
+				}
+				if err != nil {
+					log.Printf("Failed to write to collection %d, message dropped: %v", collectionID, err)
 				}
 
 			} else {
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/utils"
+)
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Permission string     `json:"permission" binding:"required"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse chứa key gốc, key này chỉ được trả về một lần
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+// /api/workspace/<workspace-id>/api-key/create
+func (ctrl *Controller) CreateAPIKeyHandler(c *gin.Context) {
+	// API key không được dùng để tạo API key khác
+	principal := getPrincipal(c)
+	if principal.APIKey != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage API keys"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := permissionRank[req.Permission]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission must be one of READ, WRITE, ADMIN"})
+		return
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	rawKey, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		Name:        req.Name,
+		Prefix:      rawKey[:utils.APIKeyPrefixLength],
+		KeyHash:     utils.HashAPIKey(rawKey),
+		WorkspaceID: getWorkspace(c).ID,
+		Permission:  req.Permission,
+		CreatedByID: principal.User.ID,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if err := ctrl.SQLiteCatalogService.CreateAPIKey(&apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditTarget(c, "api-key:%d", apiKey.ID)
+
+	c.JSON(http.StatusOK, CreateAPIKeyResponse{Key: rawKey, APIKey: &apiKey})
+}
+
+// /api/workspace/<workspace-id>/api-key/list
+func (ctrl *Controller) ListAPIKeysHandler(c *gin.Context) {
+	if getPrincipal(c).APIKey != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage API keys"})
+		return
+	}
+
+	apiKeys, err := ctrl.SQLiteCatalogService.ListAPIKeysByWorkspace(getWorkspace(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+// /api/workspace/<workspace-id>/api-key/<key-id>/revoke
+func (ctrl *Controller) RevokeAPIKeyHandler(c *gin.Context) {
+	if getPrincipal(c).APIKey != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage API keys"})
+		return
+	}
+
+	keyID, err := strconv.Atoi(c.Param("key-id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	apiKey, err := ctrl.SQLiteCatalogService.GetAPIKeyByID(keyID)
+	if err != nil || apiKey.WorkspaceID != getWorkspace(c).ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		if err := ctrl.SQLiteCatalogService.RevokeAPIKey(apiKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// Key lưu target của audit log trong gin.Context, handler có thể ghi đè target mặc định
+const auditTargetContextKey = "auditTarget"
+
+// Audit ghi audit log cho route sau khi handler xử lý xong, kể cả khi request bị từ chối
+func (ctrl *Controller) Audit(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := models.AuditLog{
+			Action:     action,
+			Target:     auditTarget(c),
+			StatusCode: c.Writer.Status(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			ClientIP:   c.ClientIP(),
+		}
+
+		if entry.StatusCode < http.StatusBadRequest {
+			entry.Outcome = models.AuditOutcomeSuccess
+		} else {
+			entry.Outcome = models.AuditOutcomeFailure
+		}
+
+		if principal := getPrincipal(c); principal != nil {
+			entry.UserID = principal.User.ID
+			entry.Username = principal.User.Username
+			if principal.APIKey != nil {
+				entry.APIKeyID = principal.APIKey.ID
+			}
+		}
+
+		if workspace := getWorkspace(c); workspace != nil {
+			entry.WorkspaceID = workspace.ID
+		} else if workspaceID, err := strconv.Atoi(c.Param("workspace-id")); err == nil {
+			entry.WorkspaceID = workspaceID
+		}
+
+		// Lỗi ghi audit log không làm thay đổi response đã trả về
+		if err := ctrl.SQLiteCatalogService.CreateAuditLog(&entry); err != nil {
+			log.Printf("Failed to write audit log for %s: %v", action, err)
+		}
+	}
+}
+
+// setAuditTarget ghi đè target của audit log cho request hiện tại
+func setAuditTarget(c *gin.Context, format string, args ...interface{}) {
+	c.Set(auditTargetContextKey, fmt.Sprintf(format, args...))
+}
+
+// auditTarget lấy target do handler gán, nếu không có thì dựng từ các tham số của route
+func auditTarget(c *gin.Context) string {
+	if target := c.GetString(auditTargetContextKey); target != "" {
+		return target
+	}
+
+	parts := make([]string, 0, len(c.Params))
+	for _, param := range c.Params {
+		parts = append(parts, fmt.Sprintf("%s:%s", strings.TrimSuffix(param.Key, "-id"), param.Value))
+	}
+	return strings.Join(parts, "/")
+}
+
+// /api/admin/audit-log?from=<RFC3339>&to=<RFC3339>&user=<username>&workspace_id=<id>&action=<action>&limit=<n>&offset=<n>
+func (ctrl *Controller) QueryAuditLogHandler(c *gin.Context) {
+	filter := service.AuditLogFilter{
+		Username: c.Query("user"),
+		Action:   c.Query("action"),
+		Limit:    100,
+	}
+
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s, expected RFC3339 time", name)})
+				return
+			}
+			*target = &t
+		}
+	}
+
+	for name, target := range map[string]*int{"workspace_id": &filter.WorkspaceID, "limit": &filter.Limit, "offset": &filter.Offset} {
+		if value := c.Query(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", name)})
+				return
+			}
+			*target = n
+		}
+	}
+
+	entries, err := ctrl.SQLiteCatalogService.QueryAuditLogs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/utils"
+)
+
+const (
+	// Key lưu Principal trong gin.Context
+	principalContextKey = "principal"
+	// Key lưu workspace đã được kiểm tra quyền trong gin.Context
+	workspaceContextKey = "workspace"
+)
+
+// Principal đại diện cho danh tính của người gọi API
+// Với JWT, User là người đăng nhập và APIKey là nil
+// Với API key, User là người đã tạo key và quyền bị giới hạn theo APIKey
+type Principal struct {
+	User   *models.User
+	APIKey *models.APIKey
+}
+
+// permissionRank dùng để so sánh các mức quyền READ < WRITE < ADMIN
+var permissionRank = map[string]int{
+	models.PermissionRead:  1,
+	models.PermissionWrite: 2,
+	models.PermissionAdmin: 3,
+}
+
+// permissionAllows kiểm tra quyền granted có bao gồm quyền required không
+func permissionAllows(granted, required string) bool {
+	return permissionRank[granted] >= permissionRank[required] && permissionRank[required] > 0
+}
+
+// AuthMiddleware xác thực request bằng header X-API-Key hoặc Authorization: Bearer <jwt>
+func (ctrl *Controller) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rawKey := c.GetHeader("X-API-Key"); rawKey != "" {
+			apiKey, err := ctrl.SQLiteCatalogService.GetAPIKeyByHash(utils.HashAPIKey(rawKey))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			if apiKey.RevokedAt != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+				return
+			}
+			if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+				return
+			}
+			user, err := ctrl.SQLiteCatalogService.GetUserByID(apiKey.CreatedByID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			// Lỗi cập nhật last_used_at không làm request thất bại
+			_ = ctrl.SQLiteCatalogService.TouchAPIKey(apiKey)
+
+			c.Set(principalContextKey, &Principal{User: user, APIKey: apiKey})
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing credentials"})
+			return
+		}
+
+		claims, err := utils.DecodeAccessToken(token, []byte(ctrl.config.JWTSecret))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		username, _ := claims["username"].(string)
+		user, err := ctrl.SQLiteCatalogService.GetUser(username)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		c.Set(principalContextKey, &Principal{User: user})
+		c.Next()
+	}
+}
+
+// RequireAdmin chỉ cho phép người dùng có vai trò admin đăng nhập bằng JWT
+func (ctrl *Controller) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := getPrincipal(c)
+		if principal == nil || principal.APIKey != nil || principal.User.Role != models.UserRoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin permission required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireWorkspacePermission kiểm tra người gọi có quyền tối thiểu là required trên workspace trong route
+// :workspace-id có thể là ID hoặc tên của workspace
+func (ctrl *Controller) RequireWorkspacePermission(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		param := c.Param("workspace-id")
+
+		var workspace *models.Workspace
+		var err error
+		if workspaceID, convErr := strconv.Atoi(param); convErr == nil {
+			workspace, err = ctrl.SQLiteCatalogService.GetWorkspaceByID(workspaceID)
+		} else {
+			workspace, err = ctrl.SQLiteCatalogService.GetWorkspaceByName(param)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			return
+		}
+
+		if !ctrl.hasWorkspacePermission(getPrincipal(c), workspace, required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+
+		c.Set(workspaceContextKey, workspace)
+		c.Next()
+	}
+}
+
+// hasWorkspacePermission kiểm tra quyền của principal trên workspace
+func (ctrl *Controller) hasWorkspacePermission(principal *Principal, workspace *models.Workspace, required string) bool {
+	if principal == nil {
+		return false
+	}
+
+	// API key chỉ có quyền trên đúng workspace của nó
+	if principal.APIKey != nil {
+		return principal.APIKey.WorkspaceID == workspace.ID && permissionAllows(principal.APIKey.Permission, required)
+	}
+
+	// Admin hệ thống và chủ sở hữu workspace có toàn quyền
+	if principal.User.Role == models.UserRoleAdmin || principal.User.ID == workspace.OwnerID {
+		return true
+	}
+
+	permission, err := ctrl.SQLiteCatalogService.GetUserPermission(principal.User.ID, workspace.ID)
+	if err != nil {
+		return false
+	}
+	return permissionAllows(permission.Permission, required)
+}
+
+// getPrincipal lấy Principal đã được AuthMiddleware gán vào context
+func getPrincipal(c *gin.Context) *Principal {
+	value, ok := c.Get(principalContextKey)
+	if !ok {
+		return nil
+	}
+	principal, _ := value.(*Principal)
+	return principal
+}
+
+// getWorkspace lấy workspace đã được RequireWorkspacePermission gán vào context
+func getWorkspace(c *gin.Context) *models.Workspace {
+	value, ok := c.Get(workspaceContextKey)
+	if !ok {
+		return nil
+	}
+	workspace, _ := value.(*models.Workspace)
+	return workspace
+}
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/main_server/service"
+	"github.com/dehuy69/mydp/utils"
+)
+
+const testJWTSecret = "test-secret"
+
+// authTestEnv chứa router gồm các route xác thực giống router thật, cùng workspace và người dùng có sẵn
+type authTestEnv struct {
+	ctrl      *Controller
+	router    *gin.Engine
+	owner     *models.User
+	workspace *models.Workspace
+	other     *models.Workspace
+}
+
+// newAuthTestEnv tạo catalog trong thư mục tạm với người dùng owner sở hữu hai workspace ws và other
+func newAuthTestEnv(t *testing.T) *authTestEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{DataFolderDefault: t.TempDir(), JWTSecret: testJWTSecret}
+	catalog, err := service.NewSQLiteCatalogService(cfg)
+	if err != nil {
+		t.Fatalf("failed to create catalog: %v", err)
+	}
+	t.Cleanup(func() { catalog.Close() })
+
+	env := &authTestEnv{ctrl: &Controller{config: cfg, SQLiteCatalogService: catalog}}
+	env.owner = env.addUser(t, "owner")
+	env.workspace = &models.Workspace{Name: "ws", OwnerID: env.owner.ID}
+	env.other = &models.Workspace{Name: "other", OwnerID: env.owner.ID}
+	for _, workspace := range []*models.Workspace{env.workspace, env.other} {
+		if err := catalog.CreateWorkspace(workspace); err != nil {
+			t.Fatalf("failed to create workspace: %v", err)
+		}
+	}
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"user": getPrincipal(c).User.Username}) }
+	env.router = gin.New()
+	privateR := env.router.Group("/api")
+	privateR.Use(env.ctrl.AuthMiddleware())
+	{
+		privateR.POST("/workspace/create", env.ctrl.CreateWorkspaceHandler)
+		privateR.GET("/workspace/:workspace-id/read", env.ctrl.RequireWorkspacePermission(models.PermissionRead), ok)
+		privateR.GET("/workspace/:workspace-id/write", env.ctrl.RequireWorkspacePermission(models.PermissionWrite), ok)
+		privateR.GET("/workspace/:workspace-id/admin", env.ctrl.RequireWorkspacePermission(models.PermissionAdmin), ok)
+		privateR.POST("/workspace/:workspace-id/api-key/create", env.ctrl.RequireWorkspacePermission(models.PermissionAdmin), env.ctrl.CreateAPIKeyHandler)
+		privateR.GET("/workspace/:workspace-id/api-key/list", env.ctrl.RequireWorkspacePermission(models.PermissionAdmin), env.ctrl.ListAPIKeysHandler)
+		privateR.POST("/workspace/:workspace-id/api-key/:key-id/revoke", env.ctrl.RequireWorkspacePermission(models.PermissionAdmin), env.ctrl.RevokeAPIKeyHandler)
+	}
+	return env
+}
+
+// addUser tạo người dùng thường với username
+func (env *authTestEnv) addUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	if err := env.ctrl.SQLiteCatalogService.AddUser(username, "password", "user"); err != nil {
+		t.Fatalf("failed to add user %s: %v", username, err)
+	}
+	user, err := env.ctrl.SQLiteCatalogService.GetUser(username)
+	if err != nil {
+		t.Fatalf("failed to get user %s: %v", username, err)
+	}
+	return user
+}
+
+// addAPIKey lưu API key rawKey của owner trên workspace với quyền permission
+func (env *authTestEnv) addAPIKey(t *testing.T, rawKey string, workspace *models.Workspace, permission string) *models.APIKey {
+	t.Helper()
+	apiKey := &models.APIKey{
+		Name:        rawKey,
+		Prefix:      rawKey[:utils.APIKeyPrefixLength],
+		KeyHash:     utils.HashAPIKey(rawKey),
+		WorkspaceID: workspace.ID,
+		Permission:  permission,
+		CreatedByID: env.owner.ID,
+	}
+	if err := env.ctrl.SQLiteCatalogService.CreateAPIKey(apiKey); err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+	return apiKey
+}
+
+// token tạo JWT của username với thuật toán method
+func token(t *testing.T, method jwt.SigningMethod, key interface{}, username string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(method, jwt.MapClaims{"username": username}).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// do gửi request với các header cho trước và trả về status code cùng body
+func (env *authTestEnv) do(method, path, body string, headers map[string]string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func apiKeyHeader(rawKey string) map[string]string {
+	return map[string]string{"X-API-Key": rawKey}
+}
+
+func TestPermissionAllows(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		want              bool
+	}{
+		{granted: models.PermissionRead, required: models.PermissionRead, want: true},
+		{granted: models.PermissionRead, required: models.PermissionWrite, want: false},
+		{granted: models.PermissionWrite, required: models.PermissionRead, want: true},
+		{granted: models.PermissionWrite, required: models.PermissionAdmin, want: false},
+		{granted: models.PermissionAdmin, required: models.PermissionWrite, want: true},
+		// Quyền không hợp lệ không cho phép gì và không được yêu cầu
+		{granted: "OWNER", required: models.PermissionRead, want: false},
+		{granted: models.PermissionAdmin, required: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := permissionAllows(tt.granted, tt.required); got != tt.want {
+			t.Errorf("permissionAllows(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	env := newAuthTestEnv(t)
+	rawKey, err := utils.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey := env.addAPIKey(t, rawKey, env.workspace, models.PermissionWrite)
+
+	// Key được tra cứu theo hash và quyền bị giới hạn theo key dù người tạo là chủ sở hữu
+	tests := []struct {
+		path string
+		key  string
+		want int
+	}{
+		{path: "/api/workspace/ws/read", key: rawKey, want: http.StatusOK},
+		{path: fmt.Sprintf("/api/workspace/%d/write", env.workspace.ID), key: rawKey, want: http.StatusOK},
+		{path: "/api/workspace/ws/admin", key: rawKey, want: http.StatusForbidden},
+		{path: "/api/workspace/other/read", key: rawKey, want: http.StatusForbidden},
+		{path: "/api/workspace/ws/read", key: rawKey + "x", want: http.StatusUnauthorized},
+		{path: "/api/workspace/ws/read", key: utils.HashAPIKey(rawKey), want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got, body := env.do(http.MethodGet, tt.path, "", apiKeyHeader(tt.key)); got != tt.want {
+			t.Errorf("%s with key %q: got %d (%s), want %d", tt.path, tt.key, got, body, tt.want)
+		}
+	}
+
+	stored, err := env.ctrl.SQLiteCatalogService.GetAPIKeyByID(apiKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.KeyHash == rawKey || stored.LastUsedAt == nil {
+		t.Fatalf("got stored key %+v, want a hashed key with last_used_at set", stored)
+	}
+
+	// Key hết hạn hoặc bị thu hồi không còn dùng được
+	expiredKey := "mydp_expired-key"
+	expired := env.addAPIKey(t, expiredKey, env.workspace, models.PermissionRead)
+	expiresAt := time.Now().Add(-time.Minute)
+	if err := env.ctrl.SQLiteCatalogService.Db.Model(expired).Update("expires_at", &expiresAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := env.ctrl.SQLiteCatalogService.RevokeAPIKey(stored); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{expiredKey, rawKey} {
+		if got, body := env.do(http.MethodGet, "/api/workspace/ws/read", "", apiKeyHeader(key)); got != http.StatusUnauthorized {
+			t.Errorf("key %q: got %d (%s), want %d", key, got, body, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestUserWorkspacePermission(t *testing.T) {
+	env := newAuthTestEnv(t)
+	member := env.addUser(t, "member")
+	permission := &models.UserPermission{UserID: member.ID, WorkspaceID: env.workspace.ID, Permission: models.PermissionWrite}
+	if err := env.ctrl.SQLiteCatalogService.Db.Create(permission).Error; err != nil {
+		t.Fatal(err)
+	}
+	env.addUser(t, "stranger")
+
+	tests := []struct {
+		username string
+		path     string
+		want     int
+	}{
+		{username: "owner", path: "/api/workspace/ws/admin", want: http.StatusOK},
+		{username: "admin", path: "/api/workspace/ws/admin", want: http.StatusOK},
+		{username: "member", path: "/api/workspace/ws/read", want: http.StatusOK},
+		{username: "member", path: "/api/workspace/ws/write", want: http.StatusOK},
+		{username: "member", path: "/api/workspace/ws/admin", want: http.StatusForbidden},
+		{username: "member", path: "/api/workspace/other/read", want: http.StatusForbidden},
+		{username: "stranger", path: "/api/workspace/ws/read", want: http.StatusForbidden},
+		{username: "member", path: "/api/workspace/missing/read", want: http.StatusNotFound},
+		{username: "nobody", path: "/api/workspace/ws/read", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		headers := bearer(token(t, jwt.SigningMethodHS256, []byte(testJWTSecret), tt.username))
+		if got, body := env.do(http.MethodGet, tt.path, "", headers); got != tt.want {
+			t.Errorf("%s as %s: got %d (%s), want %d", tt.path, tt.username, got, body, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyCannotManageKeysOrCreateWorkspaces(t *testing.T) {
+	env := newAuthTestEnv(t)
+	ownerToken := bearer(token(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "owner"))
+
+	// Chủ sở hữu đăng nhập bằng JWT tạo được key, key gốc chỉ được trả về một lần và không được lưu
+	code, body := env.do(http.MethodPost, "/api/workspace/ws/api-key/create", `{"name": "ci", "permission": "ADMIN"}`, ownerToken)
+	if code != http.StatusOK {
+		t.Fatalf("got %d (%s), want %d", code, body, http.StatusOK)
+	}
+	var created CreateAPIKeyResponse
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, created.APIKey.Prefix) || strings.Contains(body, utils.HashAPIKey(created.Key)) {
+		t.Fatalf("got response %s, want the raw key with its prefix and without its hash", body)
+	}
+
+	// Key có quyền ADMIN vẫn không quản lý được API key và không tạo được workspace
+	keyHeader := apiKeyHeader(created.Key)
+	if code, body := env.do(http.MethodGet, "/api/workspace/ws/admin", "", keyHeader); code != http.StatusOK {
+		t.Fatalf("got %d (%s) for the created key, want %d", code, body, http.StatusOK)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodPost, path: "/api/workspace/ws/api-key/create", body: `{"name": "child", "permission": "READ"}`},
+		{method: http.MethodGet, path: "/api/workspace/ws/api-key/list"},
+		{method: http.MethodPost, path: fmt.Sprintf("/api/workspace/ws/api-key/%d/revoke", created.APIKey.ID)},
+		{method: http.MethodPost, path: "/api/workspace/create", body: `{"name": "new"}`},
+	}
+	for _, tt := range tests {
+		if code, body := env.do(tt.method, tt.path, tt.body, keyHeader); code != http.StatusForbidden {
+			t.Errorf("%s %s: got %d (%s), want %d", tt.method, tt.path, code, body, http.StatusForbidden)
+		}
+	}
+
+	apiKeys, err := env.ctrl.SQLiteCatalogService.ListAPIKeysByWorkspace(env.workspace.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKeys) != 1 || apiKeys[0].RevokedAt != nil {
+		t.Fatalf("got API keys %+v, want only the unrevoked key created by the owner", apiKeys)
+	}
+}
+
+func TestJWTRequiresHS256(t *testing.T) {
+	env := newAuthTestEnv(t)
+	secret := []byte(testJWTSecret)
+	unsigned := token(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "owner")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "HS256", headers: bearer(token(t, jwt.SigningMethodHS256, secret, "owner")), want: http.StatusOK},
+		// Token ký bằng cùng secret nhưng thuật toán khác bị từ chối
+		{name: "HS384", headers: bearer(token(t, jwt.SigningMethodHS384, secret, "owner")), want: http.StatusUnauthorized},
+		{name: "HS512", headers: bearer(token(t, jwt.SigningMethodHS512, secret, "owner")), want: http.StatusUnauthorized},
+		{name: "none", headers: bearer(unsigned), want: http.StatusUnauthorized},
+		{name: "wrong secret", headers: bearer(token(t, jwt.SigningMethodHS256, []byte("other"), "owner")), want: http.StatusUnauthorized},
+		{name: "not bearer", headers: map[string]string{"Authorization": token(t, jwt.SigningMethodHS256, secret, "owner")}, want: http.StatusUnauthorized},
+		{name: "missing", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got, body := env.do(http.MethodGet, "/api/workspace/ws/read", "", tt.headers); got != tt.want {
+			t.Errorf("%s: got %d (%s), want %d", tt.name, got, body, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -10,51 +11,49 @@ import (
 )
 
 type CreateCollectionRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name    string `json:"name" binding:"required"`
+	Backend string `json:"backend"` // badger (mặc định) hoặc memory
 }
 
 func (ctrl *Controller) CreateCollectionHandler(c *gin.Context) {
-	WorkspaceIDStr := c.Param("workspace-id")
-	WorkspaceID, err := strconv.Atoi(WorkspaceIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
-		return
-	}
-
 	var req CreateCollectionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err})
 		return
 	}
 
+	// Kiểm tra quota số collection của workspace
+	quotaWrapper := domain.NewQuotaWrapper(getWorkspace(c).ID, ctrl.SQLiteCatalogService)
+	if err := quotaWrapper.CheckCreateCollection(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
 	collection := models.Collection{
 		Name:        req.Name,
-		WorkspaceID: WorkspaceID,
+		WorkspaceID: getWorkspace(c).ID,
+		Backend:     req.Backend,
 	}
 
 	// collection wrapper
-	collectionWrapper := domain.NewCollectionWrapper(&collection, ctrl.SQLiteCatalogService, ctrl.BadgerService, ctrl.BboltService)
+	collectionWrapper, ok := ctrl.collectionWrapper(c, &collection)
+	if !ok {
+		return
+	}
 
 	if err := collectionWrapper.CreateCollection(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDomainError(c, err)
 		return
 	}
+	setAuditTarget(c, "collection:%d", collection.ID)
 
 	c.JSON(http.StatusOK, collection)
 }
 
 func (ctrl *Controller) WriteCollectionHandler(c *gin.Context) {
-	collectionIDStr := c.Param("collection-id")
-	collectionID, err := strconv.Atoi(collectionIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
-		return
-	}
-
 	// Retrieve collection
-	collection, err := ctrl.SQLiteCatalogService.GetCollectionByID(collectionID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection not found"})
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
 		return
 	}
 
@@ -69,12 +68,27 @@ func (ctrl *Controller) WriteCollectionHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Data must contain a '_key' field"})
 		return
 	}
+	setAuditTarget(c, "collection:%d/key:%v", collection.ID, req["_key"])
+
+	// Kiểm tra quota số document và dung lượng của workspace
+	if !ctrl.checkWriteQuota(c, collection, req) {
+		return
+	}
 
 	// collection wrapper
-	collectionWrapper := domain.NewCollectionWrapper(collection, ctrl.SQLiteCatalogService, ctrl.BadgerService, ctrl.BboltService)
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+
+	// Kiểm tra schema và kiểu dữ liệu của index
+	validation, ok := validateDocument(c, collectionWrapper, req)
+	if !ok {
+		return
+	}
 
 	// Kiểm tra constrain
-	err = collectionWrapper.CheckIndexConstraints(req)
+	err := collectionWrapper.CheckIndexConstraints(req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -88,27 +102,19 @@ func (ctrl *Controller) WriteCollectionHandler(c *gin.Context) {
 	}
 
 	// Thêm collection ID vào dữ liệu
-	req["_collection_id"] = collectionID
+	req["_collection_id"] = collection.ID
 
 	// Ghi dữ liệu vào queue "write-collection"
 	ctrl.QueueManager.AddToQueue("write-collection", req)
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	respondWriteSuccess(c, validation)
 }
 
 // ForceWriteCollectionHandler ghi dữ liệu vào collection mà không thông qua WAL
 func (ctrl *Controller) ForceWriteCollectionHandler(c *gin.Context) {
-	collectionIDStr := c.Param("collection-id")
-	collectionID, err := strconv.Atoi(collectionIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
-		return
-	}
-
 	// Retrieve collection
-	collection, err := ctrl.SQLiteCatalogService.GetCollectionByID(collectionID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection not found"})
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
 		return
 	}
 
@@ -123,15 +129,380 @@ func (ctrl *Controller) ForceWriteCollectionHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Data must contain a '_key' field"})
 		return
 	}
+	setAuditTarget(c, "collection:%d/key:%v", collection.ID, req["_key"])
+
+	// Kiểm tra quota số document và dung lượng của workspace
+	if !ctrl.checkWriteQuota(c, collection, req) {
+		return
+	}
 
 	// collection wrapper
-	collectionWrapper := domain.NewCollectionWrapper(collection, ctrl.SQLiteCatalogService, ctrl.BadgerService, ctrl.BboltService)
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+
+	// Kiểm tra schema và kiểu dữ liệu của index
+	validation, ok := validateDocument(c, collectionWrapper, req)
+	if !ok {
+		return
+	}
 
-	err = collectionWrapper.Write(req)
+	err := collectionWrapper.Write(req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	respondWriteSuccess(c, validation)
+}
+
+type QueryCollectionRequest struct {
+	Filter string `json:"filter"`
+	Limit  int    `json:"limit"`
+}
+
+type RenameCollectionRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type SetCollectionSchemaRequest struct {
+	Schema json.RawMessage `json:"schema"`
+	Mode   string          `json:"mode"`
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/update
+// Ghi đè document đã tồn tại với cùng _key, các index được cập nhật đồng bộ
+func (ctrl *Controller) UpdateDocumentHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req map[string]interface{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditTarget(c, "collection:%d/key:%v", collection.ID, req["_key"])
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+
+	// Kiểm tra schema và kiểu dữ liệu của index
+	validation, ok := validateDocument(c, collectionWrapper, req)
+	if !ok {
+		return
+	}
+
+	// Kiểm tra quota dung lượng của workspace với phần tăng thêm so với document cũ
+	if !ctrl.checkUpdateQuota(c, collectionWrapper, req) {
+		return
+	}
+
+	if err := collectionWrapper.Update(req); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	respondWriteSuccess(c, validation)
+}
+
+type DeleteDocumentRequest struct {
+	Key string `json:"_key" binding:"required"`
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/delete
+// Xóa document theo _key, ví dụ {"_key": "user-1"}
+func (ctrl *Controller) DeleteDocumentHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req DeleteDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditTarget(c, "collection:%d/key:%v", collection.ID, req.Key)
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if err := collectionWrapper.Delete(req.Key); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/query
+// Tìm document theo filter, ví dụ {"filter": "status = \"active\" AND age >= 18", "limit": 10}
+func (ctrl *Controller) QueryCollectionHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req QueryCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	result, err := collectionWrapper.Query(req.Filter, req.Limit)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// /api/workspace/<workspace-id>/collection/list
+func (ctrl *Controller) ListCollectionsHandler(c *gin.Context) {
+	collections, err := ctrl.SQLiteCatalogService.ListCollectionsByWorkspace(getWorkspace(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, collections)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>?exact=true
+// Trả về collection kèm index, shard, số document và dung lượng
+// Mặc định số document và dung lượng lấy từ bộ đếm trong catalog, exact=true sẽ đếm lại từ Badger
+func (ctrl *Controller) DescribeCollectionHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if _, err := collectionWrapper.Stats(c.Query("exact") == "true"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/rename
+func (ctrl *Controller) RenameCollectionHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req RenameCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if err := collectionWrapper.Rename(req.Name); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/schema
+// Gắn JSON Schema cho collection, schema null sẽ gỡ schema
+func (ctrl *Controller) SetCollectionSchemaHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req SetCollectionSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if err := collectionWrapper.SetSchema(req.Schema, req.Mode); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/validate
+// Chỉ kiểm tra document với schema và kiểu dữ liệu của index, không ghi dữ liệu
+func (ctrl *Controller) ValidateDocumentHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req map[string]interface{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, collectionWrapper.Validate(req))
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/truncate
+func (ctrl *Controller) TruncateCollectionHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if err := collectionWrapper.Truncate(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/drop
+func (ctrl *Controller) DropCollectionHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	collectionWrapper, ok := ctrl.collectionWrapper(c, collection)
+	if !ok {
+		return
+	}
+	if err := collectionWrapper.Drop(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// collectionFromRequest lấy collection theo :collection-id trong route, collection phải thuộc workspace trong route
+// :collection-id có thể là ID hoặc tên của collection trong workspace
+// Nếu không hợp lệ, response lỗi đã được ghi và trả về false
+func (ctrl *Controller) collectionFromRequest(c *gin.Context) (*models.Collection, bool) {
+	collection, ok := ctrl.findCollection(getWorkspace(c).ID, c.Param("collection-id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection not found"})
+		return nil, false
+	}
+	return collection, true
+}
+
+// findCollection tìm collection của workspace theo ID hoặc tên
+func (ctrl *Controller) findCollection(workspaceID int, ref string) (*models.Collection, bool) {
+	var collection *models.Collection
+	var err error
+	if collectionID, convErr := strconv.Atoi(ref); convErr == nil {
+		collection, err = ctrl.SQLiteCatalogService.GetCollectionByID(collectionID)
+	} else {
+		collection, err = ctrl.SQLiteCatalogService.GetCollectionByName(workspaceID, ref)
+	}
+	if err != nil || collection.WorkspaceID != workspaceID {
+		return nil, false
+	}
+	return collection, true
+}
+
+// collectionWrapper mở collection với backend lưu trữ của nó, nếu lỗi thì response đã được ghi và trả về false
+func (ctrl *Controller) collectionWrapper(c *gin.Context, collection *models.Collection) (*domain.CollectionWrapper, bool) {
+	collectionWrapper, err := domain.NewCollectionWrapper(collection, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err != nil {
+		respondDomainError(c, err)
+		return nil, false
+	}
+	return collectionWrapper, true
+}
+
+// checkWriteQuota kiểm tra quota của workspace trước khi ghi document, trả về false nếu đã ghi response lỗi
+func (ctrl *Controller) checkWriteQuota(c *gin.Context, collection *models.Collection, document map[string]interface{}) bool {
+	documentBytes, err := json.Marshal(document)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	quotaWrapper := domain.NewQuotaWrapper(collection.WorkspaceID, ctrl.SQLiteCatalogService)
+	if err := quotaWrapper.CheckWrite(int64(len(documentBytes))); err != nil {
+		respondDomainError(c, err)
+		return false
+	}
+	return true
+}
+
+// checkUpdateQuota kiểm tra quota của workspace trước khi ghi đè document, trả về false nếu đã ghi response lỗi
+func (ctrl *Controller) checkUpdateQuota(c *gin.Context, collectionWrapper *domain.CollectionWrapper, document map[string]interface{}) bool {
+	documentBytes, err := json.Marshal(document)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	key, _ := document["_key"].(string)
+	oldSize, err := collectionWrapper.DocumentSize(key)
+	if err != nil {
+		respondDomainError(c, err)
+		return false
+	}
+
+	quotaWrapper := domain.NewQuotaWrapper(collectionWrapper.Collection.WorkspaceID, ctrl.SQLiteCatalogService)
+	if err := quotaWrapper.CheckUpdate(int64(len(documentBytes)) - oldSize); err != nil {
+		respondDomainError(c, err)
+		return false
+	}
+	return true
+}
+
+// validateDocument kiểm tra document trước khi ghi, trả về false nếu đã ghi response lỗi
+func validateDocument(c *gin.Context, collectionWrapper *domain.CollectionWrapper, document map[string]interface{}) (*domain.ValidationResult, bool) {
+	validation := collectionWrapper.Validate(document)
+	if !validation.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document validation failed", "errors": validation.Errors})
+		return nil, false
+	}
+	return validation, true
+}
+
+// respondWriteSuccess trả về kết quả ghi thành công, kèm cảnh báo schema ở chế độ warn
+func respondWriteSuccess(c *gin.Context, validation *domain.ValidationResult) {
+	if len(validation.Warnings) > 0 {
+		c.JSON(http.StatusOK, gin.H{"status": "success", "warnings": validation.Warnings})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/domain"
 	"github.com/dehuy69/mydp/main_server/service"
+	"github.com/gin-gonic/gin"
 )
 
 type Controller struct {
@@ -12,6 +17,8 @@ type Controller struct {
 	ParquetService       *service.ParquetService
 	QueueManager         *service.QueueManager
 	BboltService         *service.BboltService
+	Storage              *service.Storage // Chọn DocumentStore và IndexStore theo backend của collection, kèm nơi lưu table
+	RateLimiter          *service.RateLimiter
 }
 
 func NewController(config *config.Config) (*Controller, error) {
@@ -25,7 +32,7 @@ func NewController(config *config.Config) (*Controller, error) {
 		return nil, err
 	}
 
-	parquetService, err := service.NewParquetService()
+	parquetService, err := service.NewParquetService(config)
 	if err != nil {
 		return nil, err
 	}
@@ -46,9 +53,32 @@ func NewController(config *config.Config) (*Controller, error) {
 		ParquetService:       parquetService,
 		QueueManager:         queueManager,
 		BboltService:         bboltService,
+		Storage:              service.NewStorage(badgerService, bboltService, parquetService),
+		RateLimiter:          service.NewRateLimiter(),
 	}, nil
 }
 
+// respondDomainError ghi response cho lỗi trả về từ các wrapper trong domain
+func respondDomainError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidName), errors.Is(err, domain.ErrInvalidSchema),
+		errors.Is(err, domain.ErrSchemaViolation), errors.Is(err, domain.ErrInvalidIndex), errors.Is(err, domain.ErrInvalidFilter),
+		errors.Is(err, domain.ErrInvalidBackend), errors.Is(err, domain.ErrInvalidColumn), errors.Is(err, domain.ErrInvalidTableOption),
+		errors.Is(err, domain.ErrInvalidRow), errors.Is(err, domain.ErrInvalidSQL), errors.Is(err, domain.ErrInvalidPartition),
+		errors.Is(err, domain.ErrInvalidSync):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrNameConflict), errors.Is(err, domain.ErrIndexBuilding), errors.Is(err, domain.ErrCompactionRunning),
+		errors.Is(err, service.ErrSchemaConflict), errors.Is(err, service.ErrSnapshotConflict), errors.Is(err, domain.ErrSyncConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // func (ctrl *Controller) HealthCheck(c *gin.Context) {
 // 	response := HealthCheckResponse{Status: "ok"}
 // 	c.JSON(http.StatusOK, response)
@@ -3,6 +3,7 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dehuy69/mydp/main_server/domain"
 	"github.com/dehuy69/mydp/main_server/models"
@@ -15,14 +16,13 @@ type CreateIndexRequest struct {
 	Fields    string `json:"fields" binding:"required"`
 	IndexType string `json:"index_type" binding:"required"`
 	DataType  string `json:"data_type" binding:"required"`
-	IsUnique  bool   `json:"is_unique" binding:"required"`
+	IsUnique  bool   `json:"is_unique"`
+	Filter    string `json:"filter"`
 }
 
 func (ctrl *Controller) CreateIndexHandler(c *gin.Context) {
-	collectionIDStr := c.Param("collection-id")
-	collectionID, err := strconv.Atoi(collectionIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
 		return
 	}
 
@@ -32,9 +32,16 @@ func (ctrl *Controller) CreateIndexHandler(c *gin.Context) {
 		return
 	}
 
+	// Kiểm tra quota số index của workspace
+	quotaWrapper := domain.NewQuotaWrapper(collection.WorkspaceID, ctrl.SQLiteCatalogService)
+	if err := quotaWrapper.CheckCreateIndex(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
 	index := models.Index{
 		Name:         req.IndexName,
-		CollectionID: collectionID,
+		CollectionID: collection.ID,
 	}
 
 	// Parse CreateIndexRequest vào index
@@ -42,15 +49,154 @@ func (ctrl *Controller) CreateIndexHandler(c *gin.Context) {
 	index.IndexType = req.IndexType
 	index.DataType = req.DataType
 	index.IsUnique = req.IsUnique
+	index.Filter = req.Filter
 
 	// Tạo index wrapper
-	indexWrapper := domain.NewIndexWrapper(&index, ctrl.SQLiteCatalogService, ctrl.BadgerService, ctrl.BboltService)
+	indexWrapper, err := domain.NewIndexWrapper(&index, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
 
 	// Use indexWrapper to avoid "declared and not used" error
 	if err := indexWrapper.CreateIndex(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "collection:%d/index:%d", collection.ID, index.ID)
+
+	c.JSON(http.StatusOK, index)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/rebuild
+// Build lại index với cách mã hóa tuple, dùng cho index được tạo trước khi có KeyVersion
+func (ctrl *Controller) RebuildIndexHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	index, ok := ctrl.indexFromRequest(c, collection)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "collection:%d/index:%d", collection.ID, index.ID)
+
+	indexWrapper, err := domain.NewIndexWrapper(index, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	if err := indexWrapper.Rebuild(); err != nil {
+		respondDomainError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, index)
 }
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/stats
+func (ctrl *Controller) GetIndexStatsHandler(c *gin.Context) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	index, ok := ctrl.indexFromRequest(c, collection)
+	if !ok {
+		return
+	}
+
+	indexWrapper, err := domain.NewIndexWrapper(index, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	report, err := indexWrapper.Stats()
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/verify
+// Đối chiếu index với dữ liệu của collection, không thay đổi index
+func (ctrl *Controller) VerifyIndexHandler(c *gin.Context) {
+	ctrl.verifyIndex(c, false)
+}
+
+// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/repair
+// Đối chiếu index với dữ liệu của collection và sửa các entry thiếu hoặc mồ côi
+func (ctrl *Controller) RepairIndexHandler(c *gin.Context) {
+	ctrl.verifyIndex(c, true)
+}
+
+func (ctrl *Controller) verifyIndex(c *gin.Context, repair bool) {
+	collection, ok := ctrl.collectionFromRequest(c)
+	if !ok {
+		return
+	}
+
+	index, ok := ctrl.indexFromRequest(c, collection)
+	if !ok {
+		return
+	}
+	if repair {
+		setAuditTarget(c, "collection:%d/index:%d", collection.ID, index.ID)
+	}
+
+	indexWrapper, err := domain.NewIndexWrapper(index, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	report, err := indexWrapper.Verify(repair)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// /api/workspace/<workspace-id>/index/unused?days=<days>
+// Liệt kê các index không được query nào dùng trong <days> ngày gần nhất (mặc định 30)
+func (ctrl *Controller) ListUnusedIndexesHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a non-negative integer"})
+		return
+	}
+
+	workspaceWrapper := domain.NewWorkspaceWrapper(getWorkspace(c), ctrl.SQLiteCatalogService, ctrl.Storage)
+	reports, err := workspaceWrapper.UnusedIndexes(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"days": days, "indexes": reports})
+}
+
+// indexFromRequest lấy index theo :index-id trong route, index phải thuộc collection
+// :index-id có thể là ID hoặc tên của index trong collection
+// Nếu không hợp lệ, response lỗi đã được ghi và trả về false
+func (ctrl *Controller) indexFromRequest(c *gin.Context, collection *models.Collection) (*models.Index, bool) {
+	param := c.Param("index-id")
+
+	var index *models.Index
+	var err error
+	if indexID, convErr := strconv.Atoi(param); convErr == nil {
+		index, err = ctrl.SQLiteCatalogService.GetIndexByID(indexID)
+	} else {
+		index, err = ctrl.SQLiteCatalogService.GetIndexByName(collection.ID, param)
+	}
+	if err != nil || index.CollectionID != collection.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Index not found"})
+		return nil, false
+	}
+
+	return index, true
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+type SetWorkspaceQuotaRequest struct {
+	MaxCollections int   `json:"max_collections"`
+	MaxIndexes     int   `json:"max_indexes"`
+	MaxDocuments   int64 `json:"max_documents"`
+	MaxBytes       int64 `json:"max_bytes"`
+}
+
+type SetRateLimitRequest struct {
+	SubjectType       string  `json:"subject_type" binding:"required"`
+	SubjectID         int     `json:"subject_id" binding:"required"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// WorkspaceUsageResponse chứa mức sử dụng hiện tại và quota của workspace
+type WorkspaceUsageResponse struct {
+	Usage *service.WorkspaceUsage `json:"usage"`
+	Quota *models.WorkspaceQuota  `json:"quota"`
+}
+
+// RateLimitMiddleware giới hạn số request của mỗi user hoặc API key theo token bucket
+// Giới hạn lấy từ catalog (RateLimit) nếu có, nếu không dùng giới hạn mặc định trong config
+func (ctrl *Controller) RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := getPrincipal(c)
+		if principal == nil {
+			c.Next()
+			return
+		}
+
+		subjectType, subjectID := models.RateLimitSubjectUser, principal.User.ID
+		if principal.APIKey != nil {
+			subjectType, subjectID = models.RateLimitSubjectAPIKey, principal.APIKey.ID
+		}
+
+		rate, burst := ctrl.config.RateLimitPerSecond, ctrl.config.RateLimitBurst
+		if rateLimit, err := ctrl.SQLiteCatalogService.GetRateLimit(subjectType, subjectID); err == nil {
+			rate, burst = rateLimit.RequestsPerSecond, rateLimit.Burst
+		}
+		if rate <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, wait := ctrl.RateLimiter.Allow(fmt.Sprintf("%s:%d", subjectType, subjectID), rate, burst)
+		if !allowed {
+			c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// /api/workspace/<workspace-id>/usage
+func (ctrl *Controller) GetWorkspaceUsageHandler(c *gin.Context) {
+	workspace := getWorkspace(c)
+
+	usage, err := ctrl.SQLiteCatalogService.GetWorkspaceUsage(workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	quota, err := ctrl.SQLiteCatalogService.GetWorkspaceQuota(workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, WorkspaceUsageResponse{Usage: usage, Quota: quota})
+}
+
+// /api/workspace/<workspace-id>/quota
+func (ctrl *Controller) SetWorkspaceQuotaHandler(c *gin.Context) {
+	var req SetWorkspaceQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MaxCollections < 0 || req.MaxIndexes < 0 || req.MaxDocuments < 0 || req.MaxBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quota values must not be negative"})
+		return
+	}
+
+	quota := models.WorkspaceQuota{
+		WorkspaceID:    getWorkspace(c).ID,
+		MaxCollections: req.MaxCollections,
+		MaxIndexes:     req.MaxIndexes,
+		MaxDocuments:   req.MaxDocuments,
+		MaxBytes:       req.MaxBytes,
+	}
+	if err := ctrl.SQLiteCatalogService.SaveWorkspaceQuota(&quota); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// /api/admin/rate-limit
+func (ctrl *Controller) SetRateLimitHandler(c *gin.Context) {
+	var req SetRateLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SubjectType != models.RateLimitSubjectUser && req.SubjectType != models.RateLimitSubjectAPIKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subject_type must be one of user, api_key"})
+		return
+	}
+	if req.RequestsPerSecond < 0 || req.Burst < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rate limit values must not be negative"})
+		return
+	}
+
+	rateLimit := models.RateLimit{
+		SubjectType:       req.SubjectType,
+		SubjectID:         req.SubjectID,
+		RequestsPerSecond: req.RequestsPerSecond,
+		Burst:             req.Burst,
+	}
+	if err := ctrl.SQLiteCatalogService.SaveRateLimit(&rateLimit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditTarget(c, "%s:%d", req.SubjectType, req.SubjectID)
+
+	c.JSON(http.StatusOK, rateLimit)
+}
+
+// /api/admin/rate-limit/list
+func (ctrl *Controller) ListRateLimitsHandler(c *gin.Context) {
+	rateLimits, err := ctrl.SQLiteCatalogService.ListRateLimits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rateLimits)
+}
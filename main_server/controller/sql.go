@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sqlFormatJSON  = "json"
+	sqlFormatArrow = "arrow"
+
+	// sqlBatchRows là số dòng được ghi ra trước mỗi lần flush response, cũng là số dòng của một record batch Arrow
+	sqlBatchRows = 4096
+)
+
+type SQLRequest struct {
+	Query  string `json:"query" binding:"required"`
+	Format string `json:"format"` // json (mặc định) hoặc arrow
+}
+
+// /api/workspace/<workspace-id>/sql
+// Chạy câu lệnh SELECT trên một table của workspace, kết quả được trả về dần trong lúc đọc
+//   - json: {"columns": [...], "rows": [[...], ...], "stats": {...}}, date dạng YYYY-MM-DD, timestamp dạng RFC 3339,
+//     decimal dạng chuỗi và binary dạng base64. Nếu lỗi xảy ra sau khi đã trả về một phần kết quả, object có thêm key "error"
+//   - arrow: Arrow IPC stream, lỗi xảy ra trong lúc trả về được đặt trong trailer X-Error
+func (ctrl *Controller) SQLHandler(c *gin.Context) {
+	var req SQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = sqlFormatJSON
+	}
+	if req.Format != sqlFormatJSON && req.Format != sqlFormatArrow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or arrow"})
+		return
+	}
+
+	query, err := domain.PrepareSQL(ctrl.SQLiteCatalogService, ctrl.Storage, getWorkspace(c).ID, req.Query)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	if req.Format == sqlFormatArrow {
+		ctrl.writeSQLArrow(c, query)
+	} else {
+		ctrl.writeSQLJSON(c, query)
+	}
+}
+
+type SQLExecuteRequest struct {
+	Query string `json:"query" binding:"required"`
+}
+
+// /api/workspace/<workspace-id>/sql/execute
+// Chạy câu lệnh DELETE hoặc UPDATE trên một table của workspace, trả về số dòng bị ảnh hưởng và snapshot được tạo
+func (ctrl *Controller) SQLExecuteHandler(c *gin.Context) {
+	var req SQLExecuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := domain.ExecuteSQL(ctrl.SQLiteCatalogService, ctrl.Storage, getWorkspace(c).ID, req.Query)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "table:%d", result.TableID)
+	c.JSON(http.StatusOK, result)
+}
+
+func (ctrl *Controller) writeSQLJSON(c *gin.Context, query *domain.SQLQuery) {
+	columns := query.Columns()
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	header, _ := json.Marshal(columns)
+	c.Writer.WriteString(`{"columns":`)
+	c.Writer.Write(header)
+	c.Writer.WriteString(`,"rows":[`)
+
+	count := 0
+	row := make([]interface{}, len(columns))
+	stats, err := query.Run(func(values []interface{}) error {
+		for i, value := range values {
+			row[i] = sqlJSONValue(&columns[i], value)
+		}
+		encoded, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			c.Writer.WriteString(",")
+		}
+		if _, err := c.Writer.Write(encoded); err != nil {
+			return err
+		}
+		count++
+		if count%sqlBatchRows == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	c.Writer.WriteString(`]`)
+	if encoded, marshalErr := json.Marshal(stats); marshalErr == nil && stats != nil {
+		c.Writer.WriteString(`,"stats":`)
+		c.Writer.Write(encoded)
+	}
+	if err != nil {
+		log.Printf("SQL query failed after %d rows: %v", count, err)
+		encoded, _ := json.Marshal(err.Error())
+		c.Writer.WriteString(`,"error":`)
+		c.Writer.Write(encoded)
+	}
+	c.Writer.WriteString("}")
+}
+
+// sqlJSONValue chuyển giá trị SQL thành giá trị JSON
+func sqlJSONValue(column *domain.SQLColumn, value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		if column.Type == domain.SQLTypeDate {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339Nano)
+	case domain.SQLDecimal:
+		return v.String()
+	case float64:
+		// JSON không biểu diễn được NaN và vô cực
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return value
+}
+
+func (ctrl *Controller) writeSQLArrow(c *gin.Context, query *domain.SQLQuery) {
+	columns := query.Columns()
+	fields := make([]arrow.Field, len(columns))
+	for i := range columns {
+		fields[i] = arrow.Field{Name: columns[i].Name, Type: sqlArrowType(&columns[i]), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	c.Header("Content-Type", "application/vnd.apache.arrow.stream")
+	c.Header("Trailer", "X-Error")
+	c.Status(http.StatusOK)
+
+	writer := ipc.NewWriter(c.Writer, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator))
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	pending := 0
+	writeBatch := func() error {
+		record := builder.NewRecord()
+		defer record.Release()
+		pending = 0
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	_, err := query.Run(func(values []interface{}) error {
+		for i, value := range values {
+			appendSQLArrowValue(builder.Field(i), &columns[i], value)
+		}
+		pending++
+		if pending >= sqlBatchRows {
+			return writeBatch()
+		}
+		return nil
+	})
+	if err == nil && pending > 0 {
+		err = writeBatch()
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("SQL query failed while writing Arrow stream: %v", err)
+		c.Writer.Header().Set("X-Error", err.Error())
+	}
+}
+
+// sqlArrowType trả về kiểu Arrow của một cột kết quả, timestamp được trả về theo UTC
+func sqlArrowType(column *domain.SQLColumn) arrow.DataType {
+	switch column.Type {
+	case domain.SQLTypeBoolean:
+		return arrow.FixedWidthTypes.Boolean
+	case domain.SQLTypeInt64:
+		return arrow.PrimitiveTypes.Int64
+	case domain.SQLTypeDouble:
+		return arrow.PrimitiveTypes.Float64
+	case domain.SQLTypeDecimal:
+		return &arrow.Decimal128Type{Precision: int32(column.Precision), Scale: int32(column.Scale)}
+	case domain.SQLTypeString:
+		return arrow.BinaryTypes.String
+	case domain.SQLTypeBinary:
+		return arrow.BinaryTypes.Binary
+	case domain.SQLTypeDate:
+		return arrow.FixedWidthTypes.Date32
+	case domain.SQLTypeTimestamp:
+		return &arrow.TimestampType{Unit: sqlArrowTimeUnit(column.Unit), TimeZone: "UTC"}
+	}
+	return arrow.Null
+}
+
+func sqlArrowTimeUnit(unit string) arrow.TimeUnit {
+	switch unit {
+	case models.TimeUnitMillis:
+		return arrow.Millisecond
+	case models.TimeUnitNanos:
+		return arrow.Nanosecond
+	default:
+		return arrow.Microsecond
+	}
+}
+
+func appendSQLArrowValue(builder array.Builder, column *domain.SQLColumn, value interface{}) {
+	if value == nil {
+		builder.AppendNull()
+		return
+	}
+	switch b := builder.(type) {
+	case *array.BooleanBuilder:
+		b.Append(value.(bool))
+	case *array.Int64Builder:
+		b.Append(value.(int64))
+	case *array.Float64Builder:
+		b.Append(value.(float64))
+	case *array.Decimal128Builder:
+		b.Append(decimal128.FromBigInt(value.(domain.SQLDecimal).Unscaled))
+	case *array.StringBuilder:
+		b.Append(value.(string))
+	case *array.BinaryBuilder:
+		b.Append(value.([]byte))
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(value.(time.Time)))
+	case *array.TimestampBuilder:
+		t := value.(time.Time)
+		switch column.Unit {
+		case models.TimeUnitMillis:
+			b.Append(arrow.Timestamp(t.UnixMilli()))
+		case models.TimeUnitNanos:
+			b.Append(arrow.Timestamp(t.UnixNano()))
+		default:
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+		}
+	default:
+		builder.AppendNull()
+	}
+}
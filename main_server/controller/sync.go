@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateSyncRequest là khai báo một sync, collection và table là ID hoặc tên trong workspace
+type CreateSyncRequest struct {
+	Collection string            `json:"collection" binding:"required"`
+	Table      string            `json:"table" binding:"required"`
+	KeyColumn  string            `json:"key_column"` // Cột string nhận _key của document, mặc định là _key
+	Mapping    map[string]string `json:"mapping"`    // {"<cột>": "<đường dẫn trong document>"}, bỏ trống là làm phẳng document
+}
+
+// /api/workspace/<workspace-id>/sync/create
+// Đồng bộ liên tục document của collection sang table, ví dụ
+// {"collection": "users", "table": "users_olap", "mapping": {"city": "address.city", "age": "age"}}
+func (ctrl *Controller) CreateSyncHandler(c *gin.Context) {
+	var req CreateSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace := getWorkspace(c)
+	collection, ok := ctrl.findCollection(workspace.ID, req.Collection)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection not found"})
+		return
+	}
+	table, ok := ctrl.findTable(workspace.ID, req.Table)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Table not found"})
+		return
+	}
+
+	sync := models.CollectionSync{
+		WorkspaceID:  workspace.ID,
+		CollectionID: collection.ID,
+		TableID:      table.ID,
+		KeyColumn:    req.KeyColumn,
+	}
+	syncWrapper := domain.NewCollectionSyncWrapper(&sync, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := syncWrapper.CreateSync(table, req.Mapping); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "sync:%d", sync.ID)
+
+	c.JSON(http.StatusOK, sync)
+}
+
+// /api/workspace/<workspace-id>/sync/list
+func (ctrl *Controller) ListSyncsHandler(c *gin.Context) {
+	syncs, err := ctrl.SQLiteCatalogService.ListCollectionSyncsByWorkspace(getWorkspace(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, syncs)
+}
+
+// /api/workspace/<workspace-id>/sync/<sync-id>
+// Trả về sync kèm checkpoint, số thay đổi đã áp dụng, bị bỏ qua, chưa áp dụng và lỗi gần nhất
+func (ctrl *Controller) DescribeSyncHandler(c *gin.Context) {
+	sync, ok := ctrl.syncFromRequest(c)
+	if !ok {
+		return
+	}
+
+	status, err := domain.NewCollectionSyncWrapper(sync, ctrl.SQLiteCatalogService, ctrl.Storage).Status()
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// /api/workspace/<workspace-id>/sync/<sync-id>/drop
+// Dừng đồng bộ, dữ liệu đã được ghi vẫn nằm trong table
+func (ctrl *Controller) DropSyncHandler(c *gin.Context) {
+	sync, ok := ctrl.syncFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "sync:%d", sync.ID)
+
+	if err := domain.NewCollectionSyncWrapper(sync, ctrl.SQLiteCatalogService, ctrl.Storage).Drop(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// syncFromRequest lấy sync theo :sync-id trong route, sync phải thuộc workspace trong route
+// Nếu không hợp lệ, response lỗi đã được ghi và trả về false
+func (ctrl *Controller) syncFromRequest(c *gin.Context) (*models.CollectionSync, bool) {
+	syncID, err := strconv.Atoi(c.Param("sync-id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync ID"})
+		return nil, false
+	}
+	sync, err := ctrl.SQLiteCatalogService.GetCollectionSync(getWorkspace(c).ID, syncID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sync not found"})
+		return nil, false
+	}
+	return sync, true
+}
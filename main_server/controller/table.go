@@ -1 +1,379 @@
 package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateTableRequest struct {
+	Name         string                  `json:"name" binding:"required"`
+	Columns      []TableColumnRequest    `json:"columns" binding:"required"`
+	Compression  string                  `json:"compression"`    // snappy, zstd hoặc none, mặc định theo cấu hình
+	RowGroupSize int                     `json:"row_group_size"` // Số dòng tối đa của một row group, mặc định theo cấu hình
+	PartitionBy  []TablePartitionRequest `json:"partition_by"`
+	ClusterBy    string                  `json:"cluster_by"` // Cột dùng để sắp xếp dòng khi compaction
+}
+
+// TablePartitionRequest là khai báo một trường phân vùng, transform là identity (mặc định), day hoặc month
+type TablePartitionRequest struct {
+	Column    string `json:"column"`
+	Transform string `json:"transform"`
+}
+
+type AppendTableRequest struct {
+	Rows []map[string]interface{} `json:"rows"`
+}
+
+// TableColumnRequest là khai báo một cột, precision và scale dùng cho decimal, unit dùng cho timestamp
+type TableColumnRequest struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  bool   `json:"nullable"`
+	Precision int    `json:"precision"`
+	Scale     int    `json:"scale"`
+	Unit      string `json:"unit"` // millis, micros (mặc định) hoặc nanos
+}
+
+// /api/workspace/<workspace-id>/table/create
+func (ctrl *Controller) CreateTableHandler(c *gin.Context) {
+	var req CreateTableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	table := models.Table{
+		Name:         req.Name,
+		WorkspaceID:  getWorkspace(c).ID,
+		Columns:      make([]models.TableColumn, 0, len(req.Columns)),
+		Compression:  req.Compression,
+		RowGroupSize: req.RowGroupSize,
+		ClusterBy:    req.ClusterBy,
+	}
+	for _, field := range req.PartitionBy {
+		table.PartitionBy = append(table.PartitionBy, models.TablePartitionField{
+			Column:    field.Column,
+			Transform: field.Transform,
+		})
+	}
+	for _, column := range req.Columns {
+		table.Columns = append(table.Columns, models.TableColumn{
+			Name:      column.Name,
+			Type:      column.Type,
+			Nullable:  column.Nullable,
+			Precision: column.Precision,
+			Scale:     column.Scale,
+			Unit:      column.Unit,
+		})
+	}
+
+	tableWrapper := domain.NewTableWrapper(&table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := tableWrapper.CreateTable(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	c.JSON(http.StatusOK, table)
+}
+
+// /api/workspace/<workspace-id>/table/list
+func (ctrl *Controller) ListTablesHandler(c *gin.Context) {
+	tables, err := ctrl.SQLiteCatalogService.ListTablesByWorkspace(getWorkspace(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tables)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>
+// Trả về table kèm schema các cột, manifest các tệp đã commit, các phân vùng và số dòng còn trong buffer
+func (ctrl *Controller) DescribeTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+
+	files, err := ctrl.SQLiteCatalogService.ListTableFiles(table.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	table.Files = files
+	if len(table.PartitionBy) > 0 {
+		if table.Partitions, err = ctrl.SQLiteCatalogService.ListTablePartitions(table.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	table.BufferedRows = ctrl.ParquetService.BufferedRows(table.ID)
+
+	c.JSON(http.StatusOK, table)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/append
+// Body: {"rows": [{"<column>": <value>, ...}, ...]}
+// Các dòng được đưa vào buffer và chỉ được đọc thấy sau khi buffer được ghi ra tệp (khi đạt ngưỡng, theo chu kỳ hoặc gọi flush)
+func (ctrl *Controller) AppendTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	// Giữ nguyên số trong JSON để số nguyên lớn và decimal không bị mất chính xác
+	var req AppendTableRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rows must not be empty"})
+		return
+	}
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	result, err := tableWrapper.Append(req.Rows)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/flush
+// Ghi các dòng trong buffer ra tệp Parquet (mỗi phân vùng một tệp) và commit vào manifest
+func (ctrl *Controller) FlushTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	files, err := tableWrapper.Flush()
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flushed": files})
+}
+
+type AlterTableRequest struct {
+	AddColumns    []TableColumnRequest  `json:"add_columns"` // Các cột mới, phải nullable, được thêm vào cuối
+	WidenColumns  []ColumnTypeRequest   `json:"widen_columns"`
+	RenameColumns []ColumnRenameRequest `json:"rename_columns"`
+}
+
+type ColumnTypeRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // int64 cho cột int32, double cho cột float
+}
+
+type ColumnRenameRequest struct {
+	Name    string `json:"name"`
+	NewName string `json:"new_name"`
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/alter
+// Thay đổi schema của table mà không ghi lại dữ liệu: thêm cột nullable, nới kiểu int32 -> int64 và float -> double, đổi tên cột.
+// Các thay đổi trong một request được áp dụng cùng lúc và tạo một phiên bản schema mới
+func (ctrl *Controller) AlterTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	var req AlterTableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes := domain.SchemaChanges{}
+	for _, column := range req.AddColumns {
+		changes.AddColumns = append(changes.AddColumns, models.TableColumn{
+			Name:      column.Name,
+			Type:      column.Type,
+			Nullable:  column.Nullable,
+			Precision: column.Precision,
+			Scale:     column.Scale,
+			Unit:      column.Unit,
+		})
+	}
+	for _, widening := range req.WidenColumns {
+		changes.WidenColumns = append(changes.WidenColumns, domain.ColumnWidening{Name: widening.Name, Type: widening.Type})
+	}
+	for _, rename := range req.RenameColumns {
+		changes.RenameColumns = append(changes.RenameColumns, domain.ColumnRename{Name: rename.Name, NewName: rename.NewName})
+	}
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := tableWrapper.AlterSchema(changes); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+type CompactTableRequest struct {
+	TargetFileSize int64  `json:"target_file_size"` // Kích thước mong muốn (bytes) của tệp sau khi gộp, mặc định theo cấu hình
+	MinFiles       int    `json:"min_files"`        // Số tệp nhỏ tối thiểu trong một phân vùng để gộp, mặc định là 2
+	ClusterBy      string `json:"cluster_by"`       // Cột dùng để sắp xếp dòng, mặc định theo table
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/compact
+// Bắt đầu gộp các tệp nhỏ trong từng phân vùng của table trong nền, trả về lần compaction đang chạy.
+// Trạng thái được xem qua /compactions
+func (ctrl *Controller) CompactTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	var req CompactTableRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	compaction, err := tableWrapper.StartCompaction(domain.CompactionOptions{
+		TargetBytes: req.TargetFileSize,
+		MinFiles:    req.MinFiles,
+		ClusterBy:   req.ClusterBy,
+	})
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, compaction)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/compactions
+// Trạng thái compaction của table cùng các lần compaction gần nhất
+func (ctrl *Controller) TableCompactionsHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	status, err := tableWrapper.CompactionStatus()
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/snapshots
+// Liệt kê các snapshot còn lại của table, mới nhất trước
+func (ctrl *Controller) ListTableSnapshotsHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+
+	snapshots, err := ctrl.SQLiteCatalogService.ListTableSnapshots(table.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"current_snapshot_id": table.CurrentSnapshotID, "snapshots": snapshots})
+}
+
+type ExpireSnapshotsRequest struct {
+	OlderThan time.Time `json:"older_than" binding:"required"` // RFC 3339
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/snapshots/expire
+// Xóa các snapshot cũ hơn older_than và các tệp Parquet không còn thuộc snapshot nào.
+// Sau đó không thể đọc table AS OF các snapshot hoặc thời điểm trước older_than nữa
+func (ctrl *Controller) ExpireTableSnapshotsHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	var req ExpireSnapshotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	result, err := tableWrapper.ExpireSnapshots(req.OlderThan)
+	if err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/drop
+// Xóa hẳn table cùng toàn bộ dữ liệu, không thể khôi phục
+func (ctrl *Controller) DropTableHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d", table.ID)
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := tableWrapper.Drop(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// tableFromRequest lấy table theo :table-id trong route, table phải thuộc workspace trong route
+// :table-id có thể là ID hoặc tên của table trong workspace
+// Nếu không hợp lệ, response lỗi đã được ghi và trả về false
+func (ctrl *Controller) tableFromRequest(c *gin.Context) (*models.Table, bool) {
+	table, ok := ctrl.findTable(getWorkspace(c).ID, c.Param("table-id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Table not found"})
+		return nil, false
+	}
+	return table, true
+}
+
+// findTable tìm table của workspace theo ID hoặc tên
+func (ctrl *Controller) findTable(workspaceID int, ref string) (*models.Table, bool) {
+	var table *models.Table
+	var err error
+	if tableID, convErr := strconv.Atoi(ref); convErr == nil {
+		table, err = ctrl.SQLiteCatalogService.GetTableByID(tableID)
+	} else {
+		table, err = ctrl.SQLiteCatalogService.GetTableByName(workspaceID, ref)
+	}
+	if err != nil || table.WorkspaceID != workspaceID {
+		return nil, false
+	}
+	return table, true
+}
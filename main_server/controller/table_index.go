@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// /api/workspace/<workspace-id>/table/<table-id>/index/create
+type CreateTableIndexRequest struct {
+	IndexName string `json:"index_name" binding:"required"`
+	Column    string `json:"column" binding:"required"`
+	IndexType string `json:"index_type" binding:"required"` // Bloom Filter hoặc Zone Map
+}
+
+// CreateTableIndexHandler tạo index trên một cột của table. Index được ghi cho mọi tệp dữ liệu hiện có
+// trước khi trả về, SQL dùng index để bỏ qua các tệp không thể chứa dòng thỏa mãn WHERE
+func (ctrl *Controller) CreateTableIndexHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req CreateTableIndexRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Kiểm tra quota số index của workspace
+	quotaWrapper := domain.NewQuotaWrapper(table.WorkspaceID, ctrl.SQLiteCatalogService)
+	if err := quotaWrapper.CheckCreateIndex(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	index := models.Index{
+		Name:      req.IndexName,
+		Fields:    req.Column,
+		IndexType: req.IndexType,
+	}
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := tableWrapper.CreateIndex(&index); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "table:%d/index:%d", table.ID, index.ID)
+
+	c.JSON(http.StatusOK, index)
+}
+
+// /api/workspace/<workspace-id>/table/<table-id>/index/<index-id>/drop
+func (ctrl *Controller) DropTableIndexHandler(c *gin.Context) {
+	table, ok := ctrl.tableFromRequest(c)
+	if !ok {
+		return
+	}
+	index, ok := ctrl.tableIndexFromRequest(c, table)
+	if !ok {
+		return
+	}
+	setAuditTarget(c, "table:%d/index:%d", table.ID, index.ID)
+
+	tableWrapper := domain.NewTableWrapper(table, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := tableWrapper.DropIndex(index); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// tableIndexFromRequest lấy index theo :index-id trong route, index phải thuộc table
+// :index-id có thể là ID hoặc tên của index trong table
+// Nếu không hợp lệ, response lỗi đã được ghi và trả về false
+func (ctrl *Controller) tableIndexFromRequest(c *gin.Context, table *models.Table) (*models.Index, bool) {
+	param := c.Param("index-id")
+
+	var index *models.Index
+	var err error
+	if indexID, convErr := strconv.Atoi(param); convErr == nil {
+		index, err = ctrl.SQLiteCatalogService.GetIndexByID(indexID)
+	} else {
+		index, err = ctrl.SQLiteCatalogService.GetTableIndexByName(table.ID, param)
+	}
+	if err != nil || index.TableID != table.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Index not found"})
+		return nil, false
+	}
+
+	return index, true
+}
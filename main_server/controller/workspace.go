@@ -2,6 +2,7 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/dehuy69/mydp/main_server/domain"
 	"github.com/dehuy69/mydp/main_server/models"
@@ -9,8 +10,11 @@ import (
 )
 
 type CreateWorkspaceRequest struct {
-	Name   string `json:"name" binding:"required"`
-	UserID int    `json:"user_id" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+type RenameWorkspaceRequest struct {
+	Name string `json:"name" binding:"required"`
 }
 
 // Create workspace
@@ -21,21 +25,95 @@ func (ctrl *Controller) CreateWorkspaceHandler(c *gin.Context) {
 		return
 	}
 
-	// Get userID from JWT
-	// userID := c.MustGet("userID").(int)
+	// API key chỉ có quyền trong workspace của nó nên không được tạo workspace mới
+	principal := getPrincipal(c)
+	if principal.APIKey != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create workspaces"})
+		return
+	}
 
+	// Chủ sở hữu workspace là người gọi API
 	workspace := models.Workspace{
 		Name:    req.Name,
-		OwnerID: req.UserID,
+		OwnerID: principal.User.ID,
 	}
 
 	// workspace wrapper
-	workspaceWrapper := domain.NewWorkspaceWrapper(&workspace, ctrl.SQLiteCatalogService, ctrl.BadgerService)
+	workspaceWrapper := domain.NewWorkspaceWrapper(&workspace, ctrl.SQLiteCatalogService, ctrl.Storage)
 
 	if err := workspaceWrapper.CreateWorkspace(); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+	setAuditTarget(c, "workspace:%d", workspace.ID)
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// /api/workspace/list
+// Admin thấy tất cả workspace, người dùng khác thấy các workspace sở hữu hoặc được cấp quyền,
+// API key chỉ thấy workspace của nó
+func (ctrl *Controller) ListWorkspacesHandler(c *gin.Context) {
+	principal := getPrincipal(c)
+
+	var workspaces []models.Workspace
+	var err error
+	switch {
+	case principal.APIKey != nil:
+		var workspace *models.Workspace
+		workspace, err = ctrl.SQLiteCatalogService.GetWorkspaceByID(principal.APIKey.WorkspaceID)
+		if workspace != nil {
+			workspaces = []models.Workspace{*workspace}
+		}
+	case principal.User.Role == models.UserRoleAdmin:
+		workspaces, err = ctrl.SQLiteCatalogService.ListWorkspaces()
+	default:
+		workspaces, err = ctrl.SQLiteCatalogService.ListWorkspacesForUser(principal.User.ID)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// /api/workspace/<workspace-id>
+func (ctrl *Controller) GetWorkspaceHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, getWorkspace(c))
+}
+
+// /api/workspace/<workspace-id>/rename
+func (ctrl *Controller) RenameWorkspaceHandler(c *gin.Context) {
+	var req RenameWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace := getWorkspace(c)
+	workspaceWrapper := domain.NewWorkspaceWrapper(workspace, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := workspaceWrapper.Rename(req.Name); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, workspace)
 }
+
+// /api/workspace/<workspace-id>/delete
+// Workspace bị xóa mềm, dữ liệu được xóa hẳn bởi job workspace-purge sau thời gian chờ workspace_delete_grace_hours
+func (ctrl *Controller) DeleteWorkspaceHandler(c *gin.Context) {
+	workspace := getWorkspace(c)
+	workspaceWrapper := domain.NewWorkspaceWrapper(workspace, ctrl.SQLiteCatalogService, ctrl.Storage)
+	if err := workspaceWrapper.Delete(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "deleted",
+		"id":          workspace.ID,
+		"purge_after": strconv.Itoa(ctrl.config.WorkspaceDeleteGraceHours) + "h",
+	})
+}
@@ -2,7 +2,10 @@ package domain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 
 	"github.com/dehuy69/mydp/main_server/models"
 	service "github.com/dehuy69/mydp/main_server/service"
@@ -12,13 +15,14 @@ import (
 type CollectionWrapper struct {
 	SQLiteCatalogService *service.SQLiteCatalogService // Kết nối cơ sở dữ liệu
 	Collection           *models.Collection            // Chứa đối tượng Collection từ models
-	BadgerService        *service.BadgerService        // Kết nối cơ sở dữ liệu
-	BboltService         *service.BboltService         // Kết nối cơ sở dữ liệu
+	Storage              *service.Storage              // Các backend lưu trữ
+	Documents            service.DocumentStore         // Nơi lưu document, theo backend của collection
+	Indexes              service.IndexStore            // Nơi lưu index, theo backend của collection
 }
 
-// NewCollectionWrapper khởi tạo một instance mới của CollectionWrapper
-func NewCollectionWrapper(collection *models.Collection, SQLiteCatalogService *service.SQLiteCatalogService,
-	BadgerService *service.BadgerService, BboltService *service.BboltService) *CollectionWrapper {
+// NewCollectionWrapper khởi tạo một instance mới của CollectionWrapper, trả về lỗi nếu không đọc được collection
+// hoặc backend của collection không tồn tại. Với collection chưa có trong catalog, backend được chọn khi CreateCollection
+func NewCollectionWrapper(collection *models.Collection, SQLiteCatalogService *service.SQLiteCatalogService, storage *service.Storage) (*CollectionWrapper, error) {
 	// Kiểm tra tồn tại trước khi preload
 	fmt.Println("Collection ID:", collection.ID)
 	if collection.ID != 0 {
@@ -26,8 +30,7 @@ func NewCollectionWrapper(collection *models.Collection, SQLiteCatalogService *s
 		preload := SQLiteCatalogService.Db.Preload("Workspace").Preload("Indexes").Preload("Shards").First(collection)
 		err := preload.Error
 		if err != nil {
-			fmt.Println("Error preloading collection:", err)
-			return nil
+			return nil, fmt.Errorf("failed to load collection %d: %v", collection.ID, err)
 		}
 	} else {
 		fmt.Println("Collection ID is 0, không cần preload")
@@ -36,10 +39,15 @@ func NewCollectionWrapper(collection *models.Collection, SQLiteCatalogService *s
 	wrapper := CollectionWrapper{
 		SQLiteCatalogService: SQLiteCatalogService,
 		Collection:           collection,
-		BadgerService:        BadgerService,
-		BboltService:         BboltService,
+		Storage:              storage,
 	}
-	return &wrapper
+	// Backend của collection đã có trong catalog không tồn tại là lỗi cấu hình của server, không phải lỗi của request
+	if collection.ID != 0 {
+		if err := wrapper.useBackend(); err != nil {
+			return nil, fmt.Errorf("failed to select storage backend of collection %d: %v", collection.ID, err)
+		}
+	}
+	return &wrapper, nil
 }
 
 // Create Collection in catalog
@@ -50,6 +58,17 @@ func (cw *CollectionWrapper) CreateCollection() error {
 		return fmt.Errorf("failed to get server: %v", err)
 	}
 
+	if err := cw.checkName(cw.Collection.Name); err != nil {
+		return err
+	}
+
+	if cw.Collection.Backend == "" {
+		cw.Collection.Backend = models.StorageBackendBadger
+	}
+	if err := cw.useBackend(); err != nil {
+		return err
+	}
+
 	cw.Collection.ShardKey = "_key"
 
 	// Tạo collection trong catalog
@@ -76,8 +95,17 @@ func (cw *CollectionWrapper) CreateCollection() error {
 
 // Write dữ liệu vào collection với input là một map bất kỳ
 func (cw *CollectionWrapper) Write(input map[string]interface{}) error {
+	// Kiểm tra document với schema của collection và kiểu dữ liệu của các index
+	validation := cw.Validate(input)
+	if err := validation.Err(); err != nil {
+		return err
+	}
+	for _, warning := range validation.Warnings {
+		log.Printf("Schema validation warning in collection %d: %s", cw.Collection.ID, warning)
+	}
+
 	// Gọi GetByKey Kiểm tra _key trong input có tồn tại chưa, nếu có rồi thì gọi qua update để cập nhật dữ liệu
-	_, err := cw.BadgerService.Get([]byte(cw.CreateBadgerKey(input["_key"].(string))))
+	_, err := cw.Documents.Get([]byte(cw.CreateBadgerKey(input["_key"].(string))))
 	if err == nil {
 		// Nếu không có lỗi, tức là đã tồn tại dữ liệu, gọi qua update
 		return fmt.Errorf("record already exists")
@@ -85,61 +113,207 @@ func (cw *CollectionWrapper) Write(input map[string]interface{}) error {
 
 	// write index
 	// Tìm	tất cả các index của collection
+	// Nếu một index hoặc Badger ghi lỗi, các index đã ghi được hoàn tác để không để lại key mồ côi
+	applied := make([]*IndexWrapper, 0, len(cw.Collection.Indexes))
 	for _, index := range cw.Collection.Indexes {
 		// Tạo một instance của IndexWrapper
-		indexWrapper := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.BadgerService, cw.BboltService)
-		err := indexWrapper.InsertWithCheckingStatus(input)
+		indexWrapper, err := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.Storage)
+		if err != nil {
+			rollbackIndexes(applied, func(iw *IndexWrapper) error { return iw.Remove(input) })
+			return err
+		}
+		err = indexWrapper.InsertWithCheckingStatus(input)
 		if err != nil {
 			fmt.Println("DEBUG (cw *CollectionWrapper) Write ", err)
+			rollbackIndexes(applied, func(iw *IndexWrapper) error { return iw.Remove(input) })
 			return fmt.Errorf("failed to insert record into index: %v", err)
 		}
-
+		applied = append(applied, indexWrapper)
 	}
 
 	// Ghi dữ liệu vào badger
-	error := cw.writeData(input)
-	if error != nil {
-		return error
+	written, err := cw.writeData(input)
+	if err != nil {
+		if !written {
+			rollbackIndexes(applied, func(iw *IndexWrapper) error { return iw.Remove(input) })
+		}
+		return err
 	}
 
 	return nil
 }
 
-func (cw *CollectionWrapper) writeData(input map[string]interface{}) error {
+// rollbackIndexes hoàn tác thay đổi trên các index đã ghi khi một lần ghi bị lỗi
+// Lỗi khi hoàn tác chỉ được log, index lệch với dữ liệu có thể được sửa bằng verify/repair
+func rollbackIndexes(applied []*IndexWrapper, undo func(iw *IndexWrapper) error) {
+	for _, indexWrapper := range applied {
+		if err := undo(indexWrapper); err != nil {
+			log.Printf("Failed to roll back index %d: %v", indexWrapper.Index.ID, err)
+		}
+	}
+}
+
+// writeData ghi document vào Badger và cập nhật mức sử dụng của collection
+// written cho biết document đã được ghi vào Badger chưa, để caller biết có cần hoàn tác index không
+func (cw *CollectionWrapper) writeData(input map[string]interface{}) (written bool, err error) {
 	// Lấy giá trị của trường `_key` từ input map
 	keyField, ok := input["_key"]
 	if !ok {
-		return fmt.Errorf("input map must contain a '_key' field")
+		return false, fmt.Errorf("input map must contain a '_key' field")
 	}
 
 	// Chuyển đổi input map thành chuỗi JSON
 	valueBytes, err := json.Marshal(input)
 	if err != nil {
-		return fmt.Errorf("failed to marshal input map to JSON: %v", err)
+		return false, fmt.Errorf("failed to marshal input map to JSON: %v", err)
 	}
 
 	// Ghi dữ liệu vào Badger với key và value
 	keyFieldStr, ok := keyField.(string)
 	if !ok {
-		return fmt.Errorf("keyField must be a string")
+		return false, fmt.Errorf("keyField must be a string")
 	}
-	err = cw.BadgerService.Set([]byte(cw.CreateBadgerKey(keyFieldStr)), valueBytes)
+	err = cw.writeWithChange(ChangeOpUpsert, keyFieldStr, input, service.DocumentWrite{Key: []byte(cw.CreateBadgerKey(keyFieldStr)), Value: valueBytes})
 	if err != nil {
-		return fmt.Errorf("failed to write data to Badger: %v", err)
+		return false, fmt.Errorf("failed to write document: %v", err)
 	}
 
+	// Cập nhật mức sử dụng của collection, dùng cho quota và usage của workspace
+	err = cw.SQLiteCatalogService.IncrementCollectionUsage(cw.Collection.ID, 1, int64(len(valueBytes)))
+	if err != nil {
+		return true, fmt.Errorf("failed to update collection usage: %v", err)
+	}
+
+	return true, nil
+}
+
+// Update ghi đè document đã tồn tại với cùng _key, các index được cập nhật theo giá trị cũ và mới
+// Document có thể đi vào hoặc ra khỏi partial index khi giá trị thay đổi
+func (cw *CollectionWrapper) Update(input map[string]interface{}) error {
+	validation := cw.Validate(input)
+	if err := validation.Err(); err != nil {
+		return err
+	}
+	for _, warning := range validation.Warnings {
+		log.Printf("Schema validation warning in collection %d: %s", cw.Collection.ID, warning)
+	}
+
+	// Index đang build chỉ nhận document mới qua cache, không thể cập nhật
+	if cw.hasBuildingIndex() {
+		return ErrIndexBuilding
+	}
+
+	key := input["_key"].(string)
+	oldBytes, err := cw.Documents.Get([]byte(cw.CreateBadgerKey(key)))
+	if errors.Is(err, service.ErrKeyNotFound) {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read document: %v", err)
+	}
+	var oldInput map[string]interface{}
+	if err := json.Unmarshal(oldBytes, &oldInput); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON to map: %v", err)
+	}
+
+	// Kiểm tra ràng buộc trước khi thay đổi index
+	if err := cw.CheckIndexConstraints(input); err != nil {
+		return err
+	}
+
+	valueBytes, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input map to JSON: %v", err)
+	}
+
+	// Nếu một index hoặc Badger ghi lỗi, các index đã cập nhật được đưa về giá trị cũ
+	undo := func(iw *IndexWrapper) error { return iw.Update(input, oldInput) }
+	applied := make([]*IndexWrapper, 0, len(cw.Collection.Indexes))
+	for _, index := range cw.Collection.Indexes {
+		indexWrapper, err := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.Storage)
+		if err != nil {
+			rollbackIndexes(applied, undo)
+			return err
+		}
+		if err := indexWrapper.Update(oldInput, input); err != nil {
+			rollbackIndexes(append(applied, indexWrapper), undo)
+			return fmt.Errorf("failed to update index %s: %v", index.Name, err)
+		}
+		applied = append(applied, indexWrapper)
+	}
+
+	err = cw.writeWithChange(ChangeOpUpsert, key, input, service.DocumentWrite{Key: []byte(cw.CreateBadgerKey(key)), Value: valueBytes})
+	if err != nil {
+		rollbackIndexes(applied, undo)
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+
+	err = cw.SQLiteCatalogService.IncrementCollectionUsage(cw.Collection.ID, 0, int64(len(valueBytes)-len(oldBytes)))
+	if err != nil {
+		return fmt.Errorf("failed to update collection usage: %v", err)
+	}
+	return nil
+}
+
+// Delete xóa document với key khỏi collection và khỏi các index
+func (cw *CollectionWrapper) Delete(key string) error {
+	// Index đang build nhận document qua cache, không thể xóa document khỏi index đó
+	if cw.hasBuildingIndex() {
+		return ErrIndexBuilding
+	}
+
+	oldBytes, err := cw.Documents.Get([]byte(cw.CreateBadgerKey(key)))
+	if errors.Is(err, service.ErrKeyNotFound) {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read document: %v", err)
+	}
+	var oldInput map[string]interface{}
+	if err := json.Unmarshal(oldBytes, &oldInput); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON to map: %v", err)
+	}
+
+	// Nếu một index hoặc Badger xóa lỗi, document được thêm lại vào các index đã xóa
+	undo := func(iw *IndexWrapper) error { return iw.InsertWithCheckingStatus(oldInput) }
+	applied := make([]*IndexWrapper, 0, len(cw.Collection.Indexes))
+	for _, index := range cw.Collection.Indexes {
+		indexWrapper, err := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.Storage)
+		if err != nil {
+			rollbackIndexes(applied, undo)
+			return err
+		}
+		if err := indexWrapper.Remove(oldInput); err != nil {
+			rollbackIndexes(applied, undo)
+			return fmt.Errorf("failed to remove document from index %s: %v", index.Name, err)
+		}
+		applied = append(applied, indexWrapper)
+	}
+
+	err = cw.writeWithChange(ChangeOpDelete, key, nil, service.DocumentWrite{Key: []byte(cw.CreateBadgerKey(key)), Delete: true})
+	if err != nil {
+		rollbackIndexes(applied, undo)
+		return fmt.Errorf("failed to delete document: %v", err)
+	}
+
+	if err := cw.SQLiteCatalogService.IncrementCollectionUsage(cw.Collection.ID, -1, -int64(len(oldBytes))); err != nil {
+		return fmt.Errorf("failed to update collection usage: %v", err)
+	}
 	return nil
 }
 
 // Read đọc dữ liệu từ collection với key
 func (cw *CollectionWrapper) Read(key string) (map[string]interface{}, error) {
 	// Tạo key bằng cách kết hợp ID collection và key
-	combinedKey := fmt.Sprintf("%d_%v", cw.Collection.ID, key)
+	combinedKey := cw.CreateBadgerKey(key)
 
 	// Đọc dữ liệu từ Badger với key
-	valueBytes, err := cw.BadgerService.Get([]byte(combinedKey))
+	valueBytes, err := cw.Documents.Get([]byte(combinedKey))
+	if errors.Is(err, service.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, key)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read data from Badger: %v", err)
+		return nil, fmt.Errorf("failed to read document: %v", err)
 	}
 
 	// Chuyển đổi chuỗi JSON thành map
@@ -151,6 +325,18 @@ func (cw *CollectionWrapper) Read(key string) (map[string]interface{}, error) {
 	return valueMap, nil
 }
 
+// DocumentSize trả về kích thước (bytes) của document với key như được lưu trong collection
+func (cw *CollectionWrapper) DocumentSize(key string) (int64, error) {
+	valueBytes, err := cw.Documents.Get([]byte(cw.CreateBadgerKey(key)))
+	if errors.Is(err, service.ErrKeyNotFound) {
+		return 0, fmt.Errorf("%w: %s", ErrDocumentNotFound, key)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read document: %v", err)
+	}
+	return int64(len(valueBytes)), nil
+}
+
 // Function kiểm tra dữ liệu ghi vào collection có thỏa các ràng buộc của index
 func (cw *CollectionWrapper) CheckIndexConstraints(input map[string]interface{}) error {
 	// Tìm tất cả các index của collection có is_unique = true
@@ -169,8 +355,11 @@ func (cw *CollectionWrapper) CheckIndexConstraints(input map[string]interface{})
 	// Kiểm tra ràng buộc của từng index
 	for _, index := range uniqueIndexes {
 		// Tạo wrapper cho index
-		indexWrapper := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.BadgerService, cw.BboltService)
-		err := indexWrapper.CheckIndexConstraints(input)
+		indexWrapper, err := NewIndexWrapper(&index, cw.SQLiteCatalogService, cw.Storage)
+		if err != nil {
+			return err
+		}
+		err = indexWrapper.CheckIndexConstraints(input)
 		if err != nil {
 			return err
 		}
@@ -179,6 +368,123 @@ func (cw *CollectionWrapper) CheckIndexConstraints(input map[string]interface{})
 	return nil
 }
 
+// ErrDocumentNotFound được trả về khi không tìm thấy document với key
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrIndexBuilding được trả về khi thao tác không thể thực hiện trong lúc có index đang build
+var ErrIndexBuilding = errors.New("collection has an index being built")
+
+// CollectionStats chứa số document và dung lượng của collection
+type CollectionStats struct {
+	DocumentCount int64 `json:"document_count"`
+	ByteSize      int64 `json:"byte_size"`
+}
+
+// Stats trả về số document và dung lượng của collection
+// Mặc định dùng bộ đếm trong catalog, nếu exact = true thì đếm lại từ DocumentStore và cập nhật bộ đếm
+func (cw *CollectionWrapper) Stats(exact bool) (*CollectionStats, error) {
+	if !exact {
+		return &CollectionStats{DocumentCount: cw.Collection.DocumentCount, ByteSize: cw.Collection.ByteSize}, nil
+	}
+
+	count, size, err := cw.Documents.PrefixStats([]byte(cw.CreateBadgerKey("")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan collection data: %v", err)
+	}
+	if err := cw.SQLiteCatalogService.SetCollectionUsage(cw.Collection.ID, count, size); err != nil {
+		return nil, fmt.Errorf("failed to update collection usage: %v", err)
+	}
+	cw.Collection.DocumentCount, cw.Collection.ByteSize = count, size
+
+	return &CollectionStats{DocumentCount: count, ByteSize: size}, nil
+}
+
+// Rename đổi tên collection, dữ liệu và cache của index đang build nằm theo ID nên không bị ảnh hưởng
+func (cw *CollectionWrapper) Rename(name string) error {
+	if err := cw.checkName(name); err != nil {
+		return err
+	}
+	return cw.SQLiteCatalogService.RenameCollection(cw.Collection, name)
+}
+
+// checkName kiểm tra tên collection hợp lệ và chưa được dùng trong workspace
+func (cw *CollectionWrapper) checkName(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	existing, err := cw.SQLiteCatalogService.GetCollectionByName(cw.Collection.WorkspaceID, name)
+	if err == nil && existing.ID != cw.Collection.ID {
+		return fmt.Errorf("%w: collection %s already exists in workspace", ErrNameConflict, name)
+	}
+	return nil
+}
+
+// Truncate xóa tất cả document của collection và làm rỗng các index, giữ lại định nghĩa collection và index
+func (cw *CollectionWrapper) Truncate() error {
+	if cw.hasBuildingIndex() {
+		return ErrIndexBuilding
+	}
+
+	if err := cw.truncateWithChange(); err != nil {
+		return fmt.Errorf("failed to drop collection data: %v", err)
+	}
+
+	for i := range cw.Collection.Indexes {
+		if err := cw.Indexes.ClearIndex(&cw.Collection.Indexes[i]); err != nil {
+			return fmt.Errorf("failed to clear index %s: %v", cw.Collection.Indexes[i].Name, err)
+		}
+	}
+
+	if err := cw.SQLiteCatalogService.SetCollectionUsage(cw.Collection.ID, 0, 0); err != nil {
+		return fmt.Errorf("failed to reset collection usage: %v", err)
+	}
+	cw.Collection.DocumentCount, cw.Collection.ByteSize = 0, 0
+	return nil
+}
+
+// Drop xóa collection: xóa dữ liệu, file index và xóa collection cùng shard, index khỏi catalog
+func (cw *CollectionWrapper) Drop() error {
+	if err := cw.DeleteStorage(); err != nil {
+		return err
+	}
+	if err := cw.SQLiteCatalogService.HardDeleteCollection(cw.Collection.ID); err != nil {
+		return fmt.Errorf("failed to delete collection from catalog: %v", err)
+	}
+	return nil
+}
+
+// hasBuildingIndex kiểm tra collection có index đang ở trạng thái building không
+func (cw *CollectionWrapper) hasBuildingIndex() bool {
+	for _, index := range cw.Collection.Indexes {
+		if index.Status == models.IndexStatusBuilding {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteStorage xóa toàn bộ dữ liệu của collection: document, change log, dữ liệu của các index và cache của index
+// Catalog không bị thay đổi
+func (cw *CollectionWrapper) DeleteStorage() error {
+	if err := cw.Documents.DropPrefix([]byte(cw.CreateBadgerKey(""))); err != nil {
+		return fmt.Errorf("failed to drop collection data: %v", err)
+	}
+	if err := cw.DropChanges(); err != nil {
+		return fmt.Errorf("failed to drop collection change log: %v", err)
+	}
+
+	for i := range cw.Collection.Indexes {
+		if err := cw.Indexes.DeleteIndex(&cw.Collection.Indexes[i]); err != nil {
+			return fmt.Errorf("failed to delete index %s: %v", cw.Collection.Indexes[i].Name, err)
+		}
+	}
+
+	if err := os.RemoveAll(collectionCacheDir(cw.Collection.ID)); err != nil {
+		return fmt.Errorf("failed to delete index cache: %v", err)
+	}
+	return nil
+}
+
 // Tạo key badger
 func (cw *CollectionWrapper) CreateBadgerKey(inputKey string) string {
 	return fmt.Sprintf("%d||%v", cw.Collection.ID, inputKey)
@@ -186,6 +492,6 @@ func (cw *CollectionWrapper) CreateBadgerKey(inputKey string) string {
 
 // Kiểm tra exist key
 func (cw *CollectionWrapper) ExistKey(inputKey string) bool {
-	_, err := cw.BadgerService.Get([]byte(cw.CreateBadgerKey(inputKey)))
+	_, err := cw.Documents.Get([]byte(cw.CreateBadgerKey(inputKey)))
 	return err == nil
 }
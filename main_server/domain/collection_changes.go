@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+const (
+	// ChangeOpUpsert là thay đổi ghi mới hoặc cập nhật một document
+	ChangeOpUpsert = "upsert"
+	// ChangeOpDelete là thay đổi xóa một document
+	ChangeOpDelete = "delete"
+	// ChangeOpTruncate là thay đổi xóa tất cả document của collection
+	ChangeOpTruncate = "truncate"
+)
+
+// DocumentChange là một thay đổi document được ghi lại trong change log của collection
+type DocumentChange struct {
+	Seq      int64           `json:"seq"`                // Số thứ tự của thay đổi, tăng dần trong collection
+	Op       string          `json:"op"`                 // upsert, delete hoặc truncate
+	Key      string          `json:"key,omitempty"`      // _key của document, rỗng với truncate
+	Document json.RawMessage `json:"document,omitempty"` // Nội dung document sau khi ghi, chỉ có với upsert
+}
+
+// changeLogPrefix là prefix của các thay đổi của collection trong DocumentStore
+// Khác với prefix của document (<id>||), nên change log không bị tính vào số document hay bị truncate cùng document
+func (cw *CollectionWrapper) changeLogPrefix() string {
+	return fmt.Sprintf("%d|changes|", cw.Collection.ID)
+}
+
+// changeLogKey tạo key của thay đổi, số thứ tự có độ dài cố định để các thay đổi được duyệt theo thứ tự
+func (cw *CollectionWrapper) changeLogKey(seq int64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", cw.changeLogPrefix(), seq))
+}
+
+// changeLocks giữ khóa ghi của mỗi collection theo ID, xem writeWithChange
+var changeLocks sync.Map
+
+// lockChanges giữ khóa ghi của collection và trả về hàm mở khóa
+func (cw *CollectionWrapper) lockChanges() func() {
+	lock, _ := changeLocks.LoadOrStore(cw.Collection.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// writeWithChange ghi document cùng thay đổi trong một transaction của DocumentStore, trong lúc giữ khóa ghi của collection.
+// Nhờ vậy thứ tự số của các thay đổi trùng với thứ tự ghi document: sync không thấy thay đổi N+1 trước khi thay đổi N
+// được ghi (và bỏ qua N mãi mãi), các lần ghi cùng một key cũng được áp dụng theo đúng thứ tự.
+// Cờ change log được đọc lại từ catalog trong lúc giữ khóa vì sync có thể được tạo sau khi wrapper được tải
+func (cw *CollectionWrapper) writeWithChange(op, key string, document map[string]interface{}, write service.DocumentWrite) error {
+	defer cw.lockChanges()()
+
+	writes := []service.DocumentWrite{write}
+	change, err := cw.changeWrite(op, key, document)
+	if err != nil {
+		return err
+	}
+	if change != nil {
+		writes = append(writes, *change)
+	}
+	return cw.Documents.WriteBatch(writes)
+}
+
+// truncateWithChange xóa tất cả document rồi ghi lại thay đổi truncate, trong lúc giữ khóa ghi của collection.
+// DropPrefix không chạy được trong transaction nên nếu ghi thay đổi lỗi, lỗi được trả về để Truncate được gọi lại:
+// lần gọi sau không còn document để xóa và ghi lại thay đổi
+func (cw *CollectionWrapper) truncateWithChange() error {
+	defer cw.lockChanges()()
+
+	change, err := cw.changeWrite(ChangeOpTruncate, "", nil)
+	if err != nil {
+		return err
+	}
+	if err := cw.Documents.DropPrefix([]byte(cw.CreateBadgerKey(""))); err != nil {
+		return err
+	}
+	if change == nil {
+		return nil
+	}
+	if err := cw.Documents.WriteBatch([]service.DocumentWrite{*change}); err != nil {
+		return fmt.Errorf("failed to record truncate in change log: %v", err)
+	}
+	return nil
+}
+
+// changeWrite tạo thao tác ghi thay đổi vào change log, trả về nil nếu collection không có sync đọc change log
+// Phải được gọi khi đang giữ khóa ghi của collection
+func (cw *CollectionWrapper) changeWrite(op, key string, document map[string]interface{}) (*service.DocumentWrite, error) {
+	changeLog, err := cw.SQLiteCatalogService.GetCollectionChangeLog(cw.Collection.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change log flag of collection %d: %v", cw.Collection.ID, err)
+	}
+	cw.Collection.ChangeLog = changeLog
+	if !changeLog {
+		return nil, nil
+	}
+
+	change := DocumentChange{Op: op, Key: key}
+	if document != nil {
+		raw, err := json.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		change.Document = raw
+	}
+	seq, err := cw.SQLiteCatalogService.NextCollectionChangeSeq(cw.Collection.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change sequence of collection %d: %v", cw.Collection.ID, err)
+	}
+	change.Seq = seq
+	value, err := json.Marshal(change)
+	if err != nil {
+		return nil, err
+	}
+	return &service.DocumentWrite{Key: cw.changeLogKey(seq), Value: value}, nil
+}
+
+// ReadChanges đọc tối đa limit thay đổi có số thứ tự lớn hơn after, theo thứ tự ghi
+// Số trong document được giữ dạng json.Number để số nguyên lớn không bị mất chính xác
+func (cw *CollectionWrapper) ReadChanges(after int64, limit int) ([]DocumentChange, error) {
+	prefix := cw.changeLogPrefix()
+	var changes []DocumentChange
+	err := cw.Documents.ScanPrefix([]byte(prefix), func(key, value []byte) (bool, error) {
+		seq, err := strconv.ParseInt(string(key[len(prefix):]), 10, 64)
+		if err != nil || seq <= after {
+			return true, nil
+		}
+		var change DocumentChange
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&change); err != nil {
+			return false, fmt.Errorf("failed to decode change %d: %v", seq, err)
+		}
+		changes = append(changes, change)
+		return len(changes) < limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// TrimChanges xóa các thay đổi có số thứ tự không lớn hơn upTo, dùng khi mọi sync đã áp dụng các thay đổi đó
+func (cw *CollectionWrapper) TrimChanges(upTo int64) error {
+	prefix := cw.changeLogPrefix()
+	var keys [][]byte
+	err := cw.Documents.ScanPrefix([]byte(prefix), func(key, value []byte) (bool, error) {
+		seq, err := strconv.ParseInt(string(key[len(prefix):]), 10, 64)
+		if err == nil && seq > upTo {
+			return false, nil
+		}
+		keys = append(keys, append([]byte(nil), key...))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := cw.Documents.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropChanges xóa toàn bộ change log của collection
+func (cw *CollectionWrapper) DropChanges() error {
+	return cw.Documents.DropPrefix([]byte(cw.changeLogPrefix()))
+}
@@ -0,0 +1,533 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+var (
+	// ErrInvalidSync được trả về khi cấu hình sync không hợp lệ
+	ErrInvalidSync = errors.New("invalid sync")
+	// ErrSyncConflict được trả về khi table đích đã nhận dữ liệu từ một sync khác
+	ErrSyncConflict = errors.New("table already has a sync")
+)
+
+// defaultSyncBatchSize là số thay đổi tối đa trong một lô khi không được cấu hình
+const defaultSyncBatchSize = 10000
+
+// CollectionSyncWrapper là struct bọc để thêm các phương thức vào CollectionSync
+type CollectionSyncWrapper struct {
+	SQLiteCatalogService *service.SQLiteCatalogService
+	Sync                 *models.CollectionSync
+	Storage              *service.Storage
+}
+
+// NewCollectionSyncWrapper khởi tạo một instance mới của CollectionSyncWrapper
+func NewCollectionSyncWrapper(sync *models.CollectionSync, SQLiteCatalogService *service.SQLiteCatalogService, storage *service.Storage) *CollectionSyncWrapper {
+	return &CollectionSyncWrapper{
+		SQLiteCatalogService: SQLiteCatalogService,
+		Sync:                 sync,
+		Storage:              storage,
+	}
+}
+
+// CreateSync kiểm tra cấu hình rồi tạo sync trong catalog và bật change log của collection
+// KeyColumn rỗng là cột _key, cột này phải có kiểu string. Mỗi cột trong mapping phải là cột của table
+// và khác KeyColumn. Các document có sẵn được sao chép vào table ở lần chạy đầu tiên của sync
+func (sw *CollectionSyncWrapper) CreateSync(table *models.Table, mapping map[string]string) error {
+	if sw.Sync.KeyColumn == "" {
+		sw.Sync.KeyColumn = "_key"
+	}
+	index := columnIndex(table.Columns, sw.Sync.KeyColumn)
+	if index < 0 {
+		return fmt.Errorf("%w: key column %s does not exist in table %s", ErrInvalidSync, sw.Sync.KeyColumn, table.Name)
+	}
+	if table.Columns[index].Type != models.ColumnTypeString {
+		return fmt.Errorf("%w: key column %s must be of type string", ErrInvalidSync, sw.Sync.KeyColumn)
+	}
+	for column, path := range mapping {
+		if columnIndex(table.Columns, column) < 0 {
+			return fmt.Errorf("%w: mapped column %s does not exist in table %s", ErrInvalidSync, column, table.Name)
+		}
+		if column == sw.Sync.KeyColumn {
+			return fmt.Errorf("%w: key column %s is filled with the document key and cannot be mapped", ErrInvalidSync, column)
+		}
+		if path == "" {
+			return fmt.Errorf("%w: mapped column %s has an empty path", ErrInvalidSync, column)
+		}
+	}
+	sw.Sync.Mapping = nil
+	if len(mapping) > 0 {
+		raw, err := json.Marshal(mapping)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSync, err)
+		}
+		sw.Sync.Mapping = raw
+	}
+
+	err := sw.SQLiteCatalogService.CreateCollectionSync(sw.Sync)
+	if errors.Is(err, service.ErrTableAlreadySynced) {
+		return fmt.Errorf("%w: table %s", ErrSyncConflict, table.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create sync in catalog: %v", err)
+	}
+	return nil
+}
+
+// Drop xóa sync khỏi catalog, dữ liệu đã đồng bộ vẫn nằm trong table
+// Change log của collection bị xóa nếu không còn sync nào đọc từ nó
+func (sw *CollectionSyncWrapper) Drop() error {
+	if err := sw.SQLiteCatalogService.DeleteCollectionSync(sw.Sync); err != nil {
+		return fmt.Errorf("failed to delete sync from catalog: %v", err)
+	}
+	return dropUnusedChangeLog(sw.SQLiteCatalogService, sw.Storage, sw.Sync.CollectionID)
+}
+
+// dropUnusedChangeLog xóa change log của collection nếu không còn sync nào đọc từ nó
+func dropUnusedChangeLog(catalog *service.SQLiteCatalogService, storage *service.Storage, collectionID int) error {
+	remaining, err := catalog.ListCollectionSyncs(collectionID)
+	if err != nil || len(remaining) > 0 {
+		return err
+	}
+	collection, err := catalog.GetCollectionByID(collectionID)
+	if err != nil {
+		return nil
+	}
+	cw, err := NewCollectionWrapper(collection, catalog, storage)
+	if err != nil {
+		return err
+	}
+	if err := cw.DropChanges(); err != nil {
+		return fmt.Errorf("failed to drop change log of collection %d: %v", collectionID, err)
+	}
+	return nil
+}
+
+// Status điền số thay đổi chưa được áp dụng vào sync
+// Trước lần sao chép đầu tiên, đó là số document của collection
+func (sw *CollectionSyncWrapper) Status() (*models.CollectionSync, error) {
+	collection, err := sw.SQLiteCatalogService.GetCollectionByID(sw.Sync.CollectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %v", err)
+	}
+	if sw.Sync.Loaded {
+		sw.Sync.PendingChanges = collection.ChangeSeq - sw.Sync.Checkpoint
+	} else {
+		sw.Sync.PendingChanges = collection.DocumentCount
+	}
+	return sw.Sync, nil
+}
+
+// Run áp dụng các thay đổi của collection vào table theo từng lô tới khi hết thay đổi, mỗi lô là một snapshot của table.
+// Lần chạy đầu tiên sao chép toàn bộ document có sẵn thay cho dữ liệu của table.
+// Ghi mới và cập nhật document được ghi đè theo _key: các tệp chứa dòng của key bị ghi lại không có dòng đó (copy-on-write)
+// rồi dòng mới được ghi vào tệp mới, nên áp dụng lại một lô là an toàn nếu server dừng trước khi lưu checkpoint.
+// Sync dùng chung khóa với compaction của table, nếu table đang được compaction thì lần chạy bị bỏ qua
+func (sw *CollectionSyncWrapper) Run(batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = defaultSyncBatchSize
+	}
+	collection, err := sw.SQLiteCatalogService.GetCollectionByID(sw.Sync.CollectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get collection %d: %v", sw.Sync.CollectionID, err)
+	}
+	cw, err := NewCollectionWrapper(collection, sw.SQLiteCatalogService, sw.Storage)
+	if err != nil {
+		return err
+	}
+	mapping := make(map[string]string)
+	if len(sw.Sync.Mapping) > 0 {
+		if err := json.Unmarshal(sw.Sync.Mapping, &mapping); err != nil {
+			return fmt.Errorf("invalid mapping of sync %d: %v", sw.Sync.ID, err)
+		}
+	}
+
+	if !sw.Storage.Tables.TryLockCompaction(sw.Sync.TableID) {
+		return nil
+	}
+	defer sw.Storage.Tables.UnlockCompaction(sw.Sync.TableID)
+
+	// Table được đọc khi đang giữ khóa, snapshot hiện tại là gốc của các commit của lần chạy
+	table, err := sw.SQLiteCatalogService.GetTableByID(sw.Sync.TableID)
+	if err != nil {
+		return fmt.Errorf("failed to get table %d: %v", sw.Sync.TableID, err)
+	}
+
+	err = func() error {
+		if !sw.Sync.Loaded {
+			if err := sw.load(cw, table, mapping, batchSize); err != nil {
+				return err
+			}
+		}
+		for {
+			changes, err := cw.ReadChanges(sw.Sync.Checkpoint, batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to read changes of collection %d: %v", collection.ID, err)
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+			if err := sw.apply(table, mapping, changes); err != nil {
+				return err
+			}
+			if len(changes) < batchSize {
+				return nil
+			}
+		}
+	}()
+
+	sw.Sync.LastError = ""
+	if err != nil {
+		sw.Sync.LastError = err.Error()
+	}
+	if saveErr := sw.SQLiteCatalogService.UpdateCollectionSync(sw.Sync); saveErr != nil && err == nil {
+		err = fmt.Errorf("failed to save sync %d: %v", sw.Sync.ID, saveErr)
+	}
+	return err
+}
+
+// load thay toàn bộ dữ liệu của table bằng các document đang có của collection
+// Checkpoint là thay đổi cuối cùng trước khi đọc, các thay đổi trong lúc đọc được áp dụng lại ở lô sau.
+// Checkpoint được đọc trong lúc giữ khóa ghi của collection: các lần ghi đang chạy với cờ change log cũ đã kết thúc,
+// và mọi thay đổi có số không lớn hơn checkpoint đã được ghi cùng document
+func (sw *CollectionSyncWrapper) load(cw *CollectionWrapper, table *models.Table, mapping map[string]string, batchSize int) error {
+	unlock := cw.lockChanges()
+	checkpoint, err := sw.SQLiteCatalogService.GetCollectionChangeSeq(cw.Collection.ID)
+	unlock()
+	if err != nil {
+		return fmt.Errorf("failed to get change sequence of collection %d: %v", cw.Collection.ID, err)
+	}
+	files, err := sw.SQLiteCatalogService.ListTableFiles(table.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list files of table %s: %v", table.Name, err)
+	}
+
+	var written []models.TableFile
+	var rows [][]interface{}
+	var loaded, skipped int64
+	writeRows := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		files, err := sw.Storage.Tables.WriteRows(table, rows)
+		if err != nil {
+			return fmt.Errorf("failed to write rows of table %s: %v", table.Name, err)
+		}
+		written = append(written, files...)
+		rows = rows[:0]
+		return nil
+	}
+
+	prefix := cw.CreateBadgerKey("")
+	err = cw.Documents.ScanPrefix([]byte(prefix), func(key, value []byte) (bool, error) {
+		loaded++
+		row, err := sw.documentRow(table, mapping, string(key[len(prefix):]), value)
+		if err != nil {
+			skipped++
+			sw.logSkipped(string(key[len(prefix):]), err)
+			return true, nil
+		}
+		rows = append(rows, row)
+		if len(rows) >= batchSize {
+			return true, writeRows()
+		}
+		return true, nil
+	})
+	if err == nil {
+		err = writeRows()
+	}
+	if err == nil {
+		err = sw.commit(table, written, files)
+	}
+	if err != nil {
+		sw.removeFiles(table, written)
+		return fmt.Errorf("failed to load collection %d into table %s: %w", cw.Collection.ID, table.Name, err)
+	}
+
+	sw.Sync.Loaded = true
+	sw.Sync.Checkpoint = checkpoint
+	sw.Sync.AppliedChanges += loaded - skipped
+	sw.Sync.SkippedChanges += skipped
+	return sw.SQLiteCatalogService.UpdateCollectionSync(sw.Sync)
+}
+
+// apply áp dụng một lô thay đổi vào table trong một snapshot rồi lưu checkpoint
+// Chỉ thay đổi cuối cùng của mỗi key trong lô có hiệu lực, truncate xóa mọi dòng trước nó
+func (sw *CollectionSyncWrapper) apply(table *models.Table, mapping map[string]string, changes []DocumentChange) error {
+	truncated := false
+	latest := make(map[string]DocumentChange)
+	var keys []string
+	for _, change := range changes {
+		switch change.Op {
+		case ChangeOpTruncate:
+			truncated = true
+			latest = make(map[string]DocumentChange)
+			keys = nil
+		case ChangeOpUpsert, ChangeOpDelete:
+			if _, ok := latest[change.Key]; !ok {
+				keys = append(keys, change.Key)
+			}
+			latest[change.Key] = change
+		}
+	}
+
+	files, err := sw.SQLiteCatalogService.ListTableFiles(table.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list files of table %s: %v", table.Name, err)
+	}
+
+	var written, removed []models.TableFile
+	var skipped int64
+	err = func() error {
+		if truncated {
+			removed = files
+		} else if len(keys) > 0 {
+			keyColumn := columnIndex(table.Columns, sw.Sync.KeyColumn)
+			if keyColumn < 0 {
+				return fmt.Errorf("%w: key column %s no longer exists in table %s", ErrInvalidSync, sw.Sync.KeyColumn, table.Name)
+			}
+			dataFiles, deletes := service.SplitDeleteFiles(files)
+			affected, err := sw.filesWithKeys(table, dataFiles, deletes, keyColumn, keys)
+			if err != nil {
+				return err
+			}
+			for _, file := range affected {
+				inputs := append([]models.TableFile{file}, deletes[file.ID]...)
+				rewritten, err := sw.Storage.Tables.RewriteFiles(table, file.Partition, inputs, -1, func(values []interface{}) bool {
+					key, ok := values[keyColumn].(string)
+					_, changed := latest[key]
+					return !ok || !changed
+				})
+				if err != nil {
+					return fmt.Errorf("failed to rewrite file %s: %v", file.Path, err)
+				}
+				if rewritten != nil {
+					written = append(written, *rewritten)
+				}
+				removed = append(removed, file)
+			}
+		}
+
+		var rows [][]interface{}
+		for _, key := range keys {
+			change := latest[key]
+			if change.Op != ChangeOpUpsert {
+				continue
+			}
+			row, err := sw.documentRow(table, mapping, key, change.Document)
+			if err != nil {
+				skipped++
+				sw.logSkipped(key, err)
+				continue
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) > 0 {
+			files, err := sw.Storage.Tables.WriteRows(table, rows)
+			if err != nil {
+				return fmt.Errorf("failed to write rows of table %s: %v", table.Name, err)
+			}
+			written = append(written, files...)
+		}
+		return sw.commit(table, written, removed)
+	}()
+	if err != nil {
+		sw.removeFiles(table, written)
+		return err
+	}
+
+	now := time.Now()
+	sw.Sync.Checkpoint = changes[len(changes)-1].Seq
+	sw.Sync.AppliedChanges += int64(len(changes)) - skipped
+	sw.Sync.SkippedChanges += skipped
+	sw.Sync.LastSyncedAt = &now
+	return sw.SQLiteCatalogService.UpdateCollectionSync(sw.Sync)
+}
+
+// commit thay các tệp removed bằng các tệp written trong một snapshot của table, không commit nếu không có thay đổi
+func (sw *CollectionSyncWrapper) commit(table *models.Table, written, removed []models.TableFile) error {
+	if len(written) == 0 && len(removed) == 0 {
+		return nil
+	}
+	removedIDs := make([]int, len(removed))
+	for i := range removed {
+		removedIDs[i] = removed[i].ID
+	}
+	_, err := sw.SQLiteCatalogService.CommitTableSnapshot(table.ID, models.SnapshotOperationSync, table.SchemaVersion, table.CurrentSnapshotID, written, removedIDs)
+	if err != nil {
+		return fmt.Errorf("failed to commit sync to table %s: %w", table.Name, err)
+	}
+	return nil
+}
+
+// filesWithKeys trả về các tệp dữ liệu có ít nhất một dòng chưa bị xóa với giá trị của cột keyColumn nằm trong keys
+// deletes là các tệp delete theo ID của tệp dữ liệu. Row group có min/max của cột không chứa key nào bị bỏ qua
+func (sw *CollectionSyncWrapper) filesWithKeys(table *models.Table, files []models.TableFile, deletes map[int][]models.TableFile, keyColumn int, keys []string) ([]models.TableFile, error) {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	inRange := func(numRows int64, stats []service.ColumnStats) bool {
+		min, minOK := stats[0].Min.(string)
+		max, maxOK := stats[0].Max.(string)
+		if !minOK || !maxOK {
+			return true
+		}
+		i := sort.SearchStrings(sorted, min)
+		return i < len(sorted) && sorted[i] <= max
+	}
+
+	var affected []models.TableFile
+	for _, file := range files {
+		found := false
+		inputs := append([]models.TableFile{file}, deletes[file.ID]...)
+		_, err := sw.Storage.Tables.Scan(table, inputs, []int{keyColumn}, inRange, func(values []interface{}) error {
+			if key, ok := values[0].(string); ok && wanted[key] {
+				found = true
+				return service.ErrStopScan
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			affected = append(affected, file)
+		}
+	}
+	return affected, nil
+}
+
+// documentRow chuyển document thành một dòng của table
+// Với mapping, mỗi cột lấy giá trị theo đường dẫn dạng "a.b.c" trong document. Không có mapping thì document được
+// làm phẳng, tên trường lồng nhau nối bằng "_" (ví dụ address.city thành address_city), và khớp với tên cột.
+// Trường không có cột tương ứng bị bỏ qua, cột không có giá trị là null. Object hoặc mảng ghi vào cột string được lưu dạng JSON.
+// Cột KeyColumn luôn là _key của document
+func (sw *CollectionSyncWrapper) documentRow(table *models.Table, mapping map[string]string, key string, raw []byte) ([]interface{}, error) {
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	if len(mapping) > 0 {
+		for column, path := range mapping {
+			if value, ok := lookupPath(document, path); ok {
+				values[column] = value
+			}
+		}
+	} else {
+		flat := make(map[string]interface{})
+		flattenDocument("", document, flat)
+		for _, column := range table.Columns {
+			if value, ok := flat[column.Name]; ok {
+				values[column.Name] = value
+			}
+		}
+	}
+	values[sw.Sync.KeyColumn] = key
+
+	for _, column := range table.Columns {
+		if column.Type != models.ColumnTypeString {
+			continue
+		}
+		switch value := values[column.Name].(type) {
+		case map[string]interface{}, []interface{}:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			values[column.Name] = string(encoded)
+		}
+	}
+
+	rows, err := ConvertRows(table.Columns, []map[string]interface{}{values})
+	if err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// flattenDocument làm phẳng các object lồng nhau của document vào out, tên được nối bằng "_"
+// Object vẫn được giữ dưới tên của nó để có thể ghi vào cột string dạng JSON
+func flattenDocument(prefix string, document map[string]interface{}, out map[string]interface{}) {
+	for field, value := range document {
+		name := field
+		if prefix != "" {
+			name = prefix + "_" + field
+		}
+		out[name] = value
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenDocument(name, nested, out)
+		}
+	}
+}
+
+// logSkipped log document bị bỏ qua vì không chuyển được thành dòng của table
+func (sw *CollectionSyncWrapper) logSkipped(key string, err error) {
+	log.Printf("Sync %d skipped document %s: %v", sw.Sync.ID, key, err)
+}
+
+// removeFiles xóa các tệp đã ghi nhưng chưa được commit
+func (sw *CollectionSyncWrapper) removeFiles(table *models.Table, files []models.TableFile) {
+	for _, file := range files {
+		if err := sw.Storage.Tables.RemoveTableFile(table, file.Path); err != nil {
+			log.Printf("Failed to remove uncommitted sync file %s of table %d: %v", file.Path, table.ID, err)
+		}
+	}
+}
+
+// SyncCollections chạy tất cả các sync rồi xóa các thay đổi đã được mọi sync của collection áp dụng, dùng bởi job định kỳ
+func SyncCollections(catalog *service.SQLiteCatalogService, storage *service.Storage, batchSize int) error {
+	syncs, err := catalog.ListCollectionSyncs(0)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	// trimTo là checkpoint nhỏ nhất của các sync đã sao chép xong theo collection
+	trimTo := make(map[int]int64)
+	for i := range syncs {
+		sync := &syncs[i]
+		if err := NewCollectionSyncWrapper(sync, catalog, storage).Run(batchSize); err != nil {
+			log.Printf("Sync %d of collection %d to table %d failed: %v", sync.ID, sync.CollectionID, sync.TableID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !sync.Loaded {
+			continue
+		}
+		if current, ok := trimTo[sync.CollectionID]; !ok || sync.Checkpoint < current {
+			trimTo[sync.CollectionID] = sync.Checkpoint
+		}
+	}
+
+	for collectionID, checkpoint := range trimTo {
+		collection, err := catalog.GetCollectionByID(collectionID)
+		if err != nil {
+			continue
+		}
+		cw, err := NewCollectionWrapper(collection, catalog, storage)
+		if err == nil {
+			err = cw.TrimChanges(checkpoint)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to trim change log of collection %d: %v", collectionID, err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// newTestSync tạo table t(k string, a string) và sync từ collection của cw vào table đó
+func newTestSync(t *testing.T, cw *CollectionWrapper) *CollectionSyncWrapper {
+	t.Helper()
+	table := &models.Table{
+		Name:        "t",
+		WorkspaceID: cw.Collection.WorkspaceID,
+		Columns: []models.TableColumn{
+			{Name: "k", Type: models.ColumnTypeString},
+			{Name: "a", Type: models.ColumnTypeString, Nullable: true},
+		},
+	}
+	if err := NewTableWrapper(table, cw.SQLiteCatalogService, cw.Storage).CreateTable(); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	sync := &models.CollectionSync{
+		WorkspaceID:  cw.Collection.WorkspaceID,
+		CollectionID: cw.Collection.ID,
+		TableID:      table.ID,
+		KeyColumn:    "k",
+	}
+	sw := NewCollectionSyncWrapper(sync, cw.SQLiteCatalogService, cw.Storage)
+	if err := sw.CreateSync(table, nil); err != nil {
+		t.Fatalf("failed to create sync: %v", err)
+	}
+	return sw
+}
+
+// syncedRows trả về các dòng của table đích dạng chuỗi, theo thứ tự key
+func syncedRows(t *testing.T, sw *CollectionSyncWrapper) string {
+	t.Helper()
+	q, err := PrepareSQL(sw.SQLiteCatalogService, sw.Storage, sw.Sync.WorkspaceID, "SELECT k, a FROM t ORDER BY k")
+	if err != nil {
+		t.Fatalf("failed to prepare query: %v", err)
+	}
+	var rows [][]interface{}
+	_, err = q.Run(func(values []interface{}) error {
+		rows = append(rows, append([]interface{}(nil), values...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read table: %v", err)
+	}
+	return fmt.Sprint(rows)
+}
+
+func runSync(t *testing.T, sw *CollectionSyncWrapper, batchSize int) {
+	t.Helper()
+	if err := sw.Run(batchSize); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+}
+
+func mustWrite(t *testing.T, cw *CollectionWrapper, key, a string) {
+	t.Helper()
+	if err := cw.Write(map[string]interface{}{"_key": key, "a": a}); err != nil {
+		t.Fatalf("failed to write %s: %v", key, err)
+	}
+}
+
+func TestSyncInitialLoad(t *testing.T) {
+	cw, _ := newTestCollection(t)
+	mustWrite(t, cw, "x", "1")
+	mustWrite(t, cw, "y", "2")
+
+	// cw được tải trước khi sync được tạo nhưng vẫn phải ghi lại thay đổi sau đó
+	sw := newTestSync(t, cw)
+	runSync(t, sw, 10)
+	if got, want := syncedRows(t, sw), "[[x 1] [y 2]]"; got != want {
+		t.Fatalf("got %s after load, want %s", got, want)
+	}
+	if !sw.Sync.Loaded || sw.Sync.AppliedChanges != 2 {
+		t.Fatalf("got loaded %v with %d applied changes, want 2", sw.Sync.Loaded, sw.Sync.AppliedChanges)
+	}
+
+	mustWrite(t, cw, "z", "3")
+	runSync(t, sw, 10)
+	if got, want := syncedRows(t, sw), "[[x 1] [y 2] [z 3]]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestSyncCollapsesChangesInBatch(t *testing.T) {
+	cw, _ := newTestCollection(t)
+	mustWrite(t, cw, "x", "1")
+	mustWrite(t, cw, "y", "2")
+	sw := newTestSync(t, cw)
+	runSync(t, sw, 10)
+
+	if err := cw.Update(map[string]interface{}{"_key": "x", "a": "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Update(map[string]interface{}{"_key": "x", "a": "11"}); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, cw, "w", "4")
+	if err := cw.Delete("w"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Delete("y"); err != nil {
+		t.Fatal(err)
+	}
+	runSync(t, sw, 10)
+	if got, want := syncedRows(t, sw), "[[x 11]]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// Các thay đổi trước truncate trong cùng lô không còn hiệu lực
+	mustWrite(t, cw, "p", "5")
+	if err := cw.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, cw, "q", "6")
+	runSync(t, sw, 10)
+	if got, want := syncedRows(t, sw), "[[q 6]]"; got != want {
+		t.Fatalf("got %s after truncate, want %s", got, want)
+	}
+}
+
+func TestSyncReplayAfterCheckpoint(t *testing.T) {
+	cw, _ := newTestCollection(t)
+	sw := newTestSync(t, cw)
+	runSync(t, sw, 10)
+	checkpoint := sw.Sync.Checkpoint
+
+	mustWrite(t, cw, "x", "1")
+	mustWrite(t, cw, "y", "2")
+	if err := cw.Update(map[string]interface{}{"_key": "x", "a": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	runSync(t, sw, 2)
+	want := "[[x 3] [y 2]]"
+	if got := syncedRows(t, sw); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// Giả lập server dừng trước khi lưu checkpoint: các lô được áp dụng lại không tạo dòng trùng
+	sw.Sync.Checkpoint = checkpoint
+	runSync(t, sw, 2)
+	if got := syncedRows(t, sw); got != want {
+		t.Fatalf("got %s after replay, want %s", got, want)
+	}
+}
+
+func TestFailedWriteIsNotRecorded(t *testing.T) {
+	cw, documents := newTestCollection(t)
+	newTestSync(t, cw)
+
+	documents.failSet = true
+	if err := cw.Write(map[string]interface{}{"_key": "x", "a": "1"}); err == nil {
+		t.Fatal("expected write to fail")
+	}
+	documents.failSet = false
+	changes, err := cw.ReadChanges(0, 10)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("got changes %+v (%v), want none", changes, err)
+	}
+}
+
+func TestTrimChanges(t *testing.T) {
+	cw, _ := newTestCollection(t)
+	sw := newTestSync(t, cw)
+	for i := 0; i < 4; i++ {
+		mustWrite(t, cw, fmt.Sprint(i), "v")
+	}
+
+	if err := cw.TrimChanges(2); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := cw.ReadChanges(0, 10)
+	if err != nil || len(changes) != 2 || changes[0].Seq != 3 || changes[1].Seq != 4 {
+		t.Fatalf("got changes %+v (%v), want 3 and 4", changes, err)
+	}
+
+	// Sau khi mọi sync đã áp dụng, job định kỳ xóa các thay đổi
+	if err := SyncCollections(cw.SQLiteCatalogService, cw.Storage, 10); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = cw.ReadChanges(0, 10)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("got changes %+v (%v) after sync, want none", changes, err)
+	}
+	if got, want := syncedRows(t, sw), "[[0 v] [1 v] [2 v] [3 v]]"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
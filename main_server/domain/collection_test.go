@@ -0,0 +1,272 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faultyDocumentStore là MemoryDocumentStore có thể giả lập lỗi khi ghi hoặc xóa document
+type faultyDocumentStore struct {
+	*service.MemoryDocumentStore
+	failSet    bool
+	failDelete bool
+}
+
+func (fs *faultyDocumentStore) Set(key, value []byte) error {
+	if fs.failSet {
+		return errInjected
+	}
+	return fs.MemoryDocumentStore.Set(key, value)
+}
+
+func (fs *faultyDocumentStore) Delete(key []byte) error {
+	if fs.failDelete {
+		return errInjected
+	}
+	return fs.MemoryDocumentStore.Delete(key)
+}
+
+func (fs *faultyDocumentStore) WriteBatch(writes []service.DocumentWrite) error {
+	for _, write := range writes {
+		if (write.Delete && fs.failDelete) || (!write.Delete && fs.failSet) {
+			return errInjected
+		}
+	}
+	return fs.MemoryDocumentStore.WriteBatch(writes)
+}
+
+// newTestCollection tạo collection dùng backend memory với các index cho trước
+func newTestCollection(t *testing.T, indexes ...models.Index) (*CollectionWrapper, *faultyDocumentStore) {
+	t.Helper()
+	cfg := &config.Config{DataFolderDefault: t.TempDir()}
+	catalog, err := service.NewSQLiteCatalogService(cfg)
+	if err != nil {
+		t.Fatalf("failed to open catalog: %v", err)
+	}
+	tables, err := service.NewParquetService(cfg)
+	if err != nil {
+		t.Fatalf("failed to open table storage: %v", err)
+	}
+	documents := &faultyDocumentStore{MemoryDocumentStore: service.NewMemoryDocumentStore()}
+	storage := service.NewStorage(nil, nil, tables)
+	storage.SetBackend(models.StorageBackendMemory, &service.StorageBackend{Documents: documents, Indexes: service.NewMemoryIndexStore()})
+
+	workspace := &models.Workspace{Name: "ws"}
+	if err := catalog.CreateWorkspace(workspace); err != nil {
+		t.Fatalf("failed to create workspace: %v", err)
+	}
+	collection := &models.Collection{Name: "c", WorkspaceID: workspace.ID, Backend: models.StorageBackendMemory}
+	cw, err := NewCollectionWrapper(collection, catalog, storage)
+	if err != nil {
+		t.Fatalf("failed to open collection: %v", err)
+	}
+	if err := cw.CreateCollection(); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+	for i := range indexes {
+		index := indexes[i]
+		index.CollectionID = collection.ID
+		iw, err := NewIndexWrapper(&index, catalog, storage)
+		if err != nil {
+			t.Fatalf("failed to open index %s: %v", index.Name, err)
+		}
+		if err := iw.CreateIndex(); err != nil {
+			t.Fatalf("failed to create index %s: %v", index.Name, err)
+		}
+	}
+
+	cw, err = NewCollectionWrapper(&models.Collection{ID: collection.ID}, catalog, storage)
+	if err != nil {
+		t.Fatalf("failed to open collection: %v", err)
+	}
+	return cw, documents
+}
+
+// testIndexes là một index thường trên a và một index unique trên b
+func testIndexes() []models.Index {
+	return []models.Index{
+		{Name: "by_a", Fields: "a", IndexType: models.IndexTypeBTree, DataType: "string"},
+		{Name: "by_b", Fields: "b", IndexType: models.IndexTypeBTree, DataType: "string", IsUnique: true},
+	}
+}
+
+// testIndexWrapper trả về IndexWrapper của index name trong collection
+func testIndexWrapper(t *testing.T, cw *CollectionWrapper, name string) *IndexWrapper {
+	t.Helper()
+	for i := range cw.Collection.Indexes {
+		if cw.Collection.Indexes[i].Name == name {
+			iw, err := NewIndexWrapper(&cw.Collection.Indexes[i], cw.SQLiteCatalogService, cw.Storage)
+			if err != nil {
+				t.Fatalf("failed to open index %s: %v", name, err)
+			}
+			return iw
+		}
+	}
+	t.Fatalf("index %s does not exist", name)
+	return nil
+}
+
+// encodeIndexValue mã hóa value như khi document có field của index bằng value
+func encodeIndexValue(t *testing.T, iw *IndexWrapper, value interface{}) []byte {
+	t.Helper()
+	encoded, err := iw.coveredValues(map[string]interface{}{"_key": "", iw.Index.Fields: value})
+	if err != nil || len(encoded) != 1 {
+		t.Fatalf("failed to encode %v for index %s: %v", value, iw.Index.Name, err)
+	}
+	for valueBytes := range encoded {
+		return []byte(valueBytes)
+	}
+	return nil
+}
+
+// indexedKeys trả về các key trong index name có value
+func indexedKeys(t *testing.T, cw *CollectionWrapper, name string, value interface{}) []string {
+	t.Helper()
+	iw := testIndexWrapper(t, cw, name)
+	var keys []string
+	err := iw.Indexes.ScanValue(iw.Index, encodeIndexValue(t, iw, value), func(key string) (bool, error) {
+		keys = append(keys, key)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to look up %v in index %s: %v", value, name, err)
+	}
+	return keys
+}
+
+func assertIndexedKeys(t *testing.T, cw *CollectionWrapper, name string, value interface{}, want ...string) {
+	t.Helper()
+	got := indexedKeys(t, cw, name, value)
+	if len(got) != len(want) {
+		t.Fatalf("index %s, value %v: got keys %v, want %v", name, value, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("index %s, value %v: got keys %v, want %v", name, value, got, want)
+		}
+	}
+}
+
+func TestWriteRollsBackIndexes(t *testing.T) {
+	tests := []struct {
+		name    string
+		failSet bool
+		input   map[string]interface{}
+	}{
+		{name: "unique violation", input: map[string]interface{}{"_key": "k2", "a": "y", "b": "u"}},
+		{name: "document store failure", failSet: true, input: map[string]interface{}{"_key": "k2", "a": "y", "b": "v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw, documents := newTestCollection(t, testIndexes()...)
+			if err := cw.Write(map[string]interface{}{"_key": "k1", "a": "x", "b": "u"}); err != nil {
+				t.Fatalf("failed to write k1: %v", err)
+			}
+
+			documents.failSet = tt.failSet
+			if err := cw.Write(tt.input); err == nil {
+				t.Fatal("expected write to fail")
+			}
+			documents.failSet = false
+
+			assertIndexedKeys(t, cw, "by_a", "y")
+			assertIndexedKeys(t, cw, "by_b", "v")
+			assertIndexedKeys(t, cw, "by_a", "x", "k1")
+			assertIndexedKeys(t, cw, "by_b", "u", "k1")
+			if _, err := cw.Read("k2"); err == nil {
+				t.Fatal("k2 must not be written")
+			}
+		})
+	}
+}
+
+func TestUpdateRollsBackIndexes(t *testing.T) {
+	tests := []struct {
+		name    string
+		failSet bool
+		input   map[string]interface{}
+	}{
+		{name: "unique violation", input: map[string]interface{}{"_key": "k2", "a": "z", "b": "u"}},
+		{name: "document store failure", failSet: true, input: map[string]interface{}{"_key": "k2", "a": "z", "b": "w"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw, documents := newTestCollection(t, testIndexes()...)
+			for _, input := range []map[string]interface{}{
+				{"_key": "k1", "a": "x", "b": "u"},
+				{"_key": "k2", "a": "y", "b": "v"},
+			} {
+				if err := cw.Write(input); err != nil {
+					t.Fatalf("failed to write %s: %v", input["_key"], err)
+				}
+			}
+
+			documents.failSet = tt.failSet
+			if err := cw.Update(tt.input); err == nil {
+				t.Fatal("expected update to fail")
+			}
+			documents.failSet = false
+
+			assertIndexedKeys(t, cw, "by_a", "y", "k2")
+			assertIndexedKeys(t, cw, "by_a", "z")
+			assertIndexedKeys(t, cw, "by_b", "v", "k2")
+			assertIndexedKeys(t, cw, "by_b", "w")
+			assertIndexedKeys(t, cw, "by_b", "u", "k1")
+			document, err := cw.Read("k2")
+			if err != nil || document["a"] != "y" {
+				t.Fatalf("k2 must keep its old value, got %v (%v)", document, err)
+			}
+		})
+	}
+}
+
+func TestDeleteRollsBackIndexes(t *testing.T) {
+	cw, documents := newTestCollection(t, testIndexes()...)
+	if err := cw.Write(map[string]interface{}{"_key": "k1", "a": "x", "b": "u"}); err != nil {
+		t.Fatalf("failed to write k1: %v", err)
+	}
+
+	documents.failDelete = true
+	if err := cw.Delete("k1"); err == nil {
+		t.Fatal("expected delete to fail")
+	}
+	documents.failDelete = false
+
+	assertIndexedKeys(t, cw, "by_a", "x", "k1")
+	assertIndexedKeys(t, cw, "by_b", "u", "k1")
+	if _, err := cw.Read("k1"); err != nil {
+		t.Fatalf("k1 must still exist: %v", err)
+	}
+
+	if err := cw.Delete("k1"); err != nil {
+		t.Fatalf("failed to delete k1: %v", err)
+	}
+	assertIndexedKeys(t, cw, "by_a", "x")
+	assertIndexedKeys(t, cw, "by_b", "u")
+	if err := cw.Delete("k1"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestNewCollectionWrapperUnknownBackend(t *testing.T) {
+	cw, _ := newTestCollection(t, testIndexes()...)
+	err := cw.SQLiteCatalogService.Db.Model(&models.Collection{}).Where("id = ?", cw.Collection.ID).Update("backend", "missing").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backend không tồn tại của collection đã có là lỗi của server, không phải ErrInvalidBackend của request
+	if _, err := NewCollectionWrapper(&models.Collection{ID: cw.Collection.ID}, cw.SQLiteCatalogService, cw.Storage); err == nil || errors.Is(err, ErrInvalidBackend) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+	index := cw.Collection.Indexes[0]
+	if _, err := NewIndexWrapper(&models.Index{ID: index.ID}, cw.SQLiteCatalogService, cw.Storage); err == nil || errors.Is(err, ErrInvalidBackend) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFilter được trả về khi biểu thức filter không hợp lệ
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Các toán tử được hỗ trợ trong filter
+const (
+	FilterOpEqual        = "="
+	FilterOpNotEqual     = "!="
+	FilterOpGreater      = ">"
+	FilterOpGreaterEqual = ">="
+	FilterOpLess         = "<"
+	FilterOpLessEqual    = "<="
+	FilterOpExists       = "exists"
+)
+
+// Condition là một điều kiện trên một field, ví dụ status = "active" hoặc exists(email)
+type Condition struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// Filter là các điều kiện nối với nhau bằng AND, filter rỗng khớp với mọi document
+// Cú pháp: <field> <op> <value> [AND ...], với op là =, !=, >, >=, <, <=, hoặc exists(<field>)
+// Value là chuỗi trong dấu nháy kép, số, true, false hoặc null. Field có thể là đường dẫn dạng address.city
+type Filter struct {
+	Conditions []Condition
+}
+
+// ParseFilter phân tích biểu thức filter, biểu thức rỗng trả về filter rỗng
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &Filter{}
+	for pos := 0; pos < len(tokens); {
+		if len(filter.Conditions) > 0 {
+			if !strings.EqualFold(tokens[pos], "AND") {
+				return nil, fmt.Errorf("%w: expected AND, got %s", ErrInvalidFilter, tokens[pos])
+			}
+			pos++
+		}
+
+		condition, next, err := parseCondition(tokens, pos)
+		if err != nil {
+			return nil, err
+		}
+		filter.Conditions = append(filter.Conditions, condition)
+		pos = next
+	}
+	return filter, nil
+}
+
+func parseCondition(tokens []string, pos int) (Condition, int, error) {
+	if pos+3 < len(tokens) && strings.EqualFold(tokens[pos], FilterOpExists) && tokens[pos+1] == "(" && tokens[pos+3] == ")" {
+		if !isFieldToken(tokens[pos+2]) {
+			return Condition{}, 0, fmt.Errorf("%w: invalid field %s", ErrInvalidFilter, tokens[pos+2])
+		}
+		return Condition{Field: tokens[pos+2], Op: FilterOpExists}, pos + 4, nil
+	}
+
+	if pos+2 >= len(tokens) {
+		return Condition{}, 0, fmt.Errorf("%w: incomplete condition", ErrInvalidFilter)
+	}
+	field, op, literal := tokens[pos], tokens[pos+1], tokens[pos+2]
+	if !isFieldToken(field) {
+		return Condition{}, 0, fmt.Errorf("%w: invalid field %s", ErrInvalidFilter, field)
+	}
+	switch op {
+	case FilterOpEqual, FilterOpNotEqual, FilterOpGreater, FilterOpGreaterEqual, FilterOpLess, FilterOpLessEqual:
+	default:
+		return Condition{}, 0, fmt.Errorf("%w: unknown operator %s", ErrInvalidFilter, op)
+	}
+	value, err := parseFilterValue(literal)
+	if err != nil {
+		return Condition{}, 0, err
+	}
+	return Condition{Field: field, Op: op, Value: value}, pos + 3, nil
+}
+
+func parseFilterValue(literal string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(literal, `"`):
+		value, err := strconv.Unquote(literal)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, literal)
+		}
+		return value, nil
+	case literal == "true":
+		return true, nil
+	case literal == "false":
+		return false, nil
+	case literal == "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %s", ErrInvalidFilter, literal)
+	}
+	return number, nil
+}
+
+func isFieldToken(token string) bool {
+	if token == "" || strings.EqualFold(token, "AND") {
+		return false
+	}
+	for i, r := range token {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '.'))) {
+			return false
+		}
+	}
+	return !strings.HasSuffix(token, ".") && !strings.Contains(token, "..")
+}
+
+// tokenizeFilter tách biểu thức thành field, toán tử, giá trị, dấu ngoặc và từ khóa
+func tokenizeFilter(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			if j < len(runes) && runes[j] == '=' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()\"=!<>", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// String trả về biểu thức chuẩn hóa của filter, dùng để lưu trong catalog
+func (f *Filter) String() string {
+	parts := make([]string, 0, len(f.Conditions))
+	for _, condition := range f.Conditions {
+		parts = append(parts, condition.String())
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func (c Condition) String() string {
+	if c.Op == FilterOpExists {
+		return fmt.Sprintf("exists(%s)", c.Field)
+	}
+	value := "null"
+	switch v := c.Value.(type) {
+	case string:
+		value = strconv.Quote(v)
+	case float64:
+		value = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		value = strconv.FormatBool(v)
+	}
+	return fmt.Sprintf("%s %s %s", c.Field, c.Op, value)
+}
+
+// Match kiểm tra document có thỏa mãn tất cả các điều kiện của filter không
+// Field không tồn tại không thỏa điều kiện nào. Field là mảng thỏa điều kiện nếu có phần tử thỏa,
+// riêng != yêu cầu không phần tử nào bằng giá trị
+func (f *Filter) Match(document map[string]interface{}) bool {
+	for _, condition := range f.Conditions {
+		if !condition.Match(document) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) Match(document map[string]interface{}) bool {
+	value, ok := lookupPath(document, c.Field)
+	if !ok {
+		return false
+	}
+	if c.Op == FilterOpExists {
+		return true
+	}
+
+	elements := []interface{}{value}
+	if array, isArray := value.([]interface{}); isArray {
+		elements = array
+	}
+
+	if c.Op == FilterOpNotEqual {
+		for _, element := range elements {
+			if compareFilterValues(element, c.Value) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, element := range elements {
+		if compareOp(c.Op, compareFilterValues(element, c.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Implies kiểm tra mọi document thỏa f cũng thỏa other, dùng để biết query có dùng được partial index không
+// Kết quả có thể là false dù thực tế f suy ra other, khi đó planner chỉ bỏ qua index
+func (f *Filter) Implies(other *Filter) bool {
+	for _, required := range other.Conditions {
+		implied := false
+		for _, condition := range f.Conditions {
+			if condition.implies(required) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) implies(other Condition) bool {
+	if c.Field != other.Field {
+		return false
+	}
+	if other.Op == FilterOpExists {
+		// Mọi điều kiện trên field chỉ thỏa khi field tồn tại
+		return true
+	}
+	if c.Op == FilterOpExists {
+		return false
+	}
+	if other.Op == FilterOpNotEqual {
+		return c.Op == FilterOpNotEqual && compareFilterValues(c.Value, other.Value) == 0
+	}
+
+	cmp := compareFilterValues(c.Value, other.Value)
+	if cmp == incomparable {
+		return false
+	}
+	switch c.Op {
+	case FilterOpEqual:
+		return compareOp(other.Op, cmp)
+	case FilterOpGreater:
+		return (other.Op == FilterOpGreater || other.Op == FilterOpGreaterEqual) && cmp >= 0
+	case FilterOpGreaterEqual:
+		return (other.Op == FilterOpGreater && cmp > 0) || (other.Op == FilterOpGreaterEqual && cmp >= 0)
+	case FilterOpLess:
+		return (other.Op == FilterOpLess || other.Op == FilterOpLessEqual) && cmp <= 0
+	case FilterOpLessEqual:
+		return (other.Op == FilterOpLess && cmp < 0) || (other.Op == FilterOpLessEqual && cmp <= 0)
+	}
+	return false
+}
+
+// EqualityValue trả về giá trị của điều kiện field = value trong filter nếu có
+func (f *Filter) EqualityValue(field string) (interface{}, bool) {
+	for _, condition := range f.Conditions {
+		if condition.Field == field && condition.Op == FilterOpEqual && condition.Value != nil {
+			return condition.Value, true
+		}
+	}
+	return nil, false
+}
+
+// incomparable là kết quả so sánh hai giá trị khác kiểu
+const incomparable = 2
+
+// compareFilterValues so sánh hai giá trị cùng kiểu, trả về -1, 0, 1 hoặc incomparable
+func compareFilterValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0
+			}
+			if !av {
+				return -1
+			}
+			return 1
+		}
+	case nil:
+		if b == nil {
+			return 0
+		}
+	}
+	return incomparable
+}
+
+func compareOp(op string, cmp int) bool {
+	if cmp == incomparable {
+		return false
+	}
+	switch op {
+	case FilterOpEqual:
+		return cmp == 0
+	case FilterOpGreater:
+		return cmp > 0
+	case FilterOpGreaterEqual:
+		return cmp >= 0
+	case FilterOpLess:
+		return cmp < 0
+	case FilterOpLessEqual:
+		return cmp <= 0
+	}
+	return false
+}
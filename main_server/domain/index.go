@@ -1,24 +1,28 @@
 package domain
 
 import (
-	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/dehuy69/mydp/main_server/models"
 	service "github.com/dehuy69/mydp/main_server/service"
-	"github.com/dgraph-io/badger/v4"
 )
 
+// ErrInvalidIndex được trả về khi định nghĩa index không hợp lệ
+var ErrInvalidIndex = errors.New("invalid index")
+
 type IndexWrapper struct {
 	SQLiteCatalogService *service.SQLiteCatalogService // Kết nối cơ sở dữ liệu
 	Index                *models.Index                 // Chứa đối tượng Collection từ models
-	BadgerService        *service.BadgerService
-	BboltService         *service.BboltService
+	Storage              *service.Storage              // Các backend lưu trữ
+	Documents            service.DocumentStore         // Nơi lưu document, theo backend của collection chứa index
+	Indexes              service.IndexStore            // Nơi lưu index, theo backend của collection chứa index
 }
 
 // type node struct {
@@ -31,34 +35,71 @@ type IndexWrapper struct {
 // NewIndexWrapper khởi tạo một instance mới của IndexWrapper
 // Một index sẽ có tên bảng là động nhưng cấu trúc của bảng sẽ giống nhau
 // value: int/string, keys: string
-func NewIndexWrapper(index *models.Index, SQLiteCatalogService *service.SQLiteCatalogService, BadgerService *service.BadgerService, bboltService *service.BboltService) *IndexWrapper {
+// Trả về lỗi nếu không đọc được index hoặc backend của collection không tồn tại.
+// Với index chưa có trong catalog, backend được chọn khi CreateIndex
+func NewIndexWrapper(index *models.Index, SQLiteCatalogService *service.SQLiteCatalogService, storage *service.Storage) (*IndexWrapper, error) {
 	if index.ID != 0 {
 		// Preload các liên kết thủ công
 		preload := SQLiteCatalogService.Db.Preload("Collection").First(index)
 		err := preload.Error
 		if err != nil {
-			fmt.Println("Error preloading collection:", err)
-			return nil
+			return nil, fmt.Errorf("failed to load index %d: %v", index.ID, err)
 		}
 	} else {
 		fmt.Println("Index ID is 0, không cần preload")
 	}
 
-	return &IndexWrapper{
+	wrapper := &IndexWrapper{
 		SQLiteCatalogService: SQLiteCatalogService,
 		Index:                index,
-		BadgerService:        BadgerService,
-		BboltService:         bboltService,
+		Storage:              storage,
+	}
+	if index.ID != 0 {
+		if err := wrapper.useBackend(index.Collection.Backend); err != nil {
+			return nil, fmt.Errorf("failed to select storage backend of index %d: %v", index.ID, err)
+		}
 	}
+	return wrapper, nil
 }
 
 // Taọ index, tạo index trong catalog -> tạo index trong indexService
 func (iw *IndexWrapper) CreateIndex() error {
+	// Index mới dùng mã hóa tuple, index cũ vẫn giữ KeyVersion legacy cho tới khi được rebuild
+	iw.Index.KeyVersion = models.IndexKeyVersionTuple
+
+	// Chuẩn hóa filter của partial index trước khi lưu vào catalog
+	filter, err := ParseFilter(iw.Index.Filter)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIndex, err)
+	}
+	iw.Index.Filter = filter.String()
+
+	fields := indexFields(iw.Index)
+	for _, field := range fields {
+		if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+			return fmt.Errorf("%w: invalid field path %q", ErrInvalidIndex, field)
+		}
+	}
+	dataTypes := strings.Split(iw.Index.DataType, ",")
+	if len(dataTypes) != 1 && len(dataTypes) != len(fields) {
+		return fmt.Errorf("%w: data_type must be a single type or one type per field", ErrInvalidIndex)
+	}
+	for _, dataType := range dataTypes {
+		if !ValidDataType(strings.TrimSpace(dataType)) {
+			return fmt.Errorf("%w: data_type must be one of string, int, float, bool", ErrInvalidIndex)
+		}
+	}
+
+	// Tên index là duy nhất trong collection
+	if _, err := iw.SQLiteCatalogService.GetIndexByName(iw.Index.CollectionID, iw.Index.Name); err == nil {
+		return fmt.Errorf("%w: index %s already exists in collection", ErrNameConflict, iw.Index.Name)
+	}
+
 	// Set status của index là building
 	iw.Index.Status = models.IndexStatusBuilding
 
 	// Tạo index trong catalog
-	err := iw.SQLiteCatalogService.CreateIndex(iw.Index)
+	err = iw.SQLiteCatalogService.CreateIndex(iw.Index)
 	if err != nil {
 		return fmt.Errorf("failed to create index: %v", err)
 	}
@@ -69,17 +110,25 @@ func (iw *IndexWrapper) CreateIndex() error {
 	if err != nil {
 		return fmt.Errorf("failed to get index: %v", err)
 	}
+	if err := iw.useBackend(iw.Index.Collection.Backend); err != nil {
+		return err
+	}
 
-	// Tạo index trong indexService
-	err = iw.BboltService.CreateIndex(iw.Index)
+	// Tạo index trong IndexStore của collection
+	err = iw.Indexes.CreateIndex(iw.Index)
 	if err != nil {
 		return fmt.Errorf("failed to create index: %v", err)
 	}
 
 	// Scan dữ liệu hiện có trong collection, insert vào index
+	// Nếu dữ liệu hiện có không thỏa index (sai kiểu dữ liệu, vi phạm unique) thì hủy index vừa tạo
+	buildStart := time.Now()
 	err = iw.scanDataAndInsert()
 	if err != nil {
-		return fmt.Errorf("failed to scan data and insert: %v", err)
+		if rollbackErr := iw.rollbackCreate(); rollbackErr != nil {
+			return fmt.Errorf("failed to scan data and insert: %v (rollback failed: %v)", err, rollbackErr)
+		}
+		return fmt.Errorf("%w: existing data does not satisfy index: %v", ErrInvalidIndex, err)
 	}
 
 	// Set status của index là ready
@@ -88,6 +137,9 @@ func (iw *IndexWrapper) CreateIndex() error {
 	if err != nil {
 		return fmt.Errorf("failed to update index: %v", err)
 	}
+	if err := iw.Indexes.RecordIndexBuild(iw.Index, time.Since(buildStart)); err != nil {
+		return fmt.Errorf("failed to record index build: %v", err)
+	}
 
 	// Thêm data cache vào index
 	err = iw.addCacheToIndex()
@@ -102,42 +154,80 @@ func (iw *IndexWrapper) CreateIndex() error {
 	return nil
 }
 
+// Rebuild xóa toàn bộ dữ liệu của index và build lại từ collection với cách mã hóa tuple
+// Dùng để chuyển index legacy sang KeyVersion mới. Nếu build lỗi, index chuyển sang inactive
+// và không còn được dùng cho query hay được cập nhật khi ghi
+func (iw *IndexWrapper) Rebuild() error {
+	iw.Index.Status = models.IndexStatusBuilding
+	iw.Index.KeyVersion = models.IndexKeyVersionTuple
+	if err := iw.SQLiteCatalogService.UpdateIndex(iw.Index); err != nil {
+		return fmt.Errorf("failed to update index: %v", err)
+	}
+
+	buildStart := time.Now()
+	err := iw.Indexes.ClearIndex(iw.Index)
+	if err == nil {
+		err = iw.scanDataAndInsert()
+	}
+	if err != nil {
+		iw.Index.Status = models.IndexStatusInactive
+		if updateErr := iw.SQLiteCatalogService.UpdateIndex(iw.Index); updateErr != nil {
+			return fmt.Errorf("failed to rebuild index: %v (failed to mark index inactive: %v)", err, updateErr)
+		}
+		return fmt.Errorf("%w: failed to rebuild index: %v", ErrInvalidIndex, err)
+	}
+
+	iw.Index.Status = models.IndexStatusActive
+	if err := iw.SQLiteCatalogService.UpdateIndex(iw.Index); err != nil {
+		return fmt.Errorf("failed to update index: %v", err)
+	}
+	if err := iw.Indexes.RecordIndexBuild(iw.Index, time.Since(buildStart)); err != nil {
+		return fmt.Errorf("failed to record index build: %v", err)
+	}
+
+	// Thêm các document được ghi trong lúc build
+	if err := iw.addCacheToIndex(); err != nil && !strings.Contains(err.Error(), "no such file or directory") {
+		return fmt.Errorf("failed to add cache to index: %v", err)
+	}
+	return nil
+}
+
+// rollbackCreate xóa file index, cache và index trong catalog khi build index thất bại
+func (iw *IndexWrapper) rollbackCreate() error {
+	if err := iw.Indexes.DeleteIndex(iw.Index); err != nil {
+		return err
+	}
+	cachePath := indexCacheDir(iw.Index)
+	if err := os.RemoveAll(cachePath); err != nil {
+		return err
+	}
+	return iw.SQLiteCatalogService.HardDeleteIndex(iw.Index.ID)
+}
+
 func (iw *IndexWrapper) scanDataAndInsert() error {
-	// Thực hiện một View transaction để đọc dữ liệu từ Badger
-	err := iw.BadgerService.Db.View(func(txn *badger.Txn) error {
-		// Tạo một iterator với các tùy chọn mặc định
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close() // Đảm bảo đóng iterator sau khi sử dụng xong
-
-		// Xác định prefix để duyệt qua các key thuộc về một collection cụ thể
-		prefix := []byte(fmt.Sprintf("%d||", iw.Index.Collection.ID))
-
-		// Duyệt qua các key bắt đầu với prefix
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			// Lấy giá trị của item và chèn vào index
-			err := item.Value(func(value []byte) error {
-				// Parse giá trị JSON thành `map[string]interface{}`
-				var record map[string]interface{}
-				err := json.Unmarshal(value, &record)
-				if err != nil {
-					return err
-				}
-
-				// Insert record vào index
-				err = iw.insertWithCheckingConstraint(record)
-				if err != nil {
-					return fmt.Errorf("failed to insert record: %v. Building index fail", err)
-				}
-				return nil
-			})
-
-			// Xử lý lỗi nếu có
-			if err != nil {
-				return err
-			}
+	// Xác định prefix để duyệt qua các key thuộc về một collection cụ thể
+	prefix := []byte(fmt.Sprintf("%d||", iw.Index.Collection.ID))
+
+	// Duyệt qua các document của collection và chèn vào index
+	err := iw.Documents.ScanPrefix(prefix, func(_, value []byte) (bool, error) {
+		// Parse giá trị JSON thành `map[string]interface{}`
+		var record map[string]interface{}
+		err := json.Unmarshal(value, &record)
+		if err != nil {
+			return false, err
 		}
-		return nil
+
+		// Document không thuộc index (thiếu field hoặc không thỏa filter) thì bỏ qua
+		if !indexCovers(iw.Index, record) {
+			return true, nil
+		}
+
+		// Insert record vào index
+		err = iw.insertWithCheckingConstraint(record)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert record: %v. Building index fail", err)
+		}
+		return true, nil
 	})
 
 	// Trả về lỗi nếu có trong quá trình xử lý
@@ -151,7 +241,7 @@ func (iw *IndexWrapper) scanDataAndInsert() error {
 // Đọc dữ liệu từ cache của index
 func (iw *IndexWrapper) readCache() ([]map[string]interface{}, error) {
 	// Đường dẫn tới file cache
-	cachePath := fmt.Sprintf("data/cache/collection_%s/index_%s/data.json", iw.Index.Collection.Name, iw.Index.Name)
+	cachePath := filepath.Join(indexCacheDir(iw.Index), "data.json")
 
 	// Mở file cache
 	f, err := os.Open(cachePath)
@@ -181,19 +271,164 @@ func (iw *IndexWrapper) addCacheToIndex() error {
 	if err != nil {
 		return fmt.Errorf("failed to read cache: %v", err)
 	}
-	for _, record := range data {
-		err := iw.insertWithCheckingConstraint(record)
+	for _, cached := range data {
+		// Đọc lại document từ Badger: lần ghi bị lỗi không còn document, bỏ qua để không tạo key mồ côi
+		key, ok := cached["_key"].(string)
+		if !ok {
+			continue
+		}
+		record, err := iw.readDocument(key)
+		if errors.Is(err, ErrDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !indexCovers(iw.Index, record) {
+			continue
+		}
+		err = iw.insertWithCheckingConstraint(record)
 		if err != nil {
 			return fmt.Errorf("failed to insert record: %v", err)
 		}
 	}
+
+	// Cache đã được đưa vào index, xóa để lần build sau không thêm lại
+	cachePath := filepath.Join(indexCacheDir(iw.Index), "data.json")
+	if err := os.Remove(cachePath); err != nil {
+		return fmt.Errorf("failed to remove cache: %v", err)
+	}
+	return nil
+}
+
+// readDocument đọc document của collection chứa index theo key
+func (iw *IndexWrapper) readDocument(key string) (map[string]interface{}, error) {
+	collectionWrapper := &CollectionWrapper{
+		SQLiteCatalogService: iw.SQLiteCatalogService,
+		Collection:           &models.Collection{ID: iw.Index.CollectionID},
+		Storage:              iw.Storage,
+		Documents:            iw.Documents,
+		Indexes:              iw.Indexes,
+	}
+	return collectionWrapper.Read(key)
+}
+
+// LookupKeys trả về các key của document có giá trị value trong index, theo thứ tự tăng dần
+func (iw *IndexWrapper) LookupKeys(value interface{}) ([]string, error) {
+	valueAsBytes, err := InterfaceToBytes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err = iw.Indexes.ScanValue(iw.Index, valueAsBytes, func(key string) (bool, error) {
+		keys = append(keys, key)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Update cập nhật index khi document thay đổi từ oldInput sang newInput
+// Document có thể đi vào hoặc ra khỏi partial index, giá trị của field mảng có thể được thêm hoặc bớt
+func (iw *IndexWrapper) Update(oldInput, newInput map[string]interface{}) error {
+	if iw.Index.Status == models.IndexStatusInactive {
+		return nil
+	}
+
+	key, ok := newInput["_key"].(string)
+	if !ok {
+		return fmt.Errorf("input must contain a string '_key' field")
+	}
+
+	oldValues, err := iw.coveredValues(oldInput)
+	if err != nil {
+		return err
+	}
+	newValues, err := iw.coveredValues(newInput)
+	if err != nil {
+		return err
+	}
+
+	for id, value := range oldValues {
+		if _, ok := newValues[id]; ok {
+			continue
+		}
+		if err := iw.RemoveKeyFromNode(value, key); err != nil {
+			return fmt.Errorf("failed to remove key from node: %v", err)
+		}
+	}
+	for id, value := range newValues {
+		if _, ok := oldValues[id]; ok {
+			continue
+		}
+		if err := iw.AddKeyToNode(value, key); err != nil {
+			return fmt.Errorf("failed to add key to node: %v", err)
+		}
+	}
 	return nil
 }
 
-// Query 1 record với giá trị value
-func (iw *IndexWrapper) Query(value interface{}) (map[string]interface{}, error) {
-	return nil, nil
+// Remove xóa document khỏi index, dùng để hoàn tác khi ghi document bị lỗi
+// Index đang build nhận document qua cache, document không còn trong Badger sẽ bị bỏ qua khi đọc cache
+func (iw *IndexWrapper) Remove(input map[string]interface{}) error {
+	if iw.Index.Status != models.IndexStatusActive {
+		return nil
+	}
+
+	key, ok := input["_key"].(string)
+	if !ok {
+		return fmt.Errorf("input must contain a string '_key' field")
+	}
 
+	values, err := iw.coveredValues(input)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := iw.RemoveKeyFromNode(value, key); err != nil {
+			return fmt.Errorf("failed to remove key from node: %v", err)
+		}
+	}
+	return nil
+}
+
+// coveredValues trả về các value của document trong index theo dạng bytes, rỗng nếu document không thuộc index
+func (iw *IndexWrapper) coveredValues(input map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if input == nil || !indexCovers(iw.Index, input) {
+		return result, nil
+	}
+	values, err := iw.documentValues(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		valueAsBytes, err := InterfaceToBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		result[string(valueAsBytes)] = value
+	}
+	return result, nil
+}
+
+// documentValues trả về các value của document trong index như indexValues, và đánh dấu index là multikey
+// trước khi document có nhiều value được ghi, vì query không được dùng cả cận dưới và cận trên khi scan index multikey
+func (iw *IndexWrapper) documentValues(input map[string]interface{}) ([]interface{}, error) {
+	values, err := indexValues(iw.Index, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 1 && !iw.Index.Multikey {
+		if err := iw.SQLiteCatalogService.SetIndexMultikey(iw.Index.ID); err != nil {
+			return nil, fmt.Errorf("failed to mark index %s as multikey: %v", iw.Index.Name, err)
+		}
+		iw.Index.Multikey = true
+	}
+	return values, nil
 }
 
 // Insert 1 input vào index
@@ -206,12 +441,13 @@ func (iw *IndexWrapper) InsertWithCheckingStatus(input map[string]interface{}) e
 		return fmt.Errorf("input must contain a '_key' field")
 	}
 
-	// Kiểm tra input có field nằm trong index không, nếu không có, thì không cần xử lý
-	if _, ok := input[iw.Index.Fields]; !ok {
+	// Index là sparse và có thể là partial index: document thiếu field của index
+	// hoặc không thỏa filter của index thì không được đưa vào index
+	if iw.Index.Status == models.IndexStatusInactive || !indexCovers(iw.Index, input) {
 		return nil
 	}
 
-	// Nếu trạng thái status của index là building, thì cache lại trong data/cache/collection_<collection_name>/index_<index_name>/data.json
+	// Nếu trạng thái status của index là building, thì cache lại trong data/cache/collection_<collection_id>/index_<index_id>/data.json
 	if iw.Index.Status == models.IndexStatusBuilding {
 		fmt.Println("DEBUG: Index is building")
 		return iw.insertToCache(input)
@@ -221,38 +457,58 @@ func (iw *IndexWrapper) InsertWithCheckingStatus(input map[string]interface{}) e
 }
 
 func (iw *IndexWrapper) insertWithCheckingConstraint(input map[string]interface{}) error {
-	// Lấy giá trị của value
+	// Lấy các giá trị của value
 	// Nếu index là loại hỗn hợp (type là hash)), thì giá trị value sẽ là một tổ hợp md5 %s%s của các trường khác nhau
 	// Nếu index là loại đơn, thì giá trị value sẽ là giá trị của trường đó
-	value := iw.getValueFromInput(input)
+	// Nếu field là mảng (multikey), mỗi phần tử là một value riêng trỏ tới document
+	values, err := iw.documentValues(input)
+	if err != nil {
+		return err
+	}
 
 	// Lấy giá trị của key. Là giá trị của trường _key trong input
-	key := input["_key"].(string)
+	key, ok := input["_key"].(string)
+	if !ok {
+		return fmt.Errorf("input must contain a string '_key' field")
+	}
 
 	// check constraints
-	err := iw.CheckIndexConstraints(input)
+	err = iw.CheckIndexConstraints(input)
 	if err != nil {
 		return fmt.Errorf("failed to check index constraints: %v", err)
 	}
 
-	// Thêm key vào node
-	err = iw.AddKeyToNode(value, key)
-	if err != nil {
-		return fmt.Errorf("failed to add key to node: %v", err)
+	// Thêm key vào node của từng value
+	for _, value := range values {
+		err = iw.AddKeyToNode(value, key)
+		if err != nil {
+			return fmt.Errorf("failed to add key to node: %v", err)
+		}
 	}
 
 	return nil
 }
 
+// collectionCacheDir là thư mục cache của các index đang build của collection
+// Đường dẫn theo ID vì tên collection và index chỉ duy nhất trong workspace
+func collectionCacheDir(collectionID int) string {
+	return filepath.Join("data", "cache", fmt.Sprintf("collection_%d", collectionID))
+}
+
+// indexCacheDir là thư mục cache của index đang build
+func indexCacheDir(index *models.Index) string {
+	return filepath.Join(collectionCacheDir(index.CollectionID), fmt.Sprintf("index_%d", index.ID))
+}
+
 func (iw *IndexWrapper) insertToCache(input map[string]interface{}) error {
 	// Lấy đường dẫn tới file cache, tạo thư mục nếu chưa tồn tại
-	cachePath := fmt.Sprintf("data/cache/collection_%s/index_%s/data.json", iw.Index.Collection.Name, iw.Index.Name)
+	cachePath := filepath.Join(indexCacheDir(iw.Index), "data.json")
 	if err := os.MkdirAll(filepath.Dir(cachePath), os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create cache folder: %v", err)
 	}
 
 	// Ghi input vào file cache, ghi vào dòng cuối cùng
-	f, err := os.Create(cachePath)
+	f, err := os.OpenFile(cachePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create cache file: %v", err)
 	}
@@ -275,23 +531,10 @@ func (iw *IndexWrapper) insertToCache(input map[string]interface{}) error {
 // 	return append(keysInIndex, key), nil
 // }
 
-// Hàm lấy value từ input
-func (iw *IndexWrapper) getValueFromInput(input map[string]interface{}) interface{} {
-	if iw.Index.IndexType == models.IndexTypeHash {
-		fieldsList := strings.Split(iw.Index.Fields, ",")
-		preHashedValue := ""
-		for _, field := range fieldsList {
-			preHashedValue += input[field].(string)
-		}
-		md5Value := md5.Sum([]byte(preHashedValue))
-		return fmt.Sprintf("%x", md5Value)
-	}
-	return input[iw.Index.Fields]
-}
-
 // Hàm kiểm tra input có thỏa mãn ràng buộc của index không
 func (iw *IndexWrapper) CheckIndexConstraints(input map[string]interface{}) error {
-	if iw.Index.IsUnique {
+	// Document không thuộc index hoặc index không hoạt động thì không cần kiểm tra ràng buộc
+	if iw.Index.IsUnique && iw.Index.Status != models.IndexStatusInactive && indexCovers(iw.Index, input) {
 		return iw.checkUniqueConstraints(input)
 	}
 	return nil
@@ -299,12 +542,30 @@ func (iw *IndexWrapper) CheckIndexConstraints(input map[string]interface{}) erro
 }
 
 // check contraints unique của index
+// Với field mảng, mỗi phần tử không được trùng với value của document khác,
+// các phần tử trùng nhau trong cùng một document được tính là một value
 func (iw *IndexWrapper) checkUniqueConstraints(input map[string]interface{}) error {
 	// Loại index có nhiều hơn 2 field, contruct value từ các field
-	value := iw.getValueFromInput(input)
+	values, err := indexValues(iw.Index, input)
+	if err != nil {
+		return err
+	}
+
+	inputKey, ok := input["_key"].(string)
+	if !ok {
+		return fmt.Errorf("input must contain a string '_key' field")
+	}
 
-	inputKey := input["_key"].(string)
+	for _, value := range values {
+		if err := iw.checkUniqueValue(value, inputKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// checkUniqueValue kiểm tra value chưa được dùng bởi document khác ngoài inputKey
+func (iw *IndexWrapper) checkUniqueValue(value interface{}, inputKey string) error {
 	// Kiểm tra node, nếu node không tồn tại, không cần kiểm tra ràng buộc
 	nodeExist, err := iw.NodeExist(value)
 	if err != nil {
@@ -326,11 +587,8 @@ func (iw *IndexWrapper) checkUniqueConstraints(input map[string]interface{}) err
 	}
 }
 
-// Thêm 1 key vào node, với value là giá trị của key
+// Thêm 1 key vào posting list của value, thống kê của index được cập nhật cùng lúc
 func (iw *IndexWrapper) AddKeyToNode(value interface{}, key string) error {
-	// filename
-	filename := iw.BboltService.GetFileNameFromIndex(iw.Index)
-
 	// Ép kiểu value
 	valueAsBytes, err := InterfaceToBytes(value)
 	if err != nil {
@@ -338,52 +596,21 @@ func (iw *IndexWrapper) AddKeyToNode(value interface{}, key string) error {
 		return err
 	}
 
-	isNodeExist, err := iw.NodeExist(value)
+	return iw.Indexes.AddEntry(iw.Index, valueAsBytes, key)
+}
+
+// Xóa 1 key khỏi posting list của value, value không còn key nào sẽ không còn trong index
+func (iw *IndexWrapper) RemoveKeyFromNode(value interface{}, key string) error {
+	valueAsBytes, err := InterfaceToBytes(value)
 	if err != nil {
-		fmt.Println("Failed to check node exist: ", err)
 		return err
 	}
 
-	if isNodeExist {
-		// Lấy node
-		node, err := iw.BboltService.GetAndParseAsNode(filename, []byte("default"), valueAsBytes)
-		if err != nil {
-			fmt.Println("Failed to get node: ", err)
-			return err
-		}
-
-		// Thêm key vào node
-		node.Keys.Add(key)
-
-		// Ghi lại node
-		err = iw.BboltService.SetNode(filename, []byte("default"), node)
-		if err != nil {
-			fmt.Println("Failed to set node: ", err)
-			return err
-		}
-	} else {
-		// Tạo node mới
-		node := &models.Node{
-			Value: valueAsBytes,
-			Keys:  mapset.NewSet[string](),
-		}
-		node.Keys.Add(key)
-		// Ghi node
-		err = iw.BboltService.SetNode(filename, []byte("default"), node)
-		if err != nil {
-			fmt.Println("Failed to set node: ", err)
-			return err
-		}
-	}
-
-	return nil
+	return iw.Indexes.RemoveEntry(iw.Index, valueAsBytes, key)
 }
 
-// Kiểm tra node exist
+// Kiểm tra value có trong index không (posting list của value có ít nhất một key)
 func (iw *IndexWrapper) NodeExist(value interface{}) (bool, error) {
-	// filename
-	filename := iw.BboltService.GetFileNameFromIndex(iw.Index)
-
 	// Ép kiểu value
 	valueAsBytes, err := InterfaceToBytes(value)
 	if err != nil {
@@ -391,25 +618,16 @@ func (iw *IndexWrapper) NodeExist(value interface{}) (bool, error) {
 		return false, err
 	}
 
-	// Lấy node
-	_, err = iw.BboltService.GetAndParseAsNode(filename, []byte("default"), valueAsBytes)
-	// Nếu mã lỗi là 'key %v not found', thì node không tồn tại
-	if err != nil && strings.Contains(err.Error(), fmt.Sprintf("key %v not found", value)) {
-		return false, nil
-	}
+	count, err := iw.Indexes.CountEntries(iw.Index, valueAsBytes)
 	if err != nil {
-		fmt.Println("Failed to get node: ", err)
+		log.Printf("Failed to count entries: %v", err)
 		return false, err
 	}
-
-	return true, nil
+	return count > 0, nil
 }
 
-// Kiểm tra key có tồn tại trong node.keys không
+// Kiểm tra key có trong posting list của value không
 func (iw *IndexWrapper) KeyExist(value interface{}, key string) (bool, error) {
-	// filename
-	filename := iw.BboltService.GetFileNameFromIndex(iw.Index)
-
 	// Ép kiểu value
 	valueAsBytes, err := InterfaceToBytes(value)
 	if err != nil {
@@ -417,24 +635,7 @@ func (iw *IndexWrapper) KeyExist(value interface{}, key string) (bool, error) {
 		return false, err
 	}
 
-	// Lấy node
-	node, err := iw.BboltService.GetAndParseAsNode(filename, []byte("default"), valueAsBytes)
-	if err != nil {
-		fmt.Println("Failed to get node: ", err)
-		return false, err
-	}
-
-	// Kiểm tra nếu node không tồn tại
-	if node == nil {
-		return false, nil
-	}
-
-	// Kiểm tra nếu key tồn tại trong node.Keys
-	if node.Keys.Contains(key) {
-		return true, nil
-	}
-
-	return false, nil
+	return iw.Indexes.HasEntry(iw.Index, valueAsBytes, key)
 }
 
 // InterfaceToBytes chuyển đổi một interface{} thành []byte dựa trên kiểu của nó
@@ -449,6 +650,12 @@ func InterfaceToBytes(value interface{}) ([]byte, error) {
 	case string:
 		// Chuyển đổi string trực tiếp thành []byte
 		return []byte(v), nil
+	case bool:
+		// Chuyển đổi bool thành []byte
+		return []byte(fmt.Sprintf("%t", v)), nil
+	case []byte:
+		// Giá trị đã được mã hóa (tuple)
+		return v, nil
 	default:
 		// Trường hợp không hỗ trợ kiểu dữ liệu
 		return nil, fmt.Errorf("unsupported type: %T", value)
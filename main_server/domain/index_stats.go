@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// IndexStatsReport là thống kê của index trả về qua API, value của các top node được giải mã để dễ đọc
+type IndexStatsReport struct {
+	IndexID      int       `json:"index_id"`
+	Name         string    `json:"name"`
+	CollectionID int       `json:"collection_id"`
+	Status       string    `json:"status"`
+	IsUnique     bool      `json:"is_unique"`
+	CreatedAt    time.Time `json:"created_at"`
+	models.IndexStats
+	TopNodes        []TopNodeReport `json:"top_nodes"`          // Thay cho TopNodes của models.IndexStats
+	AvgKeysPerValue float64         `json:"avg_keys_per_value"` // Số document trung bình của một value
+}
+
+// TopNodeReport là một node nhiều key trong index
+// Value là giá trị của field (hoặc danh sách giá trị với index nhiều field), với index Hash là chuỗi md5
+type TopNodeReport struct {
+	Value interface{} `json:"value"`
+	Keys  int64       `json:"keys"`
+}
+
+// Stats trả về thống kê của index
+func (iw *IndexWrapper) Stats() (*IndexStatsReport, error) {
+	stats, err := iw.Indexes.GetIndexStats(iw.Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index stats: %v", err)
+	}
+
+	report := &IndexStatsReport{
+		IndexID:      iw.Index.ID,
+		Name:         iw.Index.Name,
+		CollectionID: iw.Index.CollectionID,
+		Status:       iw.Index.Status,
+		IsUnique:     iw.Index.IsUnique,
+		CreatedAt:    iw.Index.CreatedAt,
+		IndexStats:   *stats,
+		TopNodes:     make([]TopNodeReport, 0, len(stats.TopNodes)),
+	}
+	if stats.DistinctValues > 0 {
+		report.AvgKeysPerValue = float64(stats.EntryCount) / float64(stats.DistinctValues)
+	}
+	for _, node := range stats.TopNodes {
+		report.TopNodes = append(report.TopNodes, TopNodeReport{Value: decodeNodeValue(iw.Index, node.Value), Keys: node.Keys})
+	}
+	return report, nil
+}
+
+// decodeNodeValue chuyển value lưu trong bbolt về dạng giá trị của field
+func decodeNodeValue(index *models.Index, value []byte) interface{} {
+	if index.KeyVersion != models.IndexKeyVersionTuple || index.IndexType != models.IndexTypeBTree {
+		return string(value)
+	}
+	components, err := DecodeTuple(value)
+	if err != nil {
+		return string(value)
+	}
+	if len(components) == 1 {
+		return components[0]
+	}
+	return components
+}
+
+// estimate ước lượng số document mà truy cập index phải đọc, dựa trên thống kê của index
+// Truy cập một value (lookup, hoặc range scan có điều kiện bằng trên tất cả các field): số key của node
+// nếu value nằm trong top node, nếu không thì số key trung bình của một value
+// Range scan khác: tổng số cặp (value, key) của index, là cận trên
+func (a *indexAccess) estimate(stats *models.IndexStats) int64 {
+	var valueAsBytes []byte
+	var err error
+	switch {
+	case a.lookupValue != nil:
+		valueAsBytes, err = InterfaceToBytes(a.lookupValue)
+	case len(a.ranges) == 0 && len(a.equalities) == len(indexFields(a.index)):
+		values := make([]interface{}, 0, len(a.equalities))
+		for _, condition := range a.equalities {
+			values = append(values, condition.Value)
+		}
+		valueAsBytes, err = EncodeTuple(values)
+	default:
+		return stats.EntryCount
+	}
+	if err != nil {
+		return stats.EntryCount
+	}
+
+	for _, node := range stats.TopNodes {
+		if string(node.Value) == string(valueAsBytes) {
+			return node.Keys
+		}
+	}
+	if stats.DistinctValues == 0 {
+		return 0
+	}
+	return (stats.EntryCount + stats.DistinctValues - 1) / stats.DistinctValues
+}
+
+// UnusedIndexes trả về thống kê của các index trong workspace không được query nào dùng kể từ since
+// Index unique vẫn có thể cần để đảm bảo ràng buộc dù không được query dùng, xem trường is_unique
+func (cw *WorkspaceWrapper) UnusedIndexes(since time.Time) ([]IndexStatsReport, error) {
+	collections, err := cw.SQLiteCatalogService.ListCollectionsByWorkspace(cw.Workspace.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %v", err)
+	}
+
+	reports := make([]IndexStatsReport, 0)
+	for i := range collections {
+		for j := range collections[i].Indexes {
+			index := &collections[i].Indexes[j]
+			indexWrapper := &IndexWrapper{
+				SQLiteCatalogService: cw.SQLiteCatalogService,
+				Index:                index,
+				Storage:              cw.Storage,
+			}
+			if err := indexWrapper.useBackend(collections[i].Backend); err != nil {
+				return nil, err
+			}
+			report, err := indexWrapper.Stats()
+			if err != nil {
+				return nil, fmt.Errorf("index %s of collection %s: %v", index.Name, collections[i].Name, err)
+			}
+			if report.LastUsedAt == nil || report.LastUsedAt.Before(since) {
+				reports = append(reports, *report)
+			}
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"crypto/md5"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// indexFields trả về danh sách field của index, Fields có dạng "field1,field2"
+// Mỗi field có thể là đường dẫn dạng "address.city" tới field lồng trong object
+func indexFields(index *models.Index) []string {
+	fields := strings.Split(index.Fields, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// lookupPath lấy giá trị theo đường dẫn dạng "a.b.c" trong document
+func lookupPath(document map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = document
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// hasIndexFields kiểm tra document có đủ tất cả các field của index không
+func hasIndexFields(index *models.Index, document map[string]interface{}) bool {
+	for _, field := range indexFields(index) {
+		if _, ok := lookupPath(document, field); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// indexCovers kiểm tra document có thuộc index không: có đủ các field của index và thỏa filter của partial index
+// Document không thuộc index thì không được đưa vào index và không bị kiểm tra ràng buộc của index
+func indexCovers(index *models.Index, document map[string]interface{}) bool {
+	if !hasIndexFields(index, document) {
+		return false
+	}
+	if index.Filter == "" {
+		return true
+	}
+	filter, err := ParseFilter(index.Filter)
+	if err != nil {
+		log.Printf("Error parsing filter of index %d: %v", index.ID, err)
+		return false
+	}
+	return filter.Match(document)
+}
+
+// indexDataTypes trả về kiểu dữ liệu của từng field, DataType có thể là một kiểu chung hoặc danh sách "string,float"
+func indexDataTypes(index *models.Index) []string {
+	fields := indexFields(index)
+	dataTypes := strings.Split(index.DataType, ",")
+	for i := range dataTypes {
+		dataTypes[i] = strings.TrimSpace(dataTypes[i])
+	}
+	if len(dataTypes) == len(fields) {
+		return dataTypes
+	}
+	result := make([]string, len(fields))
+	for i := range result {
+		result[i] = dataTypes[0]
+	}
+	return result
+}
+
+// indexValues trả về các value mà document được đưa vào index, giá trị của các field phải đúng kiểu dữ liệu khai báo
+// Field là mảng được index theo từng phần tử (multikey), các phần tử trùng nhau chỉ tính một lần,
+// mảng rỗng nghĩa là document không nằm trong index
+// Index nhiều field cho phép tối đa một field là mảng trong mỗi document, mỗi phần tử tạo ra một value riêng
+// Với KeyVersion tuple, value của B-Tree là tuple giữ thứ tự ([]byte), value của Hash là md5 của tuple
+func indexValues(index *models.Index, document map[string]interface{}) ([]interface{}, error) {
+	fields := indexFields(index)
+	dataTypes := indexDataTypes(index)
+	elements := make([][]interface{}, len(fields))
+	arrayFields := 0
+
+	for i, field := range fields {
+		value, ok := lookupPath(document, field)
+		if !ok {
+			return nil, fmt.Errorf("field %s is missing", field)
+		}
+
+		if array, isArray := value.([]interface{}); isArray {
+			arrayFields++
+			elements[i] = uniqueValues(array)
+		} else {
+			elements[i] = []interface{}{value}
+		}
+
+		for _, element := range elements[i] {
+			if err := checkDataType(element, dataTypes[i]); err != nil {
+				return nil, fmt.Errorf("field %s: %v", field, err)
+			}
+		}
+	}
+
+	if index.KeyVersion == models.IndexKeyVersionLegacy && index.IndexType != models.IndexTypeHash {
+		return elements[0], nil
+	}
+
+	if arrayFields > 1 {
+		return nil, fmt.Errorf("at most one array field is allowed in index %s", index.Name)
+	}
+
+	// Tổ hợp giá trị các field, tối đa một field có nhiều phần tử nên số tổ hợp bằng số phần tử của mảng
+	tuples := [][]interface{}{{}}
+	for i := range fields {
+		next := make([][]interface{}, 0, len(tuples)*len(elements[i]))
+		for _, tuple := range tuples {
+			for _, element := range elements[i] {
+				next = append(next, append(append([]interface{}{}, tuple...), element))
+			}
+		}
+		tuples = next
+	}
+
+	values := make([]interface{}, 0, len(tuples))
+	for _, tuple := range tuples {
+		if index.KeyVersion == models.IndexKeyVersionLegacy {
+			// Index Hash cũ: md5 của các giá trị nối liền nhau, không có dấu phân cách
+			preHashedValue := ""
+			for i, element := range tuple {
+				elementBytes, err := InterfaceToBytes(element)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %v", fields[i], err)
+				}
+				preHashedValue += string(elementBytes)
+			}
+			values = append(values, fmt.Sprintf("%x", md5.Sum([]byte(preHashedValue))))
+			continue
+		}
+
+		encoded, err := EncodeTuple(tuple)
+		if err != nil {
+			return nil, err
+		}
+		if index.IndexType == models.IndexTypeHash {
+			values = append(values, fmt.Sprintf("%x", md5.Sum(encoded)))
+		} else {
+			values = append(values, encoded)
+		}
+	}
+	return values, nil
+}
+
+// uniqueValues bỏ các phần tử trùng nhau trong mảng, giữ nguyên thứ tự
+func uniqueValues(array []interface{}) []interface{} {
+	seen := make(map[string]bool, len(array))
+	result := make([]interface{}, 0, len(array))
+	for _, element := range array {
+		id := fmt.Sprintf("%T:%v", element, element)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, element)
+	}
+	return result
+}
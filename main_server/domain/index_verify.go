@@ -0,0 +1,247 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// verifySampleLimit là số phần tử tối đa của mỗi danh sách trong báo cáo verify, các con số đếm vẫn là đầy đủ
+const verifySampleLimit = 100
+
+// IndexEntry là một cặp (value, key) trong index
+type IndexEntry struct {
+	Value interface{} `json:"value"`
+	Key   string      `json:"key"`
+}
+
+// UniqueViolation là một value của index unique được dùng bởi nhiều document
+type UniqueViolation struct {
+	Value interface{} `json:"value"`
+	Keys  []string    `json:"keys"`
+}
+
+// IndexVerifyReport là kết quả đối chiếu index với document của collection
+type IndexVerifyReport struct {
+	IndexID          int    `json:"index_id"`
+	Name             string `json:"name"`
+	CollectionID     int    `json:"collection_id"`
+	DocumentsScanned int64  `json:"documents_scanned"`
+	EntriesScanned   int64  `json:"entries_scanned"`
+
+	MissingCount         int64             `json:"missing_count"`          // Document thuộc index nhưng thiếu entry
+	Missing              []IndexEntry      `json:"missing"`                // Tối đa verifySampleLimit entry
+	OrphanCount          int64             `json:"orphan_count"`           // Entry không ứng với document nào
+	Orphans              []IndexEntry      `json:"orphans"`                // Tối đa verifySampleLimit entry
+	UniqueViolationCount int64             `json:"unique_violation_count"` // Value của index unique có nhiều document
+	UniqueViolations     []UniqueViolation `json:"unique_violations"`      // Tối đa verifySampleLimit value
+	InvalidDocumentCount int64             `json:"invalid_document_count"` // Document có field sai kiểu dữ liệu của index
+	InvalidDocuments     []string          `json:"invalid_documents"`      // Key của tối đa verifySampleLimit document
+	CountMismatches      int64             `json:"count_mismatches"`       // Value có số key đếm sẵn khác số entry
+
+	Consistent bool `json:"consistent"`
+	Repaired   bool `json:"repaired"`
+}
+
+// indexEntryID định danh một entry theo value đã mã hóa và key của document
+type indexEntryID struct {
+	value string
+	key   string
+}
+
+// Verify đối chiếu toàn bộ entry của index với các document của collection và báo cáo các entry thiếu,
+// entry mồ côi, vi phạm unique và document sai kiểu dữ liệu.
+// Nếu repair = true, entry thiếu được thêm, entry mồ côi bị xóa và số đếm của từng value được tính lại.
+// Vi phạm unique và document sai kiểu dữ liệu chỉ được báo cáo, cần sửa dữ liệu rồi verify lại.
+// Các entry mong đợi được giữ trong bộ nhớ, nên nên chạy khi collection ít ghi; mỗi thay đổi khi repair
+// được kiểm tra lại với document hiện tại để không xóa nhầm dữ liệu vừa được ghi
+func (iw *IndexWrapper) Verify(repair bool) (*IndexVerifyReport, error) {
+	switch iw.Index.Status {
+	case models.IndexStatusBuilding:
+		return nil, ErrIndexBuilding
+	case models.IndexStatusInactive:
+		return nil, fmt.Errorf("%w: index %s is inactive, rebuild it instead", ErrInvalidIndex, iw.Index.Name)
+	}
+
+	report := &IndexVerifyReport{
+		IndexID:          iw.Index.ID,
+		Name:             iw.Index.Name,
+		CollectionID:     iw.Index.CollectionID,
+		Missing:          make([]IndexEntry, 0),
+		Orphans:          make([]IndexEntry, 0),
+		UniqueViolations: make([]UniqueViolation, 0),
+		InvalidDocuments: make([]string, 0),
+	}
+	// Số đếm của value được sửa trước, để các thay đổi entry sau đó cập nhật thống kê đúng
+	mismatches, err := iw.Indexes.CheckCounts(iw.Index, repair)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check index counts: %v", err)
+	}
+	report.CountMismatches = mismatches
+
+	expected, err := iw.expectedEntries(report)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []indexEntryID
+	err = iw.Indexes.ScanEntries(iw.Index, nil, nil, func(value []byte, key string) (bool, error) {
+		report.EntriesScanned++
+		id := indexEntryID{value: string(value), key: key}
+		if _, ok := expected[id]; ok {
+			delete(expected, id)
+			return true, nil
+		}
+		orphans = append(orphans, id)
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan index entries: %v", err)
+	}
+
+	// Các entry mong đợi còn lại là các entry bị thiếu
+	missing := make([]indexEntryID, 0, len(expected))
+	for id := range expected {
+		missing = append(missing, id)
+	}
+	sortEntryIDs(missing)
+
+	report.OrphanCount, report.MissingCount = int64(len(orphans)), int64(len(missing))
+	for _, id := range orphans {
+		if len(report.Orphans) >= verifySampleLimit {
+			break
+		}
+		report.Orphans = append(report.Orphans, IndexEntry{Value: decodeNodeValue(iw.Index, []byte(id.value)), Key: id.key})
+	}
+	for _, id := range missing {
+		if len(report.Missing) >= verifySampleLimit {
+			break
+		}
+		report.Missing = append(report.Missing, IndexEntry{Value: decodeNodeValue(iw.Index, []byte(id.value)), Key: id.key})
+	}
+	report.Consistent = report.MissingCount == 0 && report.OrphanCount == 0 && report.UniqueViolationCount == 0 &&
+		report.InvalidDocumentCount == 0 && report.CountMismatches == 0
+
+	if repair {
+		if err := iw.repairEntries(missing, orphans); err != nil {
+			return nil, err
+		}
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+// expectedEntries duyệt các document của collection và trả về các entry mà index phải có,
+// đồng thời ghi vào report số document, document sai kiểu dữ liệu và vi phạm unique
+func (iw *IndexWrapper) expectedEntries(report *IndexVerifyReport) (map[indexEntryID]struct{}, error) {
+	expected := make(map[indexEntryID]struct{})
+	valueKeys := make(map[string][]string)
+	prefix := []byte(fmt.Sprintf("%d||", iw.Index.CollectionID))
+
+	err := iw.Documents.ScanPrefix(prefix, func(_, raw []byte) (bool, error) {
+		report.DocumentsScanned++
+		var document map[string]interface{}
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return false, err
+		}
+		key, ok := document["_key"].(string)
+		if !ok || !indexCovers(iw.Index, document) {
+			return true, nil
+		}
+
+		values, err := iw.coveredValues(document)
+		if err != nil {
+			report.InvalidDocumentCount++
+			if len(report.InvalidDocuments) < verifySampleLimit {
+				report.InvalidDocuments = append(report.InvalidDocuments, key)
+			}
+			return true, nil
+		}
+		for value := range values {
+			expected[indexEntryID{value: value, key: key}] = struct{}{}
+			valueKeys[value] = append(valueKeys[value], key)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan collection data: %v", err)
+	}
+
+	if iw.Index.IsUnique {
+		values := make([]string, 0)
+		for value, keys := range valueKeys {
+			if len(keys) > 1 {
+				values = append(values, value)
+			}
+		}
+		sort.Strings(values)
+		report.UniqueViolationCount = int64(len(values))
+		for _, value := range values {
+			if len(report.UniqueViolations) >= verifySampleLimit {
+				break
+			}
+			keys := valueKeys[value]
+			sort.Strings(keys)
+			report.UniqueViolations = append(report.UniqueViolations, UniqueViolation{Value: decodeNodeValue(iw.Index, []byte(value)), Keys: keys})
+		}
+	}
+	return expected, nil
+}
+
+// repairEntries xóa các entry mồ côi và thêm các entry thiếu
+// Trước mỗi thay đổi, document được đọc lại để bỏ qua các document đã thay đổi sau khi verify
+func (iw *IndexWrapper) repairEntries(missing, orphans []indexEntryID) error {
+	documentHasValue := func(id indexEntryID) (bool, error) {
+		document, err := iw.readDocument(id.key)
+		if errors.Is(err, ErrDocumentNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		values, err := iw.coveredValues(document)
+		if err != nil {
+			return false, nil
+		}
+		_, ok := values[id.value]
+		return ok, nil
+	}
+
+	for _, id := range orphans {
+		hasValue, err := documentHasValue(id)
+		if err != nil {
+			return err
+		}
+		if hasValue {
+			continue
+		}
+		if err := iw.Indexes.RemoveEntry(iw.Index, []byte(id.value), id.key); err != nil {
+			return fmt.Errorf("failed to remove orphan entry of %s: %v", id.key, err)
+		}
+	}
+	for _, id := range missing {
+		hasValue, err := documentHasValue(id)
+		if err != nil {
+			return err
+		}
+		if !hasValue {
+			continue
+		}
+		if err := iw.Indexes.AddEntry(iw.Index, []byte(id.value), id.key); err != nil {
+			return fmt.Errorf("failed to add missing entry of %s: %v", id.key, err)
+		}
+	}
+	return nil
+}
+
+func sortEntryIDs(ids []indexEntryID) {
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].value != ids[j].value {
+			return ids[i].value < ids[j].value
+		}
+		return ids[i].key < ids[j].key
+	})
+}
@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifyIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		// corrupt làm lệch index by_a với document, collection có k1 (a = x) và k2 (a = y)
+		corrupt      func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper)
+		missing      int64
+		orphans      int64
+		invalid      int64
+		repairable   bool
+		wantKeysOfX  []string
+		wantKeysOfY  []string
+		wantKeysOfZZ []string
+	}{
+		{
+			name:        "consistent",
+			corrupt:     func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper) {},
+			repairable:  true,
+			wantKeysOfX: []string{"k1"},
+			wantKeysOfY: []string{"k2"},
+		},
+		{
+			name: "missing entry",
+			corrupt: func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper) {
+				if err := iw.Indexes.RemoveEntry(iw.Index, encodeIndexValue(t, iw, "x"), "k1"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			missing:     1,
+			repairable:  true,
+			wantKeysOfX: []string{"k1"},
+			wantKeysOfY: []string{"k2"},
+		},
+		{
+			name: "orphan entry",
+			corrupt: func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper) {
+				if err := iw.Indexes.AddEntry(iw.Index, encodeIndexValue(t, iw, "zz"), "ghost"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			orphans:     1,
+			repairable:  true,
+			wantKeysOfX: []string{"k1"},
+			wantKeysOfY: []string{"k2"},
+		},
+		{
+			name: "document changed behind the index",
+			corrupt: func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper) {
+				raw, _ := json.Marshal(map[string]interface{}{"_key": "k2", "a": "zz", "b": "v"})
+				if err := documents.MemoryDocumentStore.Set([]byte(cw.CreateBadgerKey("k2")), raw); err != nil {
+					t.Fatal(err)
+				}
+			},
+			missing:      1,
+			orphans:      1,
+			repairable:   true,
+			wantKeysOfX:  []string{"k1"},
+			wantKeysOfZZ: []string{"k2"},
+		},
+		{
+			name: "invalid document",
+			corrupt: func(t *testing.T, cw *CollectionWrapper, documents *faultyDocumentStore, iw *IndexWrapper) {
+				raw, _ := json.Marshal(map[string]interface{}{"_key": "k2", "a": 5, "b": "v"})
+				if err := documents.MemoryDocumentStore.Set([]byte(cw.CreateBadgerKey("k2")), raw); err != nil {
+					t.Fatal(err)
+				}
+			},
+			orphans:     1,
+			invalid:     1,
+			wantKeysOfX: []string{"k1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw, documents := newTestCollection(t, testIndexes()...)
+			for _, input := range []map[string]interface{}{
+				{"_key": "k1", "a": "x", "b": "u"},
+				{"_key": "k2", "a": "y", "b": "v"},
+			} {
+				if err := cw.Write(input); err != nil {
+					t.Fatalf("failed to write %s: %v", input["_key"], err)
+				}
+			}
+			iw := testIndexWrapper(t, cw, "by_a")
+			tt.corrupt(t, cw, documents, iw)
+
+			report, err := iw.Verify(false)
+			if err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+			if report.MissingCount != tt.missing || report.OrphanCount != tt.orphans || report.InvalidDocumentCount != tt.invalid {
+				t.Fatalf("got missing %d, orphans %d, invalid %d, want %d, %d, %d",
+					report.MissingCount, report.OrphanCount, report.InvalidDocumentCount, tt.missing, tt.orphans, tt.invalid)
+			}
+			consistent := tt.missing == 0 && tt.orphans == 0 && tt.invalid == 0
+			if report.Consistent != consistent || report.Repaired {
+				t.Fatalf("got consistent %v, repaired %v, want %v, false", report.Consistent, report.Repaired, consistent)
+			}
+
+			if _, err := iw.Verify(true); err != nil {
+				t.Fatalf("failed to repair: %v", err)
+			}
+			report, err = iw.Verify(false)
+			if err != nil {
+				t.Fatalf("failed to verify after repair: %v", err)
+			}
+			if report.Consistent != tt.repairable {
+				t.Fatalf("after repair got consistent %v, want %v", report.Consistent, tt.repairable)
+			}
+			if report.MissingCount != 0 || report.OrphanCount != 0 {
+				t.Fatalf("after repair got missing %d, orphans %d", report.MissingCount, report.OrphanCount)
+			}
+			assertIndexedKeys(t, cw, "by_a", "x", tt.wantKeysOfX...)
+			assertIndexedKeys(t, cw, "by_a", "y", tt.wantKeysOfY...)
+			assertIndexedKeys(t, cw, "by_a", "zz", tt.wantKeysOfZZ...)
+		})
+	}
+}
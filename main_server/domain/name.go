@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidName được trả về khi tên workspace, collection hoặc index không hợp lệ
+	ErrInvalidName = errors.New("invalid name")
+	// ErrNameConflict được trả về khi tên đã được sử dụng trong cùng phạm vi
+	ErrNameConflict = errors.New("name already exists")
+)
+
+// ValidateName kiểm tra tên có thể dùng trong route thay cho ID không
+// Tên không được rỗng, không chứa '/' hoặc khoảng trắng ở đầu/cuối và không được chỉ gồm chữ số,
+// vì giá trị số trong route luôn được hiểu là ID
+func ValidateName(name string) error {
+	if name == "" || strings.TrimSpace(name) != name {
+		return fmt.Errorf("%w: name must not be empty or have leading/trailing spaces", ErrInvalidName)
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("%w: name must not contain '/'", ErrInvalidName)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("%w: name must not be numeric", ErrInvalidName)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+const (
+	// QueryPlanIndexLookup là plan tra cứu document qua index
+	QueryPlanIndexLookup = "index_lookup"
+	// QueryPlanIndexRangeScan là plan scan một khoảng key liên tục trong index B-Tree
+	QueryPlanIndexRangeScan = "index_range_scan"
+	// QueryPlanCollectionScan là plan duyệt toàn bộ collection
+	QueryPlanCollectionScan = "collection_scan"
+)
+
+// QueryPlan mô tả cách planner thực hiện query
+type QueryPlan struct {
+	Type          string `json:"type"`
+	Index         string `json:"index,omitempty"`
+	Bounds        string `json:"bounds,omitempty"`         // Các điều kiện được giải quyết bằng index
+	EstimatedKeys *int64 `json:"estimated_keys,omitempty"` // Số document ước lượng phải đọc qua index, theo thống kê của index
+}
+
+// QueryResult là kết quả của query kèm plan đã được dùng
+type QueryResult struct {
+	Plan      QueryPlan                `json:"plan"`
+	Documents []map[string]interface{} `json:"documents"`
+}
+
+// Query tìm các document thỏa filter, tối đa limit document
+// Planner dùng index active khi filter có điều kiện trên các field đứng đầu của index
+// và filter suy ra được filter của index (với partial index), nếu không thì duyệt toàn bộ collection
+// Mỗi lần index được chọn được ghi nhận vào thống kê của index
+func (cw *CollectionWrapper) Query(filterExpr string, limit int) (*QueryResult, error) {
+	filter, err := ParseFilter(filterExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	access := cw.planQuery(filter)
+	if access == nil {
+		documents, err := cw.scan(filter, limit)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{Plan: QueryPlan{Type: QueryPlanCollectionScan}, Documents: documents}, nil
+	}
+
+	if err := cw.Indexes.RecordIndexUsage(access.index); err != nil {
+		log.Printf("Failed to record usage of index %d: %v", access.index.ID, err)
+	}
+
+	documents, err := access.execute(cw, filter, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index %s: %v", access.index.Name, err)
+	}
+	return &QueryResult{Plan: access.plan(), Documents: documents}, nil
+}
+
+// indexAccess là cách truy cập một index cho query
+// Với index Hash hoặc index legacy: tra cứu đúng một value (lookup)
+// Với index B-Tree dạng tuple: scan các key có prefix là các giá trị bằng của các field đứng đầu,
+// có thể kèm điều kiện khoảng trên field tiếp theo
+type indexAccess struct {
+	index         *models.Index
+	lookupValue   interface{}
+	equalities    []Condition
+	ranges        []Condition
+	estimatedKeys int64 // -1 nếu index không có thống kê
+}
+
+// score dùng để chọn index tốt nhất, ưu tiên nhiều điều kiện bằng, rồi điều kiện khoảng, rồi index unique
+func (a *indexAccess) score() int {
+	score := len(a.equalities)*4 + len(a.ranges)*2
+	if a.index.IsUnique {
+		score++
+	}
+	return score
+}
+
+func (a *indexAccess) plan() QueryPlan {
+	conditions := append(append([]Condition{}, a.equalities...), a.ranges...)
+	planType := QueryPlanIndexLookup
+	if a.lookupValue == nil {
+		planType = QueryPlanIndexRangeScan
+	}
+	plan := QueryPlan{Type: planType, Index: a.index.Name, Bounds: (&Filter{Conditions: conditions}).String()}
+	if a.estimatedKeys >= 0 {
+		plan.EstimatedKeys = &a.estimatedKeys
+	}
+	return plan
+}
+
+// execute đọc các document qua index, filter đầy đủ vẫn được kiểm tra trên từng document
+// Posting list được đọc dần theo thứ tự, dừng khi đủ limit document
+func (a *indexAccess) execute(cw *CollectionWrapper, filter *Filter, limit int) ([]map[string]interface{}, error) {
+	documents := make([]map[string]interface{}, 0)
+	seen := make(map[string]bool)
+
+	// collect đọc document theo key, trả về false khi đã đủ limit
+	collect := func(key string) (bool, error) {
+		// Index multikey có thể trỏ tới cùng một document từ nhiều value
+		if seen[key] {
+			return true, nil
+		}
+		seen[key] = true
+
+		document, err := cw.Read(key)
+		if errors.Is(err, ErrDocumentNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if filter.Match(document) {
+			documents = append(documents, document)
+		}
+		return len(documents) < limit, nil
+	}
+
+	if a.lookupValue != nil {
+		valueAsBytes, err := InterfaceToBytes(a.lookupValue)
+		if err != nil {
+			return nil, err
+		}
+		err = cw.Indexes.ScanValue(a.index, valueAsBytes, collect)
+		return documents, err
+	}
+
+	equalityValues := make([]interface{}, 0, len(a.equalities))
+	for _, condition := range a.equalities {
+		equalityValues = append(equalityValues, condition.Value)
+	}
+	prefix, err := EncodeTuple(equalityValues)
+	if err != nil {
+		return nil, err
+	}
+	start := prefix
+	for _, condition := range a.ranges {
+		if condition.Op == FilterOpGreater || condition.Op == FilterOpGreaterEqual {
+			if start, err = EncodeTuple(append(equalityValues, condition.Value)); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	// Các entry cùng value nằm liền nhau, chỉ kiểm tra điều kiện khoảng một lần cho mỗi value
+	position := len(a.equalities)
+	var lastValue []byte
+	inRange := true
+	err = cw.Indexes.ScanEntries(a.index, start, prefix, func(value []byte, key string) (bool, error) {
+		if len(a.ranges) > 0 && !bytes.Equal(value, lastValue) {
+			lastValue = value
+			components, err := DecodeTuple(value)
+			if err != nil {
+				return false, err
+			}
+			inRange = position < len(components)
+			for _, condition := range a.ranges {
+				if !inRange || compareOp(condition.Op, compareFilterValues(components[position], condition.Value)) {
+					continue
+				}
+				// Key được sắp xếp theo field này, vượt cận trên thì các key sau cũng vượt
+				if condition.Op == FilterOpLess || condition.Op == FilterOpLessEqual {
+					return false, nil
+				}
+				inRange = false
+			}
+		}
+		if !inRange {
+			return true, nil
+		}
+		return collect(key)
+	})
+	return documents, err
+}
+
+// better so sánh hai cách truy cập index: score cao hơn tốt hơn,
+// cùng score thì chọn cách phải đọc ít document hơn theo thống kê của index
+func (a *indexAccess) better(other *indexAccess) bool {
+	if a.score() != other.score() {
+		return a.score() > other.score()
+	}
+	if a.estimatedKeys >= 0 && other.estimatedKeys >= 0 {
+		return a.estimatedKeys < other.estimatedKeys
+	}
+	return false
+}
+
+// planQuery chọn cách truy cập index tốt nhất, trả về nil nếu không có index phù hợp
+func (cw *CollectionWrapper) planQuery(filter *Filter) *indexAccess {
+	var chosen *indexAccess
+
+	for i := range cw.Collection.Indexes {
+		index := &cw.Collection.Indexes[i]
+		if index.Status != models.IndexStatusActive {
+			continue
+		}
+
+		// Partial index chỉ chứa document thỏa filter của index
+		if index.Filter != "" {
+			indexFilter, err := ParseFilter(index.Filter)
+			if err != nil || !filter.Implies(indexFilter) {
+				continue
+			}
+		}
+
+		var access *indexAccess
+		if index.KeyVersion == models.IndexKeyVersionTuple && index.IndexType == models.IndexTypeBTree {
+			access = planRangeScan(index, filter)
+		} else {
+			access = planLookup(index, filter)
+		}
+		if access == nil {
+			continue
+		}
+
+		access.estimatedKeys = -1
+		if stats, err := cw.Indexes.GetIndexStats(index); err == nil {
+			access.estimatedKeys = access.estimate(stats)
+		} else {
+			log.Printf("Failed to get stats of index %d: %v", index.ID, err)
+		}
+		if chosen == nil || access.better(chosen) {
+			chosen = access
+		}
+	}
+	return chosen
+}
+
+// planLookup dùng index khi filter có điều kiện bằng trên tất cả các field của index
+func planLookup(index *models.Index, filter *Filter) *indexAccess {
+	access := &indexAccess{index: index}
+
+	// Tạo document chỉ gồm các giá trị bằng của query để tính value trong index
+	probe := make(map[string]interface{})
+	dataTypes := indexDataTypes(index)
+	for i, field := range indexFields(index) {
+		value, ok := filter.EqualityValue(field)
+		if !ok || checkDataType(value, dataTypes[i]) != nil {
+			return nil
+		}
+		setPath(probe, field, value)
+		access.equalities = append(access.equalities, Condition{Field: field, Op: FilterOpEqual, Value: value})
+	}
+
+	values, err := indexValues(index, probe)
+	if err != nil || len(values) != 1 {
+		return nil
+	}
+	access.lookupValue = values[0]
+	return access
+}
+
+// planRangeScan dùng index B-Tree dạng tuple khi filter có điều kiện bằng trên các field đứng đầu,
+// có thể kèm điều kiện khoảng (>, >=, <, <=) trên field ngay sau đó
+func planRangeScan(index *models.Index, filter *Filter) *indexAccess {
+	access := &indexAccess{index: index}
+	fields := indexFields(index)
+	dataTypes := indexDataTypes(index)
+
+	position := 0
+	for ; position < len(fields); position++ {
+		value, ok := filter.EqualityValue(fields[position])
+		if !ok || checkDataType(value, dataTypes[position]) != nil {
+			break
+		}
+		access.equalities = append(access.equalities, Condition{Field: fields[position], Op: FilterOpEqual, Value: value})
+	}
+
+	if position < len(fields) {
+		var lower, upper []Condition
+		for _, condition := range filter.Conditions {
+			if condition.Field != fields[position] || checkDataType(condition.Value, dataTypes[position]) != nil {
+				continue
+			}
+			switch condition.Op {
+			case FilterOpGreater, FilterOpGreaterEqual:
+				lower = append(lower, condition)
+			case FilterOpLess, FilterOpLessEqual:
+				upper = append(upper, condition)
+			}
+		}
+		access.ranges = append(lower, upper...)
+		// Với index multikey, mỗi điều kiện có thể được thỏa bởi một phần tử khác nhau của mảng, ví dụ {x: [1, 10]}
+		// thỏa x > 5 AND x < 3 nhưng không value nào nằm trong khoảng, nên chỉ scan theo cận dưới
+		if index.Multikey && len(lower) > 0 {
+			access.ranges = lower
+		}
+	}
+
+	if len(access.equalities) == 0 && len(access.ranges) == 0 {
+		return nil
+	}
+	return access
+}
+
+// scan duyệt toàn bộ document của collection và trả về các document thỏa filter
+func (cw *CollectionWrapper) scan(filter *Filter, limit int) ([]map[string]interface{}, error) {
+	documents := make([]map[string]interface{}, 0)
+	prefix := []byte(cw.CreateBadgerKey(""))
+
+	err := cw.Documents.ScanPrefix(prefix, func(_, value []byte) (bool, error) {
+		var document map[string]interface{}
+		if err := json.Unmarshal(value, &document); err != nil {
+			return false, err
+		}
+		if filter.Match(document) {
+			documents = append(documents, document)
+		}
+		return len(documents) < limit, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan collection: %v", err)
+	}
+	return documents, nil
+}
+
+// setPath gán giá trị theo đường dẫn dạng "a.b.c", tạo các object trung gian nếu chưa có
+func setPath(document map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := document
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+func TestQueryMultikeyRange(t *testing.T) {
+	cw, _ := newTestCollection(t, models.Index{Name: "by_x", Fields: "x", IndexType: models.IndexTypeBTree, DataType: models.DataTypeFloat})
+	for _, input := range []map[string]interface{}{
+		{"_key": "k1", "x": 4.0},
+		{"_key": "k2", "x": []interface{}{1.0, 10.0}},
+	} {
+		if err := cw.Write(input); err != nil {
+			t.Fatalf("failed to write %s: %v", input["_key"], err)
+		}
+	}
+
+	// Collection được mở lại để đọc cờ multikey của index từ catalog
+	cw, err := NewCollectionWrapper(&models.Collection{ID: cw.Collection.ID}, cw.SQLiteCatalogService, cw.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cw.Collection.Indexes[0].Multikey {
+		t.Fatal("index must be marked multikey")
+	}
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{filter: "x > 5 AND x < 3", want: []string{"k2"}},
+		{filter: "x > 3 AND x < 5", want: []string{"k1", "k2"}},
+		{filter: "x >= 10", want: []string{"k2"}},
+		{filter: "x < 2", want: []string{"k2"}},
+		{filter: "x > 10 AND x < 20", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			result, err := cw.Query(tt.filter, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Plan.Type != QueryPlanIndexRangeScan {
+				t.Fatalf("expected index range scan, got plan %+v", result.Plan)
+			}
+			scan, err := cw.scan(mustParseFilter(t, tt.filter), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, want := documentKeys(result.Documents), documentKeys(scan)
+			if len(got) != len(tt.want) || len(want) != len(tt.want) {
+				t.Fatalf("index returned %v, collection scan %v, want %v", got, want, tt.want)
+			}
+			for key := range tt.want {
+				if !got[tt.want[key]] {
+					t.Fatalf("index returned %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func mustParseFilter(t *testing.T, expr string) *Filter {
+	t.Helper()
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func documentKeys(documents []map[string]interface{}) map[string]bool {
+	keys := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		keys[document["_key"].(string)] = true
+	}
+	return keys
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+// ErrQuotaExceeded được trả về khi thao tác vượt quá quota của workspace
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaWrapper kiểm tra quota của một workspace trước khi tạo collection, index hoặc ghi dữ liệu
+type QuotaWrapper struct {
+	SQLiteCatalogService *service.SQLiteCatalogService
+	WorkspaceID          int
+}
+
+// NewQuotaWrapper khởi tạo một instance mới của QuotaWrapper
+func NewQuotaWrapper(workspaceID int, SQLiteCatalogService *service.SQLiteCatalogService) *QuotaWrapper {
+	return &QuotaWrapper{
+		SQLiteCatalogService: SQLiteCatalogService,
+		WorkspaceID:          workspaceID,
+	}
+}
+
+// CheckCreateCollection kiểm tra workspace còn được tạo thêm collection không
+func (qw *QuotaWrapper) CheckCreateCollection() error {
+	quota, usage, err := qw.load()
+	if err != nil {
+		return err
+	}
+	if quota.MaxCollections > 0 && usage.Collections >= int64(quota.MaxCollections) {
+		return fmt.Errorf("%w: workspace has reached the maximum of %d collections", ErrQuotaExceeded, quota.MaxCollections)
+	}
+	return nil
+}
+
+// CheckCreateIndex kiểm tra workspace còn được tạo thêm index không
+func (qw *QuotaWrapper) CheckCreateIndex() error {
+	quota, usage, err := qw.load()
+	if err != nil {
+		return err
+	}
+	if quota.MaxIndexes > 0 && usage.Indexes >= int64(quota.MaxIndexes) {
+		return fmt.Errorf("%w: workspace has reached the maximum of %d indexes", ErrQuotaExceeded, quota.MaxIndexes)
+	}
+	return nil
+}
+
+// CheckWrite kiểm tra workspace còn được ghi thêm một document có kích thước bytes không
+// Mức sử dụng được cập nhật khi document thực sự được ghi, nên các write đang nằm trong queue chưa được tính
+func (qw *QuotaWrapper) CheckWrite(bytes int64) error {
+	quota, usage, err := qw.load()
+	if err != nil {
+		return err
+	}
+	if quota.MaxDocuments > 0 && usage.Documents >= quota.MaxDocuments {
+		return fmt.Errorf("%w: workspace has reached the maximum of %d documents", ErrQuotaExceeded, quota.MaxDocuments)
+	}
+	if quota.MaxBytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+		return fmt.Errorf("%w: workspace would exceed the maximum of %d bytes", ErrQuotaExceeded, quota.MaxBytes)
+	}
+	return nil
+}
+
+// CheckUpdate kiểm tra workspace còn đủ dung lượng khi một document được ghi đè làm dung lượng tăng thêm bytes
+// Số document không đổi nên không được kiểm tra, ghi đè làm document nhỏ đi luôn được phép
+func (qw *QuotaWrapper) CheckUpdate(bytes int64) error {
+	if bytes <= 0 {
+		return nil
+	}
+	quota, usage, err := qw.load()
+	if err != nil {
+		return err
+	}
+	if quota.MaxBytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+		return fmt.Errorf("%w: workspace would exceed the maximum of %d bytes", ErrQuotaExceeded, quota.MaxBytes)
+	}
+	return nil
+}
+
+func (qw *QuotaWrapper) load() (*models.WorkspaceQuota, *service.WorkspaceUsage, error) {
+	quota, err := qw.SQLiteCatalogService.GetWorkspaceQuota(qw.WorkspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get workspace quota: %v", err)
+	}
+	usage, err := qw.SQLiteCatalogService.GetWorkspaceUsage(qw.WorkspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get workspace usage: %v", err)
+	}
+	return quota, usage, nil
+}
@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var (
+	// ErrInvalidSchema được trả về khi JSON Schema hoặc chế độ kiểm tra schema không hợp lệ
+	ErrInvalidSchema = errors.New("invalid schema")
+	// ErrSchemaViolation được trả về khi document không hợp lệ với schema hoặc kiểu dữ liệu của index
+	ErrSchemaViolation = errors.New("document validation failed")
+)
+
+// ValidationResult là kết quả kiểm tra một document
+// Errors làm document bị từ chối, Warnings là lỗi schema khi collection ở chế độ warn
+type ValidationResult struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Err trả về ErrSchemaViolation kèm danh sách lỗi nếu document không hợp lệ
+func (vr *ValidationResult) Err() error {
+	if vr.Valid {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.Join(vr.Errors, "; "))
+}
+
+// compiledSchemas cache schema đã compile theo nội dung, tránh compile lại ở mỗi lần ghi
+var compiledSchemas sync.Map
+
+// SetSchema gắn JSON Schema cho collection, schema rỗng hoặc null sẽ gỡ schema
+// mode là strict (mặc định) hoặc warn
+func (cw *CollectionWrapper) SetSchema(schema json.RawMessage, mode string) error {
+	if mode == "" {
+		mode = models.SchemaModeStrict
+	}
+	if mode != models.SchemaModeStrict && mode != models.SchemaModeWarn {
+		return fmt.Errorf("%w: mode must be one of strict, warn", ErrInvalidSchema)
+	}
+
+	schema = bytes.TrimSpace(schema)
+	if len(schema) == 0 || bytes.Equal(schema, []byte("null")) {
+		schema = nil
+	} else if _, err := compileSchema(schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	if err := cw.SQLiteCatalogService.SetCollectionSchema(cw.Collection, schema, mode); err != nil {
+		return fmt.Errorf("failed to update collection schema: %v", err)
+	}
+	return nil
+}
+
+// Validate kiểm tra document với schema của collection và kiểu dữ liệu khai báo của các index
+// Sai kiểu dữ liệu của index luôn bị từ chối vì không thể đưa vào index, kể cả ở chế độ warn
+func (cw *CollectionWrapper) Validate(input map[string]interface{}) *ValidationResult {
+	result := &ValidationResult{}
+
+	if _, ok := input["_key"].(string); !ok {
+		result.Errors = append(result.Errors, "/_key: must be a string")
+	}
+
+	// Document chỉ nằm trong index khi có đủ các field của index và thỏa filter của index
+	for _, index := range cw.Collection.Indexes {
+		if index.Status == models.IndexStatusInactive || !indexCovers(&index, input) {
+			continue
+		}
+		if _, err := indexValues(&index, input); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("index %s: %v", index.Name, err))
+		}
+	}
+
+	if len(cw.Collection.Schema) > 0 {
+		schemaErrors, err := validateSchema(cw.Collection.Schema, input)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else if cw.Collection.SchemaMode == models.SchemaModeWarn {
+			result.Warnings = schemaErrors
+		} else {
+			result.Errors = append(result.Errors, schemaErrors...)
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// validateSchema trả về danh sách lỗi của document với schema
+// Các trường hệ thống (bắt đầu bằng '_') không được đưa vào kiểm tra
+func validateSchema(schema json.RawMessage, input map[string]interface{}) ([]string, error) {
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile collection schema: %v", err)
+	}
+
+	document := make(map[string]interface{}, len(input))
+	for field, value := range input {
+		if !strings.HasPrefix(field, "_") {
+			document[field] = value
+		}
+	}
+
+	err = compiled.Validate(document)
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+	return flattenValidationError(validationErr, nil), nil
+}
+
+// flattenValidationError lấy các lỗi lá trong cây lỗi của jsonschema
+func flattenValidationError(ve *jsonschema.ValidationError, out []string) []string {
+	if len(ve.Causes) == 0 {
+		location := ve.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return append(out, fmt.Sprintf("%s: %s", location, ve.Message))
+	}
+	for _, cause := range ve.Causes {
+		out = flattenValidationError(cause, out)
+	}
+	return out
+}
+
+func compileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	if cached, ok := compiledSchemas.Load(string(schema)); ok {
+		return cached.(*jsonschema.Schema), nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	// Không cho schema tham chiếu tới file hoặc URL bên ngoài
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external reference %s is not allowed", url)
+	}
+	if err := compiler.AddResource("mydp:///collection.json", bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile("mydp:///collection.json")
+	if err != nil {
+		return nil, err
+	}
+
+	compiledSchemas.Store(string(schema), compiled)
+	return compiled, nil
+}
+
+// checkDataType kiểm tra giá trị có đúng kiểu dữ liệu khai báo của index không
+// Kiểu dữ liệu không xác định (index cũ) không được kiểm tra
+func checkDataType(value interface{}, dataType string) error {
+	switch dataType {
+	case models.DataTypeString:
+		if _, ok := value.(string); ok {
+			return nil
+		}
+	case models.DataTypeInt:
+		switch v := value.(type) {
+		case int, int64:
+			return nil
+		case float64:
+			if v == math.Trunc(v) {
+				return nil
+			}
+		}
+	case models.DataTypeFloat:
+		switch value.(type) {
+		case int, int64, float64:
+			return nil
+		}
+	case models.DataTypeBool:
+		if _, ok := value.(bool); ok {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return fmt.Errorf("expected %s, got %s", dataType, jsonTypeName(value))
+}
+
+// ValidDataType kiểm tra kiểu dữ liệu khai báo cho index có được hỗ trợ không
+func ValidDataType(dataType string) bool {
+	switch dataType {
+	case models.DataTypeString, models.DataTypeInt, models.DataTypeFloat, models.DataTypeBool:
+		return true
+	}
+	return false
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int64, float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,772 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// sqlRow là ngữ cảnh để tính biểu thức: giá trị các cột được đọc của một dòng,
+// hoặc giá trị GROUP BY và kết quả các hàm tổng hợp của một nhóm
+type sqlRow struct {
+	values []interface{}
+	groups []interface{}
+	aggs   []interface{}
+}
+
+// sqlEval tính giá trị của một biểu thức đã biên dịch, nil là null
+type sqlEval func(row *sqlRow) interface{}
+
+// sqlCompiler biên dịch biểu thức thành sqlEval và ghi lại các cột cần đọc từ table
+// Khi grouped, biểu thức được tính trên nhóm: chỉ được dùng biểu thức trong GROUP BY và hàm tổng hợp
+type sqlCompiler struct {
+	table   *models.Table
+	columns []int       // Vị trí trong table.Columns của các cột cần đọc
+	slots   map[int]int // Vị trí trong table.Columns -> vị trí trong sqlRow.values
+
+	grouped     bool
+	groupKeys   []string // Dạng chuẩn của các biểu thức GROUP BY
+	groupTypes  []sqlType
+	aggs        []*sqlAggregate
+	aggKeys     map[string]int
+	inAggregate bool
+}
+
+func newSQLCompiler(table *models.Table) *sqlCompiler {
+	return &sqlCompiler{table: table, slots: make(map[int]int), aggKeys: make(map[string]int)}
+}
+
+// resolveColumn tìm cột theo tên, tên không trong dấu nháy kép không phân biệt hoa thường
+func (c *sqlCompiler) resolveColumn(ref *sqlColumnRef) (int, error) {
+	for i := range c.table.Columns {
+		name := c.table.Columns[i].Name
+		if name == ref.Name || (!ref.Quoted && strings.EqualFold(name, ref.Name)) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: column %s does not exist in table %s", ErrInvalidSQL, ref.Name, c.table.Name)
+}
+
+// slot trả về vị trí của cột trong sqlRow.values, đánh dấu cột cần đọc
+func (c *sqlCompiler) slot(column int) int {
+	if slot, ok := c.slots[column]; ok {
+		return slot
+	}
+	c.slots[column] = len(c.columns)
+	c.columns = append(c.columns, column)
+	return len(c.columns) - 1
+}
+
+func (c *sqlCompiler) compile(expr sqlExpr) (sqlEval, sqlType, error) {
+	if c.grouped && !c.inAggregate {
+		key := expr.String()
+		for i, groupKey := range c.groupKeys {
+			if groupKey == key {
+				index := i
+				return func(row *sqlRow) interface{} { return row.groups[index] }, c.groupTypes[i], nil
+			}
+		}
+	}
+
+	switch e := expr.(type) {
+	case *sqlColumnRef:
+		column, err := c.resolveColumn(e)
+		if err != nil {
+			return nil, sqlType{}, err
+		}
+		if c.grouped && !c.inAggregate {
+			return nil, sqlType{}, fmt.Errorf("%w: column %s must appear in GROUP BY or be used in an aggregate function", ErrInvalidSQL, e.Name)
+		}
+		slot := c.slot(column)
+		return func(row *sqlRow) interface{} { return row.values[slot] }, columnSQLType(&c.table.Columns[column]), nil
+	case *sqlLiteral:
+		value := e.Value
+		return func(*sqlRow) interface{} { return value }, literalSQLType(value), nil
+	case *sqlUnaryExpr:
+		return c.compileUnary(e)
+	case *sqlBinaryExpr:
+		switch e.Op {
+		case "AND", "OR":
+			return c.compileLogical(e)
+		case "LIKE":
+			return c.compileLike(e)
+		case "=", "!=", "<", "<=", ">", ">=":
+			return c.compileComparison(e.Op, e.Left, e.Right)
+		default:
+			return c.compileArithmetic(e)
+		}
+	case *sqlIsNullExpr:
+		eval, _, err := c.compile(e.Expr)
+		if err != nil {
+			return nil, sqlType{}, err
+		}
+		not := e.Not
+		return func(row *sqlRow) interface{} { return (eval(row) == nil) != not }, sqlType{Kind: SQLTypeBoolean}, nil
+	case *sqlInExpr:
+		return c.compileIn(e)
+	case *sqlBetweenExpr:
+		return c.compileBetween(e)
+	case *sqlFuncCall:
+		return c.compileFunc(e)
+	}
+	return nil, sqlType{}, fmt.Errorf("%w: unsupported expression %s", ErrInvalidSQL, expr.String())
+}
+
+// compileBoolean biên dịch biểu thức phải có kiểu boolean
+func (c *sqlCompiler) compileBoolean(expr sqlExpr, clause string) (sqlEval, error) {
+	eval, typ, err := c.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if typ.Kind != SQLTypeBoolean && typ.Kind != SQLTypeNull {
+		return nil, fmt.Errorf("%w: %s must be a boolean expression, got %s", ErrInvalidSQL, clause, typ.Kind)
+	}
+	return eval, nil
+}
+
+func (c *sqlCompiler) compileUnary(e *sqlUnaryExpr) (sqlEval, sqlType, error) {
+	if e.Op == "NOT" {
+		eval, err := c.compileBoolean(e.Expr, "operand of NOT")
+		if err != nil {
+			return nil, sqlType{}, err
+		}
+		return func(row *sqlRow) interface{} {
+			if v, ok := eval(row).(bool); ok {
+				return !v
+			}
+			return nil
+		}, sqlType{Kind: SQLTypeBoolean}, nil
+	}
+
+	eval, typ, err := c.compile(e.Expr)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	if !typ.numeric() && typ.Kind != SQLTypeNull {
+		return nil, sqlType{}, fmt.Errorf("%w: cannot negate %s", ErrInvalidSQL, typ.Kind)
+	}
+	return func(row *sqlRow) interface{} {
+		switch v := eval(row).(type) {
+		case int64:
+			if v == math.MinInt64 {
+				return nil
+			}
+			return -v
+		case float64:
+			return -v
+		case SQLDecimal:
+			return SQLDecimal{Unscaled: new(big.Int).Neg(v.Unscaled), Scale: v.Scale}
+		}
+		return nil
+	}, typ, nil
+}
+
+// compileLogical biên dịch AND và OR theo logic ba giá trị của SQL
+func (c *sqlCompiler) compileLogical(e *sqlBinaryExpr) (sqlEval, sqlType, error) {
+	left, err := c.compileBoolean(e.Left, "operand of "+e.Op)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	right, err := c.compileBoolean(e.Right, "operand of "+e.Op)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	// AND dừng sớm khi gặp false, OR dừng sớm khi gặp true
+	decisive := e.Op == "OR"
+	return func(row *sqlRow) interface{} {
+		l := left(row)
+		if l == decisive {
+			return decisive
+		}
+		r := right(row)
+		if r == decisive {
+			return decisive
+		}
+		if l == nil || r == nil {
+			return nil
+		}
+		return !decisive
+	}, sqlType{Kind: SQLTypeBoolean}, nil
+}
+
+// compilePair biên dịch hai vế của phép so sánh, chuỗi hằng số được chuyển theo kiểu date/timestamp của vế kia
+func (c *sqlCompiler) compilePair(a, b sqlExpr) (sqlEval, sqlType, sqlEval, sqlType, error) {
+	literalA, aIsLiteral := a.(*sqlLiteral)
+	literalB, bIsLiteral := b.(*sqlLiteral)
+	switch {
+	case aIsLiteral && !bIsLiteral:
+		evalB, typeB, err := c.compile(b)
+		if err != nil {
+			return nil, sqlType{}, nil, sqlType{}, err
+		}
+		evalA, typeA, err := c.compileLiteral(literalA, typeB)
+		return evalA, typeA, evalB, typeB, err
+	case bIsLiteral && !aIsLiteral:
+		evalA, typeA, err := c.compile(a)
+		if err != nil {
+			return nil, sqlType{}, nil, sqlType{}, err
+		}
+		evalB, typeB, err := c.compileLiteral(literalB, typeA)
+		return evalA, typeA, evalB, typeB, err
+	}
+	evalA, typeA, err := c.compile(a)
+	if err != nil {
+		return nil, sqlType{}, nil, sqlType{}, err
+	}
+	evalB, typeB, err := c.compile(b)
+	return evalA, typeA, evalB, typeB, err
+}
+
+func (c *sqlCompiler) compileLiteral(literal *sqlLiteral, target sqlType) (sqlEval, sqlType, error) {
+	value, typ, err := coerceLiteral(literal.Value, target)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	return func(*sqlRow) interface{} { return value }, typ, nil
+}
+
+func (c *sqlCompiler) compileComparison(op string, a, b sqlExpr) (sqlEval, sqlType, error) {
+	left, leftType, right, rightType, err := c.compilePair(a, b)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	if !leftType.comparable(rightType) {
+		return nil, sqlType{}, fmt.Errorf("%w: cannot compare %s with %s", ErrInvalidSQL, leftType.Kind, rightType.Kind)
+	}
+	return func(row *sqlRow) interface{} {
+		l := left(row)
+		if l == nil {
+			return nil
+		}
+		r := right(row)
+		if r == nil {
+			return nil
+		}
+		cmp, ok := compareSQLValues(l, r)
+		if !ok {
+			return nil
+		}
+		return compareResult(op, cmp)
+	}, sqlType{Kind: SQLTypeBoolean}, nil
+}
+
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func (c *sqlCompiler) compileIn(e *sqlInExpr) (sqlEval, sqlType, error) {
+	eval, typ, err := c.compile(e.Expr)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	items := make([]sqlEval, len(e.List))
+	for i, item := range e.List {
+		var itemType sqlType
+		if literal, ok := item.(*sqlLiteral); ok {
+			items[i], itemType, err = c.compileLiteral(literal, typ)
+		} else {
+			items[i], itemType, err = c.compile(item)
+		}
+		if err != nil {
+			return nil, sqlType{}, err
+		}
+		if !typ.comparable(itemType) {
+			return nil, sqlType{}, fmt.Errorf("%w: cannot compare %s with %s in IN list", ErrInvalidSQL, typ.Kind, itemType.Kind)
+		}
+	}
+
+	not := e.Not
+	return func(row *sqlRow) interface{} {
+		v := eval(row)
+		if v == nil {
+			return nil
+		}
+		sawNull := false
+		for _, item := range items {
+			candidate := item(row)
+			if candidate == nil {
+				sawNull = true
+				continue
+			}
+			if cmp, ok := compareSQLValues(v, candidate); ok && cmp == 0 {
+				return !not
+			}
+		}
+		if sawNull {
+			return nil
+		}
+		return not
+	}, sqlType{Kind: SQLTypeBoolean}, nil
+}
+
+func (c *sqlCompiler) compileBetween(e *sqlBetweenExpr) (sqlEval, sqlType, error) {
+	low, err := c.compileBound(e.Expr, e.Low, ">=")
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	high, err := c.compileBound(e.Expr, e.High, "<=")
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	not := e.Not
+	return func(row *sqlRow) interface{} {
+		l, h := low(row), high(row)
+		var result interface{}
+		switch {
+		case l == false || h == false:
+			result = false
+		case l == nil || h == nil:
+			return nil
+		default:
+			result = true
+		}
+		return result.(bool) != not
+	}, sqlType{Kind: SQLTypeBoolean}, nil
+}
+
+func (c *sqlCompiler) compileBound(expr, bound sqlExpr, op string) (sqlEval, error) {
+	eval, _, err := c.compileComparison(op, expr, bound)
+	return eval, err
+}
+
+// compileLike biên dịch LIKE, % khớp với chuỗi bất kỳ và _ khớp với một ký tự
+func (c *sqlCompiler) compileLike(e *sqlBinaryExpr) (sqlEval, sqlType, error) {
+	eval, typ, err := c.compile(e.Left)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	pattern, patternType, err := c.compile(e.Right)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	for _, t := range []sqlType{typ, patternType} {
+		if t.Kind != SQLTypeString && t.Kind != SQLTypeNull {
+			return nil, sqlType{}, fmt.Errorf("%w: LIKE requires string operands, got %s", ErrInvalidSQL, t.Kind)
+		}
+	}
+
+	cache := make(map[string]*regexp.Regexp)
+	return func(row *sqlRow) interface{} {
+		v, ok := eval(row).(string)
+		if !ok {
+			return nil
+		}
+		p, ok := pattern(row).(string)
+		if !ok {
+			return nil
+		}
+		re, ok := cache[p]
+		if !ok {
+			re = likeRegexp(p)
+			if len(cache) < 1024 {
+				cache[p] = re
+			}
+		}
+		return re.MatchString(v)
+	}, sqlType{Kind: SQLTypeBoolean}, nil
+}
+
+func likeRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// compileArithmetic biên dịch + - * / %
+// int64 với int64 cho int64 (phép chia lấy phần nguyên), có double cho double, decimal cộng trừ nhân cho decimal,
+// decimal chia cho double. Chia cho 0 hoặc phép toán int64 bị tràn cho null
+func (c *sqlCompiler) compileArithmetic(e *sqlBinaryExpr) (sqlEval, sqlType, error) {
+	left, leftType, err := c.compile(e.Left)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	right, rightType, err := c.compile(e.Right)
+	if err != nil {
+		return nil, sqlType{}, err
+	}
+	for _, t := range []sqlType{leftType, rightType} {
+		if !t.numeric() && t.Kind != SQLTypeNull {
+			return nil, sqlType{}, fmt.Errorf("%w: operator %s requires numeric operands, got %s", ErrInvalidSQL, e.Op, t.Kind)
+		}
+	}
+
+	typ := arithmeticType(e.Op, leftType, rightType)
+	op := e.Op
+	return func(row *sqlRow) interface{} {
+		l := left(row)
+		if l == nil {
+			return nil
+		}
+		r := right(row)
+		if r == nil {
+			return nil
+		}
+		return evalArithmetic(op, typ, l, r)
+	}, typ, nil
+}
+
+func arithmeticType(op string, a, b sqlType) sqlType {
+	switch {
+	case a.Kind == SQLTypeNull:
+		return b
+	case b.Kind == SQLTypeNull:
+		return a
+	case a.Kind == SQLTypeDouble || b.Kind == SQLTypeDouble:
+		return sqlType{Kind: SQLTypeDouble}
+	case a.Kind == SQLTypeInt64 && b.Kind == SQLTypeInt64:
+		return a
+	}
+
+	// Có decimal, int64 được coi là decimal(19, 0)
+	if a.Kind == SQLTypeInt64 {
+		a = sqlType{Kind: SQLTypeDecimal, Precision: 19}
+	}
+	if b.Kind == SQLTypeInt64 {
+		b = sqlType{Kind: SQLTypeDecimal, Precision: 19}
+	}
+	switch op {
+	case "+", "-":
+		scale := max(a.Scale, b.Scale)
+		precision := max(a.Precision-a.Scale, b.Precision-b.Scale) + scale + 1
+		return sqlType{Kind: SQLTypeDecimal, Precision: min(precision, maxDecimalPrecision), Scale: scale}
+	case "*":
+		if a.Scale+b.Scale <= maxDecimalPrecision {
+			return sqlType{Kind: SQLTypeDecimal, Precision: min(a.Precision+b.Precision, maxDecimalPrecision), Scale: a.Scale + b.Scale}
+		}
+	}
+	return sqlType{Kind: SQLTypeDouble}
+}
+
+func evalArithmetic(op string, typ sqlType, l, r interface{}) interface{} {
+	switch typ.Kind {
+	case SQLTypeInt64:
+		if v, ok := int64Arithmetic(op, l.(int64), r.(int64)); ok {
+			return v
+		}
+		return nil
+	case SQLTypeDecimal:
+		x, y := toSQLDecimal(l).rescale(typ.Scale), toSQLDecimal(r).rescale(typ.Scale)
+		switch op {
+		case "+":
+			return SQLDecimal{Unscaled: new(big.Int).Add(x.Unscaled, y.Unscaled), Scale: typ.Scale}
+		case "-":
+			return SQLDecimal{Unscaled: new(big.Int).Sub(x.Unscaled, y.Unscaled), Scale: typ.Scale}
+		default:
+			x, y = toSQLDecimal(l), toSQLDecimal(r)
+			return SQLDecimal{Unscaled: new(big.Int).Mul(x.Unscaled, y.Unscaled), Scale: x.Scale + y.Scale}
+		}
+	}
+
+	x, y := toFloat(l), toFloat(r)
+	switch op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/":
+		if y == 0 {
+			return nil
+		}
+		return x / y
+	default:
+		if y == 0 {
+			return nil
+		}
+		return math.Mod(x, y)
+	}
+}
+
+// int64Arithmetic tính phép toán trên int64, trả về false khi chia cho 0 hoặc kết quả tràn int64
+// để biểu thức cho null thay vì một giá trị sai
+func int64Arithmetic(op string, x, y int64) (int64, bool) {
+	switch op {
+	case "+":
+		z := x + y
+		return z, (z > x) == (y > 0)
+	case "-":
+		z := x - y
+		return z, (z < x) == (y > 0)
+	case "*":
+		if x == 0 || y == 0 {
+			return 0, true
+		}
+		z := x * y
+		return z, z/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)
+	case "/":
+		if y == 0 || (x == math.MinInt64 && y == -1) {
+			return 0, false
+		}
+		return x / y, true
+	default:
+		if y == 0 {
+			return 0, false
+		}
+		if y == -1 {
+			return 0, true
+		}
+		return x % y, true
+	}
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case SQLDecimal:
+		return v.float()
+	}
+	return math.NaN()
+}
+
+func toSQLDecimal(value interface{}) SQLDecimal {
+	switch v := value.(type) {
+	case int64:
+		return SQLDecimal{Unscaled: big.NewInt(v)}
+	case SQLDecimal:
+		return v
+	}
+	return SQLDecimal{Unscaled: new(big.Int)}
+}
+
+func (c *sqlCompiler) compileFunc(e *sqlFuncCall) (sqlEval, sqlType, error) {
+	if !isAggregateFunc(e.Name) {
+		return nil, sqlType{}, fmt.Errorf("%w: unsupported function %s", ErrInvalidSQL, e.Name)
+	}
+	if !c.grouped {
+		return nil, sqlType{}, fmt.Errorf("%w: aggregate function %s is not allowed here", ErrInvalidSQL, e.Name)
+	}
+	if c.inAggregate {
+		return nil, sqlType{}, fmt.Errorf("%w: aggregate function calls cannot be nested", ErrInvalidSQL)
+	}
+
+	key := e.String()
+	if index, ok := c.aggKeys[key]; ok {
+		return func(row *sqlRow) interface{} { return row.aggs[index] }, c.aggs[index].typ, nil
+	}
+
+	agg := &sqlAggregate{name: e.Name, star: e.Star, distinct: e.Distinct}
+	if !e.Star {
+		if len(e.Args) != 1 {
+			return nil, sqlType{}, fmt.Errorf("%w: %s takes exactly one argument", ErrInvalidSQL, e.Name)
+		}
+		c.inAggregate = true
+		arg, argType, err := c.compile(e.Args[0])
+		c.inAggregate = false
+		if err != nil {
+			return nil, sqlType{}, err
+		}
+		agg.arg, agg.argType = arg, argType
+	} else if e.Name != "COUNT" {
+		return nil, sqlType{}, fmt.Errorf("%w: %s(*) is not supported", ErrInvalidSQL, e.Name)
+	}
+	if err := agg.resolveType(); err != nil {
+		return nil, sqlType{}, err
+	}
+
+	index := len(c.aggs)
+	c.aggs = append(c.aggs, agg)
+	c.aggKeys[key] = index
+	return func(row *sqlRow) interface{} { return row.aggs[index] }, agg.typ, nil
+}
+
+func isAggregateFunc(name string) bool {
+	switch name {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	}
+	return false
+}
+
+// containsAggregate kiểm tra biểu thức có gọi hàm tổng hợp không
+func containsAggregate(expr sqlExpr) bool {
+	switch e := expr.(type) {
+	case *sqlFuncCall:
+		if isAggregateFunc(e.Name) {
+			return true
+		}
+		for _, arg := range e.Args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case *sqlUnaryExpr:
+		return containsAggregate(e.Expr)
+	case *sqlBinaryExpr:
+		return containsAggregate(e.Left) || containsAggregate(e.Right)
+	case *sqlIsNullExpr:
+		return containsAggregate(e.Expr)
+	case *sqlInExpr:
+		if containsAggregate(e.Expr) {
+			return true
+		}
+		for _, item := range e.List {
+			if containsAggregate(item) {
+				return true
+			}
+		}
+	case *sqlBetweenExpr:
+		return containsAggregate(e.Expr) || containsAggregate(e.Low) || containsAggregate(e.High)
+	}
+	return false
+}
+
+// sqlAggregate là một hàm tổng hợp trong câu lệnh
+type sqlAggregate struct {
+	name     string
+	star     bool
+	distinct bool
+	arg      sqlEval
+	argType  sqlType
+	typ      sqlType
+}
+
+// sqlAggState là trạng thái của một hàm tổng hợp trong một nhóm
+type sqlAggState struct {
+	count int64
+	sumI  int64
+	sumF  float64
+	sumD  *big.Rat
+	value interface{}
+	seen  map[string]bool
+	// overflow cho biết tổng int64 đã bị tràn, SUM khi đó cho null
+	overflow bool
+}
+
+func (a *sqlAggregate) resolveType() error {
+	switch a.name {
+	case "COUNT":
+		a.typ = sqlType{Kind: SQLTypeInt64}
+	case "SUM", "AVG":
+		if !a.argType.numeric() && a.argType.Kind != SQLTypeNull {
+			return fmt.Errorf("%w: %s requires a numeric argument, got %s", ErrInvalidSQL, a.name, a.argType.Kind)
+		}
+		switch {
+		case a.name == "AVG":
+			a.typ = sqlType{Kind: SQLTypeDouble}
+		case a.argType.Kind == SQLTypeDecimal:
+			a.typ = sqlType{Kind: SQLTypeDecimal, Precision: maxDecimalPrecision, Scale: a.argType.Scale}
+		case a.argType.Kind == SQLTypeNull:
+			a.typ = sqlType{Kind: SQLTypeInt64}
+		default:
+			a.typ = a.argType
+		}
+	default:
+		a.typ = a.argType
+	}
+	return nil
+}
+
+func (a *sqlAggregate) newState() *sqlAggState {
+	state := &sqlAggState{}
+	if a.distinct {
+		state.seen = make(map[string]bool)
+	}
+	if a.argType.Kind == SQLTypeDecimal {
+		state.sumD = new(big.Rat)
+	}
+	return state
+}
+
+func (a *sqlAggregate) update(state *sqlAggState, row *sqlRow) {
+	if a.star {
+		state.count++
+		return
+	}
+	v := a.arg(row)
+	if v == nil {
+		return
+	}
+	if state.seen != nil {
+		key := sqlValueKey(v)
+		if state.seen[key] {
+			return
+		}
+		state.seen[key] = true
+	}
+	state.count++
+
+	switch a.name {
+	case "SUM", "AVG":
+		switch x := v.(type) {
+		case int64:
+			sum, ok := int64Arithmetic("+", state.sumI, x)
+			state.sumI = sum
+			state.overflow = state.overflow || !ok
+			state.sumF += float64(x)
+		case float64:
+			state.sumF += x
+		case SQLDecimal:
+			state.sumD.Add(state.sumD, x.rat())
+		}
+	case "MIN", "MAX":
+		if state.value == nil {
+			state.value = v
+			return
+		}
+		if cmp, ok := compareSQLValues(v, state.value); ok && (cmp < 0) == (a.name == "MIN") && cmp != 0 {
+			state.value = v
+		}
+	}
+}
+
+func (a *sqlAggregate) result(state *sqlAggState) interface{} {
+	if a.name == "COUNT" {
+		return state.count
+	}
+	if state.count == 0 {
+		return nil
+	}
+	switch a.name {
+	case "SUM":
+		switch a.typ.Kind {
+		case SQLTypeInt64:
+			if state.overflow {
+				return nil
+			}
+			return state.sumI
+		case SQLTypeDecimal:
+			unscaled := new(big.Int).Mul(state.sumD.Num(), pow10(a.typ.Scale))
+			return SQLDecimal{Unscaled: unscaled.Quo(unscaled, state.sumD.Denom()), Scale: a.typ.Scale}
+		}
+		return state.sumF
+	case "AVG":
+		if state.sumD != nil {
+			avg, _ := new(big.Rat).Quo(state.sumD, new(big.Rat).SetInt64(state.count)).Float64()
+			return avg
+		}
+		return state.sumF / float64(state.count)
+	}
+	return state.value
+}
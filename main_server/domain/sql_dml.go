@@ -0,0 +1,280 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+	"gorm.io/gorm"
+)
+
+// SQLExecResult là kết quả của một câu lệnh DELETE hoặc UPDATE
+type SQLExecResult struct {
+	Statement    string             `json:"statement"` // delete hoặc update
+	TableID      int                `json:"table_id"`
+	Table        string             `json:"table"`
+	RowsAffected int64              `json:"rows_affected"`
+	SnapshotID   int                `json:"snapshot_id,omitempty"` // Snapshot được tạo, không có nếu không dòng nào bị ảnh hưởng
+	Stats        *service.ScanStats `json:"stats"`
+}
+
+// sqlDML là câu lệnh DELETE hoặc UPDATE đã được kiểm tra với schema của table
+// Với UPDATE, mọi cột được đọc để ghi lại dòng mới, set là giá trị mới của các cột được cập nhật
+type sqlDML struct {
+	operation string
+	table     *models.Table
+	storage   *service.Storage
+	files     []models.TableFile
+	compiler  *sqlCompiler
+	where     sqlEval
+	set       map[int]sqlEval // Vị trí trong table.Columns -> giá trị mới
+	query     *SQLQuery       // Dùng để bỏ qua phân vùng và row group theo WHERE
+}
+
+// ExecuteSQL chạy câu lệnh DELETE hoặc UPDATE trên một table của workspace
+// Các dòng bị xóa được ghi vào tệp delete (vị trí của dòng trong tệp dữ liệu) thay vì ghi lại tệp dữ liệu,
+// UPDATE xóa các dòng cũ theo cách đó và ghi các dòng mới thành tệp mới. Tất cả được commit trong một snapshot,
+// các snapshot trước vẫn đọc thấy các dòng cũ. Compaction ghi lại các tệp có dòng bị xóa để xóa hẳn các dòng đó.
+// Buffer của table được flush trước để câu lệnh thấy mọi dòng đã được append.
+// Câu lệnh không chạy cùng lúc với compaction hoặc sync của table, trả về ErrCompactionRunning nếu table đang bận
+func ExecuteSQL(catalog *service.SQLiteCatalogService, storage *service.Storage, workspaceID int, query string) (*SQLExecResult, error) {
+	stmt, err := parseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	var tableName, operation string
+	switch s := stmt.(type) {
+	case *sqlDelete:
+		tableName, operation = s.Table, models.SnapshotOperationDelete
+	case *sqlUpdate:
+		tableName, operation = s.Table, models.SnapshotOperationUpdate
+	default:
+		return nil, fmt.Errorf("%w: SELECT statements must be run with sql", ErrInvalidSQL)
+	}
+
+	table, err := catalog.GetTableByName(workspaceID, tableName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: table %s does not exist", ErrInvalidSQL, tableName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table: %v", err)
+	}
+
+	tw := NewTableWrapper(table, catalog, storage)
+	if _, err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	if !storage.Tables.TryLockCompaction(table.ID) {
+		return nil, ErrCompactionRunning
+	}
+	defer storage.Tables.UnlockCompaction(table.ID)
+
+	// Đọc lại table sau khi flush và giữ khóa để có schema và snapshot mới nhất
+	table, err = catalog.GetTableByID(table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table: %v", err)
+	}
+	files, err := catalog.ListTableFiles(table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of table: %v", err)
+	}
+
+	dml := &sqlDML{operation: operation, table: table, storage: storage, files: files, compiler: newSQLCompiler(table)}
+	switch s := stmt.(type) {
+	case *sqlDelete:
+		err = dml.planWhere(s.Where)
+	case *sqlUpdate:
+		err = dml.planUpdate(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dml.run(catalog, storage)
+}
+
+// planWhere biên dịch điều kiện WHERE và tính các tệp có thể chứa dòng thỏa mãn theo phân vùng và index của table
+func (d *sqlDML) planWhere(where sqlExpr) error {
+	d.query = &SQLQuery{table: d.table, files: d.files, storage: d.storage}
+	if where == nil {
+		return nil
+	}
+	eval, err := d.compiler.compileBoolean(where, "WHERE")
+	if err != nil {
+		return err
+	}
+	d.where = eval
+	d.query.pushdown = d.compiler.pushdown(where)
+	if err := d.query.prunePartitions(); err != nil {
+		return err
+	}
+	if err := d.query.pruneByIndexes(); err != nil {
+		return err
+	}
+	d.files = d.query.files
+	return nil
+}
+
+func (d *sqlDML) planUpdate(stmt *sqlUpdate) error {
+	// Mọi cột được đọc theo thứ tự của table, nên vị trí trong sqlRow.values trùng với vị trí cột
+	for i := range d.table.Columns {
+		d.compiler.slot(i)
+	}
+
+	d.set = make(map[int]sqlEval, len(stmt.Set))
+	for _, assignment := range stmt.Set {
+		column, err := d.compiler.resolveColumn(assignment.Column)
+		if err != nil {
+			return err
+		}
+		if _, ok := d.set[column]; ok {
+			return fmt.Errorf("%w: column %s is assigned more than once", ErrInvalidSQL, d.table.Columns[column].Name)
+		}
+		if containsAggregate(assignment.Expr) {
+			return fmt.Errorf("%w: aggregate functions are not allowed in SET", ErrInvalidSQL)
+		}
+
+		target := columnSQLType(&d.table.Columns[column])
+		var eval sqlEval
+		var typ sqlType
+		if literal, ok := assignment.Expr.(*sqlLiteral); ok {
+			eval, typ, err = d.compiler.compileLiteral(literal, target)
+		} else {
+			eval, typ, err = d.compiler.compile(assignment.Expr)
+		}
+		if err != nil {
+			return err
+		}
+		if !target.comparable(typ) {
+			return fmt.Errorf("%w: cannot assign %s to column %s of type %s", ErrInvalidSQL, typ.Kind, d.table.Columns[column].Name, d.table.Columns[column].Type)
+		}
+		d.set[column] = eval
+	}
+	return d.planWhere(stmt.Where)
+}
+
+// run tìm các dòng thỏa mãn WHERE, ghi tệp delete cho các tệp dữ liệu chứa các dòng đó (và các dòng mới với UPDATE)
+// rồi commit. Các tệp đã ghi bị xóa nếu có lỗi
+func (d *sqlDML) run(catalog *service.SQLiteCatalogService, storage *service.Storage) (*SQLExecResult, error) {
+	result := &SQLExecResult{Statement: d.operation, TableID: d.table.ID, Table: d.table.Name}
+	columns := d.compiler.columns
+
+	var order []*models.TableFile
+	positions := make(map[int][]int64)
+	var updated [][]interface{}
+	var rowErr error
+	row := &sqlRow{values: make([]interface{}, len(columns))}
+	stats, err := storage.Tables.ScanPositions(d.table, d.files, columns, d.query.keepRowGroup, func(file *models.TableFile, position int64, raw []interface{}) error {
+		for i, column := range columns {
+			row.values[i] = columnSQLValue(&d.table.Columns[column], raw[i])
+		}
+		if d.where != nil && d.where(row) != true {
+			return nil
+		}
+		if d.set != nil {
+			values, err := d.updatedRow(raw, row)
+			if err != nil {
+				rowErr = err
+				return service.ErrStopScan
+			}
+			updated = append(updated, values)
+		}
+		if _, ok := positions[file.ID]; !ok {
+			order = append(order, file)
+		}
+		positions[file.ID] = append(positions[file.ID], position)
+		result.RowsAffected++
+		return nil
+	})
+	stats.SnapshotID = d.table.CurrentSnapshotID
+	stats.FilesPruned, stats.FilesSkipped = d.query.filesPruned, d.query.filesSkipped
+	result.Stats = stats
+	if rowErr != nil {
+		return nil, rowErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return result, nil
+	}
+
+	var written []models.TableFile
+	err = func() error {
+		for _, file := range order {
+			deleteFile, err := storage.Tables.WriteDeleteFile(d.table, file, positions[file.ID])
+			if err != nil {
+				return err
+			}
+			written = append(written, *deleteFile)
+		}
+		if len(updated) > 0 {
+			files, err := storage.Tables.WriteRows(d.table, updated)
+			if err != nil {
+				return fmt.Errorf("failed to write updated rows: %v", err)
+			}
+			written = append(written, files...)
+		}
+		snapshot, err := catalog.CommitTableSnapshot(d.table.ID, d.operation, d.table.SchemaVersion, d.table.CurrentSnapshotID, written, nil)
+		if err != nil {
+			return fmt.Errorf("failed to commit %s: %w", d.operation, err)
+		}
+		result.SnapshotID = snapshot.ID
+		return nil
+	}()
+	if err != nil {
+		for _, file := range written {
+			if removeErr := storage.Tables.RemoveTableFile(d.table, file.Path); removeErr != nil {
+				log.Printf("Failed to remove uncommitted file %s of table %d: %v", file.Path, d.table.ID, removeErr)
+			}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// updatedRow tạo dòng mới từ giá trị đọc được của dòng cũ và giá trị mới của các cột trong SET
+func (d *sqlDML) updatedRow(raw []interface{}, row *sqlRow) ([]interface{}, error) {
+	values := append([]interface{}(nil), raw...)
+	for column, eval := range d.set {
+		value, err := sqlValueToColumn(&d.table.Columns[column], eval(row))
+		if err != nil {
+			return nil, fmt.Errorf("%w: column %s: %v", ErrInvalidSQL, d.table.Columns[column].Name, err)
+		}
+		values[column] = value
+	}
+	return values, nil
+}
+
+// sqlValueToColumn chuyển giá trị SQL thành giá trị lưu trong tệp Parquet của cột (cùng kiểu với ConvertRows)
+// Giá trị được đưa về dạng đầu vào của ConvertRows để dùng chung việc kiểm tra phạm vi, precision và scale
+func sqlValueToColumn(column *models.TableColumn, value interface{}) (interface{}, error) {
+	var input interface{}
+	switch v := value.(type) {
+	case nil:
+		if !column.Nullable {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return nil, nil
+	case int64:
+		input = json.Number(strconv.FormatInt(v, 10))
+	case SQLDecimal:
+		input = json.Number(v.String())
+	case []byte:
+		input = base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		if column.Type == models.ColumnTypeDate {
+			input = v.Format(time.DateOnly)
+		} else {
+			input = v.Format(time.RFC3339Nano)
+		}
+	default:
+		input = value
+	}
+	return convertColumnValue(column, input)
+}
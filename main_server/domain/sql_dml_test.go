@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// newPartitionedSQLTestEnv tạo table t(id int64, region string, v int64) phân vùng theo region
+func newPartitionedSQLTestEnv(t *testing.T) *sqlTestEnv {
+	t.Helper()
+	env := newTableTestEnv(t, &models.Table{
+		Name: "t",
+		Columns: []models.TableColumn{
+			{Name: "id", Type: "int64"},
+			{Name: "region", Type: "string"},
+			{Name: "v", Type: "int64", Nullable: true},
+		},
+		PartitionBy: []models.TablePartitionField{{Column: "region", Transform: models.PartitionTransformIdentity}},
+	})
+	env.appendRows(t,
+		map[string]interface{}{"id": 1.0, "region": "a", "v": 10.0},
+		map[string]interface{}{"id": 2.0, "region": "a", "v": 20.0},
+		map[string]interface{}{"id": 3.0, "region": "b", "v": 30.0},
+	)
+	return env
+}
+
+// partitionRows trả về số dòng còn lại của mỗi phân vùng theo manifest
+func (env *sqlTestEnv) partitionRows(t *testing.T) string {
+	t.Helper()
+	partitions, err := env.catalog.ListTablePartitions(env.tableWrapper(t).Table.ID)
+	if err != nil {
+		t.Fatalf("failed to list partitions: %v", err)
+	}
+	var described []string
+	for _, partition := range partitions {
+		described = append(described, fmt.Sprintf("%s:%d", partition.Partition, partition.RowCount))
+	}
+	return fmt.Sprint(described)
+}
+
+func TestSQLUpdatePartitionColumn(t *testing.T) {
+	env := newPartitionedSQLTestEnv(t)
+	before := env.tableWrapper(t).Table.CurrentSnapshotID
+
+	result, err := ExecuteSQL(env.catalog, env.storage, env.workspaceID, "UPDATE t SET region = 'c', v = v + 1 WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowsAffected != 1 || result.SnapshotID == before {
+		t.Fatalf("got %+v, want one row updated in a new snapshot", result)
+	}
+
+	// Dòng được xóa khỏi phân vùng cũ và ghi vào phân vùng mới
+	if got, want := env.partitionRows(t), "[region=a:1 region=b:1 region=c:1]"; got != want {
+		t.Fatalf("got partitions %s, want %s", got, want)
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT id, region, v FROM t ORDER BY id", want: "[[1 c 11] [2 a 20] [3 b 30]]"},
+		{query: "SELECT id FROM t WHERE region = 'a'", want: "[[2]]"},
+		{query: "SELECT id, v FROM t WHERE region = 'c'", want: "[[1 11]]"},
+		{query: fmt.Sprintf("SELECT id FROM t AS OF %d WHERE region = 'a' ORDER BY id", before), want: "[[1] [2]]"},
+	}
+	for _, tt := range tests {
+		if got := env.mustQuery(t, tt.query); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	// Phân vùng mới được bỏ qua theo WHERE như các phân vùng khác
+	_, stats, err := env.query("SELECT id FROM t WHERE region = 'b'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FilesPruned == 0 {
+		t.Fatalf("got stats %+v, want the other partitions to be pruned", stats)
+	}
+}
@@ -0,0 +1,697 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+	"gorm.io/gorm"
+)
+
+// SQLQuery là một câu lệnh SELECT đã được kiểm tra với schema của table, sẵn sàng để chạy
+// Câu lệnh đọc các tệp của một snapshot của table: snapshot hiện tại lúc chuẩn bị hoặc snapshot trong AS OF.
+// Các dòng còn trong buffer không được đọc thấy
+type SQLQuery struct {
+	table      *models.Table
+	snapshotID int
+	files      []models.TableFile
+	storage    *service.Storage
+
+	columns      []SQLColumn
+	scan         []int // Vị trí trong table.Columns của các cột cần đọc
+	where        sqlEval
+	pushdown     []sqlPushdown
+	filesPruned  int // Số tệp bị bỏ qua nhờ phân vùng
+	filesSkipped int // Số tệp bị bỏ qua nhờ index của table
+
+	grouped bool
+	groupBy []sqlEval
+	aggs    []*sqlAggregate
+	having  sqlEval
+
+	outputs []sqlEval
+	order   []sqlOrderKey
+	limit   int64 // -1 nếu không giới hạn
+	offset  int64
+}
+
+type sqlOrderKey struct {
+	eval sqlEval
+	desc bool
+}
+
+// PrepareSQL phân tích câu lệnh SELECT trên một table của workspace và lập kế hoạch thực thi:
+// chỉ các cột được dùng trong câu lệnh được đọc, các điều kiện đơn giản trong WHERE được dùng để bỏ qua
+// các phân vùng không thể chứa dòng thỏa mãn, các tệp dựa trên index của table và các row group dựa trên thống kê min/max
+func PrepareSQL(catalog *service.SQLiteCatalogService, storage *service.Storage, workspaceID int, query string) (*SQLQuery, error) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := catalog.GetTableByName(workspaceID, stmt.From)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: table %s does not exist", ErrInvalidSQL, stmt.From)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table: %v", err)
+	}
+	snapshotID := table.CurrentSnapshotID
+	if stmt.AsOf != nil {
+		snapshot, err := resolveSnapshot(catalog, table, stmt.AsOf)
+		if err != nil {
+			return nil, err
+		}
+		snapshotID = snapshot.ID
+	}
+	files, err := catalog.ListSnapshotFiles(table.ID, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of table: %v", err)
+	}
+
+	q := &SQLQuery{table: table, snapshotID: snapshotID, files: files, storage: storage, limit: stmt.Limit, offset: stmt.Offset}
+	if err := q.plan(stmt); err != nil {
+		return nil, err
+	}
+	if err := q.prunePartitions(); err != nil {
+		return nil, err
+	}
+	if err := q.pruneByIndexes(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// resolveSnapshot tìm snapshot trong AS OF: theo ID, hoặc snapshot hiện tại tại một thời điểm
+func resolveSnapshot(catalog *service.SQLiteCatalogService, table *models.Table, asOf *sqlLiteral) (*models.TableSnapshot, error) {
+	if snapshotID, ok := asOf.Value.(int64); ok {
+		snapshot, err := catalog.GetTableSnapshot(table.ID, int(snapshotID))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: snapshot %d of table %s does not exist or has expired", ErrInvalidSQL, snapshotID, table.Name)
+		}
+		return snapshot, err
+	}
+
+	value, _, err := coerceLiteral(asOf.Value, sqlType{Kind: SQLTypeTimestamp})
+	if err != nil {
+		return nil, err
+	}
+	at := value.(time.Time)
+	snapshot, err := catalog.GetTableSnapshotAsOf(table.ID, at)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: table %s has no snapshot at %s", ErrInvalidSQL, table.Name, at.Format(time.RFC3339Nano))
+	}
+	return snapshot, err
+}
+
+// prunePartitions bỏ các tệp thuộc phân vùng mà khoảng giá trị của phân vùng cho thấy không dòng nào thỏa mãn WHERE
+func (q *SQLQuery) prunePartitions() error {
+	if len(q.table.PartitionBy) == 0 || len(q.pushdown) == 0 {
+		return nil
+	}
+
+	matches := make(map[string]bool)
+	files := make([]models.TableFile, 0, len(q.files))
+	for _, file := range q.files {
+		match, ok := matches[file.Partition]
+		if !ok {
+			match = true
+			if file.Partition != "" {
+				bounds, err := service.PartitionBounds(q.table, file.Partition)
+				if err != nil {
+					return fmt.Errorf("failed to read partition of file %s: %v", file.Path, err)
+				}
+				for _, predicate := range q.pushdown {
+					if stats, ok := bounds[predicate.index]; ok && !predicate.mayMatch(1, stats) {
+						match = false
+						break
+					}
+				}
+			}
+			matches[file.Partition] = match
+		}
+		if match {
+			files = append(files, file)
+		} else {
+			q.filesPruned++
+		}
+	}
+	q.files = files
+	return nil
+}
+
+// pruneByIndexes bỏ các tệp dữ liệu mà index của table cho thấy không dòng nào thỏa mãn WHERE:
+// bloom filter với điều kiện = và IN, zone map với các điều kiện kiểm tra được bằng min/max.
+// Tệp không có sidecar của index được giữ lại, tệp delete của tệp bị bỏ qua cũng được bỏ
+func (q *SQLQuery) pruneByIndexes() error {
+	type indexCheck struct {
+		index     *models.Index
+		predicate *sqlPushdown
+	}
+	var checks []indexCheck
+	for i := range q.table.Indexes {
+		index := &q.table.Indexes[i]
+		if index.Status != models.IndexStatusActive || !service.IsTableIndex(index) {
+			continue
+		}
+		for j := range q.pushdown {
+			predicate := &q.pushdown[j]
+			if predicate.column.Name != index.Fields {
+				continue
+			}
+			if index.IndexType == models.IndexTypeBloomFilter && predicate.op != "=" && predicate.op != "in" {
+				continue
+			}
+			checks = append(checks, indexCheck{index: index, predicate: predicate})
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	skipped := make(map[int]bool)
+	for i := range q.files {
+		file := &q.files[i]
+		if file.Content == models.TableFileContentPositionDeletes {
+			continue
+		}
+		for _, check := range checks {
+			match, err := q.indexMayMatch(file, check.index, check.predicate)
+			if err != nil {
+				return err
+			}
+			if !match {
+				skipped[file.ID] = true
+				q.filesSkipped++
+				break
+			}
+		}
+	}
+	files := make([]models.TableFile, 0, len(q.files))
+	for _, file := range q.files {
+		if !skipped[file.ID] && !skipped[file.DataFileID] {
+			files = append(files, file)
+		}
+	}
+	q.files = files
+	return nil
+}
+
+// indexMayMatch đọc sidecar của index của tệp và kiểm tra tệp có thể chứa dòng thỏa mãn predicate không
+func (q *SQLQuery) indexMayMatch(file *models.TableFile, index *models.Index, predicate *sqlPushdown) (bool, error) {
+	if index.IndexType == models.IndexTypeBloomFilter {
+		filter, err := q.storage.Tables.ReadBloomFilter(q.table, file, index)
+		if err != nil || filter == nil {
+			return true, err
+		}
+		for _, value := range predicate.values {
+			// So sánh với null không đúng với dòng nào
+			if value == nil {
+				continue
+			}
+			// Giá trị không chuyển được về kiểu của cột thì không kiểm tra bằng bloom filter
+			raw, err := sqlValueToColumn(predicate.column, value)
+			if err != nil || filter.MayContain(raw) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	zoneMap, err := q.storage.Tables.ReadZoneMap(q.table, file, index)
+	if err != nil || zoneMap == nil {
+		return true, err
+	}
+	for _, rowGroup := range zoneMap.RowGroups {
+		if predicate.mayMatch(rowGroup.NumRows, rowGroup.Stats) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Columns trả về các cột của kết quả
+func (q *SQLQuery) Columns() []SQLColumn {
+	return q.columns
+}
+
+func (q *SQLQuery) plan(stmt *sqlSelect) error {
+	c := newSQLCompiler(q.table)
+
+	// Mở rộng * thành các cột của table
+	var items []sqlSelectItem
+	for _, item := range stmt.Items {
+		if !item.Star {
+			items = append(items, item)
+			continue
+		}
+		for _, column := range q.table.Columns {
+			items = append(items, sqlSelectItem{Expr: &sqlColumnRef{Name: column.Name, Quoted: true}})
+		}
+	}
+
+	// ORDER BY có thể dùng alias hoặc số thứ tự của cột trong SELECT
+	orderItems := make([]sqlExpr, len(stmt.OrderBy))
+	orderOutputs := make([]int, len(stmt.OrderBy))
+	for i, order := range stmt.OrderBy {
+		orderItems[i], orderOutputs[i] = order.Expr, -1
+		switch e := order.Expr.(type) {
+		case *sqlLiteral:
+			if n, ok := e.Value.(int64); ok {
+				if n < 1 || n > int64(len(items)) {
+					return fmt.Errorf("%w: ORDER BY position %d is not in select list", ErrInvalidSQL, n)
+				}
+				orderOutputs[i] = int(n - 1)
+			}
+		case *sqlColumnRef:
+			for j, item := range items {
+				if item.Alias != "" && (item.Alias == e.Name || (!e.Quoted && strings.EqualFold(item.Alias, e.Name))) {
+					orderOutputs[i] = j
+					break
+				}
+			}
+		}
+	}
+
+	if stmt.Where != nil {
+		where, err := c.compileBoolean(stmt.Where, "WHERE")
+		if err != nil {
+			return err
+		}
+		q.where = where
+		q.pushdown = c.pushdown(stmt.Where)
+	}
+
+	q.grouped = len(stmt.GroupBy) > 0 || stmt.Having != nil
+	for _, item := range items {
+		q.grouped = q.grouped || containsAggregate(item.Expr)
+	}
+	for i, order := range orderItems {
+		q.grouped = q.grouped || (orderOutputs[i] < 0 && containsAggregate(order))
+	}
+
+	// Biểu thức GROUP BY được tính trên từng dòng, các biểu thức sau đó được tính trên nhóm
+	for _, expr := range stmt.GroupBy {
+		if containsAggregate(expr) {
+			return fmt.Errorf("%w: aggregate functions are not allowed in GROUP BY", ErrInvalidSQL)
+		}
+		eval, typ, err := c.compile(expr)
+		if err != nil {
+			return err
+		}
+		q.groupBy = append(q.groupBy, eval)
+		c.groupKeys = append(c.groupKeys, expr.String())
+		c.groupTypes = append(c.groupTypes, typ)
+	}
+	c.grouped = q.grouped
+
+	for _, item := range items {
+		eval, typ, err := c.compile(item.Expr)
+		if err != nil {
+			return err
+		}
+		q.outputs = append(q.outputs, eval)
+		q.columns = append(q.columns, SQLColumn{
+			Name:      q.outputName(c, item),
+			Type:      typ.Kind,
+			Precision: typ.Precision,
+			Scale:     typ.Scale,
+			Unit:      typ.Unit,
+		})
+	}
+
+	if stmt.Having != nil {
+		having, err := c.compileBoolean(stmt.Having, "HAVING")
+		if err != nil {
+			return err
+		}
+		q.having = having
+	}
+
+	for i, order := range stmt.OrderBy {
+		key := sqlOrderKey{desc: order.Desc}
+		if orderOutputs[i] >= 0 {
+			key.eval = q.outputs[orderOutputs[i]]
+		} else {
+			eval, _, err := c.compile(orderItems[i])
+			if err != nil {
+				return err
+			}
+			key.eval = eval
+		}
+		q.order = append(q.order, key)
+	}
+
+	q.scan = c.columns
+	q.aggs = c.aggs
+	return nil
+}
+
+// outputName là tên cột kết quả: alias, tên cột của table hoặc dạng chuẩn của biểu thức
+func (q *SQLQuery) outputName(c *sqlCompiler, item sqlSelectItem) string {
+	if item.Alias != "" {
+		return item.Alias
+	}
+	if ref, ok := item.Expr.(*sqlColumnRef); ok {
+		if column, err := c.resolveColumn(ref); err == nil {
+			return q.table.Columns[column].Name
+		}
+	}
+	return item.Expr.String()
+}
+
+// sqlResultRow là một dòng kết quả kèm giá trị các khóa sắp xếp
+type sqlResultRow struct {
+	values []interface{}
+	keys   []interface{}
+}
+
+// sqlGroup là một nhóm của GROUP BY
+type sqlGroup struct {
+	keys   []interface{}
+	states []*sqlAggState
+}
+
+// Run chạy câu lệnh, emit được gọi với từng dòng kết quả theo thứ tự của Columns
+// Khi không có ORDER BY và hàm tổng hợp, kết quả được trả về ngay trong lúc đọc và việc đọc dừng khi đủ LIMIT.
+// Ngược lại, kết quả được tính trong bộ nhớ trước khi trả về. Lỗi của emit được trả về nguyên vẹn
+func (q *SQLQuery) Run(emit func(values []interface{}) error) (*service.ScanStats, error) {
+	if q.limit == 0 {
+		return &service.ScanStats{SnapshotID: q.snapshotID, FilesPruned: q.filesPruned, FilesSkipped: q.filesSkipped}, nil
+	}
+
+	var emitErr error
+	var results []sqlResultRow
+	var groups []*sqlGroup
+	groupIndex := make(map[string]*sqlGroup)
+	streaming := !q.grouped && len(q.order) == 0
+	skipped, emitted := int64(0), int64(0)
+
+	row := &sqlRow{values: make([]interface{}, len(q.scan))}
+	stats, err := q.storage.Tables.Scan(q.table, q.files, q.scan, q.keepRowGroup, func(raw []interface{}) error {
+		for i, column := range q.scan {
+			row.values[i] = columnSQLValue(&q.table.Columns[column], raw[i])
+		}
+		if q.where != nil && q.where(row) != true {
+			return nil
+		}
+
+		switch {
+		case q.grouped:
+			keys := make([]interface{}, len(q.groupBy))
+			var key strings.Builder
+			for i, eval := range q.groupBy {
+				keys[i] = eval(row)
+				k := sqlValueKey(keys[i])
+				key.WriteString(strconv.Itoa(len(k)))
+				key.WriteString(":")
+				key.WriteString(k)
+			}
+			group, ok := groupIndex[key.String()]
+			if !ok {
+				group = q.newGroup(keys)
+				groupIndex[key.String()] = group
+				groups = append(groups, group)
+			}
+			for i, agg := range q.aggs {
+				agg.update(group.states[i], row)
+			}
+		case streaming:
+			if skipped < q.offset {
+				skipped++
+				return nil
+			}
+			if emitErr = emit(q.project(row).values); emitErr != nil {
+				return service.ErrStopScan
+			}
+			emitted++
+			if q.limit >= 0 && emitted >= q.limit {
+				return service.ErrStopScan
+			}
+		default:
+			results = append(results, q.project(row))
+		}
+		return nil
+	})
+	stats.SnapshotID, stats.FilesPruned, stats.FilesSkipped = q.snapshotID, q.filesPruned, q.filesSkipped
+	if err != nil {
+		return stats, err
+	}
+	if streaming || emitErr != nil {
+		return stats, emitErr
+	}
+
+	if q.grouped {
+		// Hàm tổng hợp không có GROUP BY luôn trả về một dòng, kể cả khi không có dòng nào
+		if len(groups) == 0 && len(q.groupBy) == 0 {
+			groups = append(groups, q.newGroup(nil))
+		}
+		for _, group := range groups {
+			groupRow := &sqlRow{groups: group.keys, aggs: make([]interface{}, len(q.aggs))}
+			for i, agg := range q.aggs {
+				groupRow.aggs[i] = agg.result(group.states[i])
+			}
+			if q.having != nil && q.having(groupRow) != true {
+				continue
+			}
+			results = append(results, q.project(groupRow))
+		}
+	}
+
+	q.sort(results)
+	if q.offset >= int64(len(results)) {
+		return stats, nil
+	}
+	results = results[q.offset:]
+	if q.limit >= 0 && q.limit < int64(len(results)) {
+		results = results[:q.limit]
+	}
+	for _, result := range results {
+		if err := emit(result.values); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func (q *SQLQuery) newGroup(keys []interface{}) *sqlGroup {
+	group := &sqlGroup{keys: keys, states: make([]*sqlAggState, len(q.aggs))}
+	for i, agg := range q.aggs {
+		group.states[i] = agg.newState()
+	}
+	return group
+}
+
+// project tính các cột kết quả và khóa sắp xếp của một dòng hoặc một nhóm
+func (q *SQLQuery) project(row *sqlRow) sqlResultRow {
+	result := sqlResultRow{values: make([]interface{}, len(q.outputs))}
+	for i, eval := range q.outputs {
+		result.values[i] = eval(row)
+	}
+	if len(q.order) > 0 {
+		result.keys = make([]interface{}, len(q.order))
+		for i, key := range q.order {
+			result.keys[i] = key.eval(row)
+		}
+	}
+	return result
+}
+
+// sort sắp xếp kết quả theo ORDER BY, null đứng sau khi tăng dần và đứng trước khi giảm dần
+func (q *SQLQuery) sort(results []sqlResultRow) {
+	if len(q.order) == 0 {
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		for k, key := range q.order {
+			a, b := results[i].keys[k], results[j].keys[k]
+			var cmp int
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				cmp = 1
+			case b == nil:
+				cmp = -1
+			default:
+				cmp, _ = compareSQLValues(a, b)
+			}
+			if cmp == 0 {
+				continue
+			}
+			if key.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// sqlPushdown là một điều kiện trong WHERE có thể kiểm tra bằng thống kê min/max của row group
+// op là một phép so sánh, "between", "in", "null" hoặc "not null"
+type sqlPushdown struct {
+	slot   int // Vị trí của cột trong các cột được đọc
+	index  int // Vị trí của cột trong table.Columns
+	column *models.TableColumn
+	op     string
+	values []interface{}
+}
+
+// pushdown tách WHERE thành các điều kiện nối bằng AND và giữ lại các điều kiện dạng <cột> <phép so sánh> <hằng số>
+// Phải được gọi sau khi WHERE đã được biên dịch, để các cột đã có vị trí trong các cột được đọc
+func (c *sqlCompiler) pushdown(expr sqlExpr) []sqlPushdown {
+	var result []sqlPushdown
+	column := func(e sqlExpr) (int, bool) {
+		ref, ok := e.(*sqlColumnRef)
+		if !ok {
+			return 0, false
+		}
+		index, err := c.resolveColumn(ref)
+		if err != nil {
+			return 0, false
+		}
+		return index, true
+	}
+	add := func(index int, op string, literals ...sqlExpr) {
+		predicate := sqlPushdown{slot: c.slot(index), index: index, column: &c.table.Columns[index], op: op}
+		typ := columnSQLType(predicate.column)
+		for _, literal := range literals {
+			l, ok := literal.(*sqlLiteral)
+			if !ok {
+				return
+			}
+			value, _, err := coerceLiteral(l.Value, typ)
+			if err != nil {
+				return
+			}
+			predicate.values = append(predicate.values, value)
+		}
+		result = append(result, predicate)
+	}
+
+	var walk func(e sqlExpr)
+	walk = func(e sqlExpr) {
+		switch e := e.(type) {
+		case *sqlBinaryExpr:
+			switch e.Op {
+			case "AND":
+				walk(e.Left)
+				walk(e.Right)
+			case "=", "!=", "<", "<=", ">", ">=":
+				if index, ok := column(e.Left); ok {
+					add(index, e.Op, e.Right)
+				} else if index, ok := column(e.Right); ok {
+					add(index, flipComparison(e.Op), e.Left)
+				}
+			}
+		case *sqlBetweenExpr:
+			if index, ok := column(e.Expr); ok && !e.Not {
+				add(index, "between", e.Low, e.High)
+			}
+		case *sqlInExpr:
+			if index, ok := column(e.Expr); ok && !e.Not {
+				add(index, "in", e.List...)
+			}
+		case *sqlIsNullExpr:
+			if index, ok := column(e.Expr); ok {
+				if e.Not {
+					add(index, "not null")
+				} else {
+					add(index, "null")
+				}
+			}
+		}
+	}
+	walk(expr)
+	return result
+}
+
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// keepRowGroup trả về false nếu thống kê cho thấy không dòng nào trong row group thỏa mãn WHERE
+func (q *SQLQuery) keepRowGroup(numRows int64, stats []service.ColumnStats) bool {
+	for _, predicate := range q.pushdown {
+		if !predicate.mayMatch(numRows, stats[predicate.slot]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *sqlPushdown) mayMatch(numRows int64, stats service.ColumnStats) bool {
+	hasBounds := stats.Min != nil && stats.Max != nil
+	switch p.op {
+	case "null":
+		// Không có min/max thì không chắc số null được ghi lại
+		return !hasBounds || stats.NullCount > 0
+	case "not null":
+		return stats.NullCount < numRows
+	}
+
+	// Các phép so sánh không đúng với null
+	if stats.NullCount >= numRows {
+		return false
+	}
+	if !hasBounds {
+		return true
+	}
+	for _, value := range p.values {
+		if value == nil {
+			return p.op == "in"
+		}
+	}
+	min, max := columnSQLValue(p.column, stats.Min), columnSQLValue(p.column, stats.Max)
+	for _, value := range p.values {
+		// Giá trị không so sánh được với thống kê, không bỏ qua row group
+		if _, ok := compareSQLValues(value, min); !ok {
+			return true
+		}
+	}
+	compare := func(a, b interface{}) int {
+		cmp, _ := compareSQLValues(a, b)
+		return cmp
+	}
+
+	switch p.op {
+	case "=":
+		return compare(p.values[0], min) >= 0 && compare(p.values[0], max) <= 0
+	case "!=":
+		return compare(min, max) != 0 || compare(p.values[0], min) != 0
+	case "<":
+		return compare(min, p.values[0]) < 0
+	case "<=":
+		return compare(min, p.values[0]) <= 0
+	case ">":
+		return compare(max, p.values[0]) > 0
+	case ">=":
+		return compare(max, p.values[0]) >= 0
+	case "between":
+		return compare(max, p.values[0]) >= 0 && compare(min, p.values[1]) <= 0
+	case "in":
+		for _, value := range p.values {
+			if compare(value, min) >= 0 && compare(value, max) <= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+// sqlTestEnv là catalog, storage và workspace chứa table t dùng trong các test SQL
+type sqlTestEnv struct {
+	catalog     *service.SQLiteCatalogService
+	storage     *service.Storage
+	workspaceID int
+}
+
+// newTableTestEnv tạo catalog, storage và workspace rồi tạo table trong workspace đó, tên table phải là t
+func newTableTestEnv(t *testing.T, table *models.Table) *sqlTestEnv {
+	t.Helper()
+	cfg := &config.Config{DataFolderDefault: t.TempDir()}
+	catalog, err := service.NewSQLiteCatalogService(cfg)
+	if err != nil {
+		t.Fatalf("failed to open catalog: %v", err)
+	}
+	tables, err := service.NewParquetService(cfg)
+	if err != nil {
+		t.Fatalf("failed to open table storage: %v", err)
+	}
+	storage := service.NewStorage(nil, nil, tables)
+
+	workspace := &models.Workspace{Name: "ws"}
+	if err := catalog.CreateWorkspace(workspace); err != nil {
+		t.Fatalf("failed to create workspace: %v", err)
+	}
+	table.WorkspaceID = workspace.ID
+	if err := NewTableWrapper(table, catalog, storage).CreateTable(); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return &sqlTestEnv{catalog: catalog, storage: storage, workspaceID: workspace.ID}
+}
+
+// newSQLTestEnv tạo table t(id int64, name string, v int64) với mỗi row group 2 dòng và ghi các dòng ra một tệp
+func newSQLTestEnv(t *testing.T) *sqlTestEnv {
+	t.Helper()
+	env := newTableTestEnv(t, &models.Table{
+		Name: "t",
+		Columns: []models.TableColumn{
+			{Name: "id", Type: "int64"},
+			{Name: "name", Type: "string", Nullable: true},
+			{Name: "v", Type: "int64", Nullable: true},
+		},
+		RowGroupSize: 2,
+	})
+	// Giá trị số giống như khi được đọc từ JSON
+	env.appendRows(t,
+		map[string]interface{}{"id": 1.0, "name": "a", "v": 10.0},
+		map[string]interface{}{"id": 2.0, "name": "b", "v": nil},
+		map[string]interface{}{"id": 3.0, "name": "a", "v": 30.0},
+		map[string]interface{}{"id": 4.0, "name": "c", "v": 40.0},
+		map[string]interface{}{"id": 5.0, "name": "b", "v": 50.0},
+		map[string]interface{}{"id": 6.0, "name": nil, "v": 60.0},
+	)
+	return env
+}
+
+// query chạy câu lệnh SELECT, trả về các dòng kết quả dạng chuỗi và số liệu của lần đọc
+func (env *sqlTestEnv) query(query string) (string, *service.ScanStats, error) {
+	q, err := PrepareSQL(env.catalog, env.storage, env.workspaceID, query)
+	if err != nil {
+		return "", nil, err
+	}
+	var rows [][]interface{}
+	stats, err := q.Run(func(values []interface{}) error {
+		rows = append(rows, append([]interface{}(nil), values...))
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprint(rows), stats, nil
+}
+
+func TestSQLInvalidQueries(t *testing.T) {
+	env := newSQLTestEnv(t)
+	for _, query := range []string{
+		"",
+		"SELECT",
+		"SELECT id FROM",
+		"SELECT id FROM t WHERE name = 'a",
+		"SELECT id FROM t WHERE id ! 1",
+		"SELECT id FROM t WHERE id # 1",
+		"SELECT id FROM t WHERE id IN ()",
+		"SELECT id FROM t WHERE id BETWEEN 1",
+		"SELECT id FROM t extra",
+		"SELECT id FROM t LIMIT x",
+		"SELECT nope FROM t",
+		"SELECT id FROM nope",
+		"SELECT id FROM t WHERE name + 1 = 2",
+		"SELECT id FROM t WHERE id",
+		"SELECT name, id FROM t GROUP BY name",
+		"SELECT SUM(name) FROM t",
+		"SELECT id FROM t ORDER BY 2",
+		"SELECT id FROM t ORDER BY 0",
+	} {
+		t.Run(query, func(t *testing.T) {
+			if _, _, err := env.query(query); !errors.Is(err, ErrInvalidSQL) {
+				t.Fatalf("expected ErrInvalidSQL, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLQueries(t *testing.T) {
+	env := newSQLTestEnv(t)
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "in with null", query: "SELECT id FROM t WHERE v IN (10, NULL) ORDER BY id", want: "[[1]]"},
+		{name: "in skips null column", query: "SELECT id FROM t WHERE v IN (10, 30) ORDER BY id", want: "[[1] [3]]"},
+		{name: "not in with null", query: "SELECT id FROM t WHERE v NOT IN (10, NULL)", want: "[]"},
+		{name: "not in skips null column", query: "SELECT id FROM t WHERE v NOT IN (10, 30) ORDER BY id", want: "[[4] [5] [6]]"},
+		{name: "null in list is unknown", query: "SELECT id FROM t WHERE (v IN (NULL)) IS NULL AND id < 3 ORDER BY id", want: "[[1] [2]]"},
+		{
+			name:  "group by",
+			query: "SELECT name, COUNT(*), COUNT(v), SUM(v) FROM t WHERE name IS NOT NULL GROUP BY name ORDER BY name",
+			want:  "[[a 2 2 40] [b 2 1 50] [c 1 1 40]]",
+		},
+		{
+			name:  "having",
+			query: "SELECT name, SUM(v) AS total FROM t GROUP BY name HAVING COUNT(*) > 1 AND SUM(v) > 40 ORDER BY name",
+			want:  "[[b 50]]",
+		},
+		{name: "aggregate without rows", query: "SELECT COUNT(*), SUM(v), MIN(v) FROM t WHERE id > 100", want: "[[0 <nil> <nil>]]"},
+		{name: "order by ordinal", query: "SELECT id, v FROM t WHERE v IS NOT NULL ORDER BY 2 DESC LIMIT 2", want: "[[6 60] [5 50]]"},
+		{name: "order by ordinals", query: "SELECT name, id FROM t WHERE name IS NOT NULL ORDER BY 1 DESC, 2", want: "[[c 4] [b 2] [b 5] [a 1] [a 3]]"},
+		{name: "order by ordinal of aggregate", query: "SELECT name, COUNT(*) FROM t WHERE name IS NOT NULL GROUP BY name ORDER BY 2 DESC, 1 LIMIT 2", want: "[[a 2] [b 2]]"},
+		{name: "int64 overflow", query: "SELECT id * 9223372036854775807, id + 9223372036854775806 FROM t WHERE id < 3 ORDER BY id", want: "[[9223372036854775807 9223372036854775807] [<nil> <nil>]]"},
+		{name: "int64 sum overflow", query: "SELECT SUM(id * 4611686018427387903) FROM t WHERE id < 3", want: "[[<nil>]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := env.query(tt.query)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLRowGroupPruning(t *testing.T) {
+	env := newSQLTestEnv(t)
+	tests := []struct {
+		query   string
+		want    string
+		skipped int
+	}{
+		{query: "SELECT id FROM t WHERE id > 4 ORDER BY id", want: "[[5] [6]]", skipped: 2},
+		{query: "SELECT id FROM t WHERE id = 3", want: "[[3]]", skipped: 2},
+		{query: "SELECT id FROM t WHERE id IN (1, 6) ORDER BY id", want: "[[1] [6]]", skipped: 1},
+		{query: "SELECT id FROM t WHERE v < 20", want: "[[1]]", skipped: 2},
+		// Row group không có null ở v bị bỏ qua với IS NULL
+		{query: "SELECT id FROM t WHERE v IS NULL", want: "[[2]]", skipped: 2},
+		{query: "SELECT id FROM t WHERE id > 4 OR v = 10 ORDER BY id", want: "[[1] [5] [6]]", skipped: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, stats, err := env.query(tt.query)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			if stats.RowGroups != 3 || stats.RowGroupsSkipped != tt.skipped {
+				t.Fatalf("got %d of %d row groups skipped, want %d of 3", stats.RowGroupsSkipped, stats.RowGroups, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestInt64Arithmetic(t *testing.T) {
+	tests := []struct {
+		op   string
+		x, y int64
+		want int64
+		ok   bool
+	}{
+		{"+", 1, 2, 3, true},
+		{"+", math.MaxInt64, 1, 0, false},
+		{"+", math.MinInt64, -1, 0, false},
+		{"+", math.MinInt64, math.MaxInt64, -1, true},
+		{"-", math.MinInt64, 1, 0, false},
+		{"-", 0, math.MinInt64, 0, false},
+		{"-", -1, math.MinInt64, math.MaxInt64, true},
+		{"*", 2, math.MaxInt64, 0, false},
+		{"*", -1, math.MinInt64, 0, false},
+		{"*", math.MinInt64, -1, 0, false},
+		{"*", math.MinInt64, 1, math.MinInt64, true},
+		{"*", 0, math.MinInt64, 0, true},
+		{"*", -3, 4, -12, true},
+		{"/", 7, 2, 3, true},
+		{"/", 1, 0, 0, false},
+		{"/", math.MinInt64, -1, 0, false},
+		{"%", 7, 0, 0, false},
+		{"%", math.MinInt64, -1, 0, true},
+		{"%", -7, 3, -1, true},
+	}
+	for _, tt := range tests {
+		got, ok := int64Arithmetic(tt.op, tt.x, tt.y)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%d %s %d: got %d (%v), want %d (%v)", tt.x, tt.op, tt.y, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSQLPartitionPruning(t *testing.T) {
+	env := newPartitionedSQLTestEnv(t)
+	tests := []struct {
+		query  string
+		want   string
+		pruned int
+	}{
+		{query: "SELECT id FROM t WHERE region = 'a' ORDER BY id", want: "[[1] [2]]", pruned: 1},
+		{query: "SELECT id FROM t WHERE region > 'a'", want: "[[3]]", pruned: 1},
+		{query: "SELECT id FROM t WHERE region IN ('a', 'b') ORDER BY id", want: "[[1] [2] [3]]", pruned: 0},
+		{query: "SELECT id FROM t WHERE region IS NULL", want: "[]", pruned: 2},
+		// Điều kiện trên cột khác không bỏ được phân vùng nào
+		{query: "SELECT id FROM t WHERE v = 30", want: "[[3]]", pruned: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, stats, err := env.query(tt.query)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			if stats.FilesPruned != tt.pruned {
+				t.Fatalf("got %d files pruned, want %d", stats.FilesPruned, tt.pruned)
+			}
+		})
+	}
+}
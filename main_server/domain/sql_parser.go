@@ -0,0 +1,871 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSQL được trả về khi câu lệnh SQL không hợp lệ hoặc không thể thực thi trên table
+var ErrInvalidSQL = errors.New("invalid sql")
+
+// Cú pháp được hỗ trợ:
+//
+//	SELECT <expr> [AS <alias>], ... | *
+//	FROM <table> [AS OF <snapshot-id> | AS OF '<thời điểm>']
+//	[WHERE <expr>] [GROUP BY <expr>, ...] [HAVING <expr>]
+//	[ORDER BY <expr> [ASC|DESC], ...] [LIMIT <n>] [OFFSET <n>]
+//
+//	DELETE FROM <table> [WHERE <expr>]
+//
+//	UPDATE <table> SET <column> = <expr>, ... [WHERE <expr>]
+//
+// Biểu thức gồm cột, hằng số ('chuỗi', số, TRUE, FALSE, NULL), + - * / %, so sánh (= != <> < <= > >=),
+// AND, OR, NOT, IS [NOT] NULL, [NOT] IN (...), [NOT] BETWEEN ... AND ..., [NOT] LIKE và các hàm tổng hợp
+// COUNT(*), COUNT([DISTINCT] <expr>), SUM, AVG, MIN, MAX. Tên cột và table không phân biệt hoa thường,
+// tên trong dấu nháy kép được giữ nguyên
+
+type sqlTokenKind int
+
+const (
+	sqlTokenEOF sqlTokenKind = iota
+	sqlTokenIdent
+	sqlTokenQuotedIdent
+	sqlTokenString
+	sqlTokenNumber
+	sqlTokenOp
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+// sqlKeywords là các từ khóa không được dùng làm alias không có AS
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "HAVING": true, "ORDER": true,
+	"LIMIT": true, "OFFSET": true, "AS": true, "AND": true, "OR": true, "NOT": true, "ASC": true, "DESC": true,
+	"IS": true, "NULL": true, "IN": true, "BETWEEN": true, "LIKE": true, "TRUE": true, "FALSE": true, "DISTINCT": true,
+}
+
+// tokenizeSQL tách câu lệnh thành các token, chuỗi trong dấu nháy được bỏ nháy, hai dấu nháy liền nhau được hiểu là một dấu nháy
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					if j+1 < len(runes) && runes[j+1] == r {
+						text.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				text.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated quote at position %d", ErrInvalidSQL, i)
+			}
+			kind := sqlTokenString
+			if r == '"' {
+				kind = sqlTokenQuotedIdent
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			if j < len(runes) && (runes[j] == 'e' || runes[j] == 'E') {
+				k := j + 1
+				if k < len(runes) && (runes[k] == '+' || runes[k] == '-') {
+					k++
+				}
+				if k < len(runes) && unicode.IsDigit(runes[k]) {
+					for j = k; j < len(runes) && unicode.IsDigit(runes[j]); j++ {
+					}
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenNumber, text: string(runes[i:j]), pos: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenIdent, text: string(runes[i:j]), pos: i})
+			i = j
+		case strings.ContainsRune("<>!=", r):
+			j := i + 1
+			if j < len(runes) && (runes[j] == '=' || (r == '<' && runes[j] == '>')) {
+				j++
+			}
+			op := string(runes[i:j])
+			if op == "!" {
+				return nil, fmt.Errorf("%w: unexpected character '!' at position %d", ErrInvalidSQL, i)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenOp, text: op, pos: i})
+			i = j
+		case strings.ContainsRune("(),*+-/%;", r):
+			tokens = append(tokens, sqlToken{kind: sqlTokenOp, text: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrInvalidSQL, r, i)
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlTokenEOF, pos: len(runes)}), nil
+}
+
+// sqlExpr là một biểu thức trong câu lệnh SQL
+// String trả về dạng chuẩn của biểu thức (tên cột và tên hàm viết thường), dùng để so sánh biểu thức
+// trong SELECT với GROUP BY và làm tên cột kết quả
+type sqlExpr interface {
+	String() string
+}
+
+type sqlColumnRef struct {
+	Name   string
+	Quoted bool
+}
+
+type sqlLiteral struct {
+	Value interface{} // nil, bool, int64, float64 hoặc string
+}
+
+type sqlUnaryExpr struct {
+	Op   string // "-" hoặc "NOT"
+	Expr sqlExpr
+}
+
+type sqlBinaryExpr struct {
+	Op          string // OR, AND, LIKE, = != < <= > >=, + - * / %
+	Left, Right sqlExpr
+}
+
+type sqlIsNullExpr struct {
+	Expr sqlExpr
+	Not  bool
+}
+
+type sqlInExpr struct {
+	Expr sqlExpr
+	List []sqlExpr
+	Not  bool
+}
+
+type sqlBetweenExpr struct {
+	Expr, Low, High sqlExpr
+	Not             bool
+}
+
+type sqlFuncCall struct {
+	Name     string // Viết hoa
+	Args     []sqlExpr
+	Star     bool // COUNT(*)
+	Distinct bool
+}
+
+func (e *sqlColumnRef) String() string {
+	if e.Quoted {
+		return strconv.Quote(e.Name)
+	}
+	return strings.ToLower(e.Name)
+}
+
+func (e *sqlLiteral) String() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return fmt.Sprint(e.Value)
+}
+
+func (e *sqlUnaryExpr) String() string {
+	if e.Op == "NOT" {
+		return "NOT " + e.Expr.String()
+	}
+	return e.Op + e.Expr.String()
+}
+
+func (e *sqlBinaryExpr) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+func (e *sqlIsNullExpr) String() string {
+	if e.Not {
+		return e.Expr.String() + " IS NOT NULL"
+	}
+	return e.Expr.String() + " IS NULL"
+}
+
+func (e *sqlInExpr) String() string {
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	not := ""
+	if e.Not {
+		not = "NOT "
+	}
+	return e.Expr.String() + " " + not + "IN (" + strings.Join(items, ", ") + ")"
+}
+
+func (e *sqlBetweenExpr) String() string {
+	not := ""
+	if e.Not {
+		not = "NOT "
+	}
+	return e.Expr.String() + " " + not + "BETWEEN " + e.Low.String() + " AND " + e.High.String()
+}
+
+func (e *sqlFuncCall) String() string {
+	if e.Star {
+		return strings.ToLower(e.Name) + "(*)"
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	distinct := ""
+	if e.Distinct {
+		distinct = "distinct "
+	}
+	return strings.ToLower(e.Name) + "(" + distinct + strings.Join(args, ", ") + ")"
+}
+
+type sqlSelectItem struct {
+	Star  bool
+	Expr  sqlExpr
+	Alias string
+}
+
+type sqlOrderItem struct {
+	Expr sqlExpr
+	Desc bool
+}
+
+// sqlSelect là câu lệnh SELECT, Limit = -1 nghĩa là không giới hạn
+type sqlSelect struct {
+	Items   []sqlSelectItem
+	From    string
+	AsOf    *sqlLiteral // Snapshot (int64) hoặc thời điểm (string) cần đọc, nil là snapshot hiện tại
+	Where   sqlExpr
+	GroupBy []sqlExpr
+	Having  sqlExpr
+	OrderBy []sqlOrderItem
+	Limit   int64
+	Offset  int64
+}
+
+// sqlDelete là câu lệnh DELETE, Where = nil nghĩa là xóa mọi dòng
+type sqlDelete struct {
+	Table string
+	Where sqlExpr
+}
+
+type sqlAssignment struct {
+	Column *sqlColumnRef
+	Expr   sqlExpr
+}
+
+// sqlUpdate là câu lệnh UPDATE, Where = nil nghĩa là cập nhật mọi dòng
+type sqlUpdate struct {
+	Table string
+	Set   []sqlAssignment
+	Where sqlExpr
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// parseSQL phân tích một câu lệnh SELECT
+func parseSQL(query string) (*sqlSelect, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+
+	if p.peekKeyword("DELETE") || p.peekKeyword("UPDATE") {
+		return nil, p.errorf("%s statements must be run with sql/execute", strings.ToUpper(p.peek().text))
+	}
+	if !p.acceptKeyword("SELECT") {
+		return nil, p.errorf("only SELECT statements are supported")
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseEnd(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseStatement phân tích một câu lệnh SELECT, DELETE hoặc UPDATE,
+// trả về *sqlSelect, *sqlDelete hoặc *sqlUpdate
+func parseStatement(query string) (interface{}, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+
+	var stmt interface{}
+	switch {
+	case p.acceptKeyword("SELECT"):
+		stmt, err = p.parseSelect()
+	case p.acceptKeyword("DELETE"):
+		stmt, err = p.parseDelete()
+	case p.acceptKeyword("UPDATE"):
+		stmt, err = p.parseUpdate()
+	default:
+		return nil, p.errorf("only SELECT, DELETE and UPDATE statements are supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseEnd(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseEnd chấp nhận dấu chấm phẩy ở cuối câu lệnh, sau đó không được còn token nào
+func (p *sqlParser) parseEnd() error {
+	p.acceptOp(";")
+	if p.peek().kind != sqlTokenEOF {
+		return p.errorf("unexpected %s", p.describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *sqlParser) parseDelete() (*sqlDelete, error) {
+	if !p.acceptKeyword("FROM") {
+		return nil, p.errorf("expected FROM after DELETE, got %s", p.describe(p.peek()))
+	}
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &sqlDelete{Table: table}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) parseUpdate() (*sqlUpdate, error) {
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("SET") {
+		return nil, p.errorf("expected SET, got %s", p.describe(p.peek()))
+	}
+	stmt := &sqlUpdate{Table: table}
+	for {
+		quoted := p.peek().kind == sqlTokenQuotedIdent
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptOp("=") {
+			return nil, p.errorf("expected = after column %s, got %s", name, p.describe(p.peek()))
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, sqlAssignment{Column: &sqlColumnRef{Name: name, Quoted: quoted}, Expr: expr})
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) parseSelect() (*sqlSelect, error) {
+	stmt := &sqlSelect{Limit: -1}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if !p.acceptKeyword("FROM") {
+		return nil, p.errorf("expected FROM, got %s", p.describe(p.peek()))
+	}
+	from, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.From = from
+
+	if p.peekKeyword("AS") && p.peekKeywordAt(1, "OF") {
+		p.next()
+		p.next()
+		token := p.next()
+		switch token.kind {
+		case sqlTokenNumber:
+			snapshotID, err := strconv.ParseInt(token.text, 10, 64)
+			if err != nil || snapshotID <= 0 {
+				return nil, p.errorf("invalid snapshot id %s", token.text)
+			}
+			stmt.AsOf = &sqlLiteral{Value: snapshotID}
+		case sqlTokenString:
+			stmt.AsOf = &sqlLiteral{Value: token.text}
+		default:
+			return nil, p.errorf("expected snapshot id or timestamp after AS OF")
+		}
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("GROUP") {
+		if !p.acceptKeyword("BY") {
+			return nil, p.errorf("expected BY after GROUP")
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, expr)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if !p.acceptKeyword("BY") {
+			return nil, p.errorf("expected BY after ORDER")
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := sqlOrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.parseCount("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) parseSelectItem() (sqlSelectItem, error) {
+	if p.acceptOp("*") {
+		return sqlSelectItem{Star: true}, nil
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return sqlSelectItem{}, err
+	}
+	item := sqlSelectItem{Expr: expr}
+	if p.acceptKeyword("AS") {
+		if item.Alias, err = p.parseIdent(); err != nil {
+			return sqlSelectItem{}, err
+		}
+	} else if token := p.peek(); token.kind == sqlTokenQuotedIdent || (token.kind == sqlTokenIdent && !sqlKeywords[strings.ToUpper(token.text)]) {
+		item.Alias, _ = p.parseIdent()
+	}
+	return item, nil
+}
+
+func (p *sqlParser) parseCount(clause string) (int64, error) {
+	token := p.next()
+	if token.kind != sqlTokenNumber {
+		return 0, p.errorf("expected number after %s", clause)
+	}
+	n, err := strconv.ParseInt(token.text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, p.errorf("invalid %s %s", clause, token.text)
+	}
+	return n, nil
+}
+
+func (p *sqlParser) parseIdent() (string, error) {
+	token := p.next()
+	switch {
+	case token.kind == sqlTokenQuotedIdent:
+		return token.text, nil
+	case token.kind == sqlTokenIdent && !sqlKeywords[strings.ToUpper(token.text)]:
+		return token.text, nil
+	}
+	return "", p.errorf("expected identifier, got %s", p.describe(token))
+}
+
+func (p *sqlParser) parseExpr() (sqlExpr, error) {
+	return p.parseOr()
+}
+
+func (p *sqlParser) parseOr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnaryExpr{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *sqlParser) parsePredicate() (sqlExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.peek(); token.kind == sqlTokenOp {
+		switch token.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := token.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &sqlBinaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") {
+			return nil, p.errorf("expected NULL after IS")
+		}
+		return &sqlIsNullExpr{Expr: left, Not: not}, nil
+	}
+
+	not := false
+	if p.peekKeyword("NOT") && (p.peekKeywordAt(1, "IN") || p.peekKeywordAt(1, "BETWEEN") || p.peekKeywordAt(1, "LIKE")) {
+		p.next()
+		not = true
+	}
+	switch {
+	case p.acceptKeyword("IN"):
+		if !p.acceptOp("(") {
+			return nil, p.errorf("expected ( after IN")
+		}
+		in := &sqlInExpr{Expr: left, Not: not}
+		for {
+			item, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if !p.acceptOp(")") {
+			return nil, p.errorf("expected ) after IN list")
+		}
+		return in, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, p.errorf("expected AND in BETWEEN")
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlBetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var expr sqlExpr = &sqlBinaryExpr{Op: "LIKE", Left: left, Right: pattern}
+		if not {
+			expr = &sqlUnaryExpr{Op: "NOT", Expr: expr}
+		}
+		return expr, nil
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		if token.kind != sqlTokenOp || (token.text != "+" && token.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: token.text, Left: left, Right: right}
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		if token.kind != sqlTokenOp || (token.text != "*" && token.text != "/" && token.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: token.text, Left: left, Right: right}
+	}
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	if p.acceptOp("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// Gộp dấu trừ vào hằng số để -5 là một literal, giúp đẩy điều kiện xuống row group
+		if literal, ok := expr.(*sqlLiteral); ok {
+			switch v := literal.Value.(type) {
+			case int64:
+				return &sqlLiteral{Value: -v}, nil
+			case float64:
+				return &sqlLiteral{Value: -v}, nil
+			}
+		}
+		return &sqlUnaryExpr{Op: "-", Expr: expr}, nil
+	}
+	if p.acceptOp("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case sqlTokenNumber:
+		if n, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+			return &sqlLiteral{Value: n}, nil
+		}
+		f, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", token.text)
+		}
+		return &sqlLiteral{Value: f}, nil
+	case sqlTokenString:
+		return &sqlLiteral{Value: token.text}, nil
+	case sqlTokenQuotedIdent:
+		return &sqlColumnRef{Name: token.text, Quoted: true}, nil
+	case sqlTokenOp:
+		if token.text == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.acceptOp(")") {
+				return nil, p.errorf("expected )")
+			}
+			return expr, nil
+		}
+	case sqlTokenIdent:
+		switch strings.ToUpper(token.text) {
+		case "NULL":
+			return &sqlLiteral{Value: nil}, nil
+		case "TRUE":
+			return &sqlLiteral{Value: true}, nil
+		case "FALSE":
+			return &sqlLiteral{Value: false}, nil
+		}
+		if sqlKeywords[strings.ToUpper(token.text)] {
+			break
+		}
+		if p.acceptOp("(") {
+			return p.parseFuncCall(token.text)
+		}
+		return &sqlColumnRef{Name: token.text}, nil
+	}
+	return nil, p.errorf("unexpected %s", p.describe(token))
+}
+
+func (p *sqlParser) parseFuncCall(name string) (sqlExpr, error) {
+	call := &sqlFuncCall{Name: strings.ToUpper(name)}
+	if p.acceptOp("*") {
+		call.Star = true
+	} else if !p.acceptOp(")") {
+		call.Distinct = p.acceptKeyword("DISTINCT")
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	} else {
+		return call, nil
+	}
+	if !p.acceptOp(")") {
+		return nil, p.errorf("expected ) after arguments of %s", call.Name)
+	}
+	return call, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != sqlTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *sqlParser) peekKeyword(keyword string) bool {
+	return p.peekKeywordAt(0, keyword)
+}
+
+func (p *sqlParser) peekKeywordAt(offset int, keyword string) bool {
+	if p.pos+offset >= len(p.tokens) {
+		return false
+	}
+	token := p.tokens[p.pos+offset]
+	return token.kind == sqlTokenIdent && strings.EqualFold(token.text, keyword)
+}
+
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.peekKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) acceptOp(op string) bool {
+	if token := p.peek(); token.kind == sqlTokenOp && token.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) describe(token sqlToken) string {
+	if token.kind == sqlTokenEOF {
+		return "end of query"
+	}
+	return strconv.Quote(token.text)
+}
+
+func (p *sqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidSQL, fmt.Sprintf(format, args...), p.peek().pos)
+}
@@ -0,0 +1,313 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// Kiểu của giá trị trong kết quả truy vấn SQL
+// Các kiểu số nguyên của table được đọc thành int64, float thành double
+const (
+	SQLTypeNull      = "null"
+	SQLTypeBoolean   = "boolean"
+	SQLTypeInt64     = "int64"
+	SQLTypeDouble    = "double"
+	SQLTypeDecimal   = "decimal"
+	SQLTypeString    = "string"
+	SQLTypeBinary    = "binary"
+	SQLTypeDate      = "date"
+	SQLTypeTimestamp = "timestamp"
+)
+
+// SQLColumn là một cột trong kết quả truy vấn SQL
+// Giá trị của cột có kiểu Go theo Type: nil (null), bool, int64, float64, SQLDecimal, string, []byte,
+// time.Time (UTC) với date và timestamp
+type SQLColumn struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Precision int    `json:"precision,omitempty"` // Với decimal
+	Scale     int    `json:"scale,omitempty"`     // Với decimal
+	Unit      string `json:"unit,omitempty"`      // Với timestamp
+}
+
+// SQLDecimal là số thập phân Unscaled / 10^Scale
+type SQLDecimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+// String trả về dạng thập phân với đúng Scale chữ số sau dấu chấm
+func (d SQLDecimal) String() string {
+	text := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale > 0 {
+		if len(text) <= d.Scale {
+			text = strings.Repeat("0", d.Scale-len(text)+1) + text
+		}
+		text = text[:len(text)-d.Scale] + "." + text[len(text)-d.Scale:]
+	}
+	if d.Unscaled.Sign() < 0 {
+		text = "-" + text
+	}
+	return text
+}
+
+func (d SQLDecimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Unscaled, pow10(d.Scale))
+}
+
+func (d SQLDecimal) float() float64 {
+	f, _ := d.rat().Float64()
+	return f
+}
+
+// rescale đưa decimal về scale lớn hơn hoặc bằng scale hiện tại
+func (d SQLDecimal) rescale(scale int) SQLDecimal {
+	if scale <= d.Scale {
+		return d
+	}
+	return SQLDecimal{Unscaled: new(big.Int).Mul(d.Unscaled, pow10(scale-d.Scale)), Scale: scale}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// sqlType là kiểu tĩnh của một biểu thức, được xác định khi biên dịch câu lệnh
+type sqlType struct {
+	Kind      string
+	Precision int
+	Scale     int
+	Unit      string
+}
+
+func (t sqlType) numeric() bool {
+	return t.Kind == SQLTypeInt64 || t.Kind == SQLTypeDouble || t.Kind == SQLTypeDecimal
+}
+
+func (t sqlType) temporal() bool {
+	return t.Kind == SQLTypeDate || t.Kind == SQLTypeTimestamp
+}
+
+// comparable kiểm tra hai kiểu có so sánh được với nhau không, null so sánh được với mọi kiểu
+func (t sqlType) comparable(other sqlType) bool {
+	switch {
+	case t.Kind == SQLTypeNull || other.Kind == SQLTypeNull:
+		return true
+	case t.numeric() && other.numeric():
+		return true
+	case t.temporal() && other.temporal():
+		return true
+	}
+	return t.Kind == other.Kind
+}
+
+// columnSQLType trả về kiểu SQL của một cột trong table
+func columnSQLType(column *models.TableColumn) sqlType {
+	switch column.Type {
+	case models.ColumnTypeBoolean:
+		return sqlType{Kind: SQLTypeBoolean}
+	case models.ColumnTypeInt32, models.ColumnTypeInt64:
+		return sqlType{Kind: SQLTypeInt64}
+	case models.ColumnTypeFloat, models.ColumnTypeDouble:
+		return sqlType{Kind: SQLTypeDouble}
+	case models.ColumnTypeString:
+		return sqlType{Kind: SQLTypeString}
+	case models.ColumnTypeBinary:
+		return sqlType{Kind: SQLTypeBinary}
+	case models.ColumnTypeDate:
+		return sqlType{Kind: SQLTypeDate}
+	case models.ColumnTypeTimestamp:
+		return sqlType{Kind: SQLTypeTimestamp, Unit: column.Unit}
+	case models.ColumnTypeDecimal:
+		return sqlType{Kind: SQLTypeDecimal, Precision: column.Precision, Scale: column.Scale}
+	}
+	return sqlType{Kind: SQLTypeNull}
+}
+
+// columnSQLValue chuyển giá trị đọc từ tệp Parquet (cùng kiểu với ConvertRows) thành giá trị SQL
+func columnSQLValue(column *models.TableColumn, raw interface{}) interface{} {
+	switch v := raw.(type) {
+	case nil:
+		return nil
+	case int32:
+		if column.Type == models.ColumnTypeDate {
+			return time.Unix(int64(v)*86400, 0).UTC()
+		}
+		return int64(v)
+	case int64:
+		if column.Type == models.ColumnTypeTimestamp {
+			return timestampFromUnit(v, column.Unit)
+		}
+		return v
+	case float32:
+		return float64(v)
+	case *big.Int:
+		return SQLDecimal{Unscaled: v, Scale: column.Scale}
+	}
+	return raw
+}
+
+func timestampFromUnit(v int64, unit string) time.Time {
+	switch unit {
+	case models.TimeUnitMillis:
+		return time.UnixMilli(v).UTC()
+	case models.TimeUnitNanos:
+		return time.Unix(0, v).UTC()
+	default:
+		return time.UnixMicro(v).UTC()
+	}
+}
+
+// literalSQLType trả về kiểu của một hằng số trong câu lệnh
+func literalSQLType(value interface{}) sqlType {
+	switch value.(type) {
+	case bool:
+		return sqlType{Kind: SQLTypeBoolean}
+	case int64:
+		return sqlType{Kind: SQLTypeInt64}
+	case float64:
+		return sqlType{Kind: SQLTypeDouble}
+	case string:
+		return sqlType{Kind: SQLTypeString}
+	}
+	return sqlType{Kind: SQLTypeNull}
+}
+
+// coerceLiteral chuyển chuỗi hằng số thành date hoặc timestamp khi được so sánh với cột kiểu đó,
+// ví dụ created_at >= '2024-01-01'. Các trường hợp khác giữ nguyên giá trị
+func coerceLiteral(value interface{}, target sqlType) (interface{}, sqlType, error) {
+	text, ok := value.(string)
+	if !ok || !target.temporal() {
+		return value, literalSQLType(value), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", time.DateOnly} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC(), target, nil
+		}
+	}
+	return nil, target, fmt.Errorf("%w: cannot convert '%s' to %s", ErrInvalidSQL, text, target.Kind)
+}
+
+// compareSQLValues so sánh hai giá trị khác null, trả về false nếu hai giá trị không so sánh được
+func compareSQLValues(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareOrdered(x, y), true
+		case float64:
+			return compareFloat(float64(x), y), true
+		case SQLDecimal:
+			return SQLDecimal{Unscaled: big.NewInt(x)}.rat().Cmp(y.rat()), true
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return compareFloat(x, float64(y)), true
+		case float64:
+			return compareFloat(x, y), true
+		case SQLDecimal:
+			return compareFloat(x, y.float()), true
+		}
+	case SQLDecimal:
+		switch y := b.(type) {
+		case int64:
+			return x.rat().Cmp(SQLDecimal{Unscaled: big.NewInt(y)}.rat()), true
+		case float64:
+			return compareFloat(x.float(), y), true
+		case SQLDecimal:
+			if x.Scale == y.Scale {
+				return x.Unscaled.Cmp(y.Unscaled), true
+			}
+			return x.rat().Cmp(y.rat()), true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareFloat coi NaN lớn hơn mọi số để thứ tự sắp xếp ổn định
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return 1
+	}
+	return -1
+}
+
+// sqlValueKey trả về khóa của giá trị dùng cho GROUP BY và DISTINCT, hai giá trị bằng nhau có cùng khóa
+func sqlValueKey(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "n"
+	case bool:
+		return "b" + strconv.FormatBool(v)
+	case int64:
+		return "i" + strconv.FormatInt(v, 10)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return "i" + strconv.FormatInt(int64(v), 10)
+		}
+		return "f" + strconv.FormatFloat(v, 'g', -1, 64)
+	case SQLDecimal:
+		if r := v.rat(); r.IsInt() {
+			return "i" + r.Num().String()
+		} else {
+			return "r" + r.RatString()
+		}
+	case string:
+		return "s" + v
+	case []byte:
+		return "x" + string(v)
+	case time.Time:
+		return "t" + strconv.FormatInt(v.UnixNano(), 10)
+	}
+	return fmt.Sprintf("?%v", value)
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidBackend được trả về khi collection dùng backend lưu trữ không tồn tại
+var ErrInvalidBackend = errors.New("invalid storage backend")
+
+// useBackend chọn DocumentStore và IndexStore theo backend của collection
+func (cw *CollectionWrapper) useBackend() error {
+	backend, ok := cw.Storage.Backend(cw.Collection.Backend)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidBackend, cw.Collection.Backend)
+	}
+	cw.Documents, cw.Indexes = backend.Documents, backend.Indexes
+	return nil
+}
+
+// useBackend chọn DocumentStore và IndexStore theo backend của collection chứa index
+func (iw *IndexWrapper) useBackend(name string) error {
+	backend, ok := iw.Storage.Backend(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidBackend, name)
+	}
+	iw.Documents, iw.Indexes = backend.Documents, backend.Indexes
+	return nil
+}
@@ -0,0 +1,318 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidColumn được trả về khi khai báo cột của table không hợp lệ
+	ErrInvalidColumn = errors.New("invalid column")
+	// ErrInvalidTableOption được trả về khi codec nén hoặc kích thước row group của table không hợp lệ
+	ErrInvalidTableOption = errors.New("invalid table option")
+	// ErrInvalidPartition được trả về khi khai báo phân vùng của table không hợp lệ
+	ErrInvalidPartition = errors.New("invalid partition")
+)
+
+// maxDecimalPrecision là số chữ số tối đa của decimal, giới hạn của decimal 128 bit trong Parquet
+const maxDecimalPrecision = 38
+
+// TableWrapper là struct bọc để thêm các phương thức vào Table
+type TableWrapper struct {
+	SQLiteCatalogService *service.SQLiteCatalogService
+	Table                *models.Table
+	Storage              *service.Storage
+}
+
+// NewTableWrapper khởi tạo một instance mới của TableWrapper
+func NewTableWrapper(table *models.Table, SQLiteCatalogService *service.SQLiteCatalogService, storage *service.Storage) *TableWrapper {
+	return &TableWrapper{
+		SQLiteCatalogService: SQLiteCatalogService,
+		Table:                table,
+		Storage:              storage,
+	}
+}
+
+// CreateTable kiểm tra tên và các cột rồi tạo table trong catalog cùng thư mục lưu dữ liệu theo ID của workspace và table
+// Nếu tạo trong catalog thất bại, thư mục vừa tạo được xóa
+func (tw *TableWrapper) CreateTable() error {
+	if err := tw.checkName(tw.Table.Name); err != nil {
+		return err
+	}
+	if err := ValidateColumns(tw.Table.Columns); err != nil {
+		return err
+	}
+	if err := ValidatePartitioning(tw.Table.Columns, tw.Table.PartitionBy); err != nil {
+		return err
+	}
+	if err := tw.applyOptions(); err != nil {
+		return err
+	}
+
+	created := false
+	err := tw.SQLiteCatalogService.CreateTableWithStorage(tw.Table, func(table *models.Table) error {
+		table.StoragePath = tw.Storage.Tables.TableStoragePath(table.WorkspaceID, table.ID)
+		if err := tw.Storage.Tables.CreateTableStorage(table); err != nil {
+			return fmt.Errorf("failed to create table storage: %v", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		if created {
+			if cleanupErr := tw.Storage.Tables.DeleteTableStorage(tw.Table); cleanupErr != nil {
+				log.Printf("Failed to remove storage of table %s: %v", tw.Table.Name, cleanupErr)
+			}
+		}
+		tw.Table.ID, tw.Table.StoragePath = 0, ""
+		return fmt.Errorf("failed to create table: %v", err)
+	}
+	return nil
+}
+
+// applyOptions kiểm tra codec nén, kích thước row group và cột sắp xếp khi compaction,
+// giá trị không được chỉ định lấy theo cấu hình
+func (tw *TableWrapper) applyOptions() error {
+	switch tw.Table.Compression {
+	case "":
+		tw.Table.Compression = tw.Storage.Tables.DefaultCompression()
+	case models.TableCompressionSnappy, models.TableCompressionZstd, models.TableCompressionNone:
+	default:
+		return fmt.Errorf("%w: unsupported compression %q, expected snappy, zstd or none", ErrInvalidTableOption, tw.Table.Compression)
+	}
+
+	if tw.Table.RowGroupSize < 0 {
+		return fmt.Errorf("%w: row group size must not be negative", ErrInvalidTableOption)
+	}
+	if tw.Table.RowGroupSize == 0 {
+		tw.Table.RowGroupSize = tw.Storage.Tables.DefaultRowGroupSize()
+	}
+
+	if tw.Table.ClusterBy != "" && columnIndex(tw.Table.Columns, tw.Table.ClusterBy) < 0 {
+		return fmt.Errorf("%w: cluster column %s does not exist", ErrInvalidTableOption, tw.Table.ClusterBy)
+	}
+	return nil
+}
+
+// AppendResult là kết quả của một lần append
+type AppendResult struct {
+	Appended     int                `json:"appended"`          // Số dòng được nhận
+	BufferedRows int                `json:"buffered_rows"`     // Số dòng chưa được ghi ra tệp sau lần append
+	Flushed      []models.TableFile `json:"flushed,omitempty"` // Các tệp được ghi ra nếu buffer đạt ngưỡng
+}
+
+// Append kiểm tra các dòng với schema rồi đưa vào buffer của table
+// Khi buffer đạt ngưỡng trong cấu hình, buffer được ghi ra tệp ngay. Nếu ghi thất bại, các dòng vẫn nằm trong buffer
+// và được ghi lại ở lần flush sau, nên append vẫn được coi là thành công
+func (tw *TableWrapper) Append(rows []map[string]interface{}) (*AppendResult, error) {
+	converted, err := ConvertRows(tw.Table.Columns, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AppendResult{Appended: len(converted)}
+	result.BufferedRows = tw.Storage.Tables.Append(tw.Table.ID, converted)
+	if result.BufferedRows >= tw.Storage.Tables.FlushRows() {
+		files, err := tw.Flush()
+		if err != nil {
+			log.Printf("Failed to flush table %d, rows stay buffered: %v", tw.Table.ID, err)
+		} else {
+			result.Flushed = files
+		}
+		result.BufferedRows = tw.Storage.Tables.BufferedRows(tw.Table.ID)
+	}
+	return result, nil
+}
+
+// Flush ghi buffer của table thành tệp Parquet (mỗi phân vùng một tệp) và đăng ký các tệp vào manifest trong catalog
+// dưới một snapshot mới. Tệp được ghi theo schema hiện tại trong catalog vì buffer có thể có dòng được kiểm tra
+// theo schema mới hơn tw.Table. Trả về nil nếu buffer rỗng
+func (tw *TableWrapper) Flush() ([]models.TableFile, error) {
+	table, err := tw.SQLiteCatalogService.GetTableByID(tw.Table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table %s: %v", tw.Table.Name, err)
+	}
+
+	files, err := tw.Storage.Tables.Flush(table, func(files []models.TableFile) error {
+		_, err := tw.SQLiteCatalogService.CommitTableSnapshot(table.ID, models.SnapshotOperationAppend, 0, 0, files, nil)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to flush table %s: %v", tw.Table.Name, err)
+	}
+	return files, nil
+}
+
+// FlushTables ghi buffer của tất cả các table ra tệp, dùng bởi job định kỳ và khi server dừng
+// Buffer của table không còn trong catalog bị bỏ
+func FlushTables(catalog *service.SQLiteCatalogService, storage *service.Storage) error {
+	var firstErr error
+	for _, tableID := range storage.Tables.BufferedTables() {
+		table, err := catalog.GetTableByID(tableID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			storage.Tables.DiscardBuffer(tableID)
+			continue
+		}
+		if err == nil {
+			_, err = NewTableWrapper(table, catalog, storage).Flush()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Drop xóa dữ liệu của table rồi xóa table khỏi catalog, không được xóa khi table đang được compaction hoặc đồng bộ.
+// Sync ghi vào table cũng bị xóa
+func (tw *TableWrapper) Drop() error {
+	if tw.Storage.Tables.IsCompacting(tw.Table.ID) {
+		return ErrCompactionRunning
+	}
+	syncs, err := tw.SQLiteCatalogService.ListCollectionSyncs(0)
+	if err != nil {
+		return fmt.Errorf("failed to list syncs: %v", err)
+	}
+	if err := tw.Storage.Tables.DeleteTableStorage(tw.Table); err != nil {
+		return fmt.Errorf("failed to delete table storage: %v", err)
+	}
+	if err := tw.SQLiteCatalogService.HardDeleteTable(tw.Table.ID); err != nil {
+		return fmt.Errorf("failed to delete table from catalog: %v", err)
+	}
+	for _, sync := range syncs {
+		if sync.TableID != tw.Table.ID {
+			continue
+		}
+		if err := dropUnusedChangeLog(tw.SQLiteCatalogService, tw.Storage, sync.CollectionID); err != nil {
+			log.Printf("Failed to drop change log of collection %d: %v", sync.CollectionID, err)
+		}
+	}
+	return nil
+}
+
+// checkName kiểm tra tên table hợp lệ và chưa được dùng trong workspace
+func (tw *TableWrapper) checkName(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	existing, err := tw.SQLiteCatalogService.GetTableByName(tw.Table.WorkspaceID, name)
+	if err == nil && existing.ID != tw.Table.ID {
+		return fmt.Errorf("%w: table %s already exists in workspace", ErrNameConflict, name)
+	}
+	return nil
+}
+
+// ValidateColumns kiểm tra khai báo các cột của table và chuẩn hóa chúng
+// Kiểu được đưa về chữ thường, Position và FieldID được đánh theo thứ tự khai báo và timestamp không có Unit dùng micros
+// Tên cột không phân biệt hoa thường khi kiểm tra trùng, để có thể dùng trong câu lệnh SQL
+func ValidateColumns(columns []models.TableColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: table must have at least one column", ErrInvalidColumn)
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for i := range columns {
+		column := &columns[i]
+		if column.Name == "" || strings.TrimSpace(column.Name) != column.Name {
+			return fmt.Errorf("%w: column %d: name must not be empty or have leading/trailing spaces", ErrInvalidColumn, i)
+		}
+		if seen[strings.ToLower(column.Name)] {
+			return fmt.Errorf("%w: duplicate column %s", ErrInvalidColumn, column.Name)
+		}
+		seen[strings.ToLower(column.Name)] = true
+
+		column.Position = i
+		column.FieldID = i + 1
+		column.Type = strings.ToLower(column.Type)
+		if err := validateColumnType(column); err != nil {
+			return fmt.Errorf("%w: column %s: %v", ErrInvalidColumn, column.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidatePartitioning kiểm tra khai báo phân vùng của table với các cột đã được chuẩn hóa và chuẩn hóa các trường phân vùng
+// Transform được đưa về chữ thường, rỗng là identity, và Position được đánh theo thứ tự khai báo.
+// Phân vùng theo giá trị dùng được với cột boolean, int32, int64, string và date; theo ngày, tháng với cột date và timestamp
+func ValidatePartitioning(columns []models.TableColumn, fields []models.TablePartitionField) error {
+	types := make(map[string]string, len(columns))
+	for _, column := range columns {
+		types[column.Name] = column.Type
+	}
+
+	seen := make(map[string]bool, len(fields))
+	for i := range fields {
+		field := &fields[i]
+		field.Position = i
+		field.Transform = strings.ToLower(field.Transform)
+		if field.Transform == "" {
+			field.Transform = models.PartitionTransformIdentity
+		}
+
+		columnType, ok := types[field.Column]
+		if !ok {
+			return fmt.Errorf("%w: column %s does not exist", ErrInvalidPartition, field.Column)
+		}
+		switch field.Transform {
+		case models.PartitionTransformIdentity:
+			switch columnType {
+			case models.ColumnTypeBoolean, models.ColumnTypeInt32, models.ColumnTypeInt64, models.ColumnTypeString, models.ColumnTypeDate:
+			default:
+				return fmt.Errorf("%w: column %s of type %s cannot be partitioned by value", ErrInvalidPartition, field.Column, columnType)
+			}
+		case models.PartitionTransformDay, models.PartitionTransformMonth:
+			if columnType != models.ColumnTypeDate && columnType != models.ColumnTypeTimestamp {
+				return fmt.Errorf("%w: column %s of type %s cannot be partitioned by %s", ErrInvalidPartition, field.Column, columnType, field.Transform)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported transform %q, expected identity, day or month", ErrInvalidPartition, field.Transform)
+		}
+
+		if seen[field.Name()] {
+			return fmt.Errorf("%w: duplicate partition %s", ErrInvalidPartition, field.Name())
+		}
+		seen[field.Name()] = true
+	}
+	return nil
+}
+
+// validateColumnType kiểm tra kiểu của cột và các tham số của kiểu logic
+func validateColumnType(column *models.TableColumn) error {
+	switch column.Type {
+	case models.ColumnTypeBoolean, models.ColumnTypeInt32, models.ColumnTypeInt64, models.ColumnTypeFloat,
+		models.ColumnTypeDouble, models.ColumnTypeString, models.ColumnTypeBinary, models.ColumnTypeDate:
+		if column.Precision != 0 || column.Scale != 0 || column.Unit != "" {
+			return fmt.Errorf("type %s does not take precision, scale or unit", column.Type)
+		}
+	case models.ColumnTypeTimestamp:
+		if column.Precision != 0 || column.Scale != 0 {
+			return fmt.Errorf("type timestamp does not take precision or scale")
+		}
+		switch column.Unit {
+		case "":
+			column.Unit = models.TimeUnitMicros
+		case models.TimeUnitMillis, models.TimeUnitMicros, models.TimeUnitNanos:
+		default:
+			return fmt.Errorf("unsupported timestamp unit %q, expected millis, micros or nanos", column.Unit)
+		}
+	case models.ColumnTypeDecimal:
+		if column.Unit != "" {
+			return fmt.Errorf("type decimal does not take unit")
+		}
+		if column.Precision < 1 || column.Precision > maxDecimalPrecision {
+			return fmt.Errorf("decimal precision must be between 1 and %d", maxDecimalPrecision)
+		}
+		if column.Scale < 0 || column.Scale > column.Precision {
+			return fmt.Errorf("decimal scale must be between 0 and precision")
+		}
+	default:
+		return fmt.Errorf("unsupported type %q", column.Type)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+// ErrCompactionRunning được trả về khi table đang được compaction
+var ErrCompactionRunning = errors.New("table is being compacted")
+
+// compactionHistoryLimit là số lần compaction gần nhất được trả về khi xem trạng thái
+const compactionHistoryLimit = 20
+
+// CompactionOptions là tham số của một lần compaction, giá trị 0 hoặc rỗng lấy theo cấu hình và table
+type CompactionOptions struct {
+	TargetBytes int64  // Kích thước mong muốn của tệp sau khi gộp, tệp nhỏ hơn được coi là tệp nhỏ
+	MinFiles    int    // Số tệp nhỏ tối thiểu trong một phân vùng để gộp phân vùng đó
+	ClusterBy   string // Cột dùng để sắp xếp dòng trong tệp mới, rỗng là theo table
+}
+
+// CompactionStatus là trạng thái compaction của một table
+type CompactionStatus struct {
+	Running     bool                     `json:"running"`
+	Compactions []models.TableCompaction `json:"compactions"` // Các lần compaction gần nhất, mới nhất trước
+}
+
+// compactionGroup là một nhóm tệp nhỏ trong cùng phân vùng được gộp thành một tệp
+// deletes là các tệp delete của các tệp trong nhóm, các dòng bị xóa không được ghi vào tệp mới
+type compactionGroup struct {
+	partition string
+	files     []models.TableFile
+	deletes   []models.TableFile
+}
+
+// StartCompaction bắt đầu compaction table trong nền và trả về lần compaction đang chạy
+// Với yêu cầu thủ công, phân vùng có ít nhất hai tệp nhỏ là được gộp, trừ khi MinFiles được chỉ định
+func (tw *TableWrapper) StartCompaction(options CompactionOptions) (*models.TableCompaction, error) {
+	if options.MinFiles <= 0 {
+		options.MinFiles = 2
+	}
+	compaction, groups, sortColumn, err := tw.beginCompaction(options, models.CompactionTriggerManual)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := *compaction
+	go tw.runCompaction(compaction, groups, sortColumn)
+	return &snapshot, nil
+}
+
+// Compact gộp các tệp nhỏ của table và chờ tới khi xong, dùng bởi job định kỳ
+// Trả về nil nếu không có phân vùng nào đủ tệp nhỏ để gộp, khi đó không có lần compaction nào được ghi lại
+func (tw *TableWrapper) Compact(options CompactionOptions) (*models.TableCompaction, error) {
+	compaction, groups, sortColumn, err := tw.beginCompaction(options, models.CompactionTriggerScheduled)
+	if err != nil || compaction == nil {
+		return nil, err
+	}
+	tw.runCompaction(compaction, groups, sortColumn)
+	if compaction.Status == models.CompactionStatusFailed {
+		return compaction, fmt.Errorf("failed to compact table %s: %s", tw.Table.Name, compaction.Error)
+	}
+	return compaction, nil
+}
+
+// beginCompaction khóa table, chọn các nhóm tệp cần gộp và ghi lại lần compaction với trạng thái running
+// Khóa được giữ tới khi runCompaction kết thúc. Với compaction định kỳ, nếu không có gì để gộp thì khóa được trả lại
+// và compaction trả về là nil
+func (tw *TableWrapper) beginCompaction(options CompactionOptions, trigger string) (*models.TableCompaction, []compactionGroup, int, error) {
+	if options.TargetBytes < 0 || options.MinFiles < 0 {
+		return nil, nil, 0, fmt.Errorf("%w: target size and min files must not be negative", ErrInvalidTableOption)
+	}
+	if options.TargetBytes == 0 {
+		options.TargetBytes = tw.Storage.Tables.CompactionTargetBytes()
+	}
+	if options.MinFiles == 0 {
+		options.MinFiles = tw.Storage.Tables.CompactionMinFiles()
+	}
+	if options.ClusterBy == "" {
+		options.ClusterBy = tw.Table.ClusterBy
+	}
+	sortColumn := -1
+	if options.ClusterBy != "" {
+		if sortColumn = columnIndex(tw.Table.Columns, options.ClusterBy); sortColumn < 0 {
+			return nil, nil, 0, fmt.Errorf("%w: cluster column %s does not exist", ErrInvalidTableOption, options.ClusterBy)
+		}
+	}
+
+	if !tw.Storage.Tables.TryLockCompaction(tw.Table.ID) {
+		return nil, nil, 0, ErrCompactionRunning
+	}
+	compaction, groups, err := func() (*models.TableCompaction, []compactionGroup, error) {
+		// Đang giữ khóa nên các lần compaction còn running là của lần chạy trước khi server dừng
+		if err := tw.SQLiteCatalogService.FailRunningTableCompactions(tw.Table.ID, "interrupted"); err != nil {
+			return nil, nil, err
+		}
+		// Đọc lại table trước khi liệt kê tệp để snapshot hiện tại là gốc của commit, schema cũng là mới nhất
+		table, err := tw.SQLiteCatalogService.GetTableByID(tw.Table.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get table %s: %v", tw.Table.Name, err)
+		}
+		tw.Table = table
+		if options.ClusterBy != "" {
+			if sortColumn = columnIndex(table.Columns, options.ClusterBy); sortColumn < 0 {
+				return nil, nil, fmt.Errorf("%w: cluster column %s does not exist", ErrInvalidTableOption, options.ClusterBy)
+			}
+		}
+		files, err := tw.SQLiteCatalogService.ListTableFiles(tw.Table.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list files of table %s: %v", tw.Table.Name, err)
+		}
+		groups := planCompaction(files, options.TargetBytes, options.MinFiles)
+		if len(groups) == 0 && trigger == models.CompactionTriggerScheduled {
+			return nil, nil, nil
+		}
+
+		compaction := &models.TableCompaction{
+			TableID:     tw.Table.ID,
+			Trigger:     trigger,
+			Status:      models.CompactionStatusRunning,
+			TargetBytes: options.TargetBytes,
+			ClusterBy:   options.ClusterBy,
+		}
+		if err := tw.SQLiteCatalogService.CreateTableCompaction(compaction); err != nil {
+			return nil, nil, err
+		}
+		return compaction, groups, nil
+	}()
+	if err != nil || compaction == nil {
+		tw.Storage.Tables.UnlockCompaction(tw.Table.ID)
+		return nil, nil, 0, err
+	}
+	return compaction, groups, sortColumn, nil
+}
+
+// planCompaction chia các tệp nhỏ hơn targetBytes của mỗi phân vùng thành các nhóm có tổng kích thước khoảng targetBytes,
+// theo thứ tự commit. Chỉ phân vùng có ít nhất minFiles tệp nhỏ được gộp, nhóm chỉ có một tệp bị bỏ qua.
+// Tệp có dòng bị xóa luôn được ghi lại để xóa hẳn các dòng đó, kể cả khi tệp đủ lớn hoặc là tệp duy nhất
+func planCompaction(files []models.TableFile, targetBytes int64, minFiles int) []compactionGroup {
+	files, deletes := service.SplitDeleteFiles(files)
+
+	var partitions []string
+	small := make(map[string][]models.TableFile)
+	dirty := make(map[string]bool)
+	for _, file := range files {
+		hasDeletes := len(deletes[file.ID]) > 0
+		if file.ByteSize >= targetBytes && !hasDeletes {
+			continue
+		}
+		if _, ok := small[file.Partition]; !ok {
+			partitions = append(partitions, file.Partition)
+		}
+		small[file.Partition] = append(small[file.Partition], file)
+		dirty[file.Partition] = dirty[file.Partition] || hasDeletes
+	}
+	sort.Strings(partitions)
+
+	var groups []compactionGroup
+	addGroup := func(partition string, current []models.TableFile) {
+		group := compactionGroup{partition: partition, files: current}
+		for _, file := range current {
+			group.deletes = append(group.deletes, deletes[file.ID]...)
+		}
+		if len(current) > 1 || len(group.deletes) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	for _, partition := range partitions {
+		candidates := small[partition]
+		if !dirty[partition] && (len(candidates) < minFiles || len(candidates) < 2) {
+			continue
+		}
+
+		var current []models.TableFile
+		var size int64
+		for _, file := range candidates {
+			current = append(current, file)
+			size += file.ByteSize
+			if size >= targetBytes {
+				addGroup(partition, current)
+				current, size = nil, 0
+			}
+		}
+		if len(current) > 0 {
+			addGroup(partition, current)
+		}
+	}
+	return groups
+}
+
+// runCompaction ghi lại mỗi nhóm thành một tệp rồi thay các tệp cũ bằng các tệp mới trong một snapshot,
+// nên người đọc thấy table trước hoặc sau compaction chứ không thấy trạng thái giữa chừng.
+// Tệp cũ vẫn nằm trên đĩa để đọc các snapshot trước và bị xóa khi snapshot hết hạn.
+// Kết quả được ghi vào compaction và catalog, khóa compaction của table được trả lại khi xong
+func (tw *TableWrapper) runCompaction(compaction *models.TableCompaction, groups []compactionGroup, sortColumn int) {
+	defer tw.Storage.Tables.UnlockCompaction(tw.Table.ID)
+
+	var written []models.TableFile
+	err := func() error {
+		var removed []int
+		for _, group := range groups {
+			file, err := tw.Storage.Tables.RewriteFiles(tw.Table, group.partition, append(group.files, group.deletes...), sortColumn, nil)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite partition %q: %v", group.partition, err)
+			}
+			// Các tệp delete bị loại cùng tệp dữ liệu khi commit
+			for _, input := range group.files {
+				removed = append(removed, input.ID)
+				compaction.InputFiles++
+				compaction.InputBytes += input.ByteSize
+			}
+			// Không tạo tệp mới nếu mọi dòng của nhóm đã bị xóa
+			if file == nil {
+				continue
+			}
+			written = append(written, *file)
+			compaction.OutputFiles++
+			compaction.OutputBytes += file.ByteSize
+			compaction.RowCount += file.RowCount
+		}
+		if len(groups) == 0 {
+			return nil
+		}
+
+		snapshot, err := tw.SQLiteCatalogService.CommitTableSnapshot(tw.Table.ID, models.SnapshotOperationCompact, tw.Table.SchemaVersion, tw.Table.CurrentSnapshotID, written, removed)
+		if err != nil {
+			return fmt.Errorf("failed to commit compaction: %w", err)
+		}
+		compaction.SnapshotID = snapshot.ID
+		return nil
+	}()
+
+	finishedAt := time.Now()
+	compaction.FinishedAt = &finishedAt
+	compaction.Status = models.CompactionStatusSucceeded
+	if err != nil {
+		compaction.Status = models.CompactionStatusFailed
+		compaction.Error = err.Error()
+		for _, file := range written {
+			if removeErr := tw.Storage.Tables.RemoveTableFile(tw.Table, file.Path); removeErr != nil {
+				log.Printf("Failed to remove uncommitted compaction file %s of table %d: %v", file.Path, tw.Table.ID, removeErr)
+			}
+		}
+		log.Printf("Compaction %d of table %d failed: %v", compaction.ID, tw.Table.ID, err)
+	}
+	if err := tw.SQLiteCatalogService.UpdateTableCompaction(compaction); err != nil {
+		log.Printf("Failed to save compaction %d of table %d: %v", compaction.ID, tw.Table.ID, err)
+	}
+}
+
+// CompactionStatus trả về table có đang được compaction không cùng các lần compaction gần nhất
+func (tw *TableWrapper) CompactionStatus() (*CompactionStatus, error) {
+	compactions, err := tw.SQLiteCatalogService.ListTableCompactions(tw.Table.ID, compactionHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &CompactionStatus{Running: tw.Storage.Tables.IsCompacting(tw.Table.ID), Compactions: compactions}, nil
+}
+
+// CompactTables gộp các tệp nhỏ của tất cả các table, dùng bởi job định kỳ
+// Table đang được compaction theo yêu cầu thủ công được bỏ qua
+func CompactTables(catalog *service.SQLiteCatalogService, storage *service.Storage) error {
+	tables, err := catalog.ListTables()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for i := range tables {
+		compaction, err := NewTableWrapper(&tables[i], catalog, storage).Compact(CompactionOptions{})
+		if errors.Is(err, ErrCompactionRunning) {
+			continue
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if compaction != nil {
+			log.Printf("Compacted table %d: %d files into %d files", tables[i].ID, compaction.InputFiles, compaction.OutputFiles)
+		}
+	}
+	return firstErr
+}
+
+// columnIndex trả về vị trí của cột có tên name, -1 nếu không có
+func columnIndex(columns []models.TableColumn, name string) int {
+	for i := range columns {
+		if columns[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// dataFile và deleteFile tạo tệp trong manifest để lập kế hoạch compaction
+func dataFile(id int, partition string, size int64) models.TableFile {
+	return models.TableFile{ID: id, Partition: partition, ByteSize: size, Content: models.TableFileContentData}
+}
+
+func deleteFile(id, dataFileID int, partition string) models.TableFile {
+	return models.TableFile{ID: id, Partition: partition, ByteSize: 1, Content: models.TableFileContentPositionDeletes, DataFileID: dataFileID}
+}
+
+// describeGroups mô tả mỗi nhóm dạng "<phân vùng>:<ID các tệp>/<ID các tệp delete>"
+func describeGroups(groups []compactionGroup) []string {
+	described := []string{}
+	for _, group := range groups {
+		var files, deletes []int
+		for _, file := range group.files {
+			files = append(files, file.ID)
+		}
+		for _, file := range group.deletes {
+			deletes = append(deletes, file.ID)
+		}
+		described = append(described, fmt.Sprintf("%s:%v/%v", group.partition, files, deletes))
+	}
+	return described
+}
+
+func TestPlanCompaction(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []models.TableFile
+		want  []string
+	}{
+		{
+			name:  "small files are merged",
+			files: []models.TableFile{dataFile(1, "p=a", 10), dataFile(2, "p=a", 10), dataFile(3, "p=a", 10)},
+			want:  []string{"p=a:[1 2 3]/[]"},
+		},
+		{
+			name:  "partition below min files is skipped",
+			files: []models.TableFile{dataFile(1, "p=a", 10), dataFile(2, "p=a", 10), dataFile(3, "p=b", 10)},
+			want:  []string{},
+		},
+		{
+			name:  "files reaching target size are kept",
+			files: []models.TableFile{dataFile(1, "", 200), dataFile(2, "", 10), dataFile(3, "", 100), dataFile(4, "", 10), dataFile(5, "", 10)},
+			want:  []string{":[2 4 5]/[]"},
+		},
+		{
+			name: "groups are split at target size",
+			files: []models.TableFile{
+				dataFile(1, "", 60), dataFile(2, "", 60), dataFile(3, "", 60), dataFile(4, "", 30), dataFile(5, "", 20),
+			},
+			want: []string{":[1 2]/[]", ":[3 4 5]/[]"},
+		},
+		{
+			name:  "last group with a single file is skipped",
+			files: []models.TableFile{dataFile(1, "", 60), dataFile(2, "", 60), dataFile(3, "", 60)},
+			want:  []string{":[1 2]/[]"},
+		},
+		{
+			name: "partitions are planned in order",
+			files: []models.TableFile{
+				dataFile(1, "p=b", 10), dataFile(2, "p=a", 10), dataFile(3, "p=b", 10), dataFile(4, "p=a", 10),
+				dataFile(5, "p=b", 10), dataFile(6, "p=a", 10),
+			},
+			want: []string{"p=a:[2 4 6]/[]", "p=b:[1 3 5]/[]"},
+		},
+		{
+			name:  "large file with deletes is rewritten alone",
+			files: []models.TableFile{dataFile(1, "p=a", 500), deleteFile(2, 1, "p=a"), dataFile(3, "p=b", 500)},
+			want:  []string{"p=a:[1]/[2]"},
+		},
+		{
+			name: "deletes are merged with small files of the partition",
+			files: []models.TableFile{
+				dataFile(1, "", 10), deleteFile(2, 1, ""), deleteFile(3, 1, ""), dataFile(4, "", 10), dataFile(5, "", 500),
+			},
+			want: []string{":[1 4]/[2 3]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describeGroups(planCompaction(tt.files, 100, 3))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got groups %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+// CreateIndex tạo index bloom filter hoặc zone map trên một cột của table và ghi sidecar cho các tệp dữ liệu đã có
+// Tệp được ghi sau khi index được tạo có sidecar ngay khi ghi. Tệp được ghi trong lúc build bởi lần flush
+// bắt đầu trước khi index được tạo có thể thiếu sidecar, các tệp đó luôn được đọc cho tới khi được compaction ghi lại
+func (tw *TableWrapper) CreateIndex(index *models.Index) error {
+	if err := ValidateName(index.Name); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.ReplaceAll(index.IndexType, " ", "")) {
+	case "bloomfilter", "bloom":
+		index.IndexType = models.IndexTypeBloomFilter
+	case "zonemap", "minmax":
+		index.IndexType = models.IndexTypeZoneMap
+	default:
+		return fmt.Errorf("%w: index_type of a table index must be %s or %s", ErrInvalidIndex, models.IndexTypeBloomFilter, models.IndexTypeZoneMap)
+	}
+	column := columnIndex(tw.Table.Columns, index.Fields)
+	if column < 0 {
+		return fmt.Errorf("%w: column %s does not exist in table %s", ErrInvalidIndex, index.Fields, tw.Table.Name)
+	}
+	if _, err := tw.SQLiteCatalogService.GetTableIndexByName(tw.Table.ID, index.Name); err == nil {
+		return fmt.Errorf("%w: index %s already exists in table", ErrNameConflict, index.Name)
+	}
+
+	index.TableID = tw.Table.ID
+	index.CollectionID = 0
+	index.Fields = tw.Table.Columns[column].Name
+	index.DataType = tw.Table.Columns[column].Type
+	index.Status = models.IndexStatusBuilding
+	if err := tw.SQLiteCatalogService.CreateIndex(index); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	built, err := tw.buildIndexFiles(index, nil)
+	if err == nil {
+		err = tw.SQLiteCatalogService.UpdateIndexStatus(index.ID, models.IndexStatusActive)
+	}
+	if err != nil {
+		if rollbackErr := tw.dropIndex(index); rollbackErr != nil {
+			return fmt.Errorf("failed to build index: %v (rollback failed: %v)", err, rollbackErr)
+		}
+		return fmt.Errorf("failed to build index: %v", err)
+	}
+	index.Status = models.IndexStatusActive
+
+	// Các tệp được commit trong lúc build
+	if _, err := tw.buildIndexFiles(index, built); err != nil {
+		log.Printf("Failed to write index %s for files committed during build of table %d: %v", index.Name, tw.Table.ID, err)
+	}
+	return nil
+}
+
+// buildIndexFiles ghi sidecar của index cho các tệp dữ liệu hiện tại của table không có trong skip,
+// trả về ID của các tệp đã được ghi sidecar cùng skip
+func (tw *TableWrapper) buildIndexFiles(index *models.Index, skip map[int]bool) (map[int]bool, error) {
+	table, err := tw.SQLiteCatalogService.GetTableByID(tw.Table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table %s: %v", tw.Table.Name, err)
+	}
+	files, err := tw.SQLiteCatalogService.ListTableFiles(table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of table %s: %v", table.Name, err)
+	}
+	files, _ = service.SplitDeleteFiles(files)
+
+	built := make(map[int]bool, len(files))
+	for id := range skip {
+		built[id] = true
+	}
+	for i := range files {
+		if built[files[i].ID] {
+			continue
+		}
+		if err := tw.Storage.Tables.WriteIndexFile(table, &files[i], index); err != nil {
+			return nil, fmt.Errorf("failed to write index of file %s: %v", files[i].Path, err)
+		}
+		built[files[i].ID] = true
+	}
+	return built, nil
+}
+
+// DropIndex xóa index của table khỏi catalog cùng sidecar của index trong mọi tệp dữ liệu
+func (tw *TableWrapper) DropIndex(index *models.Index) error {
+	if err := tw.dropIndex(index); err != nil {
+		return fmt.Errorf("failed to drop index %s: %v", index.Name, err)
+	}
+	return nil
+}
+
+// dropIndex xóa index khỏi catalog trước để các lần ghi sau không tạo thêm sidecar rồi mới xóa sidecar
+func (tw *TableWrapper) dropIndex(index *models.Index) error {
+	if err := tw.SQLiteCatalogService.HardDeleteIndex(index.ID); err != nil {
+		return err
+	}
+	return tw.Storage.Tables.RemoveIndexFiles(tw.Table, index.ID)
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// newIndexedSQLTestEnv tạo table t(id int64, name string, n int32) có ba tệp, bloom filter trên name và n,
+// zone map trên id. Tệp cuối được ghi sau khi các index được tạo
+func newIndexedSQLTestEnv(t *testing.T) *sqlTestEnv {
+	t.Helper()
+	env := newTableTestEnv(t, &models.Table{
+		Name: "t",
+		Columns: []models.TableColumn{
+			{Name: "id", Type: models.ColumnTypeInt64},
+			{Name: "name", Type: models.ColumnTypeString, Nullable: true},
+			{Name: "n", Type: models.ColumnTypeInt32, Nullable: true},
+		},
+	})
+	env.appendRows(t,
+		map[string]interface{}{"id": 1.0, "name": "a", "n": 1.0},
+		map[string]interface{}{"id": 2.0, "name": "b", "n": -2.0},
+	)
+	env.appendRows(t,
+		map[string]interface{}{"id": 3.0, "name": "c", "n": 10.0},
+		map[string]interface{}{"id": 4.0, "name": nil, "n": 2147483647.0},
+	)
+	for _, index := range []*models.Index{
+		{Name: "by_name", Fields: "name", IndexType: "bloom"},
+		{Name: "by_n", Fields: "n", IndexType: models.IndexTypeBloomFilter},
+		{Name: "by_id", Fields: "id", IndexType: "zone map"},
+	} {
+		if err := env.tableWrapper(t).CreateIndex(index); err != nil {
+			t.Fatalf("failed to create index %s: %v", index.Name, err)
+		}
+	}
+	env.appendRows(t, map[string]interface{}{"id": 5.0, "name": "e", "n": -2147483648.0})
+	return env
+}
+
+// assertFilesSkipped chạy các câu lệnh và kiểm tra kết quả cùng số tệp bị bỏ qua nhờ index
+func assertFilesSkipped(t *testing.T, env *sqlTestEnv, tests []struct {
+	query   string
+	want    string
+	skipped int
+}) {
+	t.Helper()
+	for _, tt := range tests {
+		got, stats, err := env.query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got != tt.want || stats.FilesSkipped != tt.skipped {
+			t.Errorf("%s: got %s with %d files skipped, want %s with %d", tt.query, got, stats.FilesSkipped, tt.want, tt.skipped)
+		}
+	}
+}
+
+func TestSQLTableIndexSkipsFiles(t *testing.T) {
+	env := newIndexedSQLTestEnv(t)
+	assertFilesSkipped(t, env, []struct {
+		query   string
+		want    string
+		skipped int
+	}{
+		{query: "SELECT id FROM t WHERE name = 'c'", want: "[[3]]", skipped: 2},
+		{query: "SELECT id FROM t WHERE name IN ('a', 'e') ORDER BY id", want: "[[1] [5]]", skipped: 1},
+		{query: "SELECT id FROM t WHERE name = 'zzz'", want: "[]", skipped: 3},
+		{query: "SELECT id FROM t WHERE name IN (NULL)", want: "[]", skipped: 3},
+		// Bloom filter chỉ dùng được với = và IN
+		{query: "SELECT id FROM t WHERE name > 'd'", want: "[[5]]", skipped: 0},
+		{query: "SELECT id FROM t WHERE id > 4", want: "[[5]]", skipped: 2},
+		{query: "SELECT id FROM t WHERE id BETWEEN 2 AND 3 ORDER BY id", want: "[[2] [3]]", skipped: 1},
+		// Index của các cột khác nhau được kết hợp
+		{query: "SELECT id FROM t WHERE name = 'a' AND id > 2", want: "[]", skipped: 3},
+	})
+}
+
+func TestSQLTableIndexAfterWidening(t *testing.T) {
+	env := newIndexedSQLTestEnv(t)
+	err := env.tableWrapper(t).AlterSchema(SchemaChanges{WidenColumns: []ColumnWidening{{Name: "n", Type: models.ColumnTypeInt64}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.appendRows(t, map[string]interface{}{"id": 6.0, "name": "f", "n": 5e9})
+
+	// Bloom filter của các tệp được ghi với kiểu int32 không cho âm tính giả khi cột là int64
+	assertFilesSkipped(t, env, []struct {
+		query   string
+		want    string
+		skipped int
+	}{
+		{query: "SELECT id FROM t WHERE n = -2", want: "[[2]]", skipped: 3},
+		{query: "SELECT id FROM t WHERE n = 2147483647", want: "[[4]]", skipped: 3},
+		{query: "SELECT id FROM t WHERE n = -2147483648", want: "[[5]]", skipped: 3},
+		{query: "SELECT id FROM t WHERE n IN (1, 5000000000) ORDER BY id", want: "[[1] [6]]", skipped: 2},
+	})
+}
@@ -0,0 +1,197 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// ErrInvalidRow được trả về khi một dòng append vào table không khớp với schema của table
+var ErrInvalidRow = errors.New("invalid row")
+
+// ConvertRows kiểm tra các dòng với schema của table và chuyển thành giá trị theo thứ tự cột trong catalog
+// Cột không có trong dòng hoặc có giá trị null được hiểu là null, chỉ hợp lệ với cột nullable.
+// Dòng có key không phải là cột của table bị từ chối. Chỉ cần một dòng không hợp lệ thì cả lô bị từ chối
+//
+// Kiểu Go của giá trị sau khi chuyển:
+//   - boolean: bool, int32: int32, int64: int64, float: float32, double: float64
+//   - string: string, binary: []byte (đầu vào là chuỗi base64)
+//   - date: int32 số ngày từ 1970-01-01 (đầu vào là chuỗi YYYY-MM-DD)
+//   - timestamp: int64 theo đơn vị của cột (đầu vào là chuỗi RFC 3339 hoặc số nguyên theo đơn vị của cột)
+//   - decimal: *big.Int là giá trị đã nhân 10^scale (đầu vào là chuỗi hoặc số)
+//
+// Số trong JSON nên được decode bằng json.Decoder.UseNumber để số nguyên lớn không bị mất chính xác
+func ConvertRows(columns []models.TableColumn, rows []map[string]interface{}) ([][]interface{}, error) {
+	position := make(map[string]int, len(columns))
+	for i := range columns {
+		position[columns[i].Name] = i
+	}
+
+	converted := make([][]interface{}, len(rows))
+	for r, row := range rows {
+		for key := range row {
+			if _, ok := position[key]; !ok {
+				return nil, fmt.Errorf("%w: row %d: unknown column %s", ErrInvalidRow, r, key)
+			}
+		}
+
+		values := make([]interface{}, len(columns))
+		for i := range columns {
+			column := &columns[i]
+			value := row[column.Name]
+			if value == nil {
+				if !column.Nullable {
+					return nil, fmt.Errorf("%w: row %d: column %s must not be null", ErrInvalidRow, r, column.Name)
+				}
+				continue
+			}
+			v, err := convertColumnValue(column, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: row %d: column %s: %v", ErrInvalidRow, r, column.Name, err)
+			}
+			values[i] = v
+		}
+		converted[r] = values
+	}
+	return converted, nil
+}
+
+func convertColumnValue(column *models.TableColumn, value interface{}) (interface{}, error) {
+	switch column.Type {
+	case models.ColumnTypeBoolean:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case models.ColumnTypeInt32:
+		if v, ok := parseInteger(value, 32); ok {
+			return int32(v), nil
+		}
+	case models.ColumnTypeInt64:
+		if v, ok := parseInteger(value, 64); ok {
+			return v, nil
+		}
+	case models.ColumnTypeFloat:
+		if v, ok := parseFloat(value); ok && (math.IsInf(v, 0) || math.Abs(v) <= math.MaxFloat32) {
+			return float32(v), nil
+		}
+	case models.ColumnTypeDouble:
+		if v, ok := parseFloat(value); ok {
+			return v, nil
+		}
+	case models.ColumnTypeString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case models.ColumnTypeBinary:
+		if v, ok := value.(string); ok {
+			b, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected base64 string: %v", err)
+			}
+			return b, nil
+		}
+	case models.ColumnTypeDate:
+		if v, ok := value.(string); ok {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				return nil, fmt.Errorf("expected date in YYYY-MM-DD format")
+			}
+			return int32(t.Unix() / 86400), nil
+		}
+	case models.ColumnTypeTimestamp:
+		if v, ok := value.(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("expected RFC 3339 timestamp")
+			}
+			switch column.Unit {
+			case models.TimeUnitMillis:
+				return t.UnixMilli(), nil
+			case models.TimeUnitNanos:
+				return t.UnixNano(), nil
+			default:
+				return t.UnixMicro(), nil
+			}
+		}
+		if v, ok := parseInteger(value, 64); ok {
+			return v, nil
+		}
+	case models.ColumnTypeDecimal:
+		return parseDecimal(value, column.Precision, column.Scale)
+	}
+	return nil, fmt.Errorf("value %v is not a valid %s", value, column.Type)
+}
+
+// parseInteger chấp nhận json.Number hoặc float64 không có phần thập phân và nằm trong phạm vi bitSize bit
+func parseInteger(value interface{}, bitSize int) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		i, err := strconv.ParseInt(v.String(), 10, bitSize)
+		return i, err == nil
+	case float64:
+		limit := math.Ldexp(1, bitSize-1)
+		if v != math.Trunc(v) || v < -limit || v >= limit {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func parseFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// parseDecimal chuyển chuỗi hoặc số thập phân thành số nguyên đã nhân 10^scale
+// Giá trị có nhiều chữ số thập phân hơn scale hoặc nhiều chữ số hơn precision bị từ chối thay vì làm tròn
+func parseDecimal(value interface{}, precision, scale int) (*big.Int, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("value %v is not a valid decimal", value)
+	}
+
+	negative := strings.HasPrefix(text, "-")
+	digits := strings.TrimLeft(strings.TrimPrefix(text, "-"), "+")
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if integer == "" && fraction == "" || strings.Trim(integer+fraction, "0123456789") != "" {
+		return nil, fmt.Errorf("value %v is not a valid decimal", value)
+	}
+	if trimmed := strings.TrimRight(fraction, "0"); len(trimmed) > scale {
+		return nil, fmt.Errorf("value %s has more than %d digits after the decimal point", text, scale)
+	}
+	fraction = (fraction + strings.Repeat("0", scale))[:scale]
+
+	unscaled, ok := new(big.Int).SetString("0"+integer+fraction, 10)
+	if !ok {
+		return nil, fmt.Errorf("value %v is not a valid decimal", value)
+	}
+	if len(unscaled.String()) > precision {
+		return nil, fmt.Errorf("value %s exceeds precision %d", text, precision)
+	}
+	if negative {
+		unscaled.Neg(unscaled)
+	}
+	return unscaled, nil
+}
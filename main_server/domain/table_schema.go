@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// widenableTypes là các cặp kiểu cột có thể được nới mà không cần ghi lại tệp: kiểu cũ -> kiểu mới
+var widenableTypes = map[string]string{
+	models.ColumnTypeInt32: models.ColumnTypeInt64,
+	models.ColumnTypeFloat: models.ColumnTypeDouble,
+}
+
+// ColumnWidening nới kiểu của một cột
+type ColumnWidening struct {
+	Name string
+	Type string
+}
+
+// ColumnRename đổi tên một cột
+type ColumnRename struct {
+	Name    string
+	NewName string
+}
+
+// SchemaChanges là các thay đổi schema của table được áp dụng cùng lúc, theo thứ tự nới kiểu, đổi tên rồi thêm cột.
+// Tên trong Widen và Rename là tên hiện tại của cột
+type SchemaChanges struct {
+	AddColumns    []models.TableColumn
+	WidenColumns  []ColumnWidening
+	RenameColumns []ColumnRename
+}
+
+// AlterSchema thay đổi schema của table mà không ghi lại các tệp đã có: thêm cột nullable ở cuối,
+// nới kiểu int32 thành int64 và float thành double, đổi tên cột. Phiên bản schema của table tăng một.
+// Cột được nhận biết trong tệp theo field ID nên tệp cũ được đọc theo schema mới: cột được thêm là null,
+// giá trị của cột được nới kiểu được chuyển sang kiểu mới khi đọc
+func (tw *TableWrapper) AlterSchema(changes SchemaChanges) error {
+	if len(changes.AddColumns) == 0 && len(changes.WidenColumns) == 0 && len(changes.RenameColumns) == 0 {
+		return fmt.Errorf("%w: no schema change", ErrInvalidColumn)
+	}
+
+	columns := append([]models.TableColumn(nil), tw.Table.Columns...)
+	clusterBy := tw.Table.ClusterBy
+
+	for _, widening := range changes.WidenColumns {
+		index := columnIndex(columns, widening.Name)
+		if index < 0 {
+			return fmt.Errorf("%w: column %s does not exist", ErrInvalidColumn, widening.Name)
+		}
+		column := &columns[index]
+		target := strings.ToLower(widening.Type)
+		if widenableTypes[column.Type] != target {
+			return fmt.Errorf("%w: column %s of type %s cannot be widened to %s, only int32 to int64 and float to double are supported",
+				ErrInvalidColumn, column.Name, column.Type, widening.Type)
+		}
+		column.Type = target
+	}
+
+	for _, rename := range changes.RenameColumns {
+		index := columnIndex(columns, rename.Name)
+		if index < 0 {
+			return fmt.Errorf("%w: column %s does not exist", ErrInvalidColumn, rename.Name)
+		}
+		if err := checkColumnName(columns, rename.NewName, index); err != nil {
+			return err
+		}
+		// Đường dẫn phân vùng chứa tên cột, đổi tên sẽ làm thư mục của dữ liệu cũ và mới khác nhau
+		for _, field := range tw.Table.PartitionBy {
+			if field.Column == rename.Name {
+				return fmt.Errorf("%w: column %s is used for partitioning and cannot be renamed", ErrInvalidColumn, rename.Name)
+			}
+		}
+		if clusterBy == rename.Name {
+			clusterBy = rename.NewName
+		}
+		columns[index].Name = rename.NewName
+	}
+
+	nextFieldID := 1
+	for _, column := range columns {
+		if column.FieldID >= nextFieldID {
+			nextFieldID = column.FieldID + 1
+		}
+	}
+	for _, column := range changes.AddColumns {
+		if err := checkColumnName(columns, column.Name, -1); err != nil {
+			return err
+		}
+		if !column.Nullable {
+			return fmt.Errorf("%w: column %s: added columns must be nullable, existing rows have no value", ErrInvalidColumn, column.Name)
+		}
+		column.Type = strings.ToLower(column.Type)
+		if err := validateColumnType(&column); err != nil {
+			return fmt.Errorf("%w: column %s: %v", ErrInvalidColumn, column.Name, err)
+		}
+		column.ID = 0
+		column.Position = len(columns)
+		column.FieldID = nextFieldID
+		column.LegacyName = ""
+		nextFieldID++
+		columns = append(columns, column)
+	}
+
+	if err := tw.SQLiteCatalogService.AlterTableColumns(tw.Table.ID, tw.Table.SchemaVersion, columns, clusterBy); err != nil {
+		return fmt.Errorf("failed to alter schema of table %s: %w", tw.Table.Name, err)
+	}
+	tw.Table.Columns = columns
+	tw.Table.ClusterBy = clusterBy
+	tw.Table.SchemaVersion++
+	return nil
+}
+
+// checkColumnName kiểm tra tên cột hợp lệ và chưa được dùng bởi cột khác (không phân biệt hoa thường), bỏ qua cột ở vị trí self
+func checkColumnName(columns []models.TableColumn, name string, self int) error {
+	if name == "" || strings.TrimSpace(name) != name {
+		return fmt.Errorf("%w: column name must not be empty or have leading/trailing spaces", ErrInvalidColumn)
+	}
+	for i := range columns {
+		if i != self && strings.EqualFold(columns[i].Name, name) {
+			return fmt.Errorf("%w: duplicate column %s", ErrInvalidColumn, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+func TestAlterSchemaReadsOldFiles(t *testing.T) {
+	env := newTableTestEnv(t, &models.Table{
+		Name: "t",
+		Columns: []models.TableColumn{
+			{Name: "id", Type: models.ColumnTypeInt64},
+			{Name: "n", Type: models.ColumnTypeInt32, Nullable: true},
+			{Name: "f", Type: models.ColumnTypeFloat, Nullable: true},
+			{Name: "name", Type: models.ColumnTypeString, Nullable: true},
+		},
+	})
+	env.appendRows(t,
+		map[string]interface{}{"id": 1.0, "n": 1.0, "f": 1.5, "name": "a"},
+		map[string]interface{}{"id": 2.0, "n": 7.0, "f": nil, "name": "b"},
+	)
+
+	err := env.tableWrapper(t).AlterSchema(SchemaChanges{
+		WidenColumns:  []ColumnWidening{{Name: "n", Type: "INT64"}, {Name: "f", Type: models.ColumnTypeDouble}},
+		RenameColumns: []ColumnRename{{Name: "name", NewName: "label"}},
+		AddColumns:    []models.TableColumn{{Name: "name", Type: models.ColumnTypeString, Nullable: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dòng mới dùng được khoảng giá trị của kiểu mới, tên cũ đã được dùng lại cho cột mới
+	env.appendRows(t, map[string]interface{}{"id": 3.0, "n": 5e9, "f": 0.1, "label": "c", "name": "new"})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT id, n, f, label, name FROM t ORDER BY id", want: "[[1 1 1.5 a <nil>] [2 7 <nil> b <nil>] [3 5000000000 0.1 c new]]"},
+		{query: "SELECT id FROM t WHERE n > 5 ORDER BY id", want: "[[2] [3]]"},
+		{query: "SELECT id FROM t WHERE label = 'a'", want: "[[1]]"},
+		{query: "SELECT COUNT(name), SUM(n) FROM t", want: "[[1 5000000008]]"},
+	}
+	for _, tt := range tests {
+		if got := env.mustQuery(t, tt.query); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+	if table := env.tableWrapper(t).Table; table.SchemaVersion != 2 {
+		t.Fatalf("got schema version %d, want 2", table.SchemaVersion)
+	}
+}
+
+func TestAlterSchemaInvalidChanges(t *testing.T) {
+	env := newSQLTestEnv(t)
+	for _, changes := range []SchemaChanges{
+		{},
+		{WidenColumns: []ColumnWidening{{Name: "id", Type: models.ColumnTypeInt32}}},
+		{WidenColumns: []ColumnWidening{{Name: "nope", Type: models.ColumnTypeInt64}}},
+		{RenameColumns: []ColumnRename{{Name: "id", NewName: "v"}}},
+		{AddColumns: []models.TableColumn{{Name: "w", Type: models.ColumnTypeInt64}}},
+	} {
+		if err := env.tableWrapper(t).AlterSchema(changes); !errors.Is(err, ErrInvalidColumn) {
+			t.Errorf("%+v: expected ErrInvalidColumn, got %v", changes, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	service "github.com/dehuy69/mydp/main_server/service"
+)
+
+// orphanFileMinAge là tuổi tối thiểu của tệp không có trong catalog trước khi bị xóa,
+// để không xóa tệp của một lần flush đang ghi hoặc đang chờ commit
+const orphanFileMinAge = time.Hour
+
+// ExpireSnapshotsResult là kết quả của một lần xóa snapshot cũ
+type ExpireSnapshotsResult struct {
+	ExpiredSnapshots   int `json:"expired_snapshots"`    // Số snapshot bị xóa
+	DeletedFiles       int `json:"deleted_files"`        // Số tệp đã bị loại và không còn thuộc snapshot nào
+	DeletedOrphanFiles int `json:"deleted_orphan_files"` // Số tệp trong thư mục của table không có trong catalog
+}
+
+// ExpireSnapshots xóa các snapshot không còn cần để đọc table tại các thời điểm sau before, cùng các tệp Parquet
+// chỉ thuộc các snapshot đó. Snapshot hiện tại tại thời điểm before luôn được giữ lại.
+// Các tệp trong thư mục của table không có trong catalog (do server dừng giữa lúc ghi và commit) cũng được xóa
+func (tw *TableWrapper) ExpireSnapshots(before time.Time) (*ExpireSnapshotsResult, error) {
+	expired, files, err := tw.SQLiteCatalogService.ExpireTableSnapshots(tw.Table.ID, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire snapshots of table %s: %v", tw.Table.Name, err)
+	}
+
+	result := &ExpireSnapshotsResult{ExpiredSnapshots: expired}
+	for _, file := range files {
+		// Tệp đã bị xóa khỏi catalog, nếu xóa khỏi đĩa thất bại thì tệp sẽ được xóa như tệp mồ côi ở lần sau
+		if err := tw.Storage.Tables.RemoveTableFile(tw.Table, file.Path); err != nil {
+			log.Printf("Failed to remove expired file %s of table %d: %v", file.Path, tw.Table.ID, err)
+			continue
+		}
+		result.DeletedFiles++
+	}
+
+	orphans, err := tw.deleteOrphanFiles(before)
+	result.DeletedOrphanFiles = orphans
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// deleteOrphanFiles xóa các tệp trong thư mục của table không có trong catalog và cũ hơn cả before lẫn orphanFileMinAge
+func (tw *TableWrapper) deleteOrphanFiles(before time.Time) (int, error) {
+	storageFiles, err := tw.Storage.Tables.ListStorageFiles(tw.Table)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files of table %s: %v", tw.Table.Name, err)
+	}
+	if len(storageFiles) == 0 {
+		return 0, nil
+	}
+	catalogFiles, err := tw.SQLiteCatalogService.ListAllTableFiles(tw.Table.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list manifest of table %s: %v", tw.Table.Name, err)
+	}
+	known := make(map[string]bool, len(catalogFiles))
+	for _, file := range catalogFiles {
+		known[file.Path] = true
+	}
+
+	cutoff := time.Now().Add(-orphanFileMinAge)
+	if before.Before(cutoff) {
+		cutoff = before
+	}
+	deleted := 0
+	for _, file := range storageFiles {
+		if known[file.Path] || !file.ModTime.Before(cutoff) {
+			continue
+		}
+		if err := tw.Storage.Tables.RemoveTableFile(tw.Table, file.Path); err != nil {
+			return deleted, fmt.Errorf("failed to remove orphan file %s: %v", file.Path, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ExpireTableSnapshots xóa các snapshot cũ hơn retention của tất cả các table, dùng bởi job định kỳ
+func ExpireTableSnapshots(catalog *service.SQLiteCatalogService, storage *service.Storage, retention time.Duration) error {
+	tables, err := catalog.ListTables()
+	if err != nil {
+		return err
+	}
+
+	before := time.Now().Add(-retention)
+	var firstErr error
+	for i := range tables {
+		result, err := NewTableWrapper(&tables[i], catalog, storage).ExpireSnapshots(before)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if result.ExpiredSnapshots > 0 || result.DeletedFiles > 0 || result.DeletedOrphanFiles > 0 {
+			log.Printf("Expired %d snapshots of table %d, deleted %d files and %d orphan files",
+				result.ExpiredSnapshots, tables[i].ID, result.DeletedFiles, result.DeletedOrphanFiles)
+		}
+	}
+	return firstErr
+}
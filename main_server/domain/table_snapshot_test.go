@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// tableWrapper trả về TableWrapper của table t với trạng thái mới nhất trong catalog
+func (env *sqlTestEnv) tableWrapper(t *testing.T) *TableWrapper {
+	t.Helper()
+	table, err := env.catalog.GetTableByName(env.workspaceID, "t")
+	if err != nil {
+		t.Fatalf("failed to get table: %v", err)
+	}
+	return NewTableWrapper(table, env.catalog, env.storage)
+}
+
+// mustQuery chạy câu lệnh SELECT và trả về các dòng kết quả dạng chuỗi
+func (env *sqlTestEnv) mustQuery(t *testing.T, query string) string {
+	t.Helper()
+	got, _, err := env.query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return got
+}
+
+// appendRows ghi thêm các dòng vào table t thành một snapshot mới
+func (env *sqlTestEnv) appendRows(t *testing.T, rows ...map[string]interface{}) {
+	t.Helper()
+	tw := env.tableWrapper(t)
+	if _, err := tw.Append(rows); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := tw.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+}
+
+func TestSQLAsOf(t *testing.T) {
+	env := newSQLTestEnv(t)
+	first := env.tableWrapper(t).Table.CurrentSnapshotID
+	snapshot, err := env.catalog.GetTableSnapshot(env.tableWrapper(t).Table.ID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.appendRows(t, map[string]interface{}{"id": 7.0, "name": "d", "v": 70.0})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT COUNT(*), MAX(id) FROM t", want: "[[7 7]]"},
+		{query: fmt.Sprintf("SELECT COUNT(*), MAX(id) FROM t AS OF %d", first), want: "[[6 6]]"},
+		{query: fmt.Sprintf("SELECT COUNT(*) FROM t AS OF '%s'", snapshot.CreatedAt.Format(time.RFC3339Nano)), want: "[[6]]"},
+		{query: fmt.Sprintf("SELECT COUNT(*) FROM t AS OF '%s'", time.Now().Add(time.Hour).Format(time.RFC3339)), want: "[[7]]"},
+	}
+	for _, tt := range tests {
+		if got := env.mustQuery(t, tt.query); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM t AS OF 999",
+		"SELECT id FROM t AS OF '2000-01-01T00:00:00Z'",
+	} {
+		if _, _, err := env.query(query); !errors.Is(err, ErrInvalidSQL) {
+			t.Errorf("%s: expected ErrInvalidSQL, got %v", query, err)
+		}
+	}
+}
+
+func TestExpireSnapshots(t *testing.T) {
+	env := newSQLTestEnv(t)
+	first := env.tableWrapper(t).Table.CurrentSnapshotID
+	env.appendRows(t, map[string]interface{}{"id": 7.0, "name": "d", "v": 70.0})
+	// Compaction thay hai tệp bằng một tệp, hai tệp cũ chỉ còn thuộc các snapshot trước
+	if _, err := env.tableWrapper(t).Compact(CompactionOptions{TargetBytes: 1 << 30, MinFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	tw := env.tableWrapper(t)
+	dir := env.storage.Tables.TableDir(tw.Table)
+	orphan, fresh := path.Join(dir, "orphan.parquet"), path.Join(dir, "fresh.parquet")
+	for _, name := range []string{orphan, fresh} {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * orphanFileMinAge)
+	if err := os.Chtimes(orphan, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := tw.ExpireSnapshots(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExpiredSnapshots != 2 || result.DeletedFiles != 2 || result.DeletedOrphanFiles != 1 {
+		t.Fatalf("got %+v, want 2 expired snapshots, 2 deleted files and 1 orphan file", result)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphan file still exists: %v", err)
+	}
+	// Tệp mới có thể là tệp của một lần flush chưa commit
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("fresh file was removed: %v", err)
+	}
+
+	if got := env.mustQuery(t, "SELECT COUNT(*) FROM t"); got != "[[7]]" {
+		t.Fatalf("got %s after expire, want [[7]]", got)
+	}
+	if _, _, err := env.query(fmt.Sprintf("SELECT id FROM t AS OF %d", first)); !errors.Is(err, ErrInvalidSQL) {
+		t.Fatalf("expected expired snapshot to be rejected, got %v", err)
+	}
+
+	// Không còn gì để xóa ở lần chạy sau
+	result, err = tw.ExpireSnapshots(time.Now())
+	if err != nil || result.ExpiredSnapshots != 0 || result.DeletedFiles != 0 || result.DeletedOrphanFiles != 0 {
+		t.Fatalf("got %+v (%v) on second run, want nothing expired", result, err)
+	}
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Tag của từng kiểu giá trị trong tuple, thứ tự tag quyết định thứ tự giữa các kiểu khác nhau
+const (
+	tupleTagNull   byte = 0x01
+	tupleTagFalse  byte = 0x02
+	tupleTagTrue   byte = 0x03
+	tupleTagNumber byte = 0x04
+	tupleTagString byte = 0x05
+)
+
+// EncodeTuple mã hóa một tuple giá trị thành bytes giữ nguyên thứ tự theo từng thành phần:
+// so sánh bytes của hai tuple cho cùng kết quả với so sánh lần lượt từng thành phần.
+// Mã hóa của k thành phần đầu là prefix của mã hóa cả tuple, nên có thể scan theo các field đứng đầu.
+//   - null, false, true: chỉ gồm tag
+//   - số: tag + 8 byte float64 big-endian, đảo bit để số âm đứng trước số dương
+//   - chuỗi: tag + bytes với 0x00 được escape thành 0x00 0xFF, kết thúc bằng 0x00 0x01
+func EncodeTuple(values []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, value := range values {
+		if err := encodeTupleComponent(&buf, value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeTupleComponent(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(tupleTagNull)
+	case bool:
+		if v {
+			buf.WriteByte(tupleTagTrue)
+		} else {
+			buf.WriteByte(tupleTagFalse)
+		}
+	case int:
+		return encodeTupleComponent(buf, float64(v))
+	case int64:
+		return encodeTupleComponent(buf, float64(v))
+	case float64:
+		bits := math.Float64bits(v)
+		if v >= 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		buf.WriteByte(tupleTagNumber)
+		var raw [8]byte
+		binary.BigEndian.PutUint64(raw[:], bits)
+		buf.Write(raw[:])
+	case string:
+		buf.WriteByte(tupleTagString)
+		for i := 0; i < len(v); i++ {
+			buf.WriteByte(v[i])
+			if v[i] == 0x00 {
+				buf.WriteByte(0xFF)
+			}
+		}
+		buf.Write([]byte{0x00, 0x01})
+	default:
+		return fmt.Errorf("unsupported type in tuple: %T", value)
+	}
+	return nil
+}
+
+// DecodeTuple giải mã bytes được tạo bởi EncodeTuple thành danh sách giá trị
+func DecodeTuple(data []byte) ([]interface{}, error) {
+	var values []interface{}
+	for pos := 0; pos < len(data); {
+		tag := data[pos]
+		pos++
+		switch tag {
+		case tupleTagNull:
+			values = append(values, nil)
+		case tupleTagFalse:
+			values = append(values, false)
+		case tupleTagTrue:
+			values = append(values, true)
+		case tupleTagNumber:
+			if pos+8 > len(data) {
+				return nil, fmt.Errorf("truncated number in tuple")
+			}
+			bits := binary.BigEndian.Uint64(data[pos : pos+8])
+			if bits&(1<<63) != 0 {
+				bits ^= 1 << 63
+			} else {
+				bits = ^bits
+			}
+			values = append(values, math.Float64frombits(bits))
+			pos += 8
+		case tupleTagString:
+			var str []byte
+			for {
+				if pos >= len(data) {
+					return nil, fmt.Errorf("unterminated string in tuple")
+				}
+				if data[pos] == 0x00 {
+					if pos+1 >= len(data) {
+						return nil, fmt.Errorf("unterminated string in tuple")
+					}
+					if data[pos+1] == 0x01 {
+						pos += 2
+						break
+					}
+					str = append(str, 0x00)
+					pos += 2
+					continue
+				}
+				str = append(str, data[pos])
+				pos++
+			}
+			values = append(values, string(str))
+		default:
+			return nil, fmt.Errorf("unknown tag 0x%02x in tuple", tag)
+		}
+	}
+	return values, nil
+}
@@ -1,6 +1,9 @@
 package domain
 
 import (
+	"fmt"
+	"log"
+
 	"github.com/dehuy69/mydp/main_server/models"
 	service "github.com/dehuy69/mydp/main_server/service"
 )
@@ -8,21 +11,100 @@ import (
 type WorkspaceWrapper struct {
 	SQLiteCatalogService *service.SQLiteCatalogService
 	Workspace            *models.Workspace
-	BadgerService        *service.BadgerService
+	Storage              *service.Storage
 }
 
-func NewWorkspaceWrapper(workspace *models.Workspace, SQLiteCatalogService *service.SQLiteCatalogService, BadgerService *service.BadgerService) *WorkspaceWrapper {
+func NewWorkspaceWrapper(workspace *models.Workspace, SQLiteCatalogService *service.SQLiteCatalogService, storage *service.Storage) *WorkspaceWrapper {
 	return &WorkspaceWrapper{
 		SQLiteCatalogService: SQLiteCatalogService,
 		Workspace:            workspace,
-		BadgerService:        BadgerService,
+		Storage:              storage,
 	}
 }
 
 func (cw *WorkspaceWrapper) CreateWorkspace() error {
+	if err := cw.checkName(cw.Workspace.Name); err != nil {
+		return err
+	}
+
 	err := cw.SQLiteCatalogService.CreateWorkspace(cw.Workspace)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// Rename đổi tên workspace
+func (cw *WorkspaceWrapper) Rename(name string) error {
+	if err := cw.checkName(name); err != nil {
+		return err
+	}
+	return cw.SQLiteCatalogService.RenameWorkspace(cw.Workspace, name)
+}
+
+// checkName kiểm tra tên workspace hợp lệ và chưa được dùng
+// Tên workspace là duy nhất toàn hệ thống, kể cả các workspace đã bị xóa mềm nhưng chưa bị xóa hẳn
+func (cw *WorkspaceWrapper) checkName(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	taken, err := cw.SQLiteCatalogService.WorkspaceNameTaken(name, cw.Workspace.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: workspace %s already exists", ErrNameConflict, name)
+	}
+	return nil
+}
+
+// Delete xóa mềm workspace, dữ liệu vẫn còn cho tới khi Purge được gọi sau thời gian chờ
+func (cw *WorkspaceWrapper) Delete() error {
+	return cw.SQLiteCatalogService.SoftDeleteWorkspace(cw.Workspace)
+}
+
+// Purge xóa hẳn workspace: xóa document và index của từng collection, dữ liệu của từng table, sau đó xóa khỏi catalog
+// Dữ liệu được xóa trước catalog để nếu bị gián đoạn, lần chạy sau vẫn tìm thấy workspace và xóa tiếp
+func (cw *WorkspaceWrapper) Purge() error {
+	collections, err := cw.SQLiteCatalogService.ListCollectionsByWorkspace(cw.Workspace.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %v", err)
+	}
+
+	for i := range collections {
+		collection := &collections[i]
+		collectionWrapper := &CollectionWrapper{
+			SQLiteCatalogService: cw.SQLiteCatalogService,
+			Collection:           collection,
+			Storage:              cw.Storage,
+		}
+		if err := collectionWrapper.useBackend(); err != nil {
+			return fmt.Errorf("collection %d: %v", collection.ID, err)
+		}
+		if err := collectionWrapper.DeleteStorage(); err != nil {
+			return fmt.Errorf("failed to delete storage of collection %d: %v", collection.ID, err)
+		}
+		if err := cw.SQLiteCatalogService.HardDeleteCollection(collection.ID); err != nil {
+			return fmt.Errorf("failed to delete collection %d from catalog: %v", collection.ID, err)
+		}
+	}
+
+	tables, err := cw.SQLiteCatalogService.ListTablesByWorkspace(cw.Workspace.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %v", err)
+	}
+
+	for i := range tables {
+		tableWrapper := NewTableWrapper(&tables[i], cw.SQLiteCatalogService, cw.Storage)
+		if err := tableWrapper.Drop(); err != nil {
+			return fmt.Errorf("table %d: %v", tables[i].ID, err)
+		}
+	}
+
+	if err := cw.SQLiteCatalogService.HardDeleteWorkspace(cw.Workspace.ID); err != nil {
+		return fmt.Errorf("failed to delete workspace from catalog: %v", err)
+	}
+
+	log.Printf("Workspace %d (%s) purged with %d collections and %d tables", cw.Workspace.ID, cw.Workspace.Name, len(collections), len(tables))
+	return nil
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -24,6 +27,63 @@ type UserPermission struct {
 	User        User   `gorm:"foreignKey:UserID"`                  // Tham chiếu đến người dùng
 }
 
+const (
+	// UserRoleAdmin là vai trò quản trị toàn hệ thống
+	UserRoleAdmin = "admin"
+)
+
+const (
+	// PermissionRead cho phép đọc dữ liệu trong workspace
+	PermissionRead = "READ"
+	// PermissionWrite cho phép ghi dữ liệu, tạo collection và index trong workspace
+	PermissionWrite = "WRITE"
+	// PermissionAdmin cho phép quản trị workspace (API key, cấu hình, ...)
+	PermissionAdmin = "ADMIN"
+)
+
+// APIKey struct đại diện cho một API key dùng cho truy cập service-to-service, chỉ có hiệu lực trong một workspace
+// Key gốc chỉ được trả về một lần khi tạo, catalog chỉ lưu SHA-256 của key
+type APIKey struct {
+	gorm.Model
+	ID          int        `json:"id" gorm:"primarykey"`
+	Name        string     `json:"name" gorm:"not null"`                // Tên gợi nhớ của key
+	Prefix      string     `json:"prefix" gorm:"not null"`              // Vài ký tự đầu của key, dùng để nhận diện key trong danh sách
+	KeyHash     string     `json:"-" gorm:"uniqueIndex;not null"`       // SHA-256 (hex) của key
+	WorkspaceID int        `json:"workspace_id" gorm:"not null;index"`  // ID của workspace mà key có quyền truy cập
+	Workspace   Workspace  `gorm:"foreignKey:WorkspaceID"`              // Tham chiếu đến workspace
+	Permission  string     `json:"permission" gorm:"not null"`          // Quyền của key (READ, WRITE, ADMIN)
+	CreatedByID int        `json:"created_by_id" gorm:"not null;index"` // ID của người dùng đã tạo key
+	CreatedBy   User       `gorm:"foreignKey:CreatedByID"`              // Tham chiếu đến người tạo key
+	ExpiresAt   *time.Time `json:"expires_at"`                          // Thời điểm hết hạn, nil nếu không hết hạn
+	LastUsedAt  *time.Time `json:"last_used_at"`                        // Lần cuối key được sử dụng
+	RevokedAt   *time.Time `json:"revoked_at"`                          // Thời điểm key bị thu hồi, nil nếu còn hiệu lực
+}
+
+// AuditLog struct ghi lại một hành động thay đổi dữ liệu hoặc cấu hình
+// Bảng chỉ được ghi thêm (append-only) nên không dùng gorm.Model, bản ghi chỉ bị xóa bởi job retention
+type AuditLog struct {
+	ID          int       `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`      // Thời điểm thực hiện hành động
+	UserID      int       `json:"user_id" gorm:"index"`         // ID của người dùng (với API key là người tạo key)
+	Username    string    `json:"username" gorm:"index"`        // Tên đăng nhập của người dùng
+	APIKeyID    int       `json:"api_key_id"`                   // ID của API key nếu xác thực bằng API key
+	WorkspaceID int       `json:"workspace_id" gorm:"index"`    // ID của workspace bị tác động (nếu có)
+	Action      string    `json:"action" gorm:"index;not null"` // Tên hành động, ví dụ: collection.create
+	Target      string    `json:"target"`                       // Đối tượng bị tác động, ví dụ: collection:3
+	Outcome     string    `json:"outcome" gorm:"not null"`      // Kết quả (success, failure)
+	StatusCode  int       `json:"status_code"`                  // HTTP status code trả về
+	Method      string    `json:"method"`                       // HTTP method
+	Path        string    `json:"path"`                         // Đường dẫn của request
+	ClientIP    string    `json:"client_ip"`                    // Địa chỉ IP của client
+}
+
+const (
+	// AuditOutcomeSuccess là kết quả hành động thành công
+	AuditOutcomeSuccess = "success"
+	// AuditOutcomeFailure là kết quả hành động thất bại
+	AuditOutcomeFailure = "failure"
+)
+
 // Workspace struct đại diện cho một workspace trong catalog
 type Workspace struct {
 	gorm.Model
@@ -39,16 +99,66 @@ type Workspace struct {
 // Collection struct đại diện cho một bảng OLTP trong workspace với hỗ trợ sharding
 type Collection struct {
 	gorm.Model
-	ID            int       `json:"id" gorm:"primarykey"`               // ID của collection
-	Name          string    `json:"name" gorm:"uniqueIndex;not null"`   // Tên của collection
-	WorkspaceID   int       `json:"workspace_id" gorm:"not null;index"` // ID của workspace chứa collection này
-	Workspace     Workspace `gorm:"foreignKey:WorkspaceID"`             // Tham chiếu đến workspace
-	ShardKey      string    `json:"shard_key" gorm:"not null"`          // Khóa để thực hiện sharding
-	ShardStrategy string    `json:"shard_strategy" gorm:"not null"`     // Chiến lược sharding (range, hash, list, etc.)
-	Shards        []Shard   `json:"shards"`                             // Danh sách các shards
-	Indexes       []Index   `json:"indexes"`                            // Danh sách các chỉ mục trong collection
+	ID            int             `json:"id" gorm:"primarykey"`                                                                    // ID của collection
+	Name          string          `json:"name" gorm:"uniqueIndex:idx_collection_workspace_name,priority:2;not null"`               // Tên của collection, duy nhất trong workspace
+	WorkspaceID   int             `json:"workspace_id" gorm:"uniqueIndex:idx_collection_workspace_name,priority:1;not null;index"` // ID của workspace chứa collection này
+	Workspace     Workspace       `gorm:"foreignKey:WorkspaceID"`                                                                  // Tham chiếu đến workspace
+	ShardKey      string          `json:"shard_key" gorm:"not null"`                                                               // Khóa để thực hiện sharding
+	ShardStrategy string          `json:"shard_strategy" gorm:"not null"`                                                          // Chiến lược sharding (range, hash, list, etc.)
+	Shards        []Shard         `json:"shards"`                                                                                  // Danh sách các shards
+	Indexes       []Index         `json:"indexes"`                                                                                 // Danh sách các chỉ mục trong collection
+	DocumentCount int64           `json:"document_count" gorm:"not null;default:0"`                                                // Số document đã ghi vào collection
+	ByteSize      int64           `json:"byte_size" gorm:"not null;default:0"`                                                     // Tổng kích thước (bytes) của các document
+	Schema        json.RawMessage `json:"schema" gorm:"type:text"`                                                                 // JSON Schema của document, rỗng nghĩa là không kiểm tra
+	SchemaMode    string          `json:"schema_mode" gorm:"not null;default:strict"`                                              // Chế độ kiểm tra schema (strict, warn)
+	Backend       string          `json:"backend" gorm:"not null;default:badger"`                                                  // Nơi lưu document và index (badger, memory)
+	ChangeLog     bool            `json:"change_log" gorm:"not null;default:false"`                                                // Ghi lại các thay đổi document để đồng bộ sang table, bật khi collection có sync
+	ChangeSeq     int64           `json:"change_seq" gorm:"not null;default:0"`                                                    // Số thứ tự của thay đổi được ghi lại gần nhất
+}
+
+const (
+	// StorageBackendBadger lưu document trong Badger và index trong các file bbolt, là backend mặc định
+	StorageBackendBadger = "badger"
+	// StorageBackendMemory lưu document và index trong bộ nhớ, dữ liệu mất khi server khởi động lại
+	StorageBackendMemory = "memory"
+)
+
+const (
+	// SchemaModeStrict từ chối document không hợp lệ với schema
+	SchemaModeStrict = "strict"
+	// SchemaModeWarn vẫn ghi document không hợp lệ nhưng trả về cảnh báo
+	SchemaModeWarn = "warn"
+)
+
+// WorkspaceQuota struct chứa giới hạn tài nguyên của một workspace, giá trị 0 nghĩa là không giới hạn
+type WorkspaceQuota struct {
+	gorm.Model
+	ID             int       `json:"id" gorm:"primarykey"`
+	WorkspaceID    int       `json:"workspace_id" gorm:"uniqueIndex;not null"` // ID của workspace áp dụng quota
+	Workspace      Workspace `gorm:"foreignKey:WorkspaceID"`                   // Tham chiếu đến workspace
+	MaxCollections int       `json:"max_collections"`                          // Số collection tối đa
+	MaxIndexes     int       `json:"max_indexes"`                              // Số index tối đa trên tất cả các collection và table
+	MaxDocuments   int64     `json:"max_documents"`                            // Số document tối đa trên tất cả các collection
+	MaxBytes       int64     `json:"max_bytes"`                                // Tổng dung lượng document tối đa (bytes)
 }
 
+// RateLimit struct chứa giới hạn request của một user hoặc API key, ghi đè giới hạn mặc định trong config
+type RateLimit struct {
+	gorm.Model
+	ID                int     `json:"id" gorm:"primarykey"`
+	SubjectType       string  `json:"subject_type" gorm:"uniqueIndex:idx_rate_limit_subject;not null"` // Loại subject (user, api_key)
+	SubjectID         int     `json:"subject_id" gorm:"uniqueIndex:idx_rate_limit_subject;not null"`   // ID của user hoặc API key
+	RequestsPerSecond float64 `json:"requests_per_second" gorm:"not null"`                             // Số request trung bình mỗi giây, 0 nghĩa là không giới hạn
+	Burst             int     `json:"burst" gorm:"not null"`                                           // Số request tối đa trong một đợt
+}
+
+const (
+	// RateLimitSubjectUser là subject loại người dùng
+	RateLimitSubjectUser = "user"
+	// RateLimitSubjectAPIKey là subject loại API key
+	RateLimitSubjectAPIKey = "api_key"
+)
+
 // Shard struct đại diện cho thông tin về một shard trong Collection
 type Shard struct {
 	gorm.Model
@@ -66,29 +176,253 @@ type Shard struct {
 // Table struct đại diện cho một bảng OLAP trong workspace
 type Table struct {
 	gorm.Model
-	ID          int       `json:"id" gorm:"primarykey"`
-	Name        string    `json:"name" gorm:"unique;not null"`        // Tên của table
-	WorkspaceID int       `json:"workspace_id" gorm:"not null;index"` // ID của workspace chứa table này
-	Workspace   Workspace `gorm:"foreignKey:WorkspaceID"`             // Tham chiếu đến workspace
-	Indexes     []Index   `json:"indexes"`                            // Danh sách các chỉ mục trong table
+	ID                int                   `json:"id" gorm:"primarykey"`
+	Name              string                `json:"name" gorm:"uniqueIndex:idx_table_workspace_name,priority:2;not null"`               // Tên của table, duy nhất trong workspace
+	WorkspaceID       int                   `json:"workspace_id" gorm:"uniqueIndex:idx_table_workspace_name,priority:1;not null;index"` // ID của workspace chứa table này
+	Workspace         Workspace             `gorm:"foreignKey:WorkspaceID"`                                                             // Tham chiếu đến workspace
+	Indexes           []Index               `json:"indexes"`                                                                            // Danh sách các chỉ mục trong table
+	Columns           []TableColumn         `json:"columns"`                                                                            // Các cột của table, theo thứ tự Position
+	StoragePath       string                `json:"storage_path"`                                                                       // Thư mục chứa dữ liệu của table, tương đối với thư mục dữ liệu
+	Compression       string                `json:"compression"`                                                                        // Codec nén của các tệp Parquet (snappy, zstd, none), rỗng là theo cấu hình
+	RowGroupSize      int                   `json:"row_group_size"`                                                                     // Số dòng tối đa của một row group, 0 là theo cấu hình
+	RowCount          int64                 `json:"row_count" gorm:"not null;default:0"`                                                // Tổng số dòng trong các tệp đã commit
+	ByteSize          int64                 `json:"byte_size" gorm:"not null;default:0"`                                                // Tổng kích thước (bytes) của các tệp đã commit
+	SchemaVersion     int                   `json:"schema_version" gorm:"not null;default:1"`                                           // Phiên bản schema, tăng mỗi lần các cột được thêm, nới kiểu hoặc đổi tên
+	CurrentSnapshotID int                   `json:"current_snapshot_id" gorm:"not null;default:0"`                                      // Snapshot mới nhất, 0 nếu table chưa có commit nào
+	PartitionBy       []TablePartitionField `json:"partition_by,omitempty"`                                                             // Các trường phân vùng, theo thứ tự Position, rỗng nếu table không phân vùng
+	ClusterBy         string                `json:"cluster_by,omitempty"`                                                               // Cột dùng để sắp xếp dòng khi compaction, rỗng là giữ thứ tự append
+	Files             []TableFile           `json:"files,omitempty"`                                                                    // Manifest: các tệp Parquet đã commit, chỉ có khi describe
+	Partitions        []TablePartition      `json:"partitions,omitempty" gorm:"-"`                                                      // Các phân vùng đang có dữ liệu, chỉ có khi describe
+	BufferedRows      int                   `json:"buffered_rows" gorm:"-"`                                                             // Số dòng đã append nhưng chưa được ghi ra tệp, không lưu trong catalog
+}
+
+const (
+	// TableCompressionSnappy nén tệp Parquet bằng snappy, là codec mặc định
+	TableCompressionSnappy = "snappy"
+	// TableCompressionZstd nén tệp Parquet bằng zstd
+	TableCompressionZstd = "zstd"
+	// TableCompressionNone không nén tệp Parquet
+	TableCompressionNone = "none"
+)
+
+// TableFile struct là một tệp Parquet bất biến đã được commit vào table
+// Danh sách TableFile của table là manifest: người đọc chỉ đọc các tệp có trong manifest.
+// Tệp thuộc snapshot S nếu AddedSnapshotID <= S và tệp chưa bị loại bỏ trước hoặc tại S (RemovedSnapshotID = 0 hoặc > S).
+// Tệp delete chứa vị trí (bắt đầu từ 0) các dòng đã bị xóa của tệp dữ liệu DataFileID, các dòng này bị bỏ qua khi đọc.
+// Tệp delete bị loại khỏi manifest cùng với tệp dữ liệu của nó
+type TableFile struct {
+	gorm.Model
+	ID                int    `json:"id" gorm:"primarykey"`
+	TableID           int    `json:"table_id" gorm:"not null;index"`                         // ID của table chứa tệp này
+	Path              string `json:"path" gorm:"not null"`                                   // Đường dẫn tệp (gồm thư mục phân vùng), tương đối với thư mục của table
+	RowCount          int64  `json:"row_count" gorm:"not null"`                              // Số dòng trong tệp
+	ByteSize          int64  `json:"byte_size" gorm:"not null"`                              // Kích thước tệp (bytes)
+	RowGroups         int    `json:"row_groups" gorm:"not null"`                             // Số row group trong tệp
+	Partition         string `json:"partition,omitempty"`                                    // Thư mục phân vùng kiểu Hive chứa tệp, ví dụ country=VN/ts_day=2024-03-01, rỗng nếu table không phân vùng
+	AddedSnapshotID   int    `json:"added_snapshot_id" gorm:"not null;default:0;index"`      // Snapshot thêm tệp vào table
+	RemovedSnapshotID int    `json:"removed_snapshot_id" gorm:"not null;default:0;index"`    // Snapshot loại tệp khỏi table (ví dụ khi compaction), 0 nếu tệp còn trong snapshot hiện tại
+	Content           string `json:"content" gorm:"not null;default:data"`                   // Loại tệp: data hoặc position_deletes
+	DataFileID        int    `json:"data_file_id,omitempty" gorm:"not null;default:0;index"` // Tệp dữ liệu có các dòng bị xóa, chỉ dùng với tệp delete
 }
 
+const (
+	// TableFileContentData là tệp chứa các dòng của table
+	TableFileContentData = "data"
+	// TableFileContentPositionDeletes là tệp chứa vị trí các dòng đã bị xóa của một tệp dữ liệu
+	TableFileContentPositionDeletes = "position_deletes"
+)
+
+// TableSnapshot struct là một phiên bản của table sau một lần commit
+// Mỗi lần commit (append, compaction, ...) tạo một snapshot mới, tệp của snapshot được xác định bởi
+// AddedSnapshotID và RemovedSnapshotID của TableFile. ID của snapshot tăng dần theo thứ tự commit
+type TableSnapshot struct {
+	ID            int       `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time `json:"created_at"`
+	TableID       int       `json:"table_id" gorm:"not null;index"` // ID của table
+	ParentID      int       `json:"parent_id" gorm:"not null"`      // Snapshot trước đó, 0 nếu là snapshot đầu tiên
+	Operation     string    `json:"operation" gorm:"not null"`      // Loại commit, ví dụ append
+	SchemaVersion int       `json:"schema_version" gorm:"not null"` // Phiên bản schema của table tại snapshot
+	AddedFiles    int       `json:"added_files" gorm:"not null"`    // Số tệp được thêm bởi commit
+	RemovedFiles  int       `json:"removed_files" gorm:"not null"`  // Số tệp bị loại bởi commit
+	FileCount     int       `json:"file_count" gorm:"not null"`     // Số tệp của table tại snapshot
+	RowCount      int64     `json:"row_count" gorm:"not null"`      // Số dòng của table tại snapshot
+	ByteSize      int64     `json:"byte_size" gorm:"not null"`      // Tổng kích thước các tệp của table tại snapshot
+}
+
+const (
+	// SnapshotOperationAppend là commit thêm các tệp mới từ buffer của table
+	SnapshotOperationAppend = "append"
+	// SnapshotOperationCompact là commit thay các tệp nhỏ bằng các tệp đã được gộp
+	SnapshotOperationCompact = "compact"
+	// SnapshotOperationSync là commit áp dụng một lô thay đổi của collection được đồng bộ vào table
+	SnapshotOperationSync = "sync"
+	// SnapshotOperationDelete là commit thêm các tệp delete của câu lệnh DELETE
+	SnapshotOperationDelete = "delete"
+	// SnapshotOperationUpdate là commit thêm các tệp delete cho các dòng cũ và các tệp chứa dòng mới của câu lệnh UPDATE
+	SnapshotOperationUpdate = "update"
+)
+
+// TableCompaction struct là một lần compaction của table: gộp các tệp nhỏ trong từng phân vùng thành tệp lớn hơn
+type TableCompaction struct {
+	ID          int        `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time  `json:"created_at"`                     // Thời điểm bắt đầu
+	FinishedAt  *time.Time `json:"finished_at"`                    // Thời điểm kết thúc, nil nếu đang chạy
+	TableID     int        `json:"table_id" gorm:"not null;index"` // ID của table
+	Trigger     string     `json:"trigger" gorm:"not null"`        // manual hoặc scheduled
+	Status      string     `json:"status" gorm:"not null"`         // running, succeeded hoặc failed
+	TargetBytes int64      `json:"target_bytes" gorm:"not null"`   // Kích thước mong muốn của tệp sau khi gộp
+	ClusterBy   string     `json:"cluster_by,omitempty"`           // Cột dùng để sắp xếp dòng trong tệp mới
+	InputFiles  int        `json:"input_files"`                    // Số tệp được gộp
+	InputBytes  int64      `json:"input_bytes"`                    // Tổng kích thước các tệp được gộp
+	OutputFiles int        `json:"output_files"`                   // Số tệp mới
+	OutputBytes int64      `json:"output_bytes"`                   // Tổng kích thước các tệp mới
+	RowCount    int64      `json:"row_count"`                      // Số dòng được ghi lại
+	SnapshotID  int        `json:"snapshot_id"`                    // Snapshot được tạo, 0 nếu không có gì để gộp hoặc thất bại
+	Error       string     `json:"error,omitempty"`
+}
+
+const (
+	// CompactionTriggerManual là compaction được yêu cầu qua API
+	CompactionTriggerManual = "manual"
+	// CompactionTriggerScheduled là compaction của job định kỳ
+	CompactionTriggerScheduled = "scheduled"
+)
+
+const (
+	// CompactionStatusRunning là compaction đang chạy
+	CompactionStatusRunning = "running"
+	// CompactionStatusSucceeded là compaction đã commit xong, hoặc không có tệp nào cần gộp
+	CompactionStatusSucceeded = "succeeded"
+	// CompactionStatusFailed là compaction thất bại, manifest của table không thay đổi
+	CompactionStatusFailed = "failed"
+)
+
+// CollectionSync struct là một cấu hình đồng bộ liên tục document của collection sang table OLAP
+// Thay đổi của collection được đọc dần từ change log sau Checkpoint và được áp dụng vào table theo từng lô.
+// Mỗi table chỉ nhận dữ liệu từ một sync, mỗi document là một dòng có KeyColumn là _key của document
+type CollectionSync struct {
+	gorm.Model
+	ID             int             `json:"id" gorm:"primarykey"`
+	WorkspaceID    int             `json:"workspace_id" gorm:"not null;index"`        // ID của workspace chứa collection và table
+	CollectionID   int             `json:"collection_id" gorm:"not null;index"`       // Collection nguồn
+	TableID        int             `json:"table_id" gorm:"not null;uniqueIndex"`      // Table đích
+	KeyColumn      string          `json:"key_column" gorm:"not null"`                // Cột string của table chứa _key của document
+	Mapping        json.RawMessage `json:"mapping" gorm:"type:text"`                  // JSON {"<cột>": "<đường dẫn trong document>"}, rỗng là làm phẳng document và khớp theo tên
+	Loaded         bool            `json:"loaded" gorm:"not null;default:false"`      // Đã sao chép các document có sẵn khi tạo sync
+	Checkpoint     int64           `json:"checkpoint" gorm:"not null;default:0"`      // Số thứ tự của thay đổi cuối cùng đã được áp dụng
+	AppliedChanges int64           `json:"applied_changes" gorm:"not null;default:0"` // Tổng số thay đổi đã áp dụng
+	SkippedChanges int64           `json:"skipped_changes" gorm:"not null;default:0"` // Số document không chuyển được thành dòng của table và bị bỏ qua
+	LastSyncedAt   *time.Time      `json:"last_synced_at"`                            // Lần cuối áp dụng một lô thay đổi
+	LastError      string          `json:"last_error,omitempty"`                      // Lỗi gần nhất, rỗng sau một lần chạy thành công
+	PendingChanges int64           `json:"pending_changes" gorm:"-"`                  // Số thay đổi chưa được áp dụng, chỉ có khi xem trạng thái
+}
+
+// TablePartitionField struct là một trường phân vùng của table
+// Dữ liệu của table được chia thành các thư mục kiểu Hive <tên>=<giá trị> lồng nhau theo thứ tự Position.
+// Tên là tên cột với phân vùng theo giá trị, hoặc <cột>_day, <cột>_month với phân vùng theo ngày, tháng
+type TablePartitionField struct {
+	gorm.Model
+	ID        int    `json:"id" gorm:"primarykey"`
+	TableID   int    `json:"table_id" gorm:"not null;index"` // ID của table
+	Position  int    `json:"position" gorm:"not null"`       // Thứ tự của trường trong đường dẫn phân vùng, bắt đầu từ 0
+	Column    string `json:"column" gorm:"not null"`         // Tên cột nguồn
+	Transform string `json:"transform" gorm:"not null"`      // identity, day hoặc month
+}
+
+// Name trả về tên của trường phân vùng trong đường dẫn thư mục
+func (f *TablePartitionField) Name() string {
+	if f.Transform == PartitionTransformIdentity {
+		return f.Column
+	}
+	return f.Column + "_" + f.Transform
+}
+
+const (
+	// PartitionTransformIdentity phân vùng theo giá trị của cột
+	PartitionTransformIdentity = "identity"
+	// PartitionTransformDay phân vùng theo ngày (UTC) của cột date hoặc timestamp
+	PartitionTransformDay = "day"
+	// PartitionTransformMonth phân vùng theo tháng (UTC) của cột date hoặc timestamp
+	PartitionTransformMonth = "month"
+)
+
+// TablePartition là thống kê của một phân vùng, được tổng hợp từ manifest
+type TablePartition struct {
+	Partition string `json:"partition"`
+	FileCount int    `json:"file_count"`
+	RowCount  int64  `json:"row_count"`
+	ByteSize  int64  `json:"byte_size"`
+}
+
+// TableColumn struct đại diện cho một cột trong schema của table
+// Precision và Scale chỉ dùng cho kiểu decimal, Unit chỉ dùng cho kiểu timestamp
+type TableColumn struct {
+	gorm.Model
+	ID         int    `json:"id" gorm:"primarykey"`
+	TableID    int    `json:"table_id" gorm:"uniqueIndex:idx_column_table_name,priority:1;not null;index"` // ID của table chứa cột này
+	Name       string `json:"name" gorm:"uniqueIndex:idx_column_table_name,priority:2;not null"`           // Tên của cột, duy nhất trong table
+	Position   int    `json:"position" gorm:"not null"`                                                    // Thứ tự của cột trong table, bắt đầu từ 0
+	Type       string `json:"type" gorm:"not null"`                                                        // Kiểu dữ liệu của cột (int64, string, timestamp, decimal, ...)
+	Nullable   bool   `json:"nullable" gorm:"not null"`                                                    // Cột có được để trống (null) hay không
+	Precision  int    `json:"precision,omitempty"`                                                         // Tổng số chữ số của decimal
+	Scale      int    `json:"scale,omitempty"`                                                             // Số chữ số sau dấu thập phân của decimal
+	Unit       string `json:"unit,omitempty"`                                                              // Đơn vị của timestamp (millis, micros, nanos)
+	FieldID    int    `json:"field_id" gorm:"not null;default:0"`                                          // ID ổn định của cột trong table, được ghi vào tệp Parquet và không đổi khi cột được đổi tên
+	LegacyName string `json:"-"`                                                                           // Tên cột trong các tệp được ghi trước khi có field ID, rỗng với cột được thêm sau
+}
+
+const (
+	// ColumnTypeBoolean là kiểu true/false
+	ColumnTypeBoolean = "boolean"
+	// ColumnTypeInt32 là kiểu số nguyên 32 bit
+	ColumnTypeInt32 = "int32"
+	// ColumnTypeInt64 là kiểu số nguyên 64 bit
+	ColumnTypeInt64 = "int64"
+	// ColumnTypeFloat là kiểu số thực 32 bit
+	ColumnTypeFloat = "float"
+	// ColumnTypeDouble là kiểu số thực 64 bit
+	ColumnTypeDouble = "double"
+	// ColumnTypeString là kiểu chuỗi UTF-8
+	ColumnTypeString = "string"
+	// ColumnTypeBinary là kiểu chuỗi byte
+	ColumnTypeBinary = "binary"
+	// ColumnTypeDate là kiểu ngày, không có giờ
+	ColumnTypeDate = "date"
+	// ColumnTypeTimestamp là kiểu thời điểm theo UTC với đơn vị trong Unit
+	ColumnTypeTimestamp = "timestamp"
+	// ColumnTypeDecimal là kiểu số thập phân chính xác với Precision và Scale
+	ColumnTypeDecimal = "decimal"
+)
+
+const (
+	// TimeUnitMillis là đơn vị mili giây của timestamp
+	TimeUnitMillis = "millis"
+	// TimeUnitMicros là đơn vị micro giây của timestamp, là đơn vị mặc định
+	TimeUnitMicros = "micros"
+	// TimeUnitNanos là đơn vị nano giây của timestamp
+	TimeUnitNanos = "nanos"
+)
+
 // Index struct đại diện cho một chỉ mục trong một collection hoặc table
+// Chỉ mục luôn là sparse: document không có đủ các field của chỉ mục không được đưa vào chỉ mục
 type Index struct {
 	gorm.Model
 	ID           int         `json:"id" gorm:"primarykey"`
-	Name         string      `json:"name" gorm:"unique;not null"` // Tên của chỉ mục
-	TableID      int         `json:"table_id" gorm:"index"`       // ID của table chứa chỉ mục này (nếu có)
-	CollectionID int         `json:"collection_id" gorm:"index"`  // ID của collection chứa chỉ mục này (nếu có)
-	IndexType    string      `json:"index_type" gorm:"not null"`  // Loại chỉ mục (ví dụ: B-Tree, Hash, Inverted Index)
-	Fields       string      `json:"fields" gorm:"not null"`      // Các trường được đánh chỉ mục, ví dụ: "column1,column2", luôn là single, chỉ khi loại index hash thì mới là multiple
-	DataType     string      `json:"data_type" gorm:"not null"`   // Kiểu dữ liệu của trường (ví dụ: string, int, float, etc.)
-	Status       string      `json:"status" gorm:"not null"`      // Trạng thái của chỉ mục (active, building, etc.)
-	ServerID     int         `json:"server_id" gorm:"index"`      // ID của Index Worker Server chịu trách nhiệm xử lý chỉ mục này
-	Server       Server      `gorm:"foreignKey:ServerID"`         // Tham chiếu đến server Index Worker
-	Table        *Table      `gorm:"foreignKey:TableID"`          // Tham chiếu đến bảng
-	Collection   *Collection `gorm:"foreignKey:CollectionID"`     // Tham chiếu đến collection
-	IsUnique     bool        `json:"is_unique" gorm:"not null"`   // Chỉ mục có ràng buộc unique hay không
+	Name         string      `json:"name" gorm:"uniqueIndex:idx_index_owner_name,priority:3;not null"`       // Tên của chỉ mục, duy nhất trong collection hoặc table
+	TableID      int         `json:"table_id" gorm:"uniqueIndex:idx_index_owner_name,priority:2;index"`      // ID của table chứa chỉ mục này (nếu có)
+	CollectionID int         `json:"collection_id" gorm:"uniqueIndex:idx_index_owner_name,priority:1;index"` // ID của collection chứa chỉ mục này (nếu có)
+	IndexType    string      `json:"index_type" gorm:"not null"`                                             // Loại chỉ mục (ví dụ: B-Tree, Hash, Inverted Index)
+	Fields       string      `json:"fields" gorm:"not null"`                                                 // Các trường được đánh chỉ mục, ví dụ: "column1,column2", luôn là single, chỉ khi loại index hash thì mới là multiple
+	DataType     string      `json:"data_type" gorm:"not null"`                                              // Kiểu dữ liệu của trường (ví dụ: string, int, float, etc.), index nhiều field có thể khai báo "string,float"
+	Status       string      `json:"status" gorm:"not null"`                                                 // Trạng thái của chỉ mục (active, building, etc.)
+	ServerID     int         `json:"server_id" gorm:"index"`                                                 // ID của Index Worker Server chịu trách nhiệm xử lý chỉ mục này
+	Server       Server      `gorm:"foreignKey:ServerID"`                                                    // Tham chiếu đến server Index Worker
+	Table        *Table      `gorm:"foreignKey:TableID"`                                                     // Tham chiếu đến bảng
+	Collection   *Collection `gorm:"foreignKey:CollectionID"`                                                // Tham chiếu đến collection
+	IsUnique     bool        `json:"is_unique" gorm:"not null"`                                              // Chỉ mục có ràng buộc unique hay không
+	Filter       string      `json:"filter"`                                                                 // Biểu thức filter của partial index, rỗng nghĩa là index mọi document có đủ các field
+	KeyVersion   int         `json:"key_version" gorm:"not null;default:0"`                                  // Cách mã hóa giá trị trong index (0: legacy, 1: tuple)
+	Multikey     bool        `json:"multikey" gorm:"not null;default:false"`                                 // Có document cho nhiều value trong index (field là mảng), được đặt khi ghi document đó và không bị xóa
 }
 
 const (
@@ -98,6 +432,12 @@ const (
 	IndexTypeHash = "Hash"
 	// IndexTypeInvertedIndex là loại chỉ mục Inverted Index
 	IndexTypeInvertedIndex = "Inverted Index"
+	// IndexTypeBloomFilter là chỉ mục của table: bloom filter của một cột trong mỗi tệp dữ liệu,
+	// dùng để bỏ qua tệp chắc chắn không chứa giá trị trong điều kiện = hoặc IN
+	IndexTypeBloomFilter = "Bloom Filter"
+	// IndexTypeZoneMap là chỉ mục của table: min/max và số null của một cột trong từng row group của mỗi tệp dữ liệu,
+	// dùng để bỏ qua tệp mà không cần mở tệp
+	IndexTypeZoneMap = "Zone Map"
 )
 
 const (
@@ -107,6 +447,15 @@ const (
 	DataTypeInt = "int"
 	// DataTypeFloat là kiểu dữ liệu float
 	DataTypeFloat = "float"
+	// DataTypeBool là kiểu dữ liệu bool
+	DataTypeBool = "bool"
+)
+
+const (
+	// IndexKeyVersionLegacy là cách mã hóa cũ: giá trị đơn được lưu nguyên dạng chuỗi, Hash là md5 của các giá trị nối liền nhau
+	IndexKeyVersionLegacy = 0
+	// IndexKeyVersionTuple là cách mã hóa tuple: giá trị giữ thứ tự theo từng field, Hash là md5 của tuple
+	IndexKeyVersionTuple = 1
 )
 
 const (
@@ -122,11 +471,11 @@ const (
 type Pipeline struct {
 	gorm.Model
 	ID          int       `json:"id" gorm:"primarykey"`
-	Name        string    `json:"name" gorm:"unique;not null"`        // Tên của pipeline
-	WorkspaceID int       `json:"workspace_id" gorm:"not null;index"` // ID của workspace chứa pipeline này
-	Workspace   Workspace `gorm:"foreignKey:WorkspaceID"`             // Tham chiếu đến workspace
-	Notebook    string    `json:"notebook" gorm:"not null"`           // Đường dẫn tới Jupyter Notebook
-	Schedule    string    `json:"schedule"`                           // Lịch trình chạy pipeline
+	Name        string    `json:"name" gorm:"uniqueIndex:idx_pipeline_workspace_name,priority:2;not null"`               // Tên của pipeline, duy nhất trong workspace
+	WorkspaceID int       `json:"workspace_id" gorm:"uniqueIndex:idx_pipeline_workspace_name,priority:1;not null;index"` // ID của workspace chứa pipeline này
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID"`                                                                // Tham chiếu đến workspace
+	Notebook    string    `json:"notebook" gorm:"not null"`                                                              // Đường dẫn tới Jupyter Notebook
+	Schedule    string    `json:"schedule"`                                                                              // Lịch trình chạy pipeline
 }
 
 // Server struct đại diện cho một máy chủ nơi các shards được triển khai
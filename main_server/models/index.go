@@ -1,15 +1,26 @@
 package models
 
-import mapset "github.com/deckarep/golang-set/v2"
-
-// Generic Node type
-// type Node[T any] struct {
-// 	Value T
-// 	Keys  mapset.Set[string]
-// }
-
-// Generic Node type
-type Node struct {
-	Value []byte
-	Keys  mapset.Set[string]
+import "time"
+
+// IndexStatsTopNodes là số node nhiều key nhất được theo dõi trong thống kê của index
+const IndexStatsTopNodes = 10
+
+// IndexStats là thống kê của một index, được lưu trong bucket "stats" của file bbolt của index
+// và được cập nhật cùng transaction với mỗi lần thay đổi node
+type IndexStats struct {
+	EntryCount      int64      `json:"entry_count"`       // Tổng số cặp (value, key) trong index
+	DistinctValues  int64      `json:"distinct_values"`   // Số value khác nhau, bằng số node
+	TopNodes        []NodeStat `json:"top_nodes"`         // Các node nhiều key nhất, giảm dần theo số key
+	FileSize        int64      `json:"file_size"`         // Kích thước file bbolt (bytes), tính khi đọc thống kê
+	BuildDurationMs int64      `json:"build_duration_ms"` // Thời gian build index lần gần nhất
+	BuiltAt         *time.Time `json:"built_at"`          // Thời điểm build index lần gần nhất
+	LastUpdatedAt   *time.Time `json:"last_updated_at"`   // Thời điểm index thay đổi lần gần nhất
+	QueryCount      int64      `json:"query_count"`       // Số query đã dùng index
+	LastUsedAt      *time.Time `json:"last_used_at"`      // Thời điểm query dùng index lần gần nhất
+}
+
+// NodeStat là số key của một node trong index
+type NodeStat struct {
+	Value []byte `json:"value"`
+	Keys  int64  `json:"keys"`
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dehuy69/mydp/config"
 	"github.com/dehuy69/mydp/main_server/controller"
+	"github.com/dehuy69/mydp/main_server/models"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,19 +20,115 @@ func SetupRouter(ctrl *controller.Controller) *gin.Engine {
 	publicR := r.Group("/api")
 	{
 		publicR.POST("/login", ctrl.LoginHandler)
+	}
+
+	// Các route cần xác thực bằng JWT hoặc API key (header X-API-Key)
+	// Các route thay đổi dữ liệu hoặc cấu hình được ghi audit log qua ctrl.Audit
+	// <workspace-id>, <collection-id> và <table-id> có thể là ID hoặc tên, ví dụ /api/workspace/analytics/collection/events
+	privateR := r.Group("/api")
+	privateR.Use(ctrl.AuthMiddleware(), ctrl.RateLimitMiddleware())
+	{
 		// /api/workspace/create
-		publicR.POST("/workspace/create", ctrl.CreateWorkspaceHandler)
+		privateR.POST("/workspace/create", ctrl.Audit("workspace.create"), ctrl.CreateWorkspaceHandler)
+		// /api/workspace/list
+		privateR.GET("/workspace/list", ctrl.ListWorkspacesHandler)
+		// /api/workspace/<workspace-id>
+		privateR.GET("/workspace/:workspace-id", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.GetWorkspaceHandler)
+		privateR.POST("/workspace/:workspace-id/rename", ctrl.Audit("workspace.rename"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.RenameWorkspaceHandler)
+		privateR.POST("/workspace/:workspace-id/delete", ctrl.Audit("workspace.delete"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.DeleteWorkspaceHandler)
 		// /api/workspace/<workspace-id>/collection/create
-		publicR.POST("/workspace/:workspace-id/collection/create", ctrl.CreateCollectionHandler)
+		privateR.POST("/workspace/:workspace-id/collection/create", ctrl.Audit("collection.create"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CreateCollectionHandler)
 		///api/workspace/<workspace-id>/collection/<collection-id>/write
-		publicR.POST("/workspace/:workspace-id/collection/:collection-id/write", ctrl.WriteCollectionHandler)
-		publicR.POST("/workspace/:workspace-id/collection/:collection-id/force-write", ctrl.ForceWriteCollectionHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/write", ctrl.Audit("collection.write"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.WriteCollectionHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/force-write", ctrl.Audit("collection.force-write"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.ForceWriteCollectionHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/update
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/update", ctrl.Audit("collection.update"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.UpdateDocumentHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/delete
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/delete", ctrl.Audit("collection.delete"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.DeleteDocumentHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/query
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/query", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.QueryCollectionHandler)
+		// /api/workspace/<workspace-id>/collection/list
+		privateR.GET("/workspace/:workspace-id/collection/list", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ListCollectionsHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>
+		privateR.GET("/workspace/:workspace-id/collection/:collection-id", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.DescribeCollectionHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/rename", ctrl.Audit("collection.rename"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.RenameCollectionHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/schema
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/schema", ctrl.Audit("collection.schema"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.SetCollectionSchemaHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/validate
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/validate", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ValidateDocumentHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/truncate", ctrl.Audit("collection.truncate"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.TruncateCollectionHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/drop", ctrl.Audit("collection.drop"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.DropCollectionHandler)
 		// /api/workspace/<workspace-id>/collection/<collection-id>/index/create
-		publicR.POST("/workspace/:workspace-id/collection/:collection-id/index/create", ctrl.CreateIndexHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/index/create", ctrl.Audit("index.create"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CreateIndexHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/rebuild
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/index/:index-id/rebuild", ctrl.Audit("index.rebuild"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.RebuildIndexHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/stats
+		privateR.GET("/workspace/:workspace-id/collection/:collection-id/index/:index-id/stats", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.GetIndexStatsHandler)
+		// /api/workspace/<workspace-id>/collection/<collection-id>/index/<index-id>/verify
+		privateR.GET("/workspace/:workspace-id/collection/:collection-id/index/:index-id/verify", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.VerifyIndexHandler)
+		privateR.POST("/workspace/:workspace-id/collection/:collection-id/index/:index-id/repair", ctrl.Audit("index.repair"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.RepairIndexHandler)
+		// /api/workspace/<workspace-id>/index/unused
+		privateR.GET("/workspace/:workspace-id/index/unused", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ListUnusedIndexesHandler)
+
+		// /api/workspace/<workspace-id>/table/create
+		privateR.POST("/workspace/:workspace-id/table/create", ctrl.Audit("table.create"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CreateTableHandler)
+		// /api/workspace/<workspace-id>/table/list
+		privateR.GET("/workspace/:workspace-id/table/list", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ListTablesHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>
+		privateR.GET("/workspace/:workspace-id/table/:table-id", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.DescribeTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/append
+		privateR.POST("/workspace/:workspace-id/table/:table-id/append", ctrl.Audit("table.append"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.AppendTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/flush
+		privateR.POST("/workspace/:workspace-id/table/:table-id/flush", ctrl.Audit("table.flush"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.FlushTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/alter
+		privateR.POST("/workspace/:workspace-id/table/:table-id/alter", ctrl.Audit("table.alter"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.AlterTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/compact
+		privateR.POST("/workspace/:workspace-id/table/:table-id/compact", ctrl.Audit("table.compact"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CompactTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/compactions
+		privateR.GET("/workspace/:workspace-id/table/:table-id/compactions", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.TableCompactionsHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/snapshots
+		privateR.GET("/workspace/:workspace-id/table/:table-id/snapshots", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ListTableSnapshotsHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/snapshots/expire
+		privateR.POST("/workspace/:workspace-id/table/:table-id/snapshots/expire", ctrl.Audit("table.expire-snapshots"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.ExpireTableSnapshotsHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/drop
+		privateR.POST("/workspace/:workspace-id/table/:table-id/drop", ctrl.Audit("table.drop"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.DropTableHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/index/create
+		privateR.POST("/workspace/:workspace-id/table/:table-id/index/create", ctrl.Audit("table-index.create"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CreateTableIndexHandler)
+		// /api/workspace/<workspace-id>/table/<table-id>/index/<index-id>/drop
+		privateR.POST("/workspace/:workspace-id/table/:table-id/index/:index-id/drop", ctrl.Audit("table-index.drop"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.DropTableIndexHandler)
+		// /api/workspace/<workspace-id>/sync/create
+		privateR.POST("/workspace/:workspace-id/sync/create", ctrl.Audit("sync.create"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.CreateSyncHandler)
+		// /api/workspace/<workspace-id>/sync/list
+		privateR.GET("/workspace/:workspace-id/sync/list", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.ListSyncsHandler)
+		// /api/workspace/<workspace-id>/sync/<sync-id>
+		privateR.GET("/workspace/:workspace-id/sync/:sync-id", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.DescribeSyncHandler)
+		// /api/workspace/<workspace-id>/sync/<sync-id>/drop
+		privateR.POST("/workspace/:workspace-id/sync/:sync-id/drop", ctrl.Audit("sync.drop"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.DropSyncHandler)
+		// /api/workspace/<workspace-id>/sql
+		privateR.POST("/workspace/:workspace-id/sql", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.SQLHandler)
+		// /api/workspace/<workspace-id>/sql/execute
+		privateR.POST("/workspace/:workspace-id/sql/execute", ctrl.Audit("sql.execute"), ctrl.RequireWorkspacePermission(models.PermissionWrite), ctrl.SQLExecuteHandler)
+
+		// /api/workspace/<workspace-id>/api-key/...
+		privateR.POST("/workspace/:workspace-id/api-key/create", ctrl.Audit("api-key.create"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.CreateAPIKeyHandler)
+		privateR.GET("/workspace/:workspace-id/api-key/list", ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.ListAPIKeysHandler)
+		privateR.POST("/workspace/:workspace-id/api-key/:key-id/revoke", ctrl.Audit("api-key.revoke"), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.RevokeAPIKeyHandler)
+
+		// /api/workspace/<workspace-id>/usage
+		privateR.GET("/workspace/:workspace-id/usage", ctrl.RequireWorkspacePermission(models.PermissionRead), ctrl.GetWorkspaceUsageHandler)
+		// /api/workspace/<workspace-id>/quota, chỉ admin hệ thống được thay đổi quota
+		privateR.POST("/workspace/:workspace-id/quota", ctrl.Audit("workspace.quota"), ctrl.RequireAdmin(), ctrl.RequireWorkspacePermission(models.PermissionAdmin), ctrl.SetWorkspaceQuotaHandler)
+
+		// /api/admin/rate-limit
+		privateR.POST("/admin/rate-limit", ctrl.Audit("rate-limit.set"), ctrl.RequireAdmin(), ctrl.SetRateLimitHandler)
+		privateR.GET("/admin/rate-limit/list", ctrl.RequireAdmin(), ctrl.ListRateLimitsHandler)
+
+		// /api/admin/audit-log
+		privateR.GET("/admin/audit-log", ctrl.RequireAdmin(), ctrl.QueryAuditLogHandler)
 
-		publicR.GET("/_internal/debug/getall-badger", ctrl.GetAllBadger)
-		publicR.GET("/_internal/debug/getall-bbolt", ctrl.GetAllBbolt)
-		publicR.GET("/_internal/debug/getall-queue", ctrl.GetAllQueue)
+		privateR.GET("/_internal/debug/getall-badger", ctrl.RequireAdmin(), ctrl.GetAllBadger)
+		privateR.GET("/_internal/debug/getall-bbolt", ctrl.RequireAdmin(), ctrl.GetAllBbolt)
+		privateR.GET("/_internal/debug/getall-queue", ctrl.RequireAdmin(), ctrl.GetAllQueue)
 	}
 
 	return r
@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewAuditRetentionJob tạo job xóa các bản ghi audit log cũ hơn retentionDays ngày
+func NewAuditRetentionJob(catalog *service.SQLiteCatalogService, retentionDays int) Job {
+	return Job{
+		Name:     "audit-retention",
+		Interval: time.Hour,
+		Run: func() error {
+			deleted, err := catalog.DeleteAuditLogsBefore(time.Now().AddDate(0, 0, -retentionDays))
+			if err != nil {
+				return err
+			}
+			if deleted > 0 {
+				log.Printf("Audit retention: deleted %d entries older than %d days", deleted, retentionDays)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,23 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewCollectionSyncJob tạo job áp dụng thay đổi của các collection vào các table được đồng bộ mỗi intervalSeconds giây,
+// mỗi lô có tối đa batchSize thay đổi
+func NewCollectionSyncJob(catalog *service.SQLiteCatalogService, storage *service.Storage, intervalSeconds, batchSize int) Job {
+	if intervalSeconds <= 0 {
+		intervalSeconds = 10
+	}
+	return Job{
+		Name:     "collection-sync",
+		Interval: time.Duration(intervalSeconds) * time.Second,
+		Run: func() error {
+			return domain.SyncCollections(catalog, storage, batchSize)
+		},
+	}
+}
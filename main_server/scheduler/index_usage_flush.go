@@ -0,0 +1,16 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewIndexUsageFlushJob tạo job ghi số lần các index được query dùng từ bộ nhớ vào file index
+func NewIndexUsageFlushJob(bboltService *service.BboltService) Job {
+	return Job{
+		Name:     "index-usage-flush",
+		Interval: time.Minute,
+		Run:      bboltService.FlushIndexUsage,
+	}
+}
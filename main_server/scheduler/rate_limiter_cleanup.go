@@ -0,0 +1,19 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewRateLimiterCleanupJob tạo job dọn các token bucket không còn được sử dụng
+func NewRateLimiterCleanupJob(rateLimiter *service.RateLimiter) Job {
+	return Job{
+		Name:     "rate-limiter-cleanup",
+		Interval: 10 * time.Minute,
+		Run: func() error {
+			rateLimiter.Cleanup(10 * time.Minute)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Job là một tác vụ chạy định kỳ trong main server
+type Job struct {
+	Name     string        // Tên job, dùng khi ghi log
+	Interval time.Duration // Khoảng thời gian giữa hai lần chạy
+	Run      func() error  // Hàm thực thi job
+}
+
+// Scheduler chạy các Job định kỳ, mỗi job chạy trong một goroutine riêng
+type Scheduler struct {
+	jobs     []Job
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewScheduler khởi tạo một Scheduler rỗng
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Register đăng ký một job, phải gọi trước Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start chạy tất cả các job đã đăng ký, mỗi job chạy một lần ngay khi start rồi lặp lại theo Interval
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+	log.Printf("Scheduler started with %d jobs", len(s.jobs))
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job.Run(); err != nil {
+			log.Printf("Job %s failed: %v", job.Name, err)
+		}
+
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown dừng tất cả các job và chờ lần chạy hiện tại kết thúc
+func (s *Scheduler) Shutdown() {
+	close(s.stopChan)
+	s.wg.Wait()
+	log.Println("Scheduler stopped")
+}
@@ -0,0 +1,19 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewTableCompactionJob tạo job gộp các tệp nhỏ của các table mỗi intervalSeconds giây
+func NewTableCompactionJob(catalog *service.SQLiteCatalogService, storage *service.Storage, intervalSeconds int) Job {
+	return Job{
+		Name:     "table-compaction",
+		Interval: time.Duration(intervalSeconds) * time.Second,
+		Run: func() error {
+			return domain.CompactTables(catalog, storage)
+		},
+	}
+}
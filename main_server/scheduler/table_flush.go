@@ -0,0 +1,23 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewTableFlushJob tạo job ghi các dòng còn trong buffer của các table ra tệp Parquet mỗi intervalSeconds giây
+// để dòng đã append không nằm trong bộ nhớ quá lâu khi table nhận ít dữ liệu
+func NewTableFlushJob(catalog *service.SQLiteCatalogService, storage *service.Storage, intervalSeconds int) Job {
+	if intervalSeconds <= 0 {
+		intervalSeconds = 60
+	}
+	return Job{
+		Name:     "table-flush",
+		Interval: time.Duration(intervalSeconds) * time.Second,
+		Run: func() error {
+			return domain.FlushTables(catalog, storage)
+		},
+	}
+}
@@ -0,0 +1,20 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewTableSnapshotExpireJob tạo job xóa các snapshot cũ hơn retentionHours giờ của các table
+// cùng các tệp Parquet không còn thuộc snapshot nào
+func NewTableSnapshotExpireJob(catalog *service.SQLiteCatalogService, storage *service.Storage, retentionHours int) Job {
+	return Job{
+		Name:     "table-snapshot-expire",
+		Interval: 10 * time.Minute,
+		Run: func() error {
+			return domain.ExpireTableSnapshots(catalog, storage, time.Duration(retentionHours)*time.Hour)
+		},
+	}
+}
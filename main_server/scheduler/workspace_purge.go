@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/domain"
+	"github.com/dehuy69/mydp/main_server/service"
+)
+
+// NewWorkspacePurgeJob tạo job xóa hẳn các workspace đã bị xóa mềm quá graceHours giờ
+func NewWorkspacePurgeJob(catalog *service.SQLiteCatalogService, storage *service.Storage, graceHours int) Job {
+	return Job{
+		Name:     "workspace-purge",
+		Interval: 10 * time.Minute,
+		Run: func() error {
+			workspaces, err := catalog.ListWorkspacesDeletedBefore(time.Now().Add(-time.Duration(graceHours) * time.Hour))
+			if err != nil {
+				return err
+			}
+
+			for i := range workspaces {
+				workspaceWrapper := domain.NewWorkspaceWrapper(&workspaces[i], catalog, storage)
+				if err := workspaceWrapper.Purge(); err != nil {
+					return fmt.Errorf("failed to purge workspace %d: %v", workspaces[i].ID, err)
+				}
+			}
+			return nil
+		},
+	}
+}
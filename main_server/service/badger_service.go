@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"path"
 
 	"github.com/dehuy69/mydp/config"
@@ -46,11 +47,14 @@ func (bs *BadgerService) Set(key, value []byte) error {
 	return err
 }
 
-// Get đọc giá trị từ cơ sở dữ liệu Badger dựa trên khóa
+// Get đọc giá trị từ cơ sở dữ liệu Badger dựa trên khóa, trả về ErrKeyNotFound nếu không có khóa
 func (bs *BadgerService) Get(key []byte) ([]byte, error) {
 	var value []byte
 	err := bs.Db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrKeyNotFound
+		}
 		if err != nil {
 			return err
 		}
@@ -68,6 +72,76 @@ func (bs *BadgerService) Delete(key []byte) error {
 	return err
 }
 
+// DropPrefix xóa tất cả các key bắt đầu bằng prefix, ví dụ toàn bộ document của một collection "<collection_id>||"
+func (bs *BadgerService) DropPrefix(prefix []byte) error {
+	return bs.Db.DropPrefix(prefix)
+}
+
+// PrefixStats đếm số key và tổng kích thước value (xấp xỉ) của các key bắt đầu bằng prefix
+// Chỉ duyệt key, không đọc value
+func (bs *BadgerService) PrefixStats(prefix []byte) (int64, int64, error) {
+	var count, size int64
+	err := bs.Db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			count++
+			size += it.Item().ValueSize()
+		}
+		return nil
+	})
+	return count, size, err
+}
+
+// ScanPrefix duyệt các key bắt đầu bằng prefix theo thứ tự tăng dần, dừng khi fn trả về false hoặc lỗi
+func (bs *BadgerService) ScanPrefix(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	return bs.Db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			next := true
+			err := item.Value(func(value []byte) error {
+				var err error
+				next, err = fn(item.Key(), value)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if !next {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// WriteBatch áp dụng các thao tác ghi trong một transaction của Badger
+func (bs *BadgerService) WriteBatch(writes []DocumentWrite) error {
+	return bs.Db.Update(func(txn *badger.Txn) error {
+		for _, write := range writes {
+			var err error
+			if write.Delete {
+				err = txn.Delete(write.Key)
+			} else {
+				err = txn.Set(write.Key, write.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (bs *BadgerService) GetAllBadger() ([]map[string]interface{}, error) {
 	var data []map[string]interface{}
 
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"go.etcd.io/bbolt"
+)
+
+// Thống kê của index được lưu trong bucket "stats" của file bbolt, tách riêng với các bucket của posting list
+var (
+	statsBucket = []byte("stats")
+	statsKey    = []byte("stats")
+)
+
+// GetIndexStats trả về thống kê của index, kể cả số lần dùng chưa được ghi vào file
+// Index được tạo trước khi có thống kê sẽ được tính từ các node, và được lưu lại ở lần ghi tiếp theo
+func (bs *BboltService) GetIndexStats(index *models.Index) (*models.IndexStats, error) {
+	fileName := bs.GetFileNameFromIndex(index)
+	db, release, err := bs.indexDB(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var stats *models.IndexStats
+	err = db.View(func(tx *bbolt.Tx) error {
+		var err error
+		stats, err = loadStats(tx)
+		if err != nil {
+			return err
+		}
+		stats.FileSize = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	bs.pendingUsage(fileName, stats)
+	return stats, nil
+}
+
+// RecordIndexBuild lưu thời gian build của index, gọi sau khi build hoặc rebuild thành công
+func (bs *BboltService) RecordIndexBuild(index *models.Index, duration time.Duration) error {
+	return bs.updateStats(index, func(stats *models.IndexStats) {
+		now := time.Now()
+		stats.BuildDurationMs = duration.Milliseconds()
+		stats.BuiltAt = &now
+	})
+}
+
+// indexUsage đếm số lần query dùng một index kể từ lần ghi vào bucket "stats" gần nhất
+type indexUsage struct {
+	count    atomic.Int64
+	lastUsed atomic.Int64 // Unix nano của lần dùng gần nhất
+}
+
+// RecordIndexUsage ghi nhận một query đã dùng index
+// Số lần dùng được đếm trong bộ nhớ và được ghi vào file index bởi FlushIndexUsage, để query không phải ghi file
+func (bs *BboltService) RecordIndexUsage(index *models.Index) error {
+	value, _ := bs.usage.LoadOrStore(bs.GetFileNameFromIndex(index), &indexUsage{})
+	usage := value.(*indexUsage)
+	usage.lastUsed.Store(time.Now().UnixNano())
+	usage.count.Add(1)
+	return nil
+}
+
+// FlushIndexUsage ghi số lần dùng được đếm trong bộ nhớ của các index vào bucket "stats", gọi định kỳ và khi đóng
+// Nếu ghi lỗi, số lần dùng được giữ lại cho lần ghi sau
+func (bs *BboltService) FlushIndexUsage() error {
+	var firstErr error
+	bs.usage.Range(func(key, value interface{}) bool {
+		usage := value.(*indexUsage)
+		count := usage.count.Swap(0)
+		if count == 0 {
+			return true
+		}
+		lastUsed := time.Unix(0, usage.lastUsed.Load())
+		err := bs.updateStatsFile(key.(string), func(stats *models.IndexStats) {
+			stats.QueryCount += count
+			if stats.LastUsedAt == nil || stats.LastUsedAt.Before(lastUsed) {
+				stats.LastUsedAt = &lastUsed
+			}
+		})
+		if err != nil {
+			usage.count.Add(count)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to write usage of index file %s: %w", key, err)
+			}
+		}
+		return true
+	})
+	return firstErr
+}
+
+// pendingUsage cộng số lần dùng chưa được ghi vào file của index vào stats
+func (bs *BboltService) pendingUsage(fileName string, stats *models.IndexStats) {
+	value, ok := bs.usage.Load(fileName)
+	if !ok {
+		return
+	}
+	usage := value.(*indexUsage)
+	if count := usage.count.Load(); count > 0 {
+		stats.QueryCount += count
+		lastUsed := time.Unix(0, usage.lastUsed.Load())
+		if stats.LastUsedAt == nil || stats.LastUsedAt.Before(lastUsed) {
+			stats.LastUsedAt = &lastUsed
+		}
+	}
+}
+
+func (bs *BboltService) updateStats(index *models.Index, fn func(stats *models.IndexStats)) error {
+	return bs.updateStatsFile(bs.GetFileNameFromIndex(index), fn)
+}
+
+func (bs *BboltService) updateStatsFile(fileName string, fn func(stats *models.IndexStats)) error {
+	db, release, err := bs.indexDB(fileName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		stats, err := loadStats(tx)
+		if err != nil {
+			return err
+		}
+		fn(stats)
+		return saveStats(tx, stats)
+	})
+}
+
+// loadStats đọc thống kê trong bucket "stats", nếu chưa có thì tính từ số key của từng value
+func loadStats(tx *bbolt.Tx) (*models.IndexStats, error) {
+	stats := &models.IndexStats{}
+	if b := tx.Bucket(statsBucket); b != nil {
+		if raw := b.Get(statsKey); raw != nil {
+			if err := json.Unmarshal(raw, stats); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal index stats: %w", err)
+			}
+			return stats, nil
+		}
+	}
+
+	if counts := tx.Bucket(countBucket); counts != nil {
+		err := counts.ForEach(func(k, _ []byte) error {
+			value := countKeyValue(k)
+			applyNodeChange(stats, value, 0, entryCount(counts, value))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func saveStats(tx *bbolt.Tx, stats *models.IndexStats) error {
+	b, err := tx.CreateBucketIfNotExists(statsBucket)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return b.Put(statsKey, raw)
+}
+
+// applyNodeChange cập nhật thống kê khi số key của node value đổi từ before sang after
+// Danh sách top node chỉ được cập nhật với node vừa thay đổi, nên khi một node trong danh sách giảm số key,
+// node ngoài danh sách có thể nhiều key hơn mà chưa được đưa vào. Danh sách chính xác trở lại sau khi rebuild
+func applyNodeChange(stats *models.IndexStats, value []byte, before, after int64) {
+	stats.EntryCount += after - before
+	if before == 0 && after > 0 {
+		stats.DistinctValues++
+	} else if before > 0 && after == 0 {
+		stats.DistinctValues--
+	}
+
+	topNodes := make([]models.NodeStat, 0, len(stats.TopNodes)+1)
+	for _, node := range stats.TopNodes {
+		if !bytes.Equal(node.Value, value) {
+			topNodes = append(topNodes, node)
+		}
+	}
+	if after > 0 {
+		topNodes = append(topNodes, models.NodeStat{Value: append([]byte{}, value...), Keys: after})
+	}
+	sort.SliceStable(topNodes, func(i, j int) bool {
+		if topNodes[i].Keys != topNodes[j].Keys {
+			return topNodes[i].Keys > topNodes[j].Keys
+		}
+		return bytes.Compare(topNodes[i].Value, topNodes[j].Value) < 0
+	})
+	if len(topNodes) > models.IndexStatsTopNodes {
+		topNodes = topNodes[:models.IndexStatsTopNodes]
+	}
+	stats.TopNodes = topNodes
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+func TestIndexUsageIsFlushedOnClose(t *testing.T) {
+	cfg := &config.Config{DataFolderDefault: t.TempDir()}
+	index := &models.Index{ID: 1, CollectionID: 1}
+
+	bs, err := NewBboltService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.CreateIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := bs.RecordIndexUsage(index); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bs.FlushIndexUsage(); err != nil {
+		t.Fatal(err)
+	}
+	// Số lần dùng chưa được ghi vẫn có trong thống kê
+	if err := bs.RecordIndexUsage(index); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := bs.GetIndexStats(index)
+	if err != nil || stats.QueryCount != 4 || stats.LastUsedAt == nil {
+		t.Fatalf("got stats %+v (%v), want 4 queries", stats, err)
+	}
+	if err := bs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBboltService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	stats, err = reopened.GetIndexStats(index)
+	if err != nil || stats.QueryCount != 4 {
+		t.Fatalf("got stats %+v (%v) after reopen, want 4 queries", stats, err)
+	}
+}
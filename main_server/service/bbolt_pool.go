@@ -0,0 +1,191 @@
+package service
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// defaultBboltMaxOpenFiles là số file index được mở cùng lúc khi cấu hình không chỉ định
+const defaultBboltMaxOpenFiles = 256
+
+// bboltOpenTimeout là thời gian tối đa chờ khóa file index khi mở, ví dụ khi cmd/index_check đang giữ file.
+// File được mở trong lúc giữ khóa của pool nên không được chờ lâu
+const bboltOpenTimeout = time.Second
+
+// errPoolClosed được trả về khi truy cập file index sau khi BboltService đã đóng
+var errPoolClosed = errors.New("bbolt handle pool is closed")
+
+// bboltHandle là một file index đang mở
+type bboltHandle struct {
+	db      *bbolt.DB
+	refs    int           // Số thao tác đang dùng handle, handle chỉ được đóng khi refs = 0
+	element *list.Element // Vị trí trong danh sách LRU
+}
+
+// bboltPool quản lý các file index đang mở, an toàn khi dùng từ nhiều goroutine
+// File được mở khi được dùng lần đầu. Khi số file mở đạt maxOpen, file ít được dùng gần đây nhất
+// và không có thao tác nào đang dùng sẽ bị đóng. Nếu mọi file đều đang được dùng, giới hạn tạm thời bị vượt
+// thay vì chờ, để không bị deadlock khi một thao tác cần nhiều file cùng lúc
+type bboltPool struct {
+	mu      sync.Mutex
+	idle    *sync.Cond // Được báo khi refs của một handle về 0
+	dir     string
+	maxOpen int
+	handles map[string]*bboltHandle
+	lru     *list.List // Tên file, đầu danh sách là file được dùng gần đây nhất
+	closed  bool
+}
+
+func newBboltPool(dir string, maxOpen int) *bboltPool {
+	if maxOpen <= 0 {
+		maxOpen = defaultBboltMaxOpenFiles
+	}
+	p := &bboltPool{
+		dir:     dir,
+		maxOpen: maxOpen,
+		handles: make(map[string]*bboltHandle),
+		lru:     list.New(),
+	}
+	p.idle = sync.NewCond(&p.mu)
+	return p
+}
+
+// acquire trả về kết nối tới file index và hàm release phải được gọi khi thao tác kết thúc
+// Nếu create = false và file chưa tồn tại thì trả về lỗi thay vì tạo file mới
+func (p *bboltPool) acquire(filename string, create bool) (*bbolt.DB, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, nil, errPoolClosed
+	}
+
+	handle, ok := p.handles[filename]
+	if !ok {
+		filePath := path.Join(p.dir, filename)
+		if !create {
+			if _, err := os.Stat(filePath); err != nil {
+				return nil, nil, fmt.Errorf("database %s not found", filename)
+			}
+		}
+
+		p.evict(p.maxOpen - 1)
+		options := *bbolt.DefaultOptions
+		options.Timeout = bboltOpenTimeout
+		db, err := bbolt.Open(filePath, 0666, &options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %w", filename, err)
+		}
+		handle = &bboltHandle{db: db, element: p.lru.PushFront(filename)}
+		p.handles[filename] = handle
+	} else {
+		p.lru.MoveToFront(handle.element)
+	}
+
+	handle.refs++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			handle.refs--
+			if handle.refs == 0 {
+				p.idle.Broadcast()
+				// Giới hạn có thể đã bị vượt khi nhiều file cùng được dùng, đóng bớt file khi chúng được trả lại
+				p.evict(p.maxOpen)
+			}
+		})
+	}
+	return handle.db, release, nil
+}
+
+// evict đóng các file ít được dùng gần đây nhất không có thao tác nào đang dùng cho tới khi số file mở không quá limit
+// Phải được gọi khi đang giữ p.mu
+func (p *bboltPool) evict(limit int) {
+	for element := p.lru.Back(); element != nil && len(p.handles) > limit; {
+		prev := element.Prev()
+		filename := element.Value.(string)
+		if handle := p.handles[filename]; handle.refs == 0 {
+			if err := handle.db.Close(); err != nil {
+				log.Printf("Failed to close index file %s: %v", filename, err)
+			}
+			p.lru.Remove(element)
+			delete(p.handles, filename)
+		}
+		element = prev
+	}
+}
+
+// remove chờ các thao tác đang dùng file kết thúc, đóng file rồi gọi fn trong lúc chưa cho mở lại file
+// Dùng khi xóa file index
+func (p *bboltPool) remove(filename string, fn func(filePath string) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Trong lúc chờ, handle có thể bị evict đóng và file được mở lại bằng handle khác,
+	// nên handle hiện tại của file được đọc lại sau mỗi lần chờ
+	for {
+		handle, ok := p.handles[filename]
+		if !ok {
+			break
+		}
+		if handle.refs > 0 {
+			p.idle.Wait()
+			continue
+		}
+		if err := handle.db.Close(); err != nil {
+			return err
+		}
+		p.lru.Remove(handle.element)
+		delete(p.handles, filename)
+		break
+	}
+	return fn(path.Join(p.dir, filename))
+}
+
+// files trả về tên các file index trong thư mục, gồm cả các file chưa được mở
+func (p *bboltPool) files() ([]string, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+// close chờ các thao tác đang chạy kết thúc rồi đóng tất cả file, sau đó không thể mở file mới
+func (p *bboltPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	var firstErr error
+	// Evict có thể đóng handle khi thao tác cuối cùng trả lại file trong lúc chờ, nên chỉ đóng handle còn trong danh sách
+	for element := p.lru.Back(); element != nil; element = p.lru.Back() {
+		filename := element.Value.(string)
+		handle := p.handles[filename]
+		if handle.refs > 0 {
+			p.idle.Wait()
+			continue
+		}
+		if err := handle.db.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close %s: %v", filename, err)
+		}
+		p.lru.Remove(element)
+		delete(p.handles, filename)
+	}
+	return firstErr
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBboltPoolEvictsOnlyIdleFiles(t *testing.T) {
+	p := newBboltPool(t.TempDir(), 2)
+	defer p.close()
+
+	_, releaseA, err := p.acquire("a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, releaseB, err := p.acquire("b", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cả hai file đang được dùng nên file thứ ba được mở dù vượt giới hạn
+	_, releaseC, err := p.acquire("c", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.handles) != 3 {
+		t.Fatalf("got %d open files, want 3", len(p.handles))
+	}
+
+	releaseB()
+	releaseB() // Gọi release nhiều lần không làm giảm số tham chiếu thêm
+	if _, ok := p.handles["b"]; ok || len(p.handles) != 2 {
+		t.Fatalf("got open files %v, want b to be evicted", p.lru)
+	}
+	releaseA()
+	releaseC()
+	if len(p.handles) != 2 {
+		t.Fatalf("got %d open files, want 2", len(p.handles))
+	}
+
+	if _, _, err := p.acquire("missing", false); err == nil {
+		t.Fatal("expected an error when opening a missing file without create")
+	}
+}
+
+func TestBboltPoolRemoveWaitsForRelease(t *testing.T) {
+	p := newBboltPool(t.TempDir(), 2)
+	defer p.close()
+
+	_, release, err := p.acquire("a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := make(chan error, 1)
+	go func() {
+		removed <- p.remove("a", os.Remove)
+	}()
+
+	select {
+	case err := <-removed:
+		t.Fatalf("remove returned while the file was in use: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	if err := <-removed; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.handles["a"]; ok {
+		t.Fatal("removed file is still open")
+	}
+	if _, _, err := p.acquire("a", false); err == nil {
+		t.Fatal("expected removed file to be gone")
+	}
+}
+
+func TestBboltPoolCloseWaitsForRelease(t *testing.T) {
+	p := newBboltPool(t.TempDir(), 2)
+
+	_, release, err := p.acquire("a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, releaseB, err := p.acquire("b", true); err != nil {
+		t.Fatal(err)
+	} else {
+		releaseB()
+	}
+	closed := make(chan error, 1)
+	go func() {
+		closed <- p.close()
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("close returned while a file was in use: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if len(p.handles) != 0 {
+		t.Fatalf("got %d open files after close", len(p.handles))
+	}
+	if _, _, err := p.acquire("a", true); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("got %v, want errPoolClosed", err)
+	}
+}
+
+func TestBboltPoolConcurrentAcquireAndRemove(t *testing.T) {
+	p := newBboltPool(t.TempDir(), 2)
+	defer p.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				filename := fmt.Sprintf("f%d", (i+j)%4)
+				if j%5 == 0 {
+					err := p.remove(filename, func(filePath string) error {
+						// File phải đã được đóng khi fn chạy
+						if _, ok := p.handles[filename]; ok {
+							return fmt.Errorf("%s is still open", filename)
+						}
+						if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+							return err
+						}
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+					continue
+				}
+				db, release, err := p.acquire(filename, true)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if err := db.View(func(tx *bbolt.Tx) error { return nil }); err != nil {
+					t.Error(err)
+				}
+				release()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(p.handles) > 2 {
+		t.Fatalf("got %d open files, want at most 2", len(p.handles))
+	}
+}
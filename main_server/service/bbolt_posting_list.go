@@ -0,0 +1,464 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// Mỗi value của index có một posting list là các key của document có value đó.
+// Posting list được lưu theo dạng mỗi cặp (value, key) là một entry trong bucket "entries":
+//
+//	escape(value) + 0x00 0x00 + key -> rỗng
+//
+// với escape thay mỗi byte 0x00 trong value bằng 0x00 0xFF, nên dấu phân cách 0x00 0x00 không xuất hiện trong value
+// và các entry được sắp xếp theo value rồi theo key. Thêm và xóa một key là O(log n), đọc một posting list là
+// duyệt các entry có cùng prefix. Bucket "counts" lưu số key của từng value (uint64 big-endian) để biết value
+// có tồn tại không và cập nhật thống kê mà không cần đọc cả posting list. Key trong "counts" là value có thêm
+// một byte prefix, vì value có thể rỗng (chuỗi rỗng với index dạng cũ) mà bbolt không cho phép key rỗng.
+//
+// File index cũ lưu mỗi value là một node trong bucket "default" với giá trị là mảng JSON các key,
+// và được chuyển sang dạng entry khi file được dùng lần đầu (xem migratePostingLists)
+var (
+	entryBucket      = []byte("entries")
+	countBucket      = []byte("counts")
+	legacyNodeBucket = []byte("default")
+	entrySeparator   = []byte{0x00, 0x00}
+	countKeyPrefix   = []byte{'v'}
+)
+
+// escapeEntryValue escape byte 0x00 trong value, giữ nguyên thứ tự giữa các value và quan hệ prefix
+func escapeEntryValue(value []byte) []byte {
+	escaped := make([]byte, 0, len(value)+2)
+	for _, b := range value {
+		escaped = append(escaped, b)
+		if b == 0x00 {
+			escaped = append(escaped, 0xFF)
+		}
+	}
+	return escaped
+}
+
+// entryKey tạo key của entry (value, key) trong bucket "entries"
+func entryKey(value []byte, key string) []byte {
+	return append(append(escapeEntryValue(value), entrySeparator...), key...)
+}
+
+// entryPrefix là prefix chung của các entry có đúng value
+func entryPrefix(value []byte) []byte {
+	return append(escapeEntryValue(value), entrySeparator...)
+}
+
+// decodeEntryKey tách key của entry thành value và key của document
+func decodeEntryKey(k []byte) ([]byte, string, error) {
+	value := make([]byte, 0, len(k))
+	for i := 0; i < len(k); i++ {
+		if k[i] != 0x00 {
+			value = append(value, k[i])
+			continue
+		}
+		if i+1 >= len(k) {
+			break
+		}
+		if k[i+1] == 0x00 {
+			return value, string(k[i+2:]), nil
+		}
+		value = append(value, 0x00)
+		i++
+	}
+	return nil, "", fmt.Errorf("invalid posting list entry %q", k)
+}
+
+// countKey tạo key của số đếm của value trong bucket "counts"
+func countKey(value []byte) []byte {
+	return append(append([]byte{}, countKeyPrefix...), value...)
+}
+
+// countKeyValue lấy value từ key trong bucket "counts"
+func countKeyValue(k []byte) []byte {
+	return k[len(countKeyPrefix):]
+}
+
+func encodeCount(count int64) []byte {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(count))
+	return raw
+}
+
+func entryCount(b *bbolt.Bucket, value []byte) int64 {
+	raw := b.Get(countKey(value))
+	if len(raw) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(raw))
+}
+
+// indexDB trả về kết nối tới file index và hàm release phải được gọi khi thao tác kết thúc,
+// chuyển file sang dạng entry nếu file còn dạng node cũ
+func (bs *BboltService) indexDB(filename string) (*bbolt.DB, func(), error) {
+	db, release, err := bs.pool.acquire(filename, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := bs.migrate(filename, db); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return db, release, nil
+}
+
+// migrate chuyển file index sang dạng entry nếu file còn dạng node cũ, mỗi file chỉ được kiểm tra một lần
+func (bs *BboltService) migrate(filename string, db *bbolt.DB) error {
+	if _, migrated := bs.migrated.Load(filename); migrated {
+		return nil
+	}
+
+	var legacy bool
+	err := db.View(func(tx *bbolt.Tx) error {
+		legacy = tx.Bucket(legacyNodeBucket) != nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if legacy {
+		start := time.Now()
+		var nodes int
+		err = db.Update(func(tx *bbolt.Tx) error {
+			var err error
+			nodes, err = migratePostingLists(tx)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate posting lists of %s: %v", filename, err)
+		}
+		log.Printf("Migrated %d index nodes of %s to posting list entries in %s", nodes, filename, time.Since(start))
+	}
+	bs.migrated.Store(filename, true)
+	return nil
+}
+
+// migrateAll chuyển các file index còn dạng node cũ sang dạng entry, được chạy nền khi khởi động
+// Trong lúc chạy, file chưa được chuyển vẫn được chuyển khi được dùng lần đầu.
+// Mỗi file được mở qua pool rồi trả lại ngay, nên số file mở không vượt giới hạn của pool
+func (bs *BboltService) migrateAll() {
+	filenames, err := bs.pool.files()
+	if err != nil {
+		log.Printf("Failed to list index files: %v", err)
+		return
+	}
+	for _, filename := range filenames {
+		if _, migrated := bs.migrated.Load(filename); migrated {
+			continue
+		}
+		_, release, err := bs.indexDB(filename)
+		if errors.Is(err, errPoolClosed) {
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		release()
+	}
+}
+
+// migratePostingLists chuyển các node trong bucket "default" sang các entry trong cùng transaction,
+// trả về số node đã chuyển. Thống kê của index không đổi vì tập (value, key) không đổi
+func migratePostingLists(tx *bbolt.Tx) (int, error) {
+	legacy := tx.Bucket(legacyNodeBucket)
+	if legacy == nil {
+		return 0, nil
+	}
+	entries, err := tx.CreateBucketIfNotExists(entryBucket)
+	if err != nil {
+		return 0, err
+	}
+	counts, err := tx.CreateBucketIfNotExists(countBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := 0
+	err = legacy.ForEach(func(value, raw []byte) error {
+		var keys []string
+		if err := json.Unmarshal(raw, &keys); err != nil {
+			return fmt.Errorf("failed to unmarshal value as []string: %w", err)
+		}
+		count := entryCount(counts, value)
+		for _, key := range keys {
+			k := entryKey(value, key)
+			if entries.Get(k) != nil {
+				continue
+			}
+			if err := entries.Put(k, []byte{}); err != nil {
+				return err
+			}
+			count++
+		}
+		nodes++
+		if count == 0 {
+			return nil
+		}
+		return counts.Put(countKey(value), encodeCount(count))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nodes, tx.DeleteBucket(legacyNodeBucket)
+}
+
+// createPostingBuckets tạo các bucket của posting list nếu chưa có
+func createPostingBuckets(tx *bbolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(entryBucket); err != nil {
+		return err
+	}
+	_, err := tx.CreateBucketIfNotExists(countBucket)
+	return err
+}
+
+// AddEntry thêm key vào posting list của value, thống kê của index được cập nhật trong cùng transaction
+func (bs *BboltService) AddEntry(index *models.Index, value []byte, key string) error {
+	return bs.updateEntry(bs.GetFileNameFromIndex(index), value, key, true)
+}
+
+// RemoveEntry xóa key khỏi posting list của value, value không còn key nào sẽ không còn trong index
+func (bs *BboltService) RemoveEntry(index *models.Index, value []byte, key string) error {
+	return bs.updateEntry(bs.GetFileNameFromIndex(index), value, key, false)
+}
+
+func (bs *BboltService) updateEntry(filename string, value []byte, key string, add bool) error {
+	db, release, err := bs.indexDB(filename)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		if err := createPostingBuckets(tx); err != nil {
+			return err
+		}
+		entries, counts := tx.Bucket(entryBucket), tx.Bucket(countBucket)
+
+		k := entryKey(value, key)
+		exists := entries.Get(k) != nil
+		if exists == add {
+			// Key đã có (hoặc đã không có) trong posting list, không cần ghi lại
+			return nil
+		}
+
+		stats, err := loadStats(tx)
+		if err != nil {
+			return err
+		}
+
+		before := entryCount(counts, value)
+		after := before + 1
+		if add {
+			err = entries.Put(k, []byte{})
+		} else {
+			after = before - 1
+			err = entries.Delete(k)
+		}
+		if err != nil {
+			return err
+		}
+		if after <= 0 {
+			err = counts.Delete(countKey(value))
+		} else {
+			err = counts.Put(countKey(value), encodeCount(after))
+		}
+		if err != nil {
+			return err
+		}
+
+		applyNodeChange(stats, value, before, after)
+		now := time.Now()
+		stats.LastUpdatedAt = &now
+		return saveStats(tx, stats)
+	})
+}
+
+// CountEntries trả về số key trong posting list của value, 0 nếu value không có trong index
+func (bs *BboltService) CountEntries(index *models.Index, value []byte) (int64, error) {
+	db, release, err := bs.indexDB(bs.GetFileNameFromIndex(index))
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var count int64
+	err = db.View(func(tx *bbolt.Tx) error {
+		if counts := tx.Bucket(countBucket); counts != nil {
+			count = entryCount(counts, value)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// HasEntry kiểm tra key có trong posting list của value không
+func (bs *BboltService) HasEntry(index *models.Index, value []byte, key string) (bool, error) {
+	db, release, err := bs.indexDB(bs.GetFileNameFromIndex(index))
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	var exists bool
+	err = db.View(func(tx *bbolt.Tx) error {
+		if entries := tx.Bucket(entryBucket); entries != nil {
+			exists = entries.Get(entryKey(value, key)) != nil
+		}
+		return nil
+	})
+	return exists, err
+}
+
+// ScanValue duyệt các key trong posting list của value theo thứ tự, fn trả về false để dừng duyệt
+func (bs *BboltService) ScanValue(index *models.Index, value []byte, fn func(key string) (bool, error)) error {
+	db, release, err := bs.indexDB(bs.GetFileNameFromIndex(index))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	prefix := entryPrefix(value)
+	return db.View(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(entryBucket)
+		if entries == nil {
+			return nil
+		}
+		c := entries.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			next, err := fn(string(k[len(prefix):]))
+			if err != nil || !next {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ScanEntries duyệt các entry theo thứ tự value rồi key, bắt đầu từ value start và chỉ trong các value có prefix
+// fn trả về false để dừng duyệt
+func (bs *BboltService) ScanEntries(index *models.Index, start, prefix []byte, fn func(value []byte, key string) (bool, error)) error {
+	db, release, err := bs.indexDB(bs.GetFileNameFromIndex(index))
+	if err != nil {
+		return err
+	}
+	defer release()
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	escapedPrefix := escapeEntryValue(prefix)
+
+	return db.View(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(entryBucket)
+		if entries == nil {
+			return nil
+		}
+		c := entries.Cursor()
+		for k, _ := c.Seek(escapeEntryValue(start)); k != nil && bytes.HasPrefix(k, escapedPrefix); k, _ = c.Next() {
+			value, key, err := decodeEntryKey(k)
+			if err != nil {
+				return err
+			}
+			next, err := fn(value, key)
+			if err != nil || !next {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CheckCounts so sánh số key trong bucket "counts" với số entry thực tế của từng value, trả về số value bị lệch
+// Nếu repair = true, bucket "counts" được ghi lại theo các entry và các số đếm trong thống kê của index được tính lại
+func (bs *BboltService) CheckCounts(index *models.Index, repair bool) (int64, error) {
+	db, release, err := bs.indexDB(bs.GetFileNameFromIndex(index))
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var mismatches int64
+	check := func(tx *bbolt.Tx) error {
+		actual := make(map[string]int64)
+		if entries := tx.Bucket(entryBucket); entries != nil {
+			err := entries.ForEach(func(k, _ []byte) error {
+				value, _, err := decodeEntryKey(k)
+				if err != nil {
+					return err
+				}
+				actual[string(value)]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		stored := make(map[string]int64)
+		if counts := tx.Bucket(countBucket); counts != nil {
+			err := counts.ForEach(func(k, _ []byte) error {
+				value := countKeyValue(k)
+				stored[string(value)] = entryCount(counts, value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for value, count := range stored {
+			if actual[value] != count {
+				mismatches++
+			}
+		}
+		for value := range actual {
+			if _, ok := stored[value]; !ok {
+				mismatches++
+			}
+		}
+		if !repair || mismatches == 0 {
+			return nil
+		}
+
+		if tx.Bucket(countBucket) != nil {
+			if err := tx.DeleteBucket(countBucket); err != nil {
+				return err
+			}
+		}
+		counts, err := tx.CreateBucket(countBucket)
+		if err != nil {
+			return err
+		}
+		stats, err := loadStats(tx)
+		if err != nil {
+			return err
+		}
+		stats.EntryCount, stats.DistinctValues, stats.TopNodes = 0, 0, nil
+		for value, count := range actual {
+			if err := counts.Put(countKey([]byte(value)), encodeCount(count)); err != nil {
+				return err
+			}
+			applyNodeChange(stats, []byte(value), 0, count)
+		}
+		return saveStats(tx, stats)
+	}
+
+	if repair {
+		err = db.Update(check)
+	} else {
+		err = db.View(check)
+	}
+	return mismatches, err
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// legacyNodes là posting list của file index dạng node cũ, gồm các value có byte 0x00 cần được escape
+var legacyNodes = map[string][]string{
+	"a":      {"k1", "k2"},
+	"a\x00b": {"k3"},
+	"\x00":   {"k4", "k5"},
+	"b":      {},
+}
+
+// newLegacyIndexService tạo file index dạng node cũ cho các index rồi trả về BboltService chưa chuyển file nào
+// migrateAll không được chạy nền để test tự gọi
+func newLegacyIndexService(t *testing.T, indexes ...*models.Index) *BboltService {
+	t.Helper()
+	cfg := &config.Config{DataFolderDefault: t.TempDir()}
+	bs, err := NewBboltService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := path.Join(cfg.DataFolderDefault, "index")
+	for _, index := range indexes {
+		db, err := bbolt.Open(path.Join(dir, bs.GetFileNameFromIndex(index)), 0666, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Update(func(tx *bbolt.Tx) error {
+			nodes, err := tx.CreateBucket(legacyNodeBucket)
+			if err != nil {
+				return err
+			}
+			for value, keys := range legacyNodes {
+				raw, err := json.Marshal(keys)
+				if err != nil {
+					return err
+				}
+				if err := nodes.Put([]byte(value), raw); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &BboltService{pool: newBboltPool(dir, 2), cfg: cfg}
+}
+
+// assertMigrated kiểm tra posting list, số đếm và thống kê của index sau khi chuyển, và bucket cũ đã bị xóa
+func assertMigrated(t *testing.T, bs *BboltService, index *models.Index) {
+	t.Helper()
+	for value, want := range legacyNodes {
+		var keys []string
+		err := bs.ScanValue(index, []byte(value), func(key string) (bool, error) {
+			keys = append(keys, key)
+			return true, nil
+		})
+		if err != nil || len(keys) != len(want) || (len(want) > 0 && !reflect.DeepEqual(keys, want)) {
+			t.Fatalf("value %q: got keys %v (%v), want %v", value, keys, err, want)
+		}
+		if count, err := bs.CountEntries(index, []byte(value)); err != nil || count != int64(len(want)) {
+			t.Fatalf("value %q: got count %d (%v), want %d", value, count, err, len(want))
+		}
+	}
+
+	var values []string
+	err := bs.ScanEntries(index, nil, nil, func(value []byte, key string) (bool, error) {
+		values = append(values, string(value)+"/"+key)
+		return true, nil
+	})
+	want := []string{"\x00/k4", "\x00/k5", "a/k1", "a/k2", "a\x00b/k3"}
+	if err != nil || !reflect.DeepEqual(values, want) {
+		t.Fatalf("got entries %q (%v), want %q", values, err, want)
+	}
+	if mismatches, err := bs.CheckCounts(index, false); err != nil || mismatches != 0 {
+		t.Fatalf("got %d count mismatches (%v)", mismatches, err)
+	}
+	stats, err := bs.GetIndexStats(index)
+	if err != nil || stats.EntryCount != 5 || stats.DistinctValues != 3 {
+		t.Fatalf("got stats %+v (%v), want 5 entries of 3 values", stats, err)
+	}
+
+	db, release, err := bs.pool.acquire(bs.GetFileNameFromIndex(index), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	err = db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(legacyNodeBucket) != nil {
+			t.Fatal("legacy node bucket still exists")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyIndexIsMigratedOnFirstUse(t *testing.T) {
+	index := &models.Index{ID: 1, CollectionID: 1}
+	bs := newLegacyIndexService(t, index)
+	defer bs.Close()
+
+	assertMigrated(t, bs, index)
+}
+
+func TestMigrateAll(t *testing.T) {
+	indexes := []*models.Index{{ID: 1, CollectionID: 1}, {ID: 2, CollectionID: 1}, {ID: 3, CollectionID: 2}}
+	bs := newLegacyIndexService(t, indexes...)
+	defer bs.Close()
+
+	bs.migrateAll()
+	for _, index := range indexes {
+		if _, migrated := bs.migrated.Load(bs.GetFileNameFromIndex(index)); !migrated {
+			t.Fatalf("index %d was not migrated", index.ID)
+		}
+		assertMigrated(t, bs, index)
+	}
+	// migrateAll mở file qua pool nên số file mở không vượt giới hạn
+	if len(bs.pool.handles) > 2 {
+		t.Fatalf("got %d open files, want at most 2", len(bs.pool.handles))
+	}
+}
+
+func TestEmptyValueEntries(t *testing.T) {
+	index := &models.Index{ID: 1, CollectionID: 1}
+	bs := newLegacyIndexService(t, index)
+	defer bs.Close()
+
+	// Chuỗi rỗng với index dạng cũ là value rỗng
+	for _, key := range []string{"k6", "k7"} {
+		if err := bs.AddEntry(index, []byte(""), key); err != nil {
+			t.Fatalf("failed to add empty value: %v", err)
+		}
+	}
+	if err := bs.RemoveEntry(index, []byte(""), "k6"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := bs.CountEntries(index, []byte("")); err != nil || count != 1 {
+		t.Fatalf("got count %d (%v), want 1", count, err)
+	}
+	if exists, err := bs.HasEntry(index, []byte(""), "k7"); err != nil || !exists {
+		t.Fatalf("got %v (%v), want k7 in posting list of empty value", exists, err)
+	}
+	if mismatches, err := bs.CheckCounts(index, false); err != nil || mismatches != 0 {
+		t.Fatalf("got %d count mismatches (%v)", mismatches, err)
+	}
+	stats, err := bs.GetIndexStats(index)
+	if err != nil || stats.EntryCount != 6 || stats.DistinctValues != 4 {
+		t.Fatalf("got stats %+v (%v), want 6 entries of 4 values", stats, err)
+	}
+}
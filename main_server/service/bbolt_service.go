@@ -3,25 +3,28 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path"
-	"path/filepath"
+	"sync"
+	"time"
 
 	"go.etcd.io/bbolt"
 
-	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/dehuy69/mydp/config"
 	"github.com/dehuy69/mydp/main_server/models"
 )
 
 // BboltService struct đại diện cho một dịch vụ lưu trữ dữ liệu sử dụng bbolt
-// BboltService sẽ lưu trữ một map các kết nối đến các cơ sở dữ liệu bbolt
+// Các file index được mở khi dùng lần đầu qua một pool giới hạn số file mở cùng lúc (xem bbolt_pool.go)
 // Tên file có kiểu collection_id_<collection_id>_index_id_<index_id>.db
-// Bucket mặc định là "default"
+// Posting list của các value được lưu trong bucket "entries" và "counts" (xem bbolt_posting_list.go)
 
 type BboltService struct {
-	DbConnection map[string]*bbolt.DB
-	cfg          *config.Config
+	pool     *bboltPool
+	cfg      *config.Config
+	migrated sync.Map // Các file index đã được kiểm tra và chuyển sang dạng entry
+	usage    sync.Map // Tên file index -> *indexUsage, số lần dùng chưa được ghi vào file
 }
 
 func NewBboltService(cfg *config.Config) (*BboltService, error) {
@@ -34,62 +37,101 @@ func NewBboltService(cfg *config.Config) (*BboltService, error) {
 		return nil, err
 	}
 
-	DbConnection := make(map[string]*bbolt.DB)
+	bs := &BboltService{pool: newBboltPool(pathToDB, cfg.BboltMaxOpenFiles), cfg: cfg}
 
-	// Walk through the files in the folder
-	err = filepath.Walk(pathToDB, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// Chuyển các file index cũ sang dạng entry trong nền, server vẫn phục vụ trong lúc chuyển
+	go bs.migrateAll()
 
-		// Check if it's a file (not a directory)
-		if !info.IsDir() {
-			// Extract the file name from the file path
-			fileName := filepath.Base(filePath)
-
-			// Open bbolt database
-			db, err := bbolt.Open(filePath, 0666, nil)
-			if err != nil {
-				return err
-			}
+	return bs, nil
+}
 
-			// Save the database connection using fileName as the key
-			DbConnection[fileName] = db
-		}
-		return nil
-	})
+// CreateIndex tạo một cơ sở dữ liệu mới với tên file là collection_id_<collection_id>_table_id_<table_id>.db
+func (bs *BboltService) CreateIndex(index *models.Index) error {
+	// Lấy tên file từ models.Index
+	fileName := bs.GetFileNameFromIndex(index)
 
+	// Tạo một cơ sở dữ liệu mới
+	db, release, err := bs.pool.acquire(fileName, true)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer release()
 
-	return &BboltService{DbConnection: DbConnection, cfg: cfg}, nil
+	// Tạo các bucket của posting list
+	err = db.Update(createPostingBuckets)
+	if err != nil {
+		return err
+	}
+	bs.migrated.Store(fileName, true)
+	return nil
 }
 
-// CreateIndex tạo một cơ sở dữ liệu mới với tên file là collection_id_<collection_id>_table_id_<table_id>.db
-func (bs *BboltService) CreateIndex(index *models.Index) error {
-	// Lấy tên file từ models.Index
+// DeleteIndex đóng kết nối và xóa file bbolt của index
+// Các thao tác đang dùng file được chờ kết thúc trước khi xóa
+func (bs *BboltService) DeleteIndex(index *models.Index) error {
 	fileName := bs.GetFileNameFromIndex(index)
 
-	// Tạo một cơ sở dữ liệu mới
-	pathToDB := path.Join(bs.cfg.DataFolderDefault, "index", fileName)
-	db, err := bbolt.Open(pathToDB, 0666, nil)
+	return bs.pool.remove(fileName, func(filePath string) error {
+		bs.migrated.Delete(fileName)
+		bs.usage.Delete(fileName)
+		err := os.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// ClearIndex xóa toàn bộ posting list của index nhưng giữ lại file bbolt
+// Thống kê được đặt lại, chỉ giữ số lần index được query dùng
+func (bs *BboltService) ClearIndex(index *models.Index) error {
+	fileName := bs.GetFileNameFromIndex(index)
+	db, release, err := bs.pool.acquire(fileName, false)
 	if err != nil {
 		return err
 	}
-	// Tạo bucket mặc định
+	defer release()
+
 	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("default"))
-		return err
+		stats, err := loadStats(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range [][]byte{legacyNodeBucket, entryBucket, countBucket} {
+			if tx.Bucket(bucket) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+		}
+		if err := createPostingBuckets(tx); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return saveStats(tx, &models.IndexStats{
+			LastUpdatedAt: &now,
+			QueryCount:    stats.QueryCount,
+			LastUsedAt:    stats.LastUsedAt,
+		})
 	})
 	if err != nil {
 		return err
 	}
-	// Lưu trữ kết nối đến cơ sở dữ liệu
-	bs.DbConnection[fileName] = db
+	bs.migrated.Store(fileName, true)
 	return nil
 }
 
+// Close ghi số lần dùng của các index, chờ các thao tác đang chạy kết thúc rồi đóng tất cả kết nối tới các file index
+func (bs *BboltService) Close() error {
+	if err := bs.FlushIndexUsage(); err != nil {
+		log.Printf("Failed to write index usage: %v", err)
+	}
+	return bs.pool.close()
+}
+
 // Hàm lấy filename từ models.Index
 func (bs *BboltService) GetFileNameFromIndex(index *models.Index) string {
 	return fmt.Sprintf("collection_id_%d_index_id_%d.db", index.CollectionID, index.ID)
@@ -97,12 +139,13 @@ func (bs *BboltService) GetFileNameFromIndex(index *models.Index) string {
 
 // Set dữ liệu vào bbolt database
 func (bs *BboltService) Set(filename string, bucket, key, value []byte) error {
-	db, ok := bs.DbConnection[filename]
-	if !ok {
-		return fmt.Errorf("database %s not found", filename)
+	db, release, err := bs.pool.acquire(filename, false)
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	err := db.Update(func(tx *bbolt.Tx) error {
+	err = db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists(bucket)
 		if err != nil {
 			return err
@@ -114,19 +157,21 @@ func (bs *BboltService) Set(filename string, bucket, key, value []byte) error {
 
 // Get dữ liệu từ bbolt database
 func (bs *BboltService) Get(filename string, bucket, key []byte) ([]byte, error) {
-	db, ok := bs.DbConnection[filename]
-	if !ok {
-		return nil, fmt.Errorf("database %s not found", filename)
+	db, release, err := bs.pool.acquire(filename, false)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+
 	var value []byte
-	err := db.View(func(tx *bbolt.Tx) error {
+	err = db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucket)
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
 		val := b.Get(key)
 		if val == nil {
-			return fmt.Errorf("key %s not found in bucket %s", key, bucket)
+			return fmt.Errorf("key %s not found in bucket %s: %w", key, bucket, ErrKeyNotFound)
 		}
 		value = append([]byte{}, val...) // Sao chép giá trị để tránh vấn đề về con trỏ
 		return nil
@@ -136,11 +181,13 @@ func (bs *BboltService) Get(filename string, bucket, key []byte) ([]byte, error)
 
 // Delete dữ liệu từ bbolt database
 func (bs *BboltService) Delete(filename string, bucket, key []byte) error {
-	db, ok := bs.DbConnection[filename]
-	if !ok {
-		return fmt.Errorf("database %s not found", filename)
+	db, release, err := bs.pool.acquire(filename, false)
+	if err != nil {
+		return err
 	}
-	err := db.Update(func(tx *bbolt.Tx) error {
+	defer release()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucket)
 		if b == nil {
 			return nil
@@ -150,53 +197,25 @@ func (bs *BboltService) Delete(filename string, bucket, key []byte) error {
 	return err
 }
 
-// GetAndParseAsNode lấy dữ liệu từ bbolt database và parse thành models.Node
-func (bs *BboltService) GetAndParseAsNode(filename string, bucket, key []byte) (*models.Node, error) {
-	// Lấy dữ liệu từ database
-	value, err := bs.Get(filename, bucket, key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse giá trị từ database thành slice []string trước
-	var keysAsSlice []string
-	err = json.Unmarshal(value, &keysAsSlice)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal value as []string: %w", err)
-	}
-
-	// Chuyển slice []string thành mapset.Set[string]
-	keysAsSet := mapset.NewSet[string]()
-	for _, key := range keysAsSlice {
-		keysAsSet.Add(key)
-	}
-
-	// Trả về Node với key và set đã được parse
-	return &models.Node{
-		Value: key,       // key là giá trị của node
-		Keys:  keysAsSet, // Keys là set của các chuỗi đã được chuyển đổi
-	}, nil
-}
-
-// SetNode lưu models.Node vào bbolt database
-func (bs *BboltService) SetNode(filename string, bucket []byte, node *models.Node) error {
-	// Parse models.Node thành JSON
-	value, err := json.Marshal(node.Keys)
-	if err != nil {
-		return err
-	}
-	return bs.Set(filename, bucket, node.Value, value)
-}
-
 // GetAllBbolt lấy tất cả dữ liệu từ tất cả các bucket trong tất cả các cơ sở dữ liệu
 func (bs *BboltService) GetAllBbolt() ([]map[string]interface{}, error) {
 	// Lưu trữ tất cả dữ liệu từ các bucket
 	var data []map[string]interface{}
 
-	// Duyệt qua tất cả các cơ sở dữ liệu
-	for _, db := range bs.DbConnection {
+	filenames, err := bs.pool.files()
+	if err != nil {
+		return nil, err
+	}
+
+	// Duyệt qua tất cả các cơ sở dữ liệu, mỗi file được trả lại pool ngay sau khi đọc
+	for _, filename := range filenames {
+		db, release, err := bs.pool.acquire(filename, false)
+		if err != nil {
+			return nil, err
+		}
+
 		// Duyệt qua tất cả các bucket trong cơ sở dữ liệu
-		err := db.View(func(tx *bbolt.Tx) error {
+		err = db.View(func(tx *bbolt.Tx) error {
 			// Duyệt qua tất cả các bucket cấp cao nhất
 			return tx.ForEach(func(bucketName []byte, b *bbolt.Bucket) error {
 				fmt.Printf("Bucket: %s\n", bucketName)
@@ -227,6 +246,7 @@ func (bs *BboltService) GetAllBbolt() ([]map[string]interface{}, error) {
 				return nil
 			})
 		})
+		release()
 
 		if err != nil {
 			return nil, err
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// MemoryDocumentStore là DocumentStore lưu document trong bộ nhớ, dùng cho test và workspace tạm thời
+// Dữ liệu mất khi server khởi động lại, số document và dung lượng trong catalog được tính lại khi gọi stats với exact
+type MemoryDocumentStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func NewMemoryDocumentStore() *MemoryDocumentStore {
+	return &MemoryDocumentStore{data: make(map[string][]byte)}
+}
+
+func (ms *MemoryDocumentStore) Set(key, value []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (ms *MemoryDocumentStore) Get(key []byte) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	value, ok := ms.data[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (ms *MemoryDocumentStore) Delete(key []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.data, string(key))
+	return nil
+}
+
+func (ms *MemoryDocumentStore) DropPrefix(prefix []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for key := range ms.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			delete(ms.data, key)
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryDocumentStore) PrefixStats(prefix []byte) (int64, int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var count, size int64
+	for key, value := range ms.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			count++
+			size += int64(len(value))
+		}
+	}
+	return count, size, nil
+}
+
+// ScanPrefix duyệt trên bản chụp các key tại thời điểm gọi, nên fn có thể ghi vào store mà không bị deadlock
+func (ms *MemoryDocumentStore) ScanPrefix(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	ms.mu.RLock()
+	keys := make([]string, 0)
+	values := make(map[string][]byte)
+	for key, value := range ms.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+			values[key] = value // Value không bị sửa tại chỗ, Set luôn thay bằng slice mới
+		}
+	}
+	ms.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		next, err := fn([]byte(key), values[key])
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryDocumentStore) WriteBatch(writes []DocumentWrite) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, write := range writes {
+		if write.Delete {
+			delete(ms.data, string(write.Key))
+		} else {
+			ms.data[string(write.Key)] = append([]byte{}, write.Value...)
+		}
+	}
+	return nil
+}
+
+// memoryIndex là posting list và thống kê của một index trong bộ nhớ
+type memoryIndex struct {
+	postings map[string]map[string]struct{} // value -> tập key
+	stats    models.IndexStats
+}
+
+// MemoryIndexStore là IndexStore lưu index trong bộ nhớ, dùng cùng MemoryDocumentStore
+// Các lần duyệt sắp xếp lại value và key mỗi lần gọi, phù hợp với lượng dữ liệu nhỏ
+type MemoryIndexStore struct {
+	mu      sync.Mutex
+	indexes map[int]*memoryIndex
+}
+
+func NewMemoryIndexStore() *MemoryIndexStore {
+	return &MemoryIndexStore{indexes: make(map[int]*memoryIndex)}
+}
+
+func (ms *MemoryIndexStore) CreateIndex(index *models.Index) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	_, err := ms.get(index)
+	return err
+}
+
+func (ms *MemoryIndexStore) DeleteIndex(index *models.Index) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.indexes, index.ID)
+	return nil
+}
+
+func (ms *MemoryIndexStore) ClearIndex(index *models.Index) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	mi.postings = make(map[string]map[string]struct{})
+	mi.stats = models.IndexStats{LastUpdatedAt: &now, QueryCount: mi.stats.QueryCount, LastUsedAt: mi.stats.LastUsedAt}
+	return nil
+}
+
+// get trả về index trong bộ nhớ, phải được gọi khi đang giữ ms.mu
+// Index có trong catalog nhưng chưa có trong bộ nhớ (sau khi server khởi động lại) được tạo rỗng,
+// vì document của collection cũng đã mất
+func (ms *MemoryIndexStore) get(index *models.Index) (*memoryIndex, error) {
+	if index.ID == 0 {
+		return nil, fmt.Errorf("index has no ID")
+	}
+	mi, ok := ms.indexes[index.ID]
+	if !ok {
+		mi = &memoryIndex{postings: make(map[string]map[string]struct{})}
+		ms.indexes[index.ID] = mi
+	}
+	return mi, nil
+}
+
+func (ms *MemoryIndexStore) AddEntry(index *models.Index, value []byte, key string) error {
+	return ms.updateEntry(index, value, key, true)
+}
+
+func (ms *MemoryIndexStore) RemoveEntry(index *models.Index, value []byte, key string) error {
+	return ms.updateEntry(index, value, key, false)
+}
+
+func (ms *MemoryIndexStore) updateEntry(index *models.Index, value []byte, key string, add bool) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return err
+	}
+
+	keys := mi.postings[string(value)]
+	if _, exists := keys[key]; exists == add {
+		return nil
+	}
+	before := int64(len(keys))
+	if add {
+		if keys == nil {
+			keys = make(map[string]struct{})
+			mi.postings[string(value)] = keys
+		}
+		keys[key] = struct{}{}
+	} else {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(mi.postings, string(value))
+		}
+	}
+
+	applyNodeChange(&mi.stats, value, before, int64(len(keys)))
+	now := time.Now()
+	mi.stats.LastUpdatedAt = &now
+	return nil
+}
+
+func (ms *MemoryIndexStore) CountEntries(index *models.Index, value []byte) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(mi.postings[string(value)])), nil
+}
+
+func (ms *MemoryIndexStore) HasEntry(index *models.Index, value []byte, key string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return false, err
+	}
+	_, ok := mi.postings[string(value)][key]
+	return ok, nil
+}
+
+func (ms *MemoryIndexStore) ScanValue(index *models.Index, value []byte, fn func(key string) (bool, error)) error {
+	ms.mu.Lock()
+	mi, err := ms.get(index)
+	if err != nil {
+		ms.mu.Unlock()
+		return err
+	}
+	keys := sortedKeys(mi.postings[string(value)])
+	ms.mu.Unlock()
+
+	for _, key := range keys {
+		next, err := fn(key)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanEntries duyệt trên bản chụp các entry tại thời điểm gọi, cùng thứ tự với BboltService.ScanEntries
+func (ms *MemoryIndexStore) ScanEntries(index *models.Index, start, prefix []byte, fn func(value []byte, key string) (bool, error)) error {
+	ms.mu.Lock()
+	mi, err := ms.get(index)
+	if err != nil {
+		ms.mu.Unlock()
+		return err
+	}
+	values := make([]string, 0)
+	postings := make(map[string][]string)
+	for value, keys := range mi.postings {
+		if bytes.HasPrefix([]byte(value), prefix) && bytes.Compare([]byte(value), start) >= 0 {
+			values = append(values, value)
+			postings[value] = sortedKeys(keys)
+		}
+	}
+	ms.mu.Unlock()
+
+	sort.Strings(values)
+	for _, value := range values {
+		for _, key := range postings[value] {
+			next, err := fn([]byte(value), key)
+			if err != nil || !next {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckCounts luôn trả về 0 vì số key của value được tính trực tiếp từ posting list
+func (ms *MemoryIndexStore) CheckCounts(index *models.Index, repair bool) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	_, err := ms.get(index)
+	return 0, err
+}
+
+func (ms *MemoryIndexStore) GetIndexStats(index *models.Index) (*models.IndexStats, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return nil, err
+	}
+	stats := mi.stats
+	stats.TopNodes = append([]models.NodeStat{}, mi.stats.TopNodes...)
+	return &stats, nil
+}
+
+func (ms *MemoryIndexStore) RecordIndexBuild(index *models.Index, duration time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	mi.stats.BuildDurationMs = duration.Milliseconds()
+	mi.stats.BuiltAt = &now
+	return nil
+}
+
+func (ms *MemoryIndexStore) RecordIndexUsage(index *models.Index) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	mi, err := ms.get(index)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	mi.stats.QueryCount++
+	mi.stats.LastUsedAt = &now
+	return nil
+}
+
+func sortedKeys(keys map[string]struct{}) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+func TestMemoryDocumentStore(t *testing.T) {
+	ms := NewMemoryDocumentStore()
+	for key, value := range map[string]string{"1||a": "A", "1||b": "BB", "2||a": "C"} {
+		if err := ms.Set([]byte(key), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ms.Get([]byte("1||c")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	count, size, err := ms.PrefixStats([]byte("1||"))
+	if err != nil || count != 2 || size != 3 {
+		t.Fatalf("got %d documents, %d bytes (%v), want 2, 3", count, size, err)
+	}
+
+	var keys []string
+	err = ms.ScanPrefix([]byte("1||"), func(key, value []byte) (bool, error) {
+		keys = append(keys, string(key))
+		// Ghi trong lúc duyệt không được deadlock
+		return true, ms.Set([]byte("1||z"), value)
+	})
+	if err != nil || !reflect.DeepEqual(keys, []string{"1||a", "1||b"}) {
+		t.Fatalf("got keys %v (%v)", keys, err)
+	}
+
+	if err := ms.DropPrefix([]byte("1||")); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, _ := ms.PrefixStats([]byte("1||")); count != 0 {
+		t.Fatalf("got %d documents after drop", count)
+	}
+	if value, err := ms.Get([]byte("2||a")); err != nil || string(value) != "C" {
+		t.Fatalf("other prefix must be kept, got %q (%v)", value, err)
+	}
+}
+
+func TestMemoryIndexStoreEntries(t *testing.T) {
+	index := &models.Index{ID: 1}
+	tests := []struct {
+		name    string
+		apply   func(ms *MemoryIndexStore) error
+		entries []string // value/key theo thứ tự duyệt
+		counts  map[string]int64
+	}{
+		{
+			name: "add is idempotent",
+			apply: func(ms *MemoryIndexStore) error {
+				for _, key := range []string{"k2", "k1", "k2"} {
+					if err := ms.AddEntry(index, []byte("x"), key); err != nil {
+						return err
+					}
+				}
+				return ms.AddEntry(index, []byte("a"), "k3")
+			},
+			entries: []string{"a/k3", "x/k1", "x/k2"},
+			counts:  map[string]int64{"x": 2, "a": 1},
+		},
+		{
+			name: "remove drops empty values",
+			apply: func(ms *MemoryIndexStore) error {
+				if err := ms.AddEntry(index, []byte("x"), "k1"); err != nil {
+					return err
+				}
+				if err := ms.RemoveEntry(index, []byte("x"), "k1"); err != nil {
+					return err
+				}
+				return ms.RemoveEntry(index, []byte("x"), "k1")
+			},
+			counts: map[string]int64{"x": 0},
+		},
+		{
+			name: "clear",
+			apply: func(ms *MemoryIndexStore) error {
+				if err := ms.AddEntry(index, []byte("x"), "k1"); err != nil {
+					return err
+				}
+				return ms.ClearIndex(index)
+			},
+			counts: map[string]int64{"x": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMemoryIndexStore()
+			if err := ms.CreateIndex(index); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.apply(ms); err != nil {
+				t.Fatal(err)
+			}
+
+			var entries []string
+			err := ms.ScanEntries(index, nil, nil, func(value []byte, key string) (bool, error) {
+				entries = append(entries, string(value)+"/"+key)
+				return true, nil
+			})
+			if err != nil || !reflect.DeepEqual(entries, tt.entries) {
+				t.Fatalf("got entries %v (%v), want %v", entries, err, tt.entries)
+			}
+			for value, want := range tt.counts {
+				if count, err := ms.CountEntries(index, []byte(value)); err != nil || count != want {
+					t.Fatalf("value %s: got %d keys (%v), want %d", value, count, err, want)
+				}
+			}
+			stats, err := ms.GetIndexStats(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.EntryCount != int64(len(tt.entries)) {
+				t.Fatalf("got entry count %d, want %d", stats.EntryCount, len(tt.entries))
+			}
+		})
+	}
+
+	if err := NewMemoryIndexStore().AddEntry(&models.Index{}, []byte("x"), "k1"); err == nil {
+		t.Fatal("index without ID must be rejected")
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// TryLockCompaction đánh dấu table đang được compaction, trả về false nếu table đã đang được compaction
+func (ps *ParquetService) TryLockCompaction(tableID int) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.compacting[tableID] {
+		return false
+	}
+	ps.compacting[tableID] = true
+	return true
+}
+
+// UnlockCompaction bỏ đánh dấu table đang được compaction
+func (ps *ParquetService) UnlockCompaction(tableID int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.compacting, tableID)
+}
+
+// IsCompacting kiểm tra table có đang được compaction không
+func (ps *ParquetService) IsCompacting(tableID int) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.compacting[tableID]
+}
+
+// RewriteFiles đọc toàn bộ các dòng của các tệp trong cùng một phân vùng và ghi lại thành một tệp mới trong phân vùng đó
+// Nếu sortColumn >= 0 (vị trí trong table.Columns), các dòng được sắp xếp tăng dần theo cột đó, null ở cuối.
+// Nếu keep khác nil, chỉ các dòng mà keep trả về true được giữ lại. Các dòng đã bị xóa bởi tệp delete trong files
+// không được ghi lại. Trả về nil nếu không còn dòng nào.
+// Tệp mới chưa được đăng ký vào manifest, người gọi commit tệp hoặc xóa tệp bằng RemoveTableFile nếu commit thất bại
+func (ps *ParquetService) RewriteFiles(table *models.Table, partition string, files []models.TableFile, sortColumn int, keep func(values []interface{}) bool) (*models.TableFile, error) {
+	columns := make([]int, len(table.Columns))
+	for i := range columns {
+		columns[i] = i
+	}
+
+	var rows [][]interface{}
+	_, err := ps.Scan(table, files, columns, nil, func(values []interface{}) error {
+		if keep != nil && !keep(values) {
+			return nil
+		}
+		rows = append(rows, append([]interface{}(nil), values...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	if sortColumn >= 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := rows[i][sortColumn], rows[j][sortColumn]
+			if a == nil || b == nil {
+				return b == nil && a != nil
+			}
+			return compareRaw(a, b) < 0
+		})
+	}
+
+	return ps.writeFile(table, partition, rows)
+}
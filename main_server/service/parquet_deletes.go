@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+// positionDelete là một dòng của tệp delete: vị trí của dòng bị xóa trong tệp dữ liệu
+type positionDelete struct {
+	Pos int64 `parquet:"pos"`
+}
+
+// WriteDeleteFile ghi vị trí các dòng bị xóa của tệp dữ liệu thành một tệp delete trong cùng thư mục phân vùng
+// Tệp mới chưa được đăng ký vào manifest, người gọi commit tệp hoặc xóa tệp bằng RemoveTableFile nếu commit thất bại
+func (ps *ParquetService) WriteDeleteFile(table *models.Table, dataFile *models.TableFile, positions []int64) (*models.TableFile, error) {
+	positions = append([]int64(nil), positions...)
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	rows := make([]positionDelete, len(positions))
+	for i, position := range positions {
+		rows[i] = positionDelete{Pos: position}
+	}
+
+	compression := table.Compression
+	if compression == "" {
+		compression = ps.DefaultCompression()
+	}
+	codec, err := compressionCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(ps.TableDir(table), dataFile.Partition)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("delete-%d-%d.parquet", time.Now().UnixNano(), ps.fileCount.Add(1))
+	tmpPath := path.Join(dir, "."+name+".tmp")
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	writeErr := func() error {
+		writer := parquet.NewGenericWriter[positionDelete](f, parquet.Compression(codec))
+		if _, err := writer.Write(rows); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr == nil {
+		writeErr = os.Rename(tmpPath, path.Join(dir, name))
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write delete file: %v", writeErr)
+	}
+
+	info, err := os.Stat(path.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &models.TableFile{
+		TableID:    table.ID,
+		Path:       path.Join(dataFile.Partition, name),
+		Partition:  dataFile.Partition,
+		RowCount:   int64(len(rows)),
+		ByteSize:   info.Size(),
+		RowGroups:  1,
+		Content:    models.TableFileContentPositionDeletes,
+		DataFileID: dataFile.ID,
+	}, nil
+}
+
+// readDeletes đọc các tệp delete trong files, trả về vị trí các dòng bị xóa theo ID của tệp dữ liệu
+func (ps *ParquetService) readDeletes(table *models.Table, files []models.TableFile) (map[int]map[int64]bool, error) {
+	deleted := make(map[int]map[int64]bool)
+	for i := range files {
+		file := &files[i]
+		if file.Content != models.TableFileContentPositionDeletes {
+			continue
+		}
+		positions, err := ps.readDeleteFile(table, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delete file %s: %w", file.Path, err)
+		}
+		if deleted[file.DataFileID] == nil {
+			deleted[file.DataFileID] = make(map[int64]bool, len(positions))
+		}
+		for _, position := range positions {
+			deleted[file.DataFileID][position] = true
+		}
+	}
+	return deleted, nil
+}
+
+func (ps *ParquetService) readDeleteFile(table *models.Table, file *models.TableFile) ([]int64, error) {
+	f, err := os.Open(path.Join(ps.TableDir(table), file.Path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := parquet.NewGenericReader[positionDelete](f)
+	defer reader.Close()
+	positions := make([]int64, 0, reader.NumRows())
+	rows := make([]positionDelete, 1024)
+	for {
+		n, err := reader.Read(rows)
+		for _, row := range rows[:n] {
+			positions = append(positions, row.Pos)
+		}
+		if err == io.EOF {
+			return positions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SplitDeleteFiles tách các tệp delete ra khỏi các tệp dữ liệu, tệp delete được nhóm theo ID của tệp dữ liệu
+func SplitDeleteFiles(files []models.TableFile) ([]models.TableFile, map[int][]models.TableFile) {
+	data := make([]models.TableFile, 0, len(files))
+	deletes := make(map[int][]models.TableFile)
+	for _, file := range files {
+		if file.Content == models.TableFileContentPositionDeletes {
+			deletes[file.DataFileID] = append(deletes[file.DataFileID], file)
+			continue
+		}
+		data = append(data, file)
+	}
+	return data, deletes
+}
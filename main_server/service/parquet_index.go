@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/bloom"
+)
+
+// Index của table được lưu thành một tệp sidecar cạnh mỗi tệp dữ liệu: <tệp dữ liệu>.idx-<index-id>.
+// Sidecar được ghi cùng tệp dữ liệu và bị xóa cùng tệp dữ liệu. Tệp dữ liệu không có sidecar
+// (ghi trước khi index được tạo xong) được coi là có thể chứa mọi giá trị
+
+// bloomFilterBitsPerValue cho tỉ lệ dương tính giả khoảng 1%
+const bloomFilterBitsPerValue = 10
+
+func init() {
+	// Min/max của zone map được lưu theo kiểu Go của giá trị, decimal là *big.Int
+	gob.Register(new(big.Int))
+}
+
+// ZoneMap là thống kê của cột được đánh index trong từng row group của một tệp dữ liệu, theo thứ tự row group
+type ZoneMap struct {
+	RowGroups []ZoneMapEntry
+}
+
+// ZoneMapEntry là thống kê của cột trong một row group, Min/Max là nil nếu mọi giá trị là null
+type ZoneMapEntry struct {
+	NumRows int64
+	Stats   ColumnStats
+}
+
+// BloomFilter là bloom filter của các giá trị khác null của cột được đánh index trong một tệp dữ liệu
+type BloomFilter struct {
+	filter bloom.SplitBlockFilter
+}
+
+// MayContain trả về false nếu tệp chắc chắn không chứa value (cùng kiểu Go với dòng được Append)
+func (f *BloomFilter) MayContain(value interface{}) bool {
+	hash, ok := BloomHash(value)
+	return !ok || f.filter.Check(hash)
+}
+
+// indexFile là nội dung của tệp sidecar, chỉ một trong Bloom và RowGroups có giá trị theo loại index
+type indexFile struct {
+	IndexType string
+	Bloom     []byte
+	RowGroups []ZoneMapEntry
+}
+
+// IsTableIndex kiểm tra index có phải loại index của table không
+func IsTableIndex(index *models.Index) bool {
+	return index.IndexType == models.IndexTypeBloomFilter || index.IndexType == models.IndexTypeZoneMap
+}
+
+// BloomHash trả về hash của giá trị dùng trong bloom filter
+// Số nguyên được hash như int64 và số thực như float64 để index vẫn dùng được sau khi cột được nới kiểu
+func BloomHash(value interface{}) (uint64, bool) {
+	var buf []byte
+	switch v := value.(type) {
+	case bool:
+		if v {
+			buf = []byte{1}
+		} else {
+			buf = []byte{0}
+		}
+	case int32:
+		buf = binary.LittleEndian.AppendUint64(nil, uint64(int64(v)))
+	case int64:
+		buf = binary.LittleEndian.AppendUint64(nil, uint64(v))
+	case float32:
+		return BloomHash(float64(v))
+	case float64:
+		// 0 và -0 bằng nhau, mọi NaN được coi là bằng nhau
+		switch {
+		case v == 0:
+			v = 0
+		case math.IsNaN(v):
+			v = math.NaN()
+		}
+		buf = binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+	case string:
+		buf = []byte(v)
+	case []byte:
+		buf = v
+	case *big.Int:
+		buf = []byte(v.String())
+	default:
+		return 0, false
+	}
+	return bloom.XXH64{}.Sum64(buf), true
+}
+
+func indexFilePath(dataPath string, indexID int) string {
+	return fmt.Sprintf("%s.idx-%d", dataPath, indexID)
+}
+
+// WriteIndexFile đọc cột được đánh index của tệp dữ liệu và ghi sidecar của index
+func (ps *ParquetService) WriteIndexFile(table *models.Table, file *models.TableFile, index *models.Index) error {
+	column := -1
+	for i := range table.Columns {
+		if table.Columns[i].Name == index.Fields {
+			column = i
+		}
+	}
+	if column < 0 {
+		return fmt.Errorf("column %s of index %s does not exist", index.Fields, index.Name)
+	}
+
+	f, err := os.Open(path.Join(ps.TableDir(table), file.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return err
+	}
+	leaf := fileLeaves(table, []int{column}, pf)[0]
+
+	content := indexFile{IndexType: index.IndexType}
+	var hashes []uint64
+	for _, rowGroup := range pf.RowGroups() {
+		numRows := rowGroup.NumRows()
+		entry := ZoneMapEntry{NumRows: numRows, Stats: ColumnStats{NullCount: numRows}}
+		if leaf >= 0 {
+			values, err := readColumnChunk(&table.Columns[column], rowGroup.ColumnChunks()[leaf], numRows)
+			if err != nil {
+				return err
+			}
+			entry.Stats.NullCount = 0
+			for _, value := range values {
+				if value == nil {
+					entry.Stats.NullCount++
+					continue
+				}
+				if hash, ok := BloomHash(value); ok {
+					hashes = append(hashes, hash)
+				}
+				if entry.Stats.Min == nil || compareRaw(value, entry.Stats.Min) < 0 {
+					entry.Stats.Min = value
+				}
+				if entry.Stats.Max == nil || compareRaw(value, entry.Stats.Max) > 0 {
+					entry.Stats.Max = value
+				}
+			}
+		}
+		content.RowGroups = append(content.RowGroups, entry)
+	}
+
+	if index.IndexType == models.IndexTypeBloomFilter {
+		// Ít nhất một block để filter của tệp chỉ có null vẫn kiểm tra được
+		filter := make(bloom.SplitBlockFilter, max(1, bloom.NumSplitBlocksOf(int64(len(hashes)), bloomFilterBitsPerValue)))
+		filter.InsertBulk(hashes)
+		content.Bloom = filter.Bytes()
+		content.RowGroups = nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&content); err != nil {
+		return err
+	}
+	target := path.Join(ps.TableDir(table), indexFilePath(file.Path, index.ID))
+	tmpPath := path.Join(path.Dir(target), "."+path.Base(target)+".tmp")
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// writeIndexFiles ghi sidecar của các index của table cho tệp dữ liệu vừa ghi
+// Lỗi chỉ được log vì tệp dữ liệu vẫn đọc được, tệp thiếu sidecar chỉ không được bỏ qua nhờ index
+func (ps *ParquetService) writeIndexFiles(table *models.Table, file *models.TableFile) {
+	for i := range table.Indexes {
+		index := &table.Indexes[i]
+		if !IsTableIndex(index) {
+			continue
+		}
+		if err := ps.WriteIndexFile(table, file, index); err != nil {
+			log.Printf("Failed to write index %s of file %s of table %d: %v", index.Name, file.Path, table.ID, err)
+		}
+	}
+}
+
+// readIndexFile đọc sidecar của index, trả về nil nếu tệp dữ liệu không có sidecar của index
+func (ps *ParquetService) readIndexFile(table *models.Table, file *models.TableFile, index *models.Index) (*indexFile, error) {
+	data, err := os.ReadFile(path.Join(ps.TableDir(table), indexFilePath(file.Path, index.ID)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var content indexFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&content); err != nil {
+		return nil, fmt.Errorf("failed to decode index %s of file %s: %v", index.Name, file.Path, err)
+	}
+	if content.IndexType != index.IndexType {
+		return nil, nil
+	}
+	return &content, nil
+}
+
+// ReadBloomFilter đọc bloom filter của tệp dữ liệu, trả về nil nếu tệp không có sidecar của index
+func (ps *ParquetService) ReadBloomFilter(table *models.Table, file *models.TableFile, index *models.Index) (*BloomFilter, error) {
+	content, err := ps.readIndexFile(table, file, index)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	if len(content.Bloom) < bloom.BlockSize {
+		return nil, fmt.Errorf("invalid bloom filter of index %s of file %s", index.Name, file.Path)
+	}
+	return &BloomFilter{filter: bloom.MakeSplitBlockFilter(content.Bloom)}, nil
+}
+
+// ReadZoneMap đọc zone map của tệp dữ liệu, trả về nil nếu tệp không có sidecar của index
+func (ps *ParquetService) ReadZoneMap(table *models.Table, file *models.TableFile, index *models.Index) (*ZoneMap, error) {
+	content, err := ps.readIndexFile(table, file, index)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	return &ZoneMap{RowGroups: content.RowGroups}, nil
+}
+
+// RemoveIndexFiles xóa sidecar của index khỏi mọi tệp dữ liệu của table, kể cả các tệp chỉ thuộc snapshot cũ
+func (ps *ParquetService) RemoveIndexFiles(table *models.Table, indexID int) error {
+	if table.StoragePath == "" {
+		return nil
+	}
+	suffix := fmt.Sprintf(".idx-%d", indexID)
+	return filepath.WalkDir(ps.TableDir(table), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !(strings.HasSuffix(entry.Name(), suffix) || strings.HasSuffix(entry.Name(), suffix+".tmp")) {
+			return nil
+		}
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// removeIndexFilesOf xóa các sidecar của một tệp dữ liệu
+func (ps *ParquetService) removeIndexFilesOf(table *models.Table, filePath string) error {
+	fullPath := path.Join(ps.TableDir(table), filePath)
+	entries, err := os.ReadDir(path.Dir(fullPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	prefix := path.Base(fullPath) + ".idx-"
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		if err := os.Remove(path.Join(path.Dir(fullPath), entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBloomHashWidening(t *testing.T) {
+	for _, v := range []int32{0, 1, -1, 42, math.MaxInt32, math.MinInt32} {
+		narrow, _ := BloomHash(v)
+		wide, _ := BloomHash(int64(v))
+		if narrow != wide {
+			t.Errorf("int32 %d and int64 %d have different hashes", v, v)
+		}
+	}
+	for _, v := range []float32{0, 1.5, -2.25, 0.1, math.MaxFloat32, float32(math.Inf(1))} {
+		narrow, _ := BloomHash(v)
+		wide, _ := BloomHash(float64(v))
+		if narrow != wide {
+			t.Errorf("float %v and double %v have different hashes", v, float64(v))
+		}
+	}
+
+	// 0 và -0 bằng nhau, các NaN bằng nhau
+	zero, _ := BloomHash(0.0)
+	negativeZero, _ := BloomHash(math.Copysign(0, -1))
+	nan, _ := BloomHash(math.NaN())
+	otherNaN, _ := BloomHash(float32(math.NaN()))
+	if zero != negativeZero || nan != otherNaN {
+		t.Error("equal floating point values have different hashes")
+	}
+
+	if _, ok := BloomHash(struct{}{}); ok {
+		t.Error("expected unsupported value to have no hash")
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// nullPartitionValue là giá trị trong đường dẫn của phân vùng chứa các dòng có cột nguồn là null, giống Hive
+const nullPartitionValue = "__HIVE_DEFAULT_PARTITION__"
+
+// partitionPath trả về thư mục phân vùng kiểu Hive của một dòng (giá trị theo thứ tự cột trong catalog),
+// rỗng nếu table không phân vùng
+func partitionPath(table *models.Table, columns map[string]int, values []interface{}) (string, error) {
+	if len(table.PartitionBy) == 0 {
+		return "", nil
+	}
+	segments := make([]string, len(table.PartitionBy))
+	for i := range table.PartitionBy {
+		field := &table.PartitionBy[i]
+		index, ok := columns[field.Column]
+		if !ok {
+			return "", fmt.Errorf("partition column %s does not exist", field.Column)
+		}
+		value, err := partitionValue(field, &table.Columns[index], values[index])
+		if err != nil {
+			return "", err
+		}
+		segments[i] = field.Name() + "=" + escapePartitionValue(value)
+	}
+	return path.Join(segments...), nil
+}
+
+// partitionValue trả về giá trị của trường phân vùng dưới dạng chuỗi chưa được escape
+func partitionValue(field *models.TablePartitionField, column *models.TableColumn, value interface{}) (string, error) {
+	if value == nil {
+		return nullPartitionValue, nil
+	}
+	if field.Transform == models.PartitionTransformIdentity {
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case int32:
+			if column.Type == models.ColumnTypeDate {
+				return time.Unix(int64(v)*86400, 0).UTC().Format(time.DateOnly), nil
+			}
+			return strconv.FormatInt(int64(v), 10), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case string:
+			return v, nil
+		}
+		return "", fmt.Errorf("column %s of type %s cannot be used for partitioning", column.Name, column.Type)
+	}
+
+	t, ok := temporalValue(column, value)
+	if !ok {
+		return "", fmt.Errorf("column %s of type %s cannot be partitioned by %s", column.Name, column.Type, field.Transform)
+	}
+	if field.Transform == models.PartitionTransformMonth {
+		return t.Format("2006-01"), nil
+	}
+	return t.Format(time.DateOnly), nil
+}
+
+// temporalValue chuyển giá trị của cột date hoặc timestamp thành thời điểm UTC
+func temporalValue(column *models.TableColumn, value interface{}) (time.Time, bool) {
+	switch column.Type {
+	case models.ColumnTypeDate:
+		if v, ok := value.(int32); ok {
+			return time.Unix(int64(v)*86400, 0).UTC(), true
+		}
+	case models.ColumnTypeTimestamp:
+		if v, ok := value.(int64); ok {
+			switch column.Unit {
+			case models.TimeUnitMillis:
+				return time.UnixMilli(v).UTC(), true
+			case models.TimeUnitNanos:
+				return time.Unix(0, v).UTC(), true
+			default:
+				return time.UnixMicro(v).UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// escapePartitionValue escape các ký tự không dùng được trong tên thư mục hoặc gây nhầm lẫn với cú pháp <tên>=<giá trị>
+// thành %XX, giống Hive
+func escapePartitionValue(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		b := value[i]
+		if b < 0x20 || b == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", b) >= 0 {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+			continue
+		}
+		escaped.WriteByte(b)
+	}
+	return escaped.String()
+}
+
+// PartitionBounds trả về khoảng giá trị của các cột nguồn trong một phân vùng, theo vị trí cột trong table.Columns.
+// Giá trị có cùng biểu diễn với thống kê của Scan và được hiểu như thống kê của một row group một dòng:
+// NullCount là 1 nếu phân vùng chứa các dòng null của cột, ngược lại là 0.
+// Phân vùng theo ngày, tháng cho khoảng từ đầu tới cuối ngày, tháng đó
+func PartitionBounds(table *models.Table, partition string) (map[int]ColumnStats, error) {
+	columns := make(map[string]int, len(table.Columns))
+	for i := range table.Columns {
+		columns[table.Columns[i].Name] = i
+	}
+	fields := make(map[string]*models.TablePartitionField, len(table.PartitionBy))
+	for i := range table.PartitionBy {
+		fields[table.PartitionBy[i].Name()] = &table.PartitionBy[i]
+	}
+
+	bounds := make(map[int]ColumnStats)
+	for _, segment := range strings.Split(partition, "/") {
+		name, escaped, ok := strings.Cut(segment, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition segment %q", segment)
+		}
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		index, ok := columns[field.Column]
+		if !ok {
+			continue
+		}
+		if escaped == nullPartitionValue {
+			bounds[index] = ColumnStats{NullCount: 1}
+			continue
+		}
+		value, err := url.PathUnescape(escaped)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition value %q: %v", escaped, err)
+		}
+		min, max, err := parsePartitionValue(field, &table.Columns[index], value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Cột có nhiều trường phân vùng (ví dụ theo tháng và theo ngày): lấy phần giao của các khoảng
+		if existing, ok := bounds[index]; ok && existing.Min != nil {
+			if compareRaw(min, existing.Min) < 0 {
+				min = existing.Min
+			}
+			if compareRaw(max, existing.Max) > 0 {
+				max = existing.Max
+			}
+		}
+		bounds[index] = ColumnStats{Min: min, Max: max}
+	}
+	return bounds, nil
+}
+
+// parsePartitionValue chuyển giá trị trong đường dẫn phân vùng về khoảng giá trị của cột nguồn
+func parsePartitionValue(field *models.TablePartitionField, column *models.TableColumn, value string) (interface{}, interface{}, error) {
+	invalid := fmt.Errorf("invalid value %q for partition %s", value, field.Name())
+	if field.Transform == models.PartitionTransformIdentity {
+		switch column.Type {
+		case models.ColumnTypeBoolean:
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, invalid
+			}
+			return v, v, nil
+		case models.ColumnTypeInt32:
+			v, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, nil, invalid
+			}
+			return int32(v), int32(v), nil
+		case models.ColumnTypeInt64:
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, nil, invalid
+			}
+			return v, v, nil
+		case models.ColumnTypeString:
+			return value, value, nil
+		case models.ColumnTypeDate:
+			t, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				return nil, nil, invalid
+			}
+			days := int32(t.Unix() / 86400)
+			return days, days, nil
+		}
+		return nil, nil, invalid
+	}
+
+	var start, end time.Time
+	if field.Transform == models.PartitionTransformMonth {
+		t, err := time.Parse("2006-01", value)
+		if err != nil {
+			return nil, nil, invalid
+		}
+		start, end = t, t.AddDate(0, 1, 0)
+	} else {
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, nil, invalid
+		}
+		start, end = t, t.AddDate(0, 0, 1)
+	}
+
+	switch column.Type {
+	case models.ColumnTypeDate:
+		return int32(start.Unix() / 86400), int32(end.Unix()/86400) - 1, nil
+	case models.ColumnTypeTimestamp:
+		switch column.Unit {
+		case models.TimeUnitMillis:
+			return start.UnixMilli(), end.UnixMilli() - 1, nil
+		case models.TimeUnitNanos:
+			return start.UnixNano(), end.UnixNano() - 1, nil
+		default:
+			return start.UnixMicro(), end.UnixMicro() - 1, nil
+		}
+	}
+	return nil, nil, invalid
+}
+
+// compareRaw so sánh hai giá trị khác null cùng kiểu của một cột, biểu diễn như giá trị trả về của Scan
+func compareRaw(a, b interface{}) int {
+	switch x := a.(type) {
+	case int32:
+		y := b.(int32)
+		return compareInt(int64(x), int64(y))
+	case int64:
+		return compareInt(x, b.(int64))
+	case float32:
+		return compareFloat(float64(x), float64(b.(float32)))
+	case float64:
+		return compareFloat(x, b.(float64))
+	case string:
+		return strings.Compare(x, b.(string))
+	case []byte:
+		return bytes.Compare(x, b.([]byte))
+	case *big.Int:
+		return x.Cmp(b.(*big.Int))
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareFloat coi NaN lớn hơn mọi số
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// newPartitionedTestTable tạo table (country string, ts timestamp, d date) phân vùng theo country, ngày của ts và tháng của d
+func newPartitionedTestTable(t *testing.T) (*ParquetService, *models.Table) {
+	t.Helper()
+	return newParquetTestTable(t,
+		[]models.TableColumn{
+			{Name: "country", Type: models.ColumnTypeString, Nullable: true},
+			{Name: "ts", Type: models.ColumnTypeTimestamp, Unit: models.TimeUnitMicros},
+			{Name: "d", Type: models.ColumnTypeDate},
+		},
+		models.TablePartitionField{Position: 0, Column: "country", Transform: models.PartitionTransformIdentity},
+		models.TablePartitionField{Position: 1, Column: "ts", Transform: models.PartitionTransformDay},
+		models.TablePartitionField{Position: 2, Column: "d", Transform: models.PartitionTransformMonth},
+	)
+}
+
+// dateValue là giá trị của cột date tại ngày value
+func dateValue(value string) int32 {
+	t, _ := time.Parse(time.DateOnly, value)
+	return int32(t.Unix() / 86400)
+}
+
+func TestPartitionPath(t *testing.T) {
+	_, table := newPartitionedTestTable(t)
+	columns := map[string]int{"country": 0, "ts": 1, "d": 2}
+	ts := time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC).UnixMicro()
+
+	tests := []struct {
+		country interface{}
+		want    string
+	}{
+		{country: "VN", want: "country=VN/ts_day=2024-03-01/d_month=2024-02"},
+		{country: "a/b=c%", want: "country=a%2Fb%3Dc%25/ts_day=2024-03-01/d_month=2024-02"},
+		{country: nil, want: "country=__HIVE_DEFAULT_PARTITION__/ts_day=2024-03-01/d_month=2024-02"},
+	}
+	for _, tt := range tests {
+		got, err := partitionPath(table, columns, []interface{}{tt.country, ts, dateValue("2024-02-29")})
+		if err != nil || got != tt.want {
+			t.Errorf("country %v: got %q (%v), want %q", tt.country, got, err, tt.want)
+		}
+	}
+
+	if _, err := partitionPath(table, columns, []interface{}{"VN", "not a timestamp", dateValue("2024-02-29")}); err == nil {
+		t.Error("expected an error for a value that cannot be partitioned")
+	}
+}
+
+func TestPartitionBounds(t *testing.T) {
+	_, table := newPartitionedTestTable(t)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	bounds, err := PartitionBounds(table, "country=a%2Fb%3Dc%25/ts_day=2024-03-01/d_month=2024-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]ColumnStats{
+		0: {Min: "a/b=c%", Max: "a/b=c%"},
+		1: {Min: day.UnixMicro(), Max: day.AddDate(0, 0, 1).UnixMicro() - 1},
+		2: {Min: dateValue("2024-02-01"), Max: dateValue("2024-02-29")},
+	}
+	if !reflect.DeepEqual(bounds, want) {
+		t.Fatalf("got bounds %+v, want %+v", bounds, want)
+	}
+
+	bounds, err = PartitionBounds(table, "country=__HIVE_DEFAULT_PARTITION__")
+	if err != nil || !reflect.DeepEqual(bounds, map[int]ColumnStats{0: {NullCount: 1}}) {
+		t.Fatalf("got bounds %+v (%v) for the null partition", bounds, err)
+	}
+
+	for _, partition := range []string{"country", "ts_day=2024-13-01", "d_month=x"} {
+		if _, err := PartitionBounds(table, partition); err == nil {
+			t.Errorf("%s: expected an error", partition)
+		}
+	}
+}
+
+func TestFlushWritesOneFilePerPartition(t *testing.T) {
+	ps, table := newPartitionedTestTable(t)
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ps.Append(table.ID, [][]interface{}{
+		{"VN", day.UnixMicro(), dateValue("2024-03-01")},
+		{"US", day.UnixMicro(), dateValue("2024-03-01")},
+		{"VN", day.Add(time.Hour).UnixMicro(), dateValue("2024-03-31")},
+		{"VN", day.AddDate(0, 0, 1).UnixMicro(), dateValue("2024-03-01")},
+	})
+
+	files, err := ps.Flush(table, func(files []models.TableFile) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var partitions []string
+	for _, file := range files {
+		if !strings.HasPrefix(file.Path, file.Partition+"/") {
+			t.Errorf("file %s is not in partition directory %s", file.Path, file.Partition)
+		}
+		partitions = append(partitions, file.Partition+":"+strings.Repeat("x", int(file.RowCount)))
+	}
+	sort.Strings(partitions)
+	want := []string{
+		"country=US/ts_day=2024-03-01/d_month=2024-03:x",
+		"country=VN/ts_day=2024-03-01/d_month=2024-03:xx",
+		"country=VN/ts_day=2024-03-02/d_month=2024-03:x",
+	}
+	if !reflect.DeepEqual(partitions, want) {
+		t.Fatalf("got partitions %v, want %v", partitions, want)
+	}
+}
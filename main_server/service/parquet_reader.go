@@ -0,0 +1,282 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+// ErrStopScan được trả về từ hàm xử lý dòng của Scan để dừng đọc sớm, Scan khi đó trả về nil
+var ErrStopScan = errors.New("stop scan")
+
+// ColumnStats là thống kê của một cột trong một row group
+// Min và Max có cùng biểu diễn với giá trị trả về của Scan, là nil nếu tệp không có thống kê min/max
+// hoặc thứ tự trong tệp không đúng với thứ tự của kiểu (decimal lưu dạng byte)
+type ColumnStats struct {
+	Min       interface{}
+	Max       interface{}
+	NullCount int64
+}
+
+// ScanStats là số liệu của một lần đọc table
+type ScanStats struct {
+	SnapshotID       int   `json:"snapshot_id"` // Snapshot được đọc, do người gọi Scan điền
+	FilesScanned     int   `json:"files_scanned"`
+	FilesPruned      int   `json:"files_pruned"`       // Số tệp bị bỏ qua nhờ phân vùng, do người gọi Scan điền
+	FilesSkipped     int   `json:"files_skipped"`      // Số tệp bị bỏ qua nhờ index của table, do người gọi Scan điền
+	RowGroups        int   `json:"row_groups"`         // Tổng số row group trong các tệp
+	RowGroupsSkipped int   `json:"row_groups_skipped"` // Số row group bị bỏ qua nhờ thống kê min/max
+	RowsScanned      int64 `json:"rows_scanned"`
+	RowsDeleted      int64 `json:"rows_deleted"` // Số dòng bị bỏ qua vì đã bị xóa bởi tệp delete
+}
+
+// Scan đọc các tệp trong manifest của table theo thứ tự, chỉ đọc các cột trong columns (vị trí trong table.Columns)
+// Với mỗi row group, keep được gọi với số dòng và thống kê của các cột cần đọc, trả về false để bỏ qua row group.
+// fn được gọi với giá trị của từng dòng theo thứ tự của columns, nil là null. Giá trị có cùng kiểu Go với dòng được Append
+// (int32, int64, float32, float64, string, []byte, *big.Int với decimal) và slice values chỉ hợp lệ trong lúc fn chạy.
+// Cột không có trong tệp được đọc là null. Tệp delete trong files được áp dụng cho tệp dữ liệu của nó,
+// các dòng đã bị xóa không được đọc
+func (ps *ParquetService) Scan(table *models.Table, files []models.TableFile, columns []int, keep func(numRows int64, stats []ColumnStats) bool, fn func(values []interface{}) error) (*ScanStats, error) {
+	return ps.ScanPositions(table, files, columns, keep, func(file *models.TableFile, position int64, values []interface{}) error {
+		return fn(values)
+	})
+}
+
+// ScanPositions giống Scan nhưng fn nhận thêm tệp dữ liệu chứa dòng và vị trí của dòng trong tệp, dùng để ghi tệp delete
+func (ps *ParquetService) ScanPositions(table *models.Table, files []models.TableFile, columns []int, keep func(numRows int64, stats []ColumnStats) bool, fn func(file *models.TableFile, position int64, values []interface{}) error) (*ScanStats, error) {
+	stats := &ScanStats{}
+	deleted, err := ps.readDeletes(table, files)
+	if err != nil {
+		return stats, err
+	}
+	for i := range files {
+		if files[i].Content == models.TableFileContentPositionDeletes {
+			continue
+		}
+		err := ps.scanFile(table, &files[i], columns, keep, deleted[files[i].ID], fn, stats)
+		if errors.Is(err, ErrStopScan) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read file %s: %w", files[i].Path, err)
+		}
+	}
+	return stats, nil
+}
+
+func (ps *ParquetService) scanFile(table *models.Table, file *models.TableFile, columns []int, keep func(numRows int64, stats []ColumnStats) bool, deleted map[int64]bool, fn func(file *models.TableFile, position int64, values []interface{}) error, stats *ScanStats) error {
+	f, err := os.Open(path.Join(ps.TableDir(table), file.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(f, info.Size(), parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return err
+	}
+	stats.FilesScanned++
+
+	leaves := fileLeaves(table, columns, pf)
+
+	// first là vị trí trong tệp của dòng đầu tiên của row group
+	var first int64
+	for _, rowGroup := range pf.RowGroups() {
+		stats.RowGroups++
+		numRows := rowGroup.NumRows()
+		chunks := rowGroup.ColumnChunks()
+		position := first
+		first += numRows
+
+		if keep != nil && !keep(numRows, chunkStats(table, columns, leaves, chunks, numRows)) {
+			stats.RowGroupsSkipped++
+			continue
+		}
+
+		values := make([][]interface{}, len(columns))
+		for i, column := range columns {
+			if leaves[i] < 0 {
+				continue
+			}
+			if values[i], err = readColumnChunk(&table.Columns[column], chunks[leaves[i]], numRows); err != nil {
+				return err
+			}
+		}
+
+		stats.RowsScanned += numRows
+		row := make([]interface{}, len(columns))
+		for r := int64(0); r < numRows; r++ {
+			if deleted[position+r] {
+				stats.RowsDeleted++
+				continue
+			}
+			for i := range columns {
+				if values[i] == nil {
+					row[i] = nil
+				} else {
+					row[i] = values[i][r]
+				}
+			}
+			if err := fn(file, position+r, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileLeaves trả về vị trí cột trong tệp (leaf) của các cột cần đọc, -1 nếu tệp không có cột
+// Cột được tìm theo field ID, nên tệp vẫn được đọc đúng sau khi cột được đổi tên. Tệp được ghi trước khi có field ID
+// chỉ có thể được tìm theo tên cột lúc ghi (LegacyName), cột được thêm sau không có trong các tệp đó
+func fileLeaves(table *models.Table, columns []int, pf *parquet.File) []int {
+	byFieldID := make(map[int]int)
+	byName := make(map[string]int)
+	for _, column := range pf.Root().Columns() {
+		if !column.Leaf() {
+			continue
+		}
+		if column.ID() > 0 {
+			byFieldID[column.ID()] = column.Index()
+		} else {
+			byName[column.Name()] = column.Index()
+		}
+	}
+
+	leaves := make([]int, len(columns))
+	for i, column := range columns {
+		tableColumn := &table.Columns[column]
+		leaf, ok := byFieldID[tableColumn.FieldID]
+		if !ok && len(byFieldID) == 0 && tableColumn.LegacyName != "" {
+			leaf, ok = byName[tableColumn.LegacyName]
+		}
+		if !ok {
+			leaf = -1
+		}
+		leaves[i] = leaf
+	}
+	return leaves
+}
+
+// chunkStats đọc thống kê của các cột cần đọc từ metadata của row group
+func chunkStats(table *models.Table, columns, leaves []int, chunks []parquet.ColumnChunk, numRows int64) []ColumnStats {
+	stats := make([]ColumnStats, len(columns))
+	for i, column := range columns {
+		if leaves[i] < 0 {
+			stats[i] = ColumnStats{NullCount: numRows}
+			continue
+		}
+		fileChunk, ok := chunks[leaves[i]].(*parquet.FileColumnChunk)
+		if !ok {
+			continue
+		}
+		stats[i].NullCount = fileChunk.NullCount()
+		tableColumn := &table.Columns[column]
+		// Min/max của decimal dạng byte được so sánh như chuỗi không dấu, không dùng được với số âm
+		if tableColumn.Type == models.ColumnTypeDecimal && tableColumn.Precision > 18 {
+			continue
+		}
+		if min, max, ok := fileChunk.Bounds(); ok {
+			stats[i].Min = columnRawValue(tableColumn, min)
+			stats[i].Max = columnRawValue(tableColumn, max)
+		}
+	}
+	return stats
+}
+
+// readColumnChunk đọc toàn bộ giá trị của một cột trong row group
+func readColumnChunk(column *models.TableColumn, chunk parquet.ColumnChunk, numRows int64) ([]interface{}, error) {
+	result := make([]interface{}, 0, numRows)
+	pages := chunk.Pages()
+	defer pages.Close()
+
+	buffer := make([]parquet.Value, 1024)
+	for {
+		page, err := pages.ReadPage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		reader := page.Values()
+		for {
+			n, err := reader.ReadValues(buffer)
+			for _, value := range buffer[:n] {
+				if value.IsNull() {
+					result = append(result, nil)
+				} else {
+					result = append(result, columnRawValue(column, value))
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				parquet.Release(page)
+				return nil, err
+			}
+		}
+		parquet.Release(page)
+	}
+
+	if int64(len(result)) != numRows {
+		return nil, fmt.Errorf("column %s has %d values, expected %d", column.Name, len(result), numRows)
+	}
+	return result, nil
+}
+
+// columnRawValue chuyển giá trị Parquet về biểu diễn dùng khi Append, byte được sao chép vì page được tái sử dụng
+// Giá trị trong tệp được ghi trước khi cột được nới kiểu (int32, float) được chuyển sang kiểu hiện tại của cột
+func columnRawValue(column *models.TableColumn, value parquet.Value) interface{} {
+	switch column.Type {
+	case models.ColumnTypeBoolean:
+		return value.Boolean()
+	case models.ColumnTypeInt32, models.ColumnTypeDate:
+		return value.Int32()
+	case models.ColumnTypeInt64, models.ColumnTypeTimestamp:
+		if value.Kind() == parquet.Int32 {
+			return int64(value.Int32())
+		}
+		return value.Int64()
+	case models.ColumnTypeFloat:
+		return value.Float()
+	case models.ColumnTypeDouble:
+		if value.Kind() == parquet.Float {
+			return float64(value.Float())
+		}
+		return value.Double()
+	case models.ColumnTypeString:
+		return string(value.ByteArray())
+	case models.ColumnTypeBinary:
+		return append([]byte{}, value.ByteArray()...)
+	case models.ColumnTypeDecimal:
+		switch {
+		case column.Precision <= 9:
+			return big.NewInt(int64(value.Int32()))
+		case column.Precision <= 18:
+			return big.NewInt(value.Int64())
+		default:
+			return decimalFromBytes(value.ByteArray())
+		}
+	}
+	return nil
+}
+
+// decimalFromBytes giải mã số nguyên dạng bù hai big-endian, ngược với decimalBytes
+func decimalFromBytes(b []byte) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return v
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// errNewerSchema được trả về khi ghi một dòng đã được kiểm tra theo schema mới hơn schema của table dùng để ghi,
+// lần flush sau với schema mới sẽ ghi lại dòng đó
+var errNewerSchema = errors.New("row was validated against a newer table schema")
+
+// decimalByteLength là số byte của decimal có precision lớn hơn 18, đủ cho precision tối đa 38
+const decimalByteLength = 16
+
+// tableSchema là schema Parquet của table cùng vị trí cột Parquet (leaf) của từng cột theo thứ tự trong catalog
+// Các cột trong tệp Parquet được sắp xếp theo tên, khác với thứ tự khai báo, và mang field ID của cột
+// để người đọc nhận biết cột sau khi cột được đổi tên
+type tableSchema struct {
+	schema  *parquet.Schema
+	columns []models.TableColumn
+	leaves  []int
+}
+
+func newTableSchema(table *models.Table) (*tableSchema, error) {
+	group := parquet.Group{}
+	for i := range table.Columns {
+		node, err := columnNode(&table.Columns[i])
+		if err != nil {
+			return nil, err
+		}
+		if table.Columns[i].Nullable {
+			node = parquet.Optional(node)
+		} else {
+			node = parquet.Required(node)
+		}
+		if table.Columns[i].FieldID > 0 {
+			node = parquet.FieldID(node, table.Columns[i].FieldID)
+		}
+		group[table.Columns[i].Name] = node
+	}
+	schema := parquet.NewSchema(table.Name, group)
+
+	leafIndex := make(map[string]int, len(table.Columns))
+	for i, columnPath := range schema.Columns() {
+		leafIndex[columnPath[0]] = i
+	}
+	leaves := make([]int, len(table.Columns))
+	for i := range table.Columns {
+		leaves[i] = leafIndex[table.Columns[i].Name]
+	}
+	return &tableSchema{schema: schema, columns: table.Columns, leaves: leaves}, nil
+}
+
+// columnNode trả về node Parquet tương ứng với kiểu của cột
+func columnNode(column *models.TableColumn) (parquet.Node, error) {
+	switch column.Type {
+	case models.ColumnTypeBoolean:
+		return parquet.Leaf(parquet.BooleanType), nil
+	case models.ColumnTypeInt32:
+		return parquet.Int(32), nil
+	case models.ColumnTypeInt64:
+		return parquet.Int(64), nil
+	case models.ColumnTypeFloat:
+		return parquet.Leaf(parquet.FloatType), nil
+	case models.ColumnTypeDouble:
+		return parquet.Leaf(parquet.DoubleType), nil
+	case models.ColumnTypeString:
+		return parquet.String(), nil
+	case models.ColumnTypeBinary:
+		return parquet.Leaf(parquet.ByteArrayType), nil
+	case models.ColumnTypeDate:
+		return parquet.Date(), nil
+	case models.ColumnTypeTimestamp:
+		switch column.Unit {
+		case models.TimeUnitMillis:
+			return parquet.Timestamp(parquet.Millisecond), nil
+		case models.TimeUnitNanos:
+			return parquet.Timestamp(parquet.Nanosecond), nil
+		default:
+			return parquet.Timestamp(parquet.Microsecond), nil
+		}
+	case models.ColumnTypeDecimal:
+		return parquet.Decimal(column.Scale, column.Precision, decimalPhysicalType(column.Precision)), nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %q", column.Type)
+	}
+}
+
+// decimalPhysicalType chọn kiểu vật lý nhỏ nhất chứa được decimal theo precision
+func decimalPhysicalType(precision int) parquet.Type {
+	switch {
+	case precision <= 9:
+		return parquet.Int32Type
+	case precision <= 18:
+		return parquet.Int64Type
+	default:
+		return parquet.FixedLenByteArrayType(decimalByteLength)
+	}
+}
+
+// row chuyển một dòng đã được kiểm tra (giá trị theo thứ tự cột trong catalog, nil là null) thành parquet.Row
+// Kiểu Go của giá trị phải khớp với kiểu của cột, xem domain.ConvertRows. Dòng được kiểm tra theo schema cũ
+// (còn trong buffer khi schema thay đổi) thiếu các cột được thêm sau, các cột đó là null.
+// Dòng được kiểm tra theo schema mới hơn schema dùng để ghi bị từ chối để không mất giá trị của các cột mới
+func (ts *tableSchema) row(values []interface{}) (parquet.Row, error) {
+	if len(values) > len(ts.columns) {
+		return nil, errNewerSchema
+	}
+	row := make(parquet.Row, len(ts.columns))
+	for i := range ts.columns {
+		column := &ts.columns[i]
+		leaf := ts.leaves[i]
+		var value interface{}
+		if i < len(values) {
+			value = values[i]
+		}
+		if value == nil {
+			row[leaf] = parquet.NullValue().Level(0, 0, leaf)
+			continue
+		}
+
+		parquetValue, err := columnValue(column, value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", column.Name, err)
+		}
+		definitionLevel := 0
+		if column.Nullable {
+			definitionLevel = 1
+		}
+		row[leaf] = parquetValue.Level(0, definitionLevel, leaf)
+	}
+	return row, nil
+}
+
+// columnValue chuyển giá trị thành giá trị Parquet của cột
+// int32 và float32 của cột đã được nới kiểu sau khi giá trị được kiểm tra được chuyển sang int64 và float64
+func columnValue(column *models.TableColumn, value interface{}) (parquet.Value, error) {
+	switch v := value.(type) {
+	case bool:
+		return parquet.BooleanValue(v), nil
+	case int32:
+		if column.Type == models.ColumnTypeInt64 {
+			return parquet.Int64Value(int64(v)), nil
+		}
+		return parquet.Int32Value(v), nil
+	case int64:
+		if column.Type == models.ColumnTypeInt32 {
+			return parquet.Value{}, errNewerSchema
+		}
+		return parquet.Int64Value(v), nil
+	case float32:
+		if column.Type == models.ColumnTypeDouble {
+			return parquet.DoubleValue(float64(v)), nil
+		}
+		return parquet.FloatValue(v), nil
+	case float64:
+		if column.Type == models.ColumnTypeFloat {
+			return parquet.Value{}, errNewerSchema
+		}
+		return parquet.DoubleValue(v), nil
+	case string:
+		return parquet.ByteArrayValue([]byte(v)), nil
+	case []byte:
+		return parquet.ByteArrayValue(v), nil
+	case *big.Int:
+		switch {
+		case column.Precision <= 9:
+			return parquet.Int32Value(int32(v.Int64())), nil
+		case column.Precision <= 18:
+			return parquet.Int64Value(v.Int64()), nil
+		default:
+			return parquet.FixedLenByteArrayValue(decimalBytes(v)), nil
+		}
+	default:
+		return parquet.Value{}, fmt.Errorf("unexpected value type %T", value)
+	}
+}
+
+// decimalBytes mã hóa số nguyên dạng bù hai big-endian trên decimalByteLength byte
+func decimalBytes(v *big.Int) []byte {
+	b := make([]byte, decimalByteLength)
+	if v.Sign() >= 0 {
+		v.FillBytes(b)
+		return b
+	}
+	// Số âm: 2^(8*n) + v
+	modulus := new(big.Int).Lsh(big.NewInt(1), 8*decimalByteLength)
+	new(big.Int).Add(modulus, v).FillBytes(b)
+	return b
+}
+
+// compressionCodec trả về codec nén theo tên trong catalog
+func compressionCodec(name string) (compress.Codec, error) {
+	switch name {
+	case models.TableCompressionSnappy:
+		return &parquet.Snappy, nil
+	case models.TableCompressionZstd:
+		return &parquet.Zstd, nil
+	case models.TableCompressionNone:
+		return &parquet.Uncompressed, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", name)
+	}
+}
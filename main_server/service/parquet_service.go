@@ -1,9 +1,377 @@
 package service
 
-// ParquetManager quản lý các hoạt động liên quan đến tệp Parquet
-type ParquetService struct{}
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-// NewParquetManager tạo một instance mới của ParquetManager
-func NewParquetService() (*ParquetService, error) {
-	return &ParquetService{}, nil
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	// defaultTableRowGroupSize là số dòng tối đa của một row group khi cấu hình không chỉ định
+	defaultTableRowGroupSize = 100000
+	// defaultTableFlushRows là số dòng trong buffer để ghi ra tệp khi cấu hình không chỉ định
+	defaultTableFlushRows = 100000
+	// defaultCompactionTargetBytes là kích thước mong muốn của tệp sau compaction khi cấu hình không chỉ định
+	defaultCompactionTargetBytes = 128 << 20
+	// defaultCompactionMinFiles là số tệp nhỏ tối thiểu trong một phân vùng để compaction định kỳ gộp phân vùng đó
+	defaultCompactionMinFiles = 5
+)
+
+// ParquetService quản lý các tệp Parquet của các table OLAP
+// Mỗi table có một thư mục riêng table/<workspace>/<table> trong thư mục dữ liệu,
+// đường dẫn được lưu trong catalog khi tạo table nên không đổi khi workspace được đổi tên.
+// Table phân vùng có các thư mục con kiểu Hive theo phân vùng, ví dụ table/ws/events/country=VN/ts_day=2024-03-01
+//
+// Các dòng được append vào buffer trong bộ nhớ của từng table rồi được ghi thành tệp Parquet bất biến khi Flush.
+// Tệp chỉ được người đọc thấy sau khi được đăng ký vào manifest trong catalog, nên tệp đang ghi dở
+// hoặc chưa được đăng ký (khi server dừng giữa chừng) không bao giờ được đọc.
+// Các dòng còn trong buffer sẽ mất nếu server dừng đột ngột
+type ParquetService struct {
+	dir        string // Thư mục dữ liệu gốc
+	cfg        *config.Config
+	mu         sync.Mutex
+	buffers    map[int][][]interface{} // ID table -> các dòng chưa được ghi ra tệp
+	compacting map[int]bool            // ID các table đang được compaction
+	fileCount  atomic.Int64            // Dùng để tạo tên tệp không trùng trong cùng một nano giây
+}
+
+// NewParquetService tạo một instance mới của ParquetService
+func NewParquetService(cfg *config.Config) (*ParquetService, error) {
+	if err := os.MkdirAll(path.Join(cfg.DataFolderDefault, "table"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &ParquetService{
+		dir:        cfg.DataFolderDefault,
+		cfg:        cfg,
+		buffers:    make(map[int][][]interface{}),
+		compacting: make(map[int]bool),
+	}, nil
+}
+
+// DefaultCompression trả về codec nén của table mới khi không được chỉ định
+func (ps *ParquetService) DefaultCompression() string {
+	if ps.cfg.TableCompression == "" {
+		return models.TableCompressionSnappy
+	}
+	return ps.cfg.TableCompression
+}
+
+// DefaultRowGroupSize trả về số dòng tối đa của một row group của table mới khi không được chỉ định
+func (ps *ParquetService) DefaultRowGroupSize() int {
+	if ps.cfg.TableRowGroupSize <= 0 {
+		return defaultTableRowGroupSize
+	}
+	return ps.cfg.TableRowGroupSize
+}
+
+// FlushRows trả về số dòng trong buffer của một table để ghi ra tệp ngay khi append
+func (ps *ParquetService) FlushRows() int {
+	if ps.cfg.TableFlushRows <= 0 {
+		return defaultTableFlushRows
+	}
+	return ps.cfg.TableFlushRows
+}
+
+// CompactionTargetBytes trả về kích thước mong muốn của tệp sau compaction khi không được chỉ định
+func (ps *ParquetService) CompactionTargetBytes() int64 {
+	if ps.cfg.TableCompactionTargetBytes <= 0 {
+		return defaultCompactionTargetBytes
+	}
+	return ps.cfg.TableCompactionTargetBytes
+}
+
+// CompactionMinFiles trả về số tệp nhỏ tối thiểu trong một phân vùng để compaction định kỳ gộp phân vùng đó
+func (ps *ParquetService) CompactionMinFiles() int {
+	if ps.cfg.TableCompactionMinFiles <= 1 {
+		return defaultCompactionMinFiles
+	}
+	return ps.cfg.TableCompactionMinFiles
+}
+
+// TableStoragePath trả về đường dẫn thư mục của table, tương đối với thư mục dữ liệu
+// Đường dẫn theo ID thay vì tên vì workspace và table có thể được đổi tên, tên cũ có thể được dùng lại
+func (ps *ParquetService) TableStoragePath(workspaceID, tableID int) string {
+	return path.Join("table", strconv.Itoa(workspaceID), strconv.Itoa(tableID))
+}
+
+// TableDir trả về đường dẫn đầy đủ tới thư mục của table
+func (ps *ParquetService) TableDir(table *models.Table) string {
+	return path.Join(ps.dir, table.StoragePath)
+}
+
+// CreateTableStorage tạo thư mục của table, trả về lỗi nếu thư mục đã tồn tại để hai table không dùng chung thư mục
+func (ps *ParquetService) CreateTableStorage(table *models.Table) error {
+	dir := ps.TableDir(table)
+	if err := os.MkdirAll(path.Dir(dir), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Mkdir(dir, os.ModePerm)
+}
+
+// DeleteTableStorage bỏ buffer và xóa thư mục của table cùng toàn bộ tệp bên trong
+func (ps *ParquetService) DeleteTableStorage(table *models.Table) error {
+	ps.DiscardBuffer(table.ID)
+	if table.StoragePath == "" {
+		return nil
+	}
+	return os.RemoveAll(ps.TableDir(table))
+}
+
+// StorageFile là một tệp dữ liệu trong thư mục của table
+type StorageFile struct {
+	Path    string // Đường dẫn tương đối với thư mục của table, cùng dạng với TableFile.Path
+	ModTime time.Time
+}
+
+// ListStorageFiles liệt kê các tệp Parquet và tệp tạm đang ghi trong thư mục của table, kể cả trong các thư mục phân vùng
+func (ps *ParquetService) ListStorageFiles(table *models.Table) ([]StorageFile, error) {
+	if table.StoragePath == "" {
+		return nil, nil
+	}
+	dir := ps.TableDir(table)
+	var files []StorageFile
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !(strings.HasSuffix(entry.Name(), ".parquet") || strings.HasSuffix(entry.Name(), ".parquet.tmp")) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, StorageFile{Path: filepath.ToSlash(relPath), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// RemoveTableFile xóa một tệp trong thư mục của table cùng các sidecar index của tệp, không lỗi nếu tệp không còn
+func (ps *ParquetService) RemoveTableFile(table *models.Table, filePath string) error {
+	if table.StoragePath == "" || filePath == "" {
+		return nil
+	}
+	err := os.Remove(path.Join(ps.TableDir(table), filePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return ps.removeIndexFilesOf(table, filePath)
+}
+
+// Append thêm các dòng đã được kiểm tra vào buffer của table và trả về số dòng đang có trong buffer
+// Mỗi dòng là các giá trị theo thứ tự cột trong catalog, xem tableSchema.row
+func (ps *ParquetService) Append(tableID int, rows [][]interface{}) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.buffers[tableID] = append(ps.buffers[tableID], rows...)
+	return len(ps.buffers[tableID])
+}
+
+// BufferedRows trả về số dòng chưa được ghi ra tệp của table
+func (ps *ParquetService) BufferedRows(tableID int) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.buffers[tableID])
+}
+
+// BufferedTables trả về ID các table có dòng chưa được ghi ra tệp
+func (ps *ParquetService) BufferedTables() []int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	tableIDs := make([]int, 0, len(ps.buffers))
+	for tableID, rows := range ps.buffers {
+		if len(rows) > 0 {
+			tableIDs = append(tableIDs, tableID)
+		}
+	}
+	return tableIDs
+}
+
+// DiscardBuffer bỏ các dòng chưa được ghi ra tệp của table, dùng khi table bị xóa
+func (ps *ParquetService) DiscardBuffer(tableID int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.buffers, tableID)
+}
+
+// Flush ghi toàn bộ buffer của table thành tệp Parquet rồi gọi commit để đăng ký các tệp vào manifest trong một lần
+// Với table phân vùng, mỗi phân vùng có dòng trong buffer được ghi thành một tệp trong thư mục của phân vùng.
+// Tệp được ghi vào tệp tạm rồi đổi tên, nên tệp có tên .parquet luôn đầy đủ.
+// Nếu ghi tệp hoặc commit thất bại, các tệp đã ghi bị xóa và các dòng được trả lại buffer để lần Flush sau ghi lại.
+// Trả về nil nếu buffer rỗng
+func (ps *ParquetService) Flush(table *models.Table, commit func(files []models.TableFile) error) ([]models.TableFile, error) {
+	ps.mu.Lock()
+	rows := ps.buffers[table.ID]
+	delete(ps.buffers, table.ID)
+	ps.mu.Unlock()
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	files, err := ps.writePartitions(table, rows)
+	if err == nil {
+		err = commit(files)
+	}
+	if err != nil {
+		for _, file := range files {
+			if removeErr := os.Remove(path.Join(ps.TableDir(table), file.Path)); removeErr != nil {
+				log.Printf("Failed to remove uncommitted file %s: %v", file.Path, removeErr)
+			}
+		}
+		ps.mu.Lock()
+		ps.buffers[table.ID] = append(rows, ps.buffers[table.ID]...)
+		ps.mu.Unlock()
+		return nil, err
+	}
+	return files, nil
+}
+
+// WriteRows ghi các dòng thành tệp Parquet mà không qua buffer, mỗi phân vùng một tệp
+// Các tệp chưa được đăng ký vào manifest, người gọi commit tệp hoặc xóa tệp bằng RemoveTableFile nếu commit thất bại.
+// Nếu ghi thất bại, các tệp đã ghi bị xóa
+func (ps *ParquetService) WriteRows(table *models.Table, rows [][]interface{}) ([]models.TableFile, error) {
+	files, err := ps.writePartitions(table, rows)
+	if err != nil {
+		for _, file := range files {
+			if removeErr := os.Remove(path.Join(ps.TableDir(table), file.Path)); removeErr != nil {
+				log.Printf("Failed to remove unwritten file %s: %v", file.Path, removeErr)
+			}
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+// writePartitions chia các dòng theo phân vùng và ghi mỗi phân vùng thành một tệp, theo thứ tự phân vùng xuất hiện
+// Nếu ghi thất bại, các tệp đã ghi được trả về cùng lỗi để người gọi xóa
+func (ps *ParquetService) writePartitions(table *models.Table, rows [][]interface{}) ([]models.TableFile, error) {
+	columns := make(map[string]int, len(table.Columns))
+	for i := range table.Columns {
+		columns[table.Columns[i].Name] = i
+	}
+
+	var partitions []string
+	partitionRows := make(map[string][][]interface{})
+	for i, values := range rows {
+		partition, err := partitionPath(table, columns, values)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		if _, ok := partitionRows[partition]; !ok {
+			partitions = append(partitions, partition)
+		}
+		partitionRows[partition] = append(partitionRows[partition], values)
+	}
+
+	files := make([]models.TableFile, 0, len(partitions))
+	for _, partition := range partitions {
+		file, err := ps.writeFile(table, partition, partitionRows[partition])
+		if err != nil {
+			return files, err
+		}
+		files = append(files, *file)
+	}
+	return files, nil
+}
+
+// writeFile ghi các dòng thành một tệp Parquet mới trong thư mục phân vùng (rỗng là thư mục của table)
+// Các cột phân vùng vẫn được lưu trong tệp như các cột khác
+func (ps *ParquetService) writeFile(table *models.Table, partition string, rows [][]interface{}) (*models.TableFile, error) {
+	schema, err := newTableSchema(table)
+	if err != nil {
+		return nil, err
+	}
+	compression := table.Compression
+	if compression == "" {
+		compression = ps.DefaultCompression()
+	}
+	codec, err := compressionCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	rowGroupSize := table.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = ps.DefaultRowGroupSize()
+	}
+	writerConfig, err := parquet.NewWriterConfig(schema.schema, parquet.Compression(codec), parquet.MaxRowsPerRowGroup(int64(rowGroupSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	parquetRows := make([]parquet.Row, len(rows))
+	for i, values := range rows {
+		if parquetRows[i], err = schema.row(values); err != nil {
+			return nil, fmt.Errorf("row %d: %v", i, err)
+		}
+	}
+
+	dir := path.Join(ps.TableDir(table), partition)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("part-%d-%d.parquet", time.Now().UnixNano(), ps.fileCount.Add(1))
+	tmpPath := path.Join(dir, "."+name+".tmp")
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	writeErr := func() error {
+		writer := parquet.NewWriter(f, writerConfig)
+		if _, err := writer.WriteRows(parquetRows); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr == nil {
+		writeErr = os.Rename(tmpPath, path.Join(dir, name))
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write parquet file: %v", writeErr)
+	}
+
+	info, err := os.Stat(path.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	file := &models.TableFile{
+		TableID:   table.ID,
+		Path:      path.Join(partition, name),
+		Partition: partition,
+		RowCount:  int64(len(rows)),
+		ByteSize:  info.Size(),
+		RowGroups: (len(rows) + rowGroupSize - 1) / rowGroupSize,
+		Content:   models.TableFileContentData,
+	}
+	ps.writeIndexFiles(table, file)
+	return file, nil
 }
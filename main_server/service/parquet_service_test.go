@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+var errCommitFailed = errors.New("commit failed")
+
+// newParquetTestTable tạo ParquetService và table (id int64, name string) với các trường phân vùng cho trước
+func newParquetTestTable(t *testing.T, columns []models.TableColumn, partitionBy ...models.TablePartitionField) (*ParquetService, *models.Table) {
+	t.Helper()
+	ps, err := NewParquetService(&config.Config{DataFolderDefault: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns == nil {
+		columns = []models.TableColumn{
+			{Name: "id", Type: models.ColumnTypeInt64},
+			{Name: "name", Type: models.ColumnTypeString, Nullable: true},
+		}
+	}
+	for i := range columns {
+		columns[i].Position = i
+		if columns[i].FieldID == 0 {
+			columns[i].FieldID = i + 1
+		}
+	}
+	table := &models.Table{ID: 1, WorkspaceID: 1, Columns: columns, PartitionBy: partitionBy, SchemaVersion: 1}
+	table.StoragePath = ps.TableStoragePath(table.WorkspaceID, table.ID)
+	return ps, table
+}
+
+// scanRows đọc tất cả các cột của các tệp và trả về các dòng dạng chuỗi
+func scanRows(t *testing.T, ps *ParquetService, table *models.Table, files []models.TableFile) string {
+	t.Helper()
+	columns := make([]int, len(table.Columns))
+	for i := range columns {
+		columns[i] = i
+	}
+	var rows [][]interface{}
+	_, err := ps.Scan(table, files, columns, nil, func(values []interface{}) error {
+		rows = append(rows, append([]interface{}(nil), values...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	return fmt.Sprint(rows)
+}
+
+func TestFlushKeepsRowsWhenCommitFails(t *testing.T) {
+	ps, table := newParquetTestTable(t, nil)
+	ps.Append(table.ID, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}})
+
+	_, err := ps.Flush(table, func(files []models.TableFile) error {
+		if len(files) != 1 || files[0].RowCount != 2 {
+			t.Errorf("got files %+v, want one file with 2 rows", files)
+		}
+		// Dòng được append trong lúc flush nằm sau các dòng được trả lại buffer
+		ps.Append(table.ID, [][]interface{}{{int64(3), "c"}})
+		return errCommitFailed
+	})
+	if !errors.Is(err, errCommitFailed) {
+		t.Fatalf("got %v, want commit error", err)
+	}
+	if rows := ps.BufferedRows(table.ID); rows != 3 {
+		t.Fatalf("got %d buffered rows, want 3", rows)
+	}
+	// Tệp chưa commit bị xóa
+	if files, err := ps.ListStorageFiles(table); err != nil || len(files) != 0 {
+		t.Fatalf("got files %+v (%v) after failed commit, want none", files, err)
+	}
+
+	var committed []models.TableFile
+	files, err := ps.Flush(table, func(files []models.TableFile) error {
+		committed = files
+		return nil
+	})
+	if err != nil || len(files) != 1 || len(committed) != 1 {
+		t.Fatalf("got files %+v (%v), want one committed file", files, err)
+	}
+	if rows := ps.BufferedRows(table.ID); rows != 0 {
+		t.Fatalf("got %d buffered rows after flush, want 0", rows)
+	}
+	if got, want := scanRows(t, ps, table, files), "[[1 a] [2 b] [3 c]]"; got != want {
+		t.Fatalf("got rows %s, want %s", got, want)
+	}
+
+	// Buffer rỗng không tạo tệp và không commit
+	files, err = ps.Flush(table, func(files []models.TableFile) error {
+		t.Error("commit must not be called for an empty buffer")
+		return nil
+	})
+	if err != nil || files != nil {
+		t.Fatalf("got files %+v (%v) for an empty buffer", files, err)
+	}
+}
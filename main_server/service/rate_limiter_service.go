@@ -0,0 +1,71 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket lưu trạng thái token bucket của một subject (user hoặc API key)
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+// RateLimiter giới hạn số request theo thuật toán token bucket, trạng thái chỉ nằm trong bộ nhớ
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter tạo một RateLimiter rỗng
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow lấy một token từ bucket của subject với tốc độ rate token/giây và dung lượng burst
+// Trả về false cùng thời gian cần chờ nếu bucket đã hết token
+func (rl *RateLimiter) Allow(subject string, rate float64, burst int) (bool, time.Duration) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := rl.buckets[subject]
+	if !ok || bucket.rate != rate || bucket.burst != burst {
+		// Bucket mới hoặc giới hạn vừa được thay đổi trong catalog
+		bucket = &tokenBucket{tokens: float64(burst), last: now, rate: rate, burst: burst}
+		rl.buckets[subject] = bucket
+	}
+
+	// Nạp thêm token theo thời gian đã trôi qua
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// Cleanup xóa các bucket không được dùng trong khoảng idle để tránh map tăng mãi
+func (rl *RateLimiter) Cleanup(idle time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for subject, bucket := range rl.buckets {
+		if time.Since(bucket.last) > idle {
+			delete(rl.buckets, subject)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/dehuy69/mydp/config"
 	"github.com/dehuy69/mydp/main_server/models"
@@ -30,12 +34,34 @@ func NewSQLiteCatalogService(cfg *config.Config) (*SQLiteCatalogService, error)
 		return nil, err
 	}
 
+	// Index của catalog cũ được tạo trước khi có cột multikey
+	legacyIndexes := db.Migrator().HasTable(&models.Index{}) && !db.Migrator().HasColumn(&models.Index{}, "Multikey")
+
 	// Tự động migrate các bảng
 	err = autoMigrate(db)
 	if err != nil {
 		return nil, err
 	}
 
+	// Coi các index cũ là multikey vì không biết chúng có document với field là mảng hay không
+	if legacyIndexes {
+		if err := db.Model(&models.Index{}).Where("1 = 1").UpdateColumn("multikey", true).Error; err != nil {
+			return nil, fmt.Errorf("failed to mark existing indexes as multikey: %v", err)
+		}
+	}
+
+	// Bỏ ràng buộc unique toàn cục trên tên của catalog cũ
+	err = migrateScopedNameUniqueness(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Đánh field ID cho các cột của table được tạo trước khi có field ID
+	err = migrateTableColumnFieldIDs(db)
+	if err != nil {
+		return nil, err
+	}
+
 	// Khởi tạo SQLiteManager
 	manager := &SQLiteCatalogService{Db: db}
 
@@ -56,14 +82,70 @@ func autoMigrate(db *gorm.DB) error {
 		&models.Workspace{},
 		&models.Collection{},
 		&models.Table{},
+		&models.TableColumn{},
+		&models.TableFile{},
+		&models.TablePartitionField{},
+		&models.TableSnapshot{},
+		&models.TableCompaction{},
+		&models.CollectionSync{},
 		&models.Index{},
 		&models.Pipeline{},
 		&models.User{},   // Thêm bảng người dùng
 		&models.Server{}, // Thêm bảng server
 		&models.Shard{},  // Thêm bảng shard
+		&models.UserPermission{},
+		&models.APIKey{},
+		&models.AuditLog{},
+		&models.WorkspaceQuota{},
+		&models.RateLimit{},
 	)
 }
 
+// migrateScopedNameUniqueness xóa các ràng buộc unique toàn cục trên cột name của catalog cũ
+// Tên collection, table, pipeline giờ chỉ duy nhất trong workspace và tên index chỉ duy nhất trong collection/table,
+// các ràng buộc mới được autoMigrate tạo dưới dạng unique index nhiều cột
+func migrateScopedNameUniqueness(db *gorm.DB) error {
+	migrator := db.Migrator()
+
+	// Collection.Name trước đây dùng uniqueIndex
+	if migrator.HasIndex(&models.Collection{}, "idx_collections_name") {
+		if err := migrator.DropIndex(&models.Collection{}, "idx_collections_name"); err != nil {
+			return fmt.Errorf("failed to drop unique index on collections.name: %v", err)
+		}
+	}
+
+	// Table.Name, Index.Name, Pipeline.Name trước đây dùng unique constraint, SQLite phải tạo lại bảng để xóa constraint
+	legacyConstraints := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.Table{}, "uni_tables_name"},
+		{&models.Index{}, "uni_indices_name"},
+		{&models.Pipeline{}, "uni_pipelines_name"},
+	}
+	for _, legacy := range legacyConstraints {
+		if migrator.HasConstraint(legacy.model, legacy.name) {
+			if err := migrator.DropConstraint(legacy.model, legacy.name); err != nil {
+				return fmt.Errorf("failed to drop constraint %s: %v", legacy.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateTableColumnFieldIDs đánh field ID cho các cột chưa có theo thứ tự cột (Position + 1) và lưu tên hiện tại của cột
+// làm tên trong các tệp cũ, vì các tệp được ghi trước khi có field ID chỉ nhận biết cột theo tên
+func migrateTableColumnFieldIDs(db *gorm.DB) error {
+	err := db.Model(&models.TableColumn{}).Where("field_id = 0").UpdateColumns(map[string]interface{}{
+		"field_id":    gorm.Expr("position + 1"),
+		"legacy_name": gorm.Expr("name"),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to assign field ids to table columns: %v", err)
+	}
+	return nil
+}
+
 // createDefaultServer tạo server mặc định nếu chưa tồn tại
 func (m *SQLiteCatalogService) createDefaultServer() error {
 	var server models.Server
@@ -136,9 +218,10 @@ func (m *SQLiteCatalogService) CreateCollection(collection *models.Collection) e
 	return nil
 }
 
-func (m *SQLiteCatalogService) GetCollectionByName(name string) (*models.Collection, error) {
+// GetCollectionByName lấy collection theo tên trong một workspace
+func (m *SQLiteCatalogService) GetCollectionByName(workspaceID int, name string) (*models.Collection, error) {
 	var collection models.Collection
-	result := m.Db.First(&collection, "name = ?", name)
+	result := m.Db.First(&collection, "workspace_id = ? AND name = ?", workspaceID, name)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -192,6 +275,13 @@ func (m *SQLiteCatalogService) GetWorkspaceByName(name string) (*models.Workspac
 	return &workspace, nil
 }
 
+// WorkspaceNameTaken kiểm tra tên workspace đã được workspace khác (kể cả đã bị xóa mềm) sử dụng chưa
+func (m *SQLiteCatalogService) WorkspaceNameTaken(name string, excludeID int) (bool, error) {
+	var count int64
+	err := m.Db.Unscoped().Model(&models.Workspace{}).Where("name = ? AND id <> ?", name, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
 func (m *SQLiteCatalogService) GetWorkspaceByID(id int) (*models.Workspace, error) {
 	var workspace models.Workspace
 	result := m.Db.First(&workspace, "id = ?", id)
@@ -206,11 +296,557 @@ func (m *SQLiteCatalogService) UpdateIndex(index *models.Index) error {
 	return m.Db.Save(index).Error
 }
 
+// HardDeleteIndex xóa hẳn index khỏi catalog
+func (m *SQLiteCatalogService) HardDeleteIndex(indexID int) error {
+	return m.Db.Unscoped().Delete(&models.Index{}, indexID).Error
+}
+
 // CreatWorkspace
 func (m *SQLiteCatalogService) CreateWorkspace(workspace *models.Workspace) error {
 	return m.Db.Create(workspace).Error
 }
 
+// ListWorkspaces lấy tất cả workspace chưa bị xóa
+func (m *SQLiteCatalogService) ListWorkspaces() ([]models.Workspace, error) {
+	var workspaces []models.Workspace
+	if err := m.Db.Order("id").Find(&workspaces).Error; err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// ListWorkspacesForUser lấy các workspace mà người dùng sở hữu hoặc được cấp quyền
+func (m *SQLiteCatalogService) ListWorkspacesForUser(userID int) ([]models.Workspace, error) {
+	permittedIDs := m.Db.Model(&models.UserPermission{}).Select("workspace_id").Where("user_id = ?", userID)
+
+	var workspaces []models.Workspace
+	err := m.Db.Where("owner_id = ? OR id IN (?)", userID, permittedIDs).Order("id").Find(&workspaces).Error
+	if err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// RenameWorkspace đổi tên workspace
+func (m *SQLiteCatalogService) RenameWorkspace(workspace *models.Workspace, name string) error {
+	if err := m.Db.Model(workspace).Update("name", name).Error; err != nil {
+		return err
+	}
+	workspace.Name = name
+	return nil
+}
+
+// SoftDeleteWorkspace đánh dấu workspace đã bị xóa (DeletedAt), dữ liệu được xóa hẳn sau thời gian chờ
+func (m *SQLiteCatalogService) SoftDeleteWorkspace(workspace *models.Workspace) error {
+	return m.Db.Delete(workspace).Error
+}
+
+// ListWorkspacesDeletedBefore lấy các workspace đã bị xóa mềm trước thời điểm before
+func (m *SQLiteCatalogService) ListWorkspacesDeletedBefore(before time.Time) ([]models.Workspace, error) {
+	var workspaces []models.Workspace
+	err := m.Db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Find(&workspaces).Error
+	if err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// ListCollectionsByWorkspace lấy các collection của workspace kèm các index
+func (m *SQLiteCatalogService) ListCollectionsByWorkspace(workspaceID int) ([]models.Collection, error) {
+	var collections []models.Collection
+	err := m.Db.Preload("Indexes").Where("workspace_id = ?", workspaceID).Order("id").Find(&collections).Error
+	if err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// HardDeleteCollection xóa hẳn collection cùng các shard, index và sync khỏi catalog
+func (m *SQLiteCatalogService) HardDeleteCollection(collectionID int) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("collection_id = ?", collectionID).Delete(&models.Shard{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("collection_id = ?", collectionID).Delete(&models.Index{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("collection_id = ?", collectionID).Delete(&models.CollectionSync{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", collectionID).Delete(&models.Collection{}).Error
+	})
+}
+
+// CreateTable tạo table cùng các cột trong một transaction
+func (m *SQLiteCatalogService) CreateTable(table *models.Table) error {
+	return m.Db.Create(table).Error
+}
+
+// CreateTableWithStorage tạo table trong catalog rồi gọi createStorage với table đã có ID để tạo nơi lưu dữ liệu
+// và điền StoragePath, trong cùng một transaction: table không được tạo nếu createStorage trả về lỗi
+func (m *SQLiteCatalogService) CreateTableWithStorage(table *models.Table, createStorage func(table *models.Table) error) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(table).Error; err != nil {
+			return err
+		}
+		if err := createStorage(table); err != nil {
+			return err
+		}
+		return tx.Model(&models.Table{}).Where("id = ?", table.ID).UpdateColumn("storage_path", table.StoragePath).Error
+	})
+}
+
+// GetTableByName lấy table theo tên trong một workspace, kèm các cột, các trường phân vùng và các index
+func (m *SQLiteCatalogService) GetTableByName(workspaceID int, name string) (*models.Table, error) {
+	var table models.Table
+	result := m.Db.Preload("Columns", orderByPosition).Preload("PartitionBy", orderByPosition).Preload("Indexes").First(&table, "workspace_id = ? AND name = ?", workspaceID, name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &table, nil
+}
+
+// GetTableByID lấy table theo ID, kèm các cột, các trường phân vùng và các index
+func (m *SQLiteCatalogService) GetTableByID(id int) (*models.Table, error) {
+	var table models.Table
+	result := m.Db.Preload("Columns", orderByPosition).Preload("PartitionBy", orderByPosition).Preload("Indexes").First(&table, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &table, nil
+}
+
+// ListTablesByWorkspace lấy các table của workspace kèm các cột, các trường phân vùng và các index
+func (m *SQLiteCatalogService) ListTablesByWorkspace(workspaceID int) ([]models.Table, error) {
+	var tables []models.Table
+	err := m.Db.Preload("Columns", orderByPosition).Preload("PartitionBy", orderByPosition).Preload("Indexes").Where("workspace_id = ?", workspaceID).Order("id").Find(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// ErrSnapshotConflict được trả về khi commit loại bỏ một tệp không còn trong snapshot hiện tại của table,
+// ví dụ khi hai lần compaction chạy đồng thời trên cùng các tệp, hoặc khi các dòng mà commit dựa vào đã bị
+// xóa bởi một commit khác, ví dụ DELETE chạy trong lúc compaction ghi lại tệp
+var ErrSnapshotConflict = errors.New("snapshot conflict")
+
+// ErrSchemaConflict được trả về khi schema của table đã thay đổi sau khi được đọc để sửa đổi
+var ErrSchemaConflict = errors.New("table schema was changed concurrently")
+
+// AlterTableColumns thay các cột của table bằng columns, đổi cột sắp xếp khi compaction và tăng phiên bản schema
+// trong một transaction. Cột có ID được cập nhật tên và kiểu, cột chưa có ID được thêm vào.
+// Nếu phiên bản schema hiện tại khác schemaVersion, không có gì thay đổi và ErrSchemaConflict được trả về
+func (m *SQLiteCatalogService) AlterTableColumns(tableID, schemaVersion int, columns []models.TableColumn, clusterBy string) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Table{}).Where("id = ? AND schema_version = ?", tableID, schemaVersion).
+			UpdateColumns(map[string]interface{}{"schema_version": gorm.Expr("schema_version + 1"), "cluster_by": clusterBy})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSchemaConflict
+		}
+
+		// Index của table tham chiếu cột theo tên, được đổi theo cột. Index được cập nhật theo ID
+		// để các cột hoán đổi tên cho nhau không làm lẫn index
+		var indexes []models.Index
+		if err := tx.Where("table_id = ?", tableID).Find(&indexes).Error; err != nil {
+			return err
+		}
+		var current []models.TableColumn
+		if err := tx.Where("table_id = ?", tableID).Find(&current).Error; err != nil {
+			return err
+		}
+		renamed := make(map[string]string)
+		for _, old := range current {
+			for _, column := range columns {
+				if column.ID == old.ID && column.Name != old.Name {
+					renamed[old.Name] = column.Name
+				}
+			}
+		}
+		for _, index := range indexes {
+			if name, ok := renamed[index.Fields]; ok {
+				if err := tx.Model(&models.Index{}).Where("id = ?", index.ID).UpdateColumn("fields", name).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Tên cột là duy nhất trong table, đổi sang tên tạm trước để có thể hoán đổi tên giữa các cột
+		for _, column := range columns {
+			if column.ID == 0 {
+				continue
+			}
+			if err := tx.Model(&models.TableColumn{}).Where("id = ?", column.ID).UpdateColumn("name", fmt.Sprintf("__renaming_%d", column.ID)).Error; err != nil {
+				return err
+			}
+		}
+		for i := range columns {
+			column := &columns[i]
+			if column.ID == 0 {
+				column.TableID = tableID
+				if err := tx.Create(column).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			err := tx.Model(&models.TableColumn{}).Where("id = ?", column.ID).UpdateColumns(map[string]interface{}{
+				"name": column.Name,
+				"type": column.Type,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CommitTableSnapshot tạo snapshot mới của table trong một transaction: thêm các tệp added vào manifest,
+// loại các tệp có ID trong removedFileIDs và cập nhật số dòng, dung lượng, snapshot hiện tại của table.
+// Người đọc thấy toàn bộ thay đổi của commit cùng lúc.
+// schemaVersion khác 0 là phiên bản schema dùng để ghi các tệp added, nếu schema đã thay đổi thì ErrSchemaConflict được trả về
+// vì các tệp có thể thiếu giá trị của các cột mới, ví dụ khi compaction ghi lại tệp được ghi theo schema mới hơn.
+// Tệp delete trong added phải thuộc tệp dữ liệu còn trong table. baseSnapshotID khác 0 là snapshot hiện tại được đọc
+// trước khi liệt kê các tệp dùng để ghi added: nếu tệp dữ liệu bị loại hoặc có dòng bị xóa bởi commit chưa phát hành
+// vào lúc đó có tệp delete được thêm sau baseSnapshotID thì ErrSnapshotConflict được trả về, vì các dòng bị xóa đó
+// có thể xuất hiện lại trong tệp được ghi lại hoặc bị xóa hai lần
+func (m *SQLiteCatalogService) CommitTableSnapshot(tableID int, operation string, schemaVersion int, baseSnapshotID int, added []models.TableFile, removedFileIDs []int) (*models.TableSnapshot, error) {
+	var snapshot models.TableSnapshot
+	err := m.Db.Transaction(func(tx *gorm.DB) error {
+		var table models.Table
+		if err := tx.Select("id", "schema_version", "current_snapshot_id").First(&table, "id = ?", tableID).Error; err != nil {
+			return err
+		}
+		if schemaVersion != 0 && schemaVersion != table.SchemaVersion {
+			return ErrSchemaConflict
+		}
+		if err := checkDeleteConflicts(tx, tableID, baseSnapshotID, added, removedFileIDs); err != nil {
+			return err
+		}
+
+		snapshot = models.TableSnapshot{
+			TableID:       tableID,
+			ParentID:      table.CurrentSnapshotID,
+			Operation:     operation,
+			SchemaVersion: table.SchemaVersion,
+			AddedFiles:    len(added),
+			RemovedFiles:  len(removedFileIDs),
+		}
+		if err := tx.Create(&snapshot).Error; err != nil {
+			return err
+		}
+
+		if len(added) > 0 {
+			for i := range added {
+				added[i].AddedSnapshotID = snapshot.ID
+			}
+			if err := tx.Create(&added).Error; err != nil {
+				return err
+			}
+		}
+		if len(removedFileIDs) > 0 {
+			result := tx.Model(&models.TableFile{}).
+				Where("table_id = ? AND id IN ? AND removed_snapshot_id = 0", tableID, removedFileIDs).
+				UpdateColumn("removed_snapshot_id", snapshot.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(removedFileIDs)) {
+				return fmt.Errorf("%w: some files are no longer part of table %d", ErrSnapshotConflict, tableID)
+			}
+			// Tệp delete không còn tác dụng khi tệp dữ liệu của nó bị loại
+			err := tx.Model(&models.TableFile{}).
+				Where("table_id = ? AND data_file_id IN ? AND removed_snapshot_id = 0", tableID, removedFileIDs).
+				UpdateColumn("removed_snapshot_id", snapshot.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Số liệu của snapshot được tính lại từ manifest thay vì cộng dồn, để luôn khớp với các tệp.
+		// Số dòng của tệp delete là số dòng bị xóa, không dòng nào bị xóa hai lần
+		var totals struct {
+			FileCount int
+			RowCount  int64
+			ByteSize  int64
+		}
+		err := tx.Model(&models.TableFile{}).
+			Select("COUNT(*) AS file_count, COALESCE(SUM("+liveRowCountSQL+"), 0) AS row_count, COALESCE(SUM(byte_size), 0) AS byte_size").
+			Where("table_id = ? AND removed_snapshot_id = 0", tableID).
+			Scan(&totals).Error
+		if err != nil {
+			return err
+		}
+		snapshot.FileCount, snapshot.RowCount, snapshot.ByteSize = totals.FileCount, totals.RowCount, totals.ByteSize
+		if err := tx.Save(&snapshot).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Table{}).Where("id = ?", tableID).UpdateColumns(map[string]interface{}{
+			"row_count":           totals.RowCount,
+			"byte_size":           totals.ByteSize,
+			"current_snapshot_id": snapshot.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// checkDeleteConflicts kiểm tra các tệp delete của commit với manifest hiện tại, xem CommitTableSnapshot
+func checkDeleteConflicts(tx *gorm.DB, tableID int, baseSnapshotID int, added []models.TableFile, removedFileIDs []int) error {
+	var targets []int
+	seen := make(map[int]bool)
+	for _, file := range added {
+		if file.Content == models.TableFileContentPositionDeletes && !seen[file.DataFileID] {
+			seen[file.DataFileID] = true
+			targets = append(targets, file.DataFileID)
+		}
+	}
+	if len(targets) > 0 {
+		var live int64
+		err := tx.Model(&models.TableFile{}).
+			Where("table_id = ? AND id IN ? AND content = ? AND removed_snapshot_id = 0", tableID, targets, models.TableFileContentData).
+			Count(&live).Error
+		if err != nil {
+			return err
+		}
+		if live != int64(len(targets)) {
+			return fmt.Errorf("%w: some files with deleted rows are no longer part of table %d", ErrSnapshotConflict, tableID)
+		}
+	}
+
+	if baseSnapshotID == 0 {
+		return nil
+	}
+	targets = append(targets, removedFileIDs...)
+	if len(targets) == 0 {
+		return nil
+	}
+	var newer int64
+	err := tx.Model(&models.TableFile{}).
+		Where("table_id = ? AND data_file_id IN ? AND content = ? AND removed_snapshot_id = 0 AND added_snapshot_id > ?",
+			tableID, targets, models.TableFileContentPositionDeletes, baseSnapshotID).
+		Count(&newer).Error
+	if err != nil {
+		return err
+	}
+	if newer > 0 {
+		return fmt.Errorf("%w: rows of some files of table %d were deleted concurrently", ErrSnapshotConflict, tableID)
+	}
+	return nil
+}
+
+// ListTableFiles lấy manifest hiện tại của table: các tệp chưa bị loại theo thứ tự commit
+func (m *SQLiteCatalogService) ListTableFiles(tableID int) ([]models.TableFile, error) {
+	var files []models.TableFile
+	err := m.Db.Where("table_id = ? AND removed_snapshot_id = 0", tableID).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ListSnapshotFiles lấy các tệp của table tại một snapshot theo thứ tự commit
+func (m *SQLiteCatalogService) ListSnapshotFiles(tableID, snapshotID int) ([]models.TableFile, error) {
+	var files []models.TableFile
+	err := m.Db.Where("table_id = ? AND added_snapshot_id <= ? AND (removed_snapshot_id = 0 OR removed_snapshot_id > ?)", tableID, snapshotID, snapshotID).
+		Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ListAllTableFiles lấy mọi tệp của table còn trong catalog, kể cả tệp đã bị loại nhưng còn thuộc snapshot cũ
+func (m *SQLiteCatalogService) ListAllTableFiles(tableID int) ([]models.TableFile, error) {
+	var files []models.TableFile
+	err := m.Db.Where("table_id = ?", tableID).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ListTableSnapshots lấy các snapshot còn lưu của table, mới nhất trước
+func (m *SQLiteCatalogService) ListTableSnapshots(tableID int) ([]models.TableSnapshot, error) {
+	var snapshots []models.TableSnapshot
+	err := m.Db.Where("table_id = ?", tableID).Order("id DESC").Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetTableSnapshot lấy một snapshot của table theo ID
+func (m *SQLiteCatalogService) GetTableSnapshot(tableID, snapshotID int) (*models.TableSnapshot, error) {
+	var snapshot models.TableSnapshot
+	if err := m.Db.First(&snapshot, "table_id = ? AND id = ?", tableID, snapshotID).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetTableSnapshotAsOf lấy snapshot hiện tại của table tại thời điểm at: snapshot mới nhất được tạo trước hoặc đúng lúc at
+func (m *SQLiteCatalogService) GetTableSnapshotAsOf(tableID int, at time.Time) (*models.TableSnapshot, error) {
+	var snapshot models.TableSnapshot
+	if err := m.Db.Where("table_id = ? AND created_at <= ?", tableID, at).Order("id DESC").First(&snapshot).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ExpireTableSnapshots xóa các snapshot của table không còn cần để đọc table tại các thời điểm sau before
+// Snapshot hiện tại tại thời điểm before được giữ lại, các snapshot trước nó bị xóa cùng các tệp chỉ thuộc các snapshot đó.
+// Trả về số snapshot bị xóa và các tệp bị xóa khỏi catalog, người gọi xóa các tệp này khỏi đĩa
+func (m *SQLiteCatalogService) ExpireTableSnapshots(tableID int, before time.Time) (int, []models.TableFile, error) {
+	var expired int64
+	var files []models.TableFile
+	err := m.Db.Transaction(func(tx *gorm.DB) error {
+		var boundary models.TableSnapshot
+		err := tx.Where("table_id = ? AND created_at <= ?", tableID, before).Order("id DESC").First(&boundary).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("table_id = ? AND id < ?", tableID, boundary.ID).Delete(&models.TableSnapshot{})
+		if result.Error != nil {
+			return result.Error
+		}
+		expired = result.RowsAffected
+
+		// Tệp bị loại tại hoặc trước snapshot giữ lại cũ nhất không còn thuộc snapshot nào
+		if err := tx.Where("table_id = ? AND removed_snapshot_id <> 0 AND removed_snapshot_id <= ?", tableID, boundary.ID).Find(&files).Error; err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Where("table_id = ? AND removed_snapshot_id <> 0 AND removed_snapshot_id <= ?", tableID, boundary.ID).Delete(&models.TableFile{}).Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return int(expired), files, nil
+}
+
+// ListTables lấy tất cả các table của các workspace
+func (m *SQLiteCatalogService) ListTables() ([]models.Table, error) {
+	var tables []models.Table
+	err := m.Db.Preload("Columns", orderByPosition).Preload("PartitionBy", orderByPosition).Preload("Indexes").Order("id").Find(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// liveRowCountSQL là số dòng còn lại mà một tệp đóng góp vào table, tệp delete làm giảm số dòng
+const liveRowCountSQL = "CASE WHEN content = '" + models.TableFileContentPositionDeletes + "' THEN -row_count ELSE row_count END"
+
+// ListTablePartitions tổng hợp các phân vùng đang có dữ liệu của table từ manifest, theo tên phân vùng
+func (m *SQLiteCatalogService) ListTablePartitions(tableID int) ([]models.TablePartition, error) {
+	var partitions []models.TablePartition
+	err := m.Db.Model(&models.TableFile{}).
+		Select("`partition`, COUNT(*) AS file_count, SUM("+liveRowCountSQL+") AS row_count, SUM(byte_size) AS byte_size").
+		Where("table_id = ? AND removed_snapshot_id = 0 AND `partition` <> ''", tableID).
+		Group("`partition`").Order("`partition`").
+		Scan(&partitions).Error
+	if err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// CreateTableCompaction lưu một lần compaction mới của table
+func (m *SQLiteCatalogService) CreateTableCompaction(compaction *models.TableCompaction) error {
+	return m.Db.Create(compaction).Error
+}
+
+// UpdateTableCompaction cập nhật trạng thái và kết quả của một lần compaction
+func (m *SQLiteCatalogService) UpdateTableCompaction(compaction *models.TableCompaction) error {
+	return m.Db.Save(compaction).Error
+}
+
+// ListTableCompactions lấy tối đa limit lần compaction gần nhất của table, mới nhất trước
+func (m *SQLiteCatalogService) ListTableCompactions(tableID, limit int) ([]models.TableCompaction, error) {
+	var compactions []models.TableCompaction
+	err := m.Db.Where("table_id = ?", tableID).Order("id DESC").Limit(limit).Find(&compactions).Error
+	if err != nil {
+		return nil, err
+	}
+	return compactions, nil
+}
+
+// FailRunningTableCompactions đánh dấu thất bại các lần compaction của table vẫn ở trạng thái running,
+// dùng khi chắc chắn không còn compaction nào của table đang chạy (ví dụ server đã dừng giữa chừng)
+func (m *SQLiteCatalogService) FailRunningTableCompactions(tableID int, reason string) error {
+	return m.Db.Model(&models.TableCompaction{}).
+		Where("table_id = ? AND status = ?", tableID, models.CompactionStatusRunning).
+		Updates(map[string]interface{}{"status": models.CompactionStatusFailed, "error": reason, "finished_at": time.Now()}).Error
+}
+
+// HardDeleteTable xóa hẳn table cùng các cột, các trường phân vùng, snapshot, manifest, lịch sử compaction, sync và index khỏi catalog
+func (m *SQLiteCatalogService) HardDeleteTable(tableID int) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("table_id = ?", tableID).Delete(&models.TablePartitionField{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("table_id = ?", tableID).Delete(&models.TableSnapshot{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("table_id = ?", tableID).Delete(&models.TableCompaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("table_id = ?", tableID).Delete(&models.CollectionSync{}).Error; err != nil {
+			return err
+		}
+		if err := refreshCollectionChangeLogs(tx); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("table_id = ?", tableID).Delete(&models.TableFile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("table_id = ?", tableID).Delete(&models.TableColumn{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("table_id = ?", tableID).Delete(&models.Index{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", tableID).Delete(&models.Table{}).Error
+	})
+}
+
+// orderByPosition sắp xếp các cột của table theo thứ tự khai báo khi preload
+func orderByPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// HardDeleteWorkspace xóa hẳn workspace và các bản ghi phụ thuộc còn lại trong catalog
+// Các collection và table phải được xóa trước bằng HardDeleteCollection và HardDeleteTable
+func (m *SQLiteCatalogService) HardDeleteWorkspace(workspaceID int) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		dependents := []interface{}{
+			&models.Table{},
+			&models.Pipeline{},
+			&models.APIKey{},
+			&models.UserPermission{},
+			&models.WorkspaceQuota{},
+		}
+		for _, model := range dependents {
+			if err := tx.Unscoped().Where("workspace_id = ?", workspaceID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id = ?", workspaceID).Delete(&models.Workspace{}).Error
+	})
+}
+
 // Hàm chung để preload tất cả các quan hệ của một model đầu vào
 func (m *SQLiteCatalogService) GetModelWithAllAssociations(model interface{}, id int) error {
 	query := m.Db.Model(model)
@@ -219,7 +855,9 @@ func (m *SQLiteCatalogService) GetModelWithAllAssociations(model interface{}, id
 	val := reflect.ValueOf(model).Elem()
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Type().Field(i)
-		if field.Tag.Get("gorm") != "" && (field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Slice) {
+		// Bỏ qua các cột dạng []byte (ví dụ json.RawMessage), đó không phải liên kết
+		isBytes := field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Uint8
+		if field.Tag.Get("gorm") != "" && (field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Slice) && !isBytes {
 			associationName := field.Name
 			query = query.Preload(associationName)
 		}
@@ -240,3 +878,384 @@ func (m *SQLiteCatalogService) GetIndexByID(id int) (*models.Index, error) {
 	}
 	return &index, nil
 }
+
+// GetUserByID lấy thông tin người dùng theo ID
+func (m *SQLiteCatalogService) GetUserByID(id int) (*models.User, error) {
+	var user models.User
+	result := m.Db.First(&user, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// GetUserPermission lấy quyền của người dùng trên một workspace
+func (m *SQLiteCatalogService) GetUserPermission(userID, workspaceID int) (*models.UserPermission, error) {
+	var permission models.UserPermission
+	result := m.Db.First(&permission, "user_id = ? AND workspace_id = ?", userID, workspaceID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &permission, nil
+}
+
+// CreateAPIKey lưu API key mới vào catalog
+func (m *SQLiteCatalogService) CreateAPIKey(apiKey *models.APIKey) error {
+	return m.Db.Create(apiKey).Error
+}
+
+// GetAPIKeyByHash lấy API key theo SHA-256 của key
+func (m *SQLiteCatalogService) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	result := m.Db.First(&apiKey, "key_hash = ?", keyHash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &apiKey, nil
+}
+
+// GetAPIKeyByID lấy API key theo ID
+func (m *SQLiteCatalogService) GetAPIKeyByID(id int) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	result := m.Db.First(&apiKey, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &apiKey, nil
+}
+
+// ListAPIKeysByWorkspace lấy tất cả API key của một workspace, bao gồm cả key đã thu hồi
+func (m *SQLiteCatalogService) ListAPIKeysByWorkspace(workspaceID int) ([]models.APIKey, error) {
+	var apiKeys []models.APIKey
+	result := m.Db.Order("id").Find(&apiKeys, "workspace_id = ?", workspaceID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey đánh dấu API key đã bị thu hồi
+func (m *SQLiteCatalogService) RevokeAPIKey(apiKey *models.APIKey) error {
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	return m.Db.Model(apiKey).Update("revoked_at", now).Error
+}
+
+// TouchAPIKey cập nhật thời điểm sử dụng gần nhất của API key
+func (m *SQLiteCatalogService) TouchAPIKey(apiKey *models.APIKey) error {
+	now := time.Now()
+	apiKey.LastUsedAt = &now
+	return m.Db.Model(apiKey).UpdateColumn("last_used_at", now).Error
+}
+
+// AuditLogFilter chứa các điều kiện lọc khi truy vấn audit log, giá trị rỗng nghĩa là không lọc
+type AuditLogFilter struct {
+	From        *time.Time
+	To          *time.Time
+	Username    string
+	WorkspaceID int
+	Action      string
+	Limit       int
+	Offset      int
+}
+
+// CreateAuditLog ghi thêm một bản ghi audit log
+func (m *SQLiteCatalogService) CreateAuditLog(entry *models.AuditLog) error {
+	return m.Db.Create(entry).Error
+}
+
+// QueryAuditLogs truy vấn audit log theo bộ lọc, mới nhất trước
+func (m *SQLiteCatalogService) QueryAuditLogs(filter AuditLogFilter) ([]models.AuditLog, error) {
+	query := m.Db.Model(&models.AuditLog{})
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.WorkspaceID != 0 {
+		query = query.Where("workspace_id = ?", filter.WorkspaceID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("id DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteAuditLogsBefore xóa các bản ghi audit log cũ hơn thời điểm before, trả về số bản ghi đã xóa
+func (m *SQLiteCatalogService) DeleteAuditLogsBefore(before time.Time) (int64, error) {
+	result := m.Db.Where("created_at < ?", before).Delete(&models.AuditLog{})
+	return result.RowsAffected, result.Error
+}
+
+// WorkspaceUsage chứa mức sử dụng tài nguyên hiện tại của một workspace
+type WorkspaceUsage struct {
+	Collections int64 `json:"collections"`
+	Indexes     int64 `json:"indexes"`
+	Documents   int64 `json:"documents"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// GetWorkspaceUsage tính mức sử dụng tài nguyên của workspace từ catalog
+func (m *SQLiteCatalogService) GetWorkspaceUsage(workspaceID int) (*WorkspaceUsage, error) {
+	var usage WorkspaceUsage
+	err := m.Db.Model(&models.Collection{}).
+		Select("COUNT(*) AS collections, COALESCE(SUM(document_count), 0) AS documents, COALESCE(SUM(byte_size), 0) AS bytes").
+		Where("workspace_id = ?", workspaceID).
+		Scan(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+
+	collectionIDs := m.Db.Model(&models.Collection{}).Select("id").Where("workspace_id = ?", workspaceID)
+	tableIDs := m.Db.Model(&models.Table{}).Select("id").Where("workspace_id = ?", workspaceID)
+	err = m.Db.Model(&models.Index{}).Where("collection_id IN (?) OR table_id IN (?)", collectionIDs, tableIDs).Count(&usage.Indexes).Error
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// IncrementCollectionUsage cộng dồn số document và dung lượng của collection
+func (m *SQLiteCatalogService) IncrementCollectionUsage(collectionID int, documents, bytes int64) error {
+	return m.Db.Model(&models.Collection{}).Where("id = ?", collectionID).UpdateColumns(map[string]interface{}{
+		"document_count": gorm.Expr("document_count + ?", documents),
+		"byte_size":      gorm.Expr("byte_size + ?", bytes),
+	}).Error
+}
+
+// SetCollectionUsage ghi đè số document và dung lượng của collection, dùng khi truncate hoặc đếm lại
+func (m *SQLiteCatalogService) SetCollectionUsage(collectionID int, documents, bytes int64) error {
+	return m.Db.Model(&models.Collection{}).Where("id = ?", collectionID).UpdateColumns(map[string]interface{}{
+		"document_count": documents,
+		"byte_size":      bytes,
+	}).Error
+}
+
+// NextCollectionChangeSeq tăng và trả về số thứ tự cho thay đổi tiếp theo của collection
+func (m *SQLiteCatalogService) NextCollectionChangeSeq(collectionID int) (int64, error) {
+	var seq int64
+	err := m.Db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Collection{}).Where("id = ?", collectionID).UpdateColumn("change_seq", gorm.Expr("change_seq + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Collection{}).Select("change_seq").Where("id = ?", collectionID).Scan(&seq).Error
+	})
+	return seq, err
+}
+
+// GetCollectionChangeSeq lấy số thứ tự của thay đổi được ghi lại gần nhất của collection
+func (m *SQLiteCatalogService) GetCollectionChangeSeq(collectionID int) (int64, error) {
+	var seq int64
+	err := m.Db.Model(&models.Collection{}).Select("change_seq").Where("id = ?", collectionID).Scan(&seq).Error
+	return seq, err
+}
+
+// GetCollectionChangeLog đọc cờ change log hiện tại của collection trong catalog
+func (m *SQLiteCatalogService) GetCollectionChangeLog(collectionID int) (bool, error) {
+	var changeLog bool
+	err := m.Db.Model(&models.Collection{}).Select("change_log").Where("id = ?", collectionID).Scan(&changeLog).Error
+	return changeLog, err
+}
+
+// RenameCollection đổi tên collection
+func (m *SQLiteCatalogService) RenameCollection(collection *models.Collection, name string) error {
+	if err := m.Db.Model(collection).Update("name", name).Error; err != nil {
+		return err
+	}
+	collection.Name = name
+	return nil
+}
+
+// SetCollectionSchema cập nhật JSON Schema và chế độ kiểm tra schema của collection
+func (m *SQLiteCatalogService) SetCollectionSchema(collection *models.Collection, schema json.RawMessage, mode string) error {
+	err := m.Db.Model(collection).Select("schema", "schema_mode").Updates(models.Collection{Schema: schema, SchemaMode: mode}).Error
+	if err != nil {
+		return err
+	}
+	collection.Schema = schema
+	collection.SchemaMode = mode
+	return nil
+}
+
+// GetWorkspaceQuota lấy quota của workspace, trả về quota rỗng (không giới hạn) nếu chưa được cấu hình
+func (m *SQLiteCatalogService) GetWorkspaceQuota(workspaceID int) (*models.WorkspaceQuota, error) {
+	// Dùng Find thay vì First vì đa số workspace không có quota, First ghi log "record not found" mỗi lần ghi
+	var quota models.WorkspaceQuota
+	result := m.Db.Where("workspace_id = ?", workspaceID).Limit(1).Find(&quota)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &models.WorkspaceQuota{WorkspaceID: workspaceID}, nil
+	}
+	return &quota, nil
+}
+
+// SaveWorkspaceQuota tạo mới hoặc cập nhật quota của workspace
+func (m *SQLiteCatalogService) SaveWorkspaceQuota(quota *models.WorkspaceQuota) error {
+	var existing models.WorkspaceQuota
+	result := m.Db.First(&existing, "workspace_id = ?", quota.WorkspaceID)
+	if result.Error == nil {
+		quota.ID = existing.ID
+		quota.CreatedAt = existing.CreatedAt
+	} else if result.Error != gorm.ErrRecordNotFound {
+		return result.Error
+	}
+	return m.Db.Save(quota).Error
+}
+
+// GetRateLimit lấy giới hạn request của một subject, trả về gorm.ErrRecordNotFound nếu subject không có giới hạn riêng
+// Được gọi với mỗi request nên dùng Find thay vì First để không ghi log "record not found"
+func (m *SQLiteCatalogService) GetRateLimit(subjectType string, subjectID int) (*models.RateLimit, error) {
+	var rateLimit models.RateLimit
+	result := m.Db.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).Limit(1).Find(&rateLimit)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rateLimit, nil
+}
+
+// SaveRateLimit tạo mới hoặc cập nhật giới hạn request của một subject
+func (m *SQLiteCatalogService) SaveRateLimit(rateLimit *models.RateLimit) error {
+	existing, err := m.GetRateLimit(rateLimit.SubjectType, rateLimit.SubjectID)
+	if err == nil {
+		rateLimit.ID = existing.ID
+		rateLimit.CreatedAt = existing.CreatedAt
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return m.Db.Save(rateLimit).Error
+}
+
+// ListRateLimits lấy tất cả giới hạn request đã cấu hình
+func (m *SQLiteCatalogService) ListRateLimits() ([]models.RateLimit, error) {
+	var rateLimits []models.RateLimit
+	if err := m.Db.Order("id").Find(&rateLimits).Error; err != nil {
+		return nil, err
+	}
+	return rateLimits, nil
+}
+
+// GetIndexByName lấy index theo tên trong một collection
+func (m *SQLiteCatalogService) GetIndexByName(collectionID int, name string) (*models.Index, error) {
+	var index models.Index
+	result := m.Db.First(&index, "collection_id = ? AND name = ?", collectionID, name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &index, nil
+}
+
+// GetTableIndexByName lấy index theo tên trong một table
+func (m *SQLiteCatalogService) GetTableIndexByName(tableID int, name string) (*models.Index, error) {
+	var index models.Index
+	result := m.Db.First(&index, "table_id = ? AND name = ?", tableID, name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &index, nil
+}
+
+// UpdateIndexStatus cập nhật trạng thái của index
+func (m *SQLiteCatalogService) UpdateIndexStatus(indexID int, status string) error {
+	return m.Db.Model(&models.Index{}).Where("id = ?", indexID).UpdateColumn("status", status).Error
+}
+
+// SetIndexMultikey đánh dấu index có document cho nhiều value
+func (m *SQLiteCatalogService) SetIndexMultikey(indexID int) error {
+	return m.Db.Model(&models.Index{}).Where("id = ?", indexID).UpdateColumn("multikey", true).Error
+}
+
+// ErrTableAlreadySynced được trả về khi table đích đã nhận dữ liệu từ một sync khác
+var ErrTableAlreadySynced = errors.New("table already has a sync")
+
+// CreateCollectionSync lưu sync mới và bật change log của collection nguồn trong cùng một transaction
+func (m *SQLiteCatalogService) CreateCollectionSync(sync *models.CollectionSync) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.CollectionSync{}).Where("table_id = ?", sync.TableID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTableAlreadySynced
+		}
+		if err := tx.Create(sync).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Collection{}).Where("id = ?", sync.CollectionID).UpdateColumn("change_log", true).Error
+	})
+}
+
+// GetCollectionSync lấy sync theo ID trong một workspace
+func (m *SQLiteCatalogService) GetCollectionSync(workspaceID, id int) (*models.CollectionSync, error) {
+	var sync models.CollectionSync
+	result := m.Db.First(&sync, "workspace_id = ? AND id = ?", workspaceID, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &sync, nil
+}
+
+// ListCollectionSyncsByWorkspace lấy các sync của workspace
+func (m *SQLiteCatalogService) ListCollectionSyncsByWorkspace(workspaceID int) ([]models.CollectionSync, error) {
+	var syncs []models.CollectionSync
+	if err := m.Db.Where("workspace_id = ?", workspaceID).Order("id").Find(&syncs).Error; err != nil {
+		return nil, err
+	}
+	return syncs, nil
+}
+
+// ListCollectionSyncs lấy tất cả các sync, nếu collectionID khác 0 thì chỉ lấy sync của collection đó
+func (m *SQLiteCatalogService) ListCollectionSyncs(collectionID int) ([]models.CollectionSync, error) {
+	var syncs []models.CollectionSync
+	query := m.Db.Order("id")
+	if collectionID != 0 {
+		query = query.Where("collection_id = ?", collectionID)
+	}
+	if err := query.Find(&syncs).Error; err != nil {
+		return nil, err
+	}
+	return syncs, nil
+}
+
+// UpdateCollectionSync lưu checkpoint và trạng thái của sync, không làm gì nếu sync đã bị xóa
+func (m *SQLiteCatalogService) UpdateCollectionSync(sync *models.CollectionSync) error {
+	return m.Db.Model(sync).
+		Select("loaded", "checkpoint", "applied_changes", "skipped_changes", "last_synced_at", "last_error").
+		Updates(sync).Error
+}
+
+// DeleteCollectionSync xóa sync, change log của collection nguồn bị tắt nếu không còn sync nào đọc từ nó
+func (m *SQLiteCatalogService) DeleteCollectionSync(sync *models.CollectionSync) error {
+	return m.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&models.CollectionSync{}, sync.ID).Error; err != nil {
+			return err
+		}
+		return refreshCollectionChangeLogs(tx)
+	})
+}
+
+// refreshCollectionChangeLogs tắt change log của các collection không còn sync nào
+func refreshCollectionChangeLogs(tx *gorm.DB) error {
+	synced := tx.Model(&models.CollectionSync{}).Select("collection_id")
+	return tx.Model(&models.Collection{}).Where("change_log = ? AND id NOT IN (?)", true, synced).UpdateColumn("change_log", false).Error
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dehuy69/mydp/config"
+	"github.com/dehuy69/mydp/main_server/models"
+	"gorm.io/gorm"
+)
+
+func newTestCatalog(t *testing.T) *SQLiteCatalogService {
+	t.Helper()
+	catalog, err := NewSQLiteCatalogService(&config.Config{DataFolderDefault: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to open catalog: %v", err)
+	}
+	return catalog
+}
+
+// newTestTable tạo table có một tệp dữ liệu, trả về table và ID của tệp
+func newTestTable(t *testing.T, catalog *SQLiteCatalogService) (*models.Table, int) {
+	t.Helper()
+	workspace := &models.Workspace{Name: "ws"}
+	if err := catalog.CreateWorkspace(workspace); err != nil {
+		t.Fatalf("failed to create workspace: %v", err)
+	}
+	table := &models.Table{Name: "t", WorkspaceID: workspace.ID}
+	if err := catalog.CreateTable(table); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	added := []models.TableFile{{TableID: table.ID, Path: "part-1.parquet", RowCount: 10, Content: models.TableFileContentData}}
+	if _, err := catalog.CommitTableSnapshot(table.ID, models.SnapshotOperationAppend, 0, 0, added, nil); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	return table, added[0].ID
+}
+
+func deleteFile(tableID, dataFileID int) models.TableFile {
+	return models.TableFile{TableID: tableID, Path: "delete.parquet", RowCount: 1, Content: models.TableFileContentPositionDeletes, DataFileID: dataFileID}
+}
+
+func TestCommitTableSnapshotDeleteConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		// run chạy commit xen giữa rồi commit cần kiểm tra với base là snapshot trước commit xen giữa
+		run func(catalog *SQLiteCatalogService, tableID, dataFileID, base int) error
+	}{
+		{
+			name: "delete after compaction removed the data file",
+			run: func(catalog *SQLiteCatalogService, tableID, dataFileID, base int) error {
+				if _, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationCompact, 0, base, nil, []int{dataFileID}); err != nil {
+					return err
+				}
+				_, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationDelete, 0, base, []models.TableFile{deleteFile(tableID, dataFileID)}, nil)
+				return err
+			},
+		},
+		{
+			name: "compaction after a delete of its input",
+			run: func(catalog *SQLiteCatalogService, tableID, dataFileID, base int) error {
+				if _, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationDelete, 0, base, []models.TableFile{deleteFile(tableID, dataFileID)}, nil); err != nil {
+					return err
+				}
+				_, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationCompact, 0, base, nil, []int{dataFileID})
+				return err
+			},
+		},
+		{
+			name: "two updates of the same file",
+			run: func(catalog *SQLiteCatalogService, tableID, dataFileID, base int) error {
+				if _, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationUpdate, 0, base, []models.TableFile{deleteFile(tableID, dataFileID)}, nil); err != nil {
+					return err
+				}
+				_, err := catalog.CommitTableSnapshot(tableID, models.SnapshotOperationUpdate, 0, base, []models.TableFile{deleteFile(tableID, dataFileID)}, nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := newTestCatalog(t)
+			table, dataFileID := newTestTable(t, catalog)
+			table, err := catalog.GetTableByID(table.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(catalog, table.ID, dataFileID, table.CurrentSnapshotID); !errors.Is(err, ErrSnapshotConflict) {
+				t.Fatalf("expected ErrSnapshotConflict, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCommitTableSnapshotSequentialDeletes(t *testing.T) {
+	catalog := newTestCatalog(t)
+	table, dataFileID := newTestTable(t, catalog)
+
+	for i := 0; i < 2; i++ {
+		table, err := catalog.GetTableByID(table.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = catalog.CommitTableSnapshot(table.ID, models.SnapshotOperationDelete, 0, table.CurrentSnapshotID, []models.TableFile{deleteFile(table.ID, dataFileID)}, nil)
+		if err != nil {
+			t.Fatalf("delete %d: %v", i, err)
+		}
+	}
+
+	table, err := catalog.GetTableByID(table.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := catalog.CommitTableSnapshot(table.ID, models.SnapshotOperationCompact, 0, table.CurrentSnapshotID, nil, []int{dataFileID})
+	if err != nil {
+		t.Fatalf("compaction: %v", err)
+	}
+	if snapshot.FileCount != 0 {
+		t.Fatalf("expected delete files to be removed with their data file, %d files left", snapshot.FileCount)
+	}
+}
+
+func TestSaveRateLimit(t *testing.T) {
+	catalog := newTestCatalog(t)
+	if _, err := catalog.GetRateLimit(models.RateLimitSubjectUser, 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+
+	for _, rate := range []float64{5, 10} {
+		if err := catalog.SaveRateLimit(&models.RateLimit{SubjectType: models.RateLimitSubjectUser, SubjectID: 1, RequestsPerSecond: rate, Burst: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rateLimit, err := catalog.GetRateLimit(models.RateLimitSubjectUser, 1)
+	if err != nil || rateLimit.RequestsPerSecond != 10 {
+		t.Fatalf("got %+v (%v), want 10 requests per second", rateLimit, err)
+	}
+	limits, err := catalog.ListRateLimits()
+	if err != nil || len(limits) != 1 {
+		t.Fatalf("got %d rate limits (%v), want 1", len(limits), err)
+	}
+}
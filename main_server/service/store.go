@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dehuy69/mydp/main_server/models"
+)
+
+// ErrKeyNotFound được trả về khi key không tồn tại
+var ErrKeyNotFound = errors.New("key not found")
+
+// DocumentStore lưu document của các collection dưới dạng key-value
+// Key có dạng <collection_id>||<key>, value là document dạng JSON
+type DocumentStore interface {
+	Set(key, value []byte) error
+	// Get trả về lỗi bọc ErrKeyNotFound nếu key không tồn tại
+	Get(key []byte) ([]byte, error)
+	Delete(key []byte) error
+	// DropPrefix xóa tất cả các key bắt đầu bằng prefix
+	DropPrefix(prefix []byte) error
+	// PrefixStats trả về số key và tổng kích thước value của các key bắt đầu bằng prefix
+	PrefixStats(prefix []byte) (int64, int64, error)
+	// ScanPrefix duyệt các key bắt đầu bằng prefix theo thứ tự tăng dần, dừng khi fn trả về false hoặc lỗi
+	// key và value chỉ hợp lệ trong lúc fn chạy
+	ScanPrefix(prefix []byte, fn func(key, value []byte) (bool, error)) error
+	// WriteBatch áp dụng các thao tác ghi trong một transaction: tất cả cùng được áp dụng hoặc không thao tác nào
+	WriteBatch(writes []DocumentWrite) error
+}
+
+// DocumentWrite là một thao tác trong WriteBatch: ghi Value vào Key, hoặc xóa Key nếu Delete
+type DocumentWrite struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// IndexStore lưu posting list và thống kê của các index
+// Mỗi value của index có một posting list là các key của document có value đó
+type IndexStore interface {
+	CreateIndex(index *models.Index) error
+	DeleteIndex(index *models.Index) error
+	// ClearIndex xóa toàn bộ posting list, thống kê được đặt lại trừ số lần index được query dùng
+	ClearIndex(index *models.Index) error
+
+	AddEntry(index *models.Index, value []byte, key string) error
+	RemoveEntry(index *models.Index, value []byte, key string) error
+	CountEntries(index *models.Index, value []byte) (int64, error)
+	HasEntry(index *models.Index, value []byte, key string) (bool, error)
+	// ScanValue duyệt các key của value theo thứ tự tăng dần, dừng khi fn trả về false hoặc lỗi
+	ScanValue(index *models.Index, value []byte, fn func(key string) (bool, error)) error
+	// ScanEntries duyệt các cặp (value, key) theo thứ tự value rồi key, bắt đầu từ value >= start (nil là từ đầu)
+	// và chỉ gồm các value bắt đầu bằng prefix (nil là không giới hạn)
+	ScanEntries(index *models.Index, start, prefix []byte, fn func(value []byte, key string) (bool, error)) error
+	// CheckCounts trả về số value có số key đếm sẵn khác số entry, repair = true thì sửa lại
+	CheckCounts(index *models.Index, repair bool) (int64, error)
+
+	GetIndexStats(index *models.Index) (*models.IndexStats, error)
+	RecordIndexBuild(index *models.Index, duration time.Duration) error
+	RecordIndexUsage(index *models.Index) error
+}
+
+var (
+	_ DocumentStore = (*BadgerService)(nil)
+	_ DocumentStore = (*MemoryDocumentStore)(nil)
+	_ IndexStore    = (*BboltService)(nil)
+	_ IndexStore    = (*MemoryIndexStore)(nil)
+)
+
+// StorageBackend là cặp DocumentStore và IndexStore mà một collection dùng
+type StorageBackend struct {
+	Documents DocumentStore
+	Indexes   IndexStore
+}
+
+// Storage chọn backend lưu trữ theo trường Backend của collection
+type Storage struct {
+	backends map[string]*StorageBackend
+	Tables   *ParquetService // Nơi lưu dữ liệu của các table OLAP
+}
+
+// NewStorage tạo Storage với backend mặc định (Badger và bbolt) và backend trong bộ nhớ
+func NewStorage(badgerService *BadgerService, bboltService *BboltService, parquetService *ParquetService) *Storage {
+	return &Storage{
+		backends: map[string]*StorageBackend{
+			models.StorageBackendBadger: {Documents: badgerService, Indexes: bboltService},
+			models.StorageBackendMemory: {Documents: NewMemoryDocumentStore(), Indexes: NewMemoryIndexStore()},
+		},
+		Tables: parquetService,
+	}
+}
+
+// Backend trả về backend theo tên, tên rỗng là backend mặc định
+func (s *Storage) Backend(name string) (*StorageBackend, bool) {
+	if name == "" {
+		name = models.StorageBackendBadger
+	}
+	backend, ok := s.backends[name]
+	return backend, ok
+}
+
+// SetBackend thay backend theo tên, ví dụ để test dùng store có lỗi giả lập
+func (s *Storage) SetBackend(name string, backend *StorageBackend) {
+	s.backends[name] = backend
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// APIKeyPrefixLength là số ký tự đầu của key được lưu lại để nhận diện
+const APIKeyPrefixLength = 12
+
+// GenerateAPIKey tạo một API key ngẫu nhiên dạng mydp_<64 ký tự hex>
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "mydp_" + hex.EncodeToString(b), nil
+}
+
+// HashAPIKey trả về SHA-256 (hex) của API key
+// Key có entropy cao nên không cần bcrypt, đồng thời cho phép tra cứu trực tiếp theo hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -33,13 +34,13 @@ func CreateAccessToken(username, jwtSecret string) (string, error) {
 func DecodeAccessToken(encodedJWT string, SECRET_KEY []byte) (map[string]interface{}, error) {
 	token, err := jwt.Parse(encodedJWT, func(token *jwt.Token) (interface{}, error) {
 		return SECRET_KEY, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		return nil, err
 	}
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		return claims, nil
 	} else {
-		return nil, err
+		return nil, fmt.Errorf("invalid token")
 	}
 }